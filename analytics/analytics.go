@@ -0,0 +1,274 @@
+// Package analytics counts the visits of public sites without cookies. Views are
+// counted in memory by site and day, with their page path, referrer host, country and
+// device class, and added to daily rollups every FlushInterval. IP addresses are never
+// stored: unique visitors are told apart by a hash of their IP address and user agent,
+// salted with a random value that only lives in memory for the day.
+package analytics
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/geoip"
+	"github.com/hyperstitieux/template/router"
+)
+
+// maxValueLength bounds the paths and hosts stored, longer ones are cut
+const maxValueLength = 255
+
+type Config struct {
+	GeoIPFile     string        // Offline country database, countries are unknown without it
+	FlushInterval time.Duration // How often views are written
+}
+
+// Analytics records the page views of public sites
+type Analytics struct {
+	config    Config
+	tx        repositories.Transactor
+	pageViews repositories.PageViewsRepository
+	geo       *geoip.DB // Nil without a database
+
+	mu       sync.Mutex
+	pending  map[siteDay]*siteViews
+	day      string              // Day the salt and visitors are for
+	salt     []byte              // Random, renewed every day and never stored
+	visitors map[uint64]struct{} // Hashes of the visitors of the day
+}
+
+type siteDay struct {
+	siteID int
+	day    string
+}
+
+// siteViews are the page views of a site on a day not written yet
+type siteViews struct {
+	views, visitors int64
+	counts          map[[2]string]int64 // By dimension and value
+}
+
+// New loads the GeoIP database of the configuration if the file is present, otherwise
+// countries are left unknown
+func New(config Config, tx repositories.Transactor, pageViews repositories.PageViewsRepository) (*Analytics, error) {
+	a := &Analytics{
+		config:    config,
+		tx:        tx,
+		pageViews: pageViews,
+		pending:   make(map[siteDay]*siteViews),
+	}
+
+	if config.GeoIPFile != "" {
+		geo, err := geoip.Open(config.GeoIPFile)
+		if errors.Is(err, fs.ErrNotExist) {
+			slog.Info("no geoip database, countries of visitors are unknown", "path", config.GeoIPFile)
+		} else if err != nil {
+			return nil, err
+		} else {
+			a.geo = geo
+		}
+	}
+
+	return a, nil
+}
+
+// Record counts a view of the page at path of a site. Bots are left out.
+func (a *Analytics) Record(r *http.Request, siteID int, path string) {
+	userAgent := r.UserAgent()
+	if isBot(userAgent) {
+		return
+	}
+
+	ip := router.ClientIP(r)
+	country := ""
+	if a.geo != nil {
+		country = a.geo.Country(ip)
+	}
+	counts := [][2]string{
+		{models.PageViewPath, truncate(path)},
+		{models.PageViewReferrer, truncate(referrerHost(r))},
+		{models.PageViewCountry, country},
+		{models.PageViewDevice, deviceClass(userAgent)},
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Visitors of a new day get new hashes, which can't be linked to those of the day before
+	day := time.Now().UTC().Format(time.DateOnly)
+	if day != a.day {
+		a.day = day
+		a.salt = make([]byte, 32)
+		rand.Read(a.salt)
+		a.visitors = make(map[uint64]struct{})
+	}
+
+	key := siteDay{siteID: siteID, day: day}
+	pending, ok := a.pending[key]
+	if !ok {
+		pending = &siteViews{counts: make(map[[2]string]int64)}
+		a.pending[key] = pending
+	}
+	pending.views++
+	for _, count := range counts {
+		pending.counts[count]++
+	}
+
+	visitor := a.visitorHash(siteID, ip, userAgent)
+	if _, seen := a.visitors[visitor]; !seen {
+		a.visitors[visitor] = struct{}{}
+		pending.visitors++
+	}
+}
+
+// visitorHash identifies a visitor of a site for the day. a.mu must be held.
+func (a *Analytics) visitorHash(siteID int, ip, userAgent string) uint64 {
+	hash := sha256.New()
+	hash.Write(a.salt)
+	hash.Write([]byte(strconv.Itoa(siteID) + "\x00" + ip + "\x00" + userAgent))
+	return binary.BigEndian.Uint64(hash.Sum(nil))
+}
+
+// Run writes the recorded views every FlushInterval until ctx is done, then one last
+// time
+func (a *Analytics) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := a.Flush(context.Background()); err != nil {
+				slog.Error("failed to flush page views", "error", err)
+			}
+			return
+		case <-ticker.C:
+			if err := a.Flush(ctx); err != nil {
+				slog.Error("failed to flush page views", "error", err)
+			}
+		}
+	}
+}
+
+// Flush adds the views recorded since the last flush to the daily rollups. Views that
+// fail to be written are kept for the next flush.
+func (a *Analytics) Flush(ctx context.Context) error {
+	a.mu.Lock()
+	pending := a.pending
+	a.pending = make(map[siteDay]*siteViews)
+	a.mu.Unlock()
+
+	for key, views := range pending {
+		err := a.tx.Transaction(ctx, func(ctx context.Context) error {
+			err := a.pageViews.AddViews(ctx, &models.PageViews{
+				SiteID:   key.siteID,
+				Day:      key.day,
+				Views:    views.views,
+				Visitors: views.visitors,
+			})
+			if err != nil {
+				return err
+			}
+
+			counts := make([]*models.PageViewCount, 0, len(views.counts))
+			for count, n := range views.counts {
+				counts = append(counts, &models.PageViewCount{Dimension: count[0], Value: count[1], Views: n})
+			}
+			return a.pageViews.AddCounts(ctx, key.siteID, key.day, counts)
+		})
+		if err != nil {
+			a.mu.Lock()
+			for key, views := range pending {
+				a.restore(key, views)
+			}
+			a.mu.Unlock()
+			return err
+		}
+		delete(pending, key)
+	}
+	return nil
+}
+
+// restore adds back views that failed to be written. a.mu must be held.
+func (a *Analytics) restore(key siteDay, failed *siteViews) {
+	current, ok := a.pending[key]
+	if !ok {
+		a.pending[key] = failed
+		return
+	}
+	current.views += failed.views
+	current.visitors += failed.visitors
+	for count, n := range failed.counts {
+		current.counts[count] += n
+	}
+}
+
+// referrerHost returns the host of the page linking to the request, without "www.".
+// Direct visits and links from the site itself have none.
+func referrerHost(r *http.Request) string {
+	referrer, err := url.Parse(r.Referer())
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(referrer.Hostname())
+	if host == "" || strings.EqualFold(host, requestHost(r)) {
+		return ""
+	}
+	return strings.TrimPrefix(host, "www.")
+}
+
+// requestHost returns the host of the request without its port
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if i := strings.LastIndex(host, ":"); i != -1 && !strings.HasSuffix(host, "]") {
+		host = host[:i]
+	}
+	return host
+}
+
+// deviceClass guesses the class of the device of a user agent
+func deviceClass(userAgent string) string {
+	switch {
+	case strings.Contains(userAgent, "iPad") || strings.Contains(userAgent, "Tablet") ||
+		strings.Contains(userAgent, "Android") && !strings.Contains(userAgent, "Mobile"):
+		return models.DeviceTablet
+	case strings.Contains(userAgent, "Mobi") || strings.Contains(userAgent, "iPhone"):
+		return models.DeviceMobile
+	default:
+		return models.DeviceDesktop
+	}
+}
+
+// isBot tells whether a user agent looks like a crawler or a script rather than a
+// reader. Requests without one are left out too.
+func isBot(userAgent string) bool {
+	if userAgent == "" {
+		return true
+	}
+	lower := strings.ToLower(userAgent)
+	for _, token := range []string{"bot", "crawl", "spider", "slurp", "headless", "curl", "wget", "python", "go-http-client"} {
+		if strings.Contains(lower, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// truncate cuts values longer than maxValueLength
+func truncate(value string) string {
+	if len(value) > maxValueLength {
+		return strings.ToValidUTF8(value[:maxValueLength], "")
+	}
+	return value
+}
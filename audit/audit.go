@@ -0,0 +1,97 @@
+// Package audit records who changed accounts and sites. Each event keeps the actor,
+// the action and its target, the address and request ID of the request, and the
+// values of the changed fields before and after. The log is only ever appended to.
+package audit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/router"
+)
+
+type Log struct {
+	events repositories.AuditEventsRepository
+}
+
+func New(events repositories.AuditEventsRepository) *Log {
+	return &Log{events: events}
+}
+
+// Record appends the action of actor on a target to the log. The action is already
+// done, so failing to record it is logged rather than returned.
+func (l *Log) Record(r *http.Request, actor *models.User, action, targetType string, targetID any, changes map[string]models.AuditChange) {
+	event := &models.AuditEvent{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   fmt.Sprint(targetID),
+		IP:         router.ClientIP(r),
+		RequestID:  r.Header.Get("X-Request-ID"),
+		Changes:    changes,
+	}
+	if actor != nil {
+		event.ActorID = &actor.ID
+		event.ActorEmail = actor.Email
+	}
+
+	// Written even if the client has gone away meanwhile
+	if err := l.events.Create(context.WithoutCancel(r.Context()), event); err != nil {
+		slog.Error("failed to record audit event", "error", err, "action", action, "target_type", targetType, "target_id", event.TargetID, "request_id", event.RequestID)
+	}
+}
+
+// Diff returns the fields whose value differs between before and after. Fields only
+// in one of them were added or removed.
+func Diff(before, after map[string]any) map[string]models.AuditChange {
+	changes := make(map[string]models.AuditChange)
+	for field, value := range before {
+		if other, ok := after[field]; !ok || !reflect.DeepEqual(value, other) {
+			changes[field] = models.AuditChange{Before: value, After: after[field]}
+		}
+	}
+	for field, value := range after {
+		if _, ok := before[field]; !ok {
+			changes[field] = models.AuditChange{After: value}
+		}
+	}
+	return changes
+}
+
+// Site returns the audited fields of a site
+func Site(site *models.Site) map[string]any {
+	fields := map[string]any{
+		"slug":          site.Slug,
+		"github_repo":   site.GithubRepo,
+		"github_branch": site.GithubBranch,
+		"subdirectory":  site.Subdirectory,
+		"user_id":       site.UserID,
+	}
+	if site.OrganizationID != nil {
+		fields["organization_id"] = *site.OrganizationID
+	}
+	return fields
+}
+
+// Limits returns the audited fields of the plan and limits of a user, leaving out the
+// limits taken from the plan
+func Limits(limits *models.UserLimits) map[string]any {
+	fields := map[string]any{"plan": limits.Plan}
+	if limits.Sites != nil {
+		fields["sites"] = *limits.Sites
+	}
+	if limits.StorageBytes != nil {
+		fields["storage_bytes"] = *limits.StorageBytes
+	}
+	if limits.BandwidthBytes != nil {
+		fields["bandwidth_bytes"] = *limits.BandwidthBytes
+	}
+	if limits.SyncsPerDay != nil {
+		fields["syncs_per_day"] = *limits.SyncsPerDay
+	}
+	return fields
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/router"
+)
+
+// APITokenPrefix starts every API token, so leaked tokens are easy to search for
+const APITokenPrefix = "ipub_"
+
+// apiTokenTouchInterval is how stale the last-used time of a token gets before a
+// request updates it
+const apiTokenTouchInterval = 5 * time.Minute
+
+// APITokenContextKey is the key used to store the API token in the request context
+const APITokenContextKey contextKey = "api_token"
+
+var errInvalidAPIToken = router.NewHTTPError(http.StatusUnauthorized, "missing, expired or revoked API token")
+
+var errSuspendedUser = router.NewHTTPError(http.StatusForbidden, "the account of this API token is suspended")
+
+// APITokenMiddleware authenticates API requests with a personal access token sent as
+// a bearer token. The token replaces any session cookie: API requests act as the
+// token's user only, which is why the CSRF middleware can leave them out.
+func APITokenMiddleware(tokens repositories.APITokensRepository, users repositories.UsersRepository) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			secret, ok := BearerToken(r)
+			if !ok {
+				rejectAPIRequest(w, r)
+				return
+			}
+
+			token, err := tokens.GetBySecret(r.Context(), secret)
+			if errors.Is(err, repositories.ErrNotFound) {
+				rejectAPIRequest(w, r)
+				return
+			}
+			if err != nil {
+				slog.Error("failed to get api token", "error", err, "path", r.URL.Path)
+				router.Handle(func(w http.ResponseWriter, r *http.Request) error {
+					return router.ErrInternalServer
+				})(w, r)
+				return
+			}
+
+			user, err := users.GetUserByID(r.Context(), token.UserID)
+			if err != nil {
+				slog.Error("failed to get api token user", "error", err, "token_id", token.ID)
+				rejectAPIRequest(w, r)
+				return
+			}
+			if user.SuspendedAt != nil {
+				router.Handle(func(w http.ResponseWriter, r *http.Request) error {
+					return errSuspendedUser
+				})(w, r)
+				return
+			}
+
+			if err := tokens.Touch(r.Context(), token.ID, time.Now().Add(-apiTokenTouchInterval)); err != nil {
+				slog.Error("failed to touch api token", "error", err, "token_id", token.ID)
+			}
+
+			r = SetCurrentUser(r, user)
+			r = r.WithContext(context.WithValue(r.Context(), APITokenContextKey, token))
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// GetAPIToken retrieves the API token the request was authenticated with
+func GetAPIToken(r *http.Request) *models.APIToken {
+	token, ok := r.Context().Value(APITokenContextKey).(*models.APIToken)
+	if !ok {
+		return nil
+	}
+	return token
+}
+
+// BearerToken returns the API token sent in the Authorization header
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || !strings.HasPrefix(token, APITokenPrefix) {
+		return "", false
+	}
+	return token, true
+}
+
+// rejectAPIRequest answers a request without a valid token
+func rejectAPIRequest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+	router.Handle(func(w http.ResponseWriter, r *http.Request) error {
+		return errInvalidAPIToken
+	})(w, r)
+}
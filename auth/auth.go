@@ -3,6 +3,7 @@ package auth
 import (
 	"context"
 	"net/http"
+	"strings"
 
 	"github.com/hyperstitieux/template/database/models"
 )
@@ -13,6 +14,9 @@ type contextKey string
 const (
 	// UserContextKey is the key used to store the user in the request context
 	UserContextKey contextKey = "user"
+	// ImpersonatorContextKey is the key used to store the admin viewing the dashboard
+	// as the current user
+	ImpersonatorContextKey contextKey = "impersonator"
 )
 
 // GetCurrentUser retrieves the authenticated user from the request context
@@ -43,3 +47,33 @@ func RequireAuth(r *http.Request) (*models.User, bool) {
 	}
 	return user, true
 }
+
+// GetImpersonator retrieves the admin viewing the dashboard as the current user, nil
+// when the current user is signed in as themselves
+func GetImpersonator(r *http.Request) *models.User {
+	user, ok := r.Context().Value(ImpersonatorContextKey).(*models.User)
+	if !ok {
+		return nil
+	}
+	return user
+}
+
+// IsAdmin checks if the user is an instance administrator, granted the role in the
+// database or listed by email in the configuration
+func IsAdmin(user *models.User, adminEmails []string) bool {
+	return user != nil && (user.IsAdmin || IsListedAdmin(user, adminEmails))
+}
+
+// IsListedAdmin checks if the user is an instance administrator listed by email in the
+// configuration, which can't be revoked from the admin console
+func IsListedAdmin(user *models.User, adminEmails []string) bool {
+	if user == nil || !user.VerifiedEmail {
+		return false
+	}
+	for _, email := range adminEmails {
+		if strings.EqualFold(email, user.Email) {
+			return true
+		}
+	}
+	return false
+}
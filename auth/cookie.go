@@ -38,11 +38,7 @@ func SetSecureCookie(w http.ResponseWriter, r *http.Request, config CookieConfig
 
 	// In development (no TLS), we may want to disable Secure flag
 	// but keep it enabled in production
-	// Check if running on localhost (with or without port)
-	host := r.Host
-	if r.TLS == nil && (host == "localhost" || host == "127.0.0.1" ||
-		len(host) > 10 && host[:10] == "localhost:" ||
-		len(host) > 10 && host[:10] == "127.0.0.1:") {
+	if isLocalhost(r) {
 		secure = false
 	}
 
@@ -65,6 +61,15 @@ func SetSecureCookie(w http.ResponseWriter, r *http.Request, config CookieConfig
 	http.SetCookie(w, cookie)
 }
 
+// isLocalhost tells whether the request is plain HTTP to localhost (with or without
+// port), as in development
+func isLocalhost(r *http.Request) bool {
+	host := r.Host
+	return r.TLS == nil && (host == "localhost" || host == "127.0.0.1" ||
+		len(host) > 10 && host[:10] == "localhost:" ||
+		len(host) > 10 && host[:10] == "127.0.0.1:")
+}
+
 // SetSessionCookie creates and sets a session cookie
 func SetSessionCookie(w http.ResponseWriter, r *http.Request, token string, duration time.Duration) {
 	config := DefaultCookieConfig(SessionCookieName, token, duration)
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hyperstitieux/template/router"
+)
+
+const (
+	// CSRFFieldName is the form field carrying the CSRF token
+	CSRFFieldName = "csrf_token"
+	// CSRFHeaderName is the header carrying the CSRF token of script requests
+	CSRFHeaderName = "X-CSRF-Token"
+	// csrfCookieDuration is how long a browser keeps its CSRF token
+	csrfCookieDuration = 365 * 24 * time.Hour
+)
+
+// CSRFTokenContextKey is the key used to store the CSRF token in the request context
+const CSRFTokenContextKey contextKey = "csrf_token"
+
+// CSRFMiddleware protects unsafe requests with double-submit tokens: every browser
+// gets a random token in a cookie, and forms and scripts send it back in a field or
+// a header. Another site can make the browser send the cookie, but can't read it to
+// fill in the form. Requests without a matching token are answered by onFailure.
+//
+// Paths under the exempt prefixes aren't checked. They must not trust cookies, like
+// the API, which only accepts bearer tokens.
+func CSRFMiddleware(onFailure router.HandlerFunc, exemptPrefixes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, prefix := range exemptPrefixes {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			token := ""
+			if cookie, err := r.Cookie(csrfCookieName(r)); err == nil && len(cookie.Value) == 43 {
+				token = cookie.Value
+			}
+
+			if !isSafeMethod(r.Method) {
+				sent := r.Header.Get(CSRFHeaderName)
+				if sent == "" {
+					sent = r.PostFormValue(CSRFFieldName)
+				}
+				if token == "" || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+					slog.Warn("csrf token mismatch",
+						"path", r.URL.Path,
+						"method", r.Method,
+						"has_cookie", token != "",
+					)
+					router.Handle(onFailure)(w, r)
+					return
+				}
+			}
+
+			// First visit, hand out a token for the forms of the page
+			if token == "" {
+				token = generateCSRFToken()
+				SetSecureCookie(w, r, DefaultCookieConfig(csrfCookieName(r), token, csrfCookieDuration))
+			}
+
+			ctx := context.WithValue(r.Context(), CSRFTokenContextKey, token)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// CSRFToken returns the CSRF token forms of the request must send back
+func CSRFToken(r *http.Request) string {
+	token, _ := r.Context().Value(CSRFTokenContextKey).(string)
+	return token
+}
+
+// csrfCookieName names the CSRF cookie. Outside local development the __Host- prefix
+// keeps the user sites on subdomains from planting a cookie of their own.
+func csrfCookieName(r *http.Request) string {
+	if isLocalhost(r) {
+		return "csrf_token"
+	}
+	return "__Host-csrf_token"
+}
+
+// isSafeMethod tells whether a method only reads, as CSRF checks skip those
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// generateCSRFToken returns 32 random bytes, base64url encoded in 43 characters
+func generateCSRFToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
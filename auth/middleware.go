@@ -1,19 +1,41 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"log/slog"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/hyperstitieux/template/database/models"
 	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/router"
 )
 
 const (
 	// SessionCookieName is the name of the session cookie
 	SessionCookieName = "session"
+	// SessionIdleTimeout is how long a session lasts without being used
+	SessionIdleTimeout = 30 * 24 * time.Hour
+	// SessionMaxLifetime is how long a session lasts at most, however much it is used
+	SessionMaxLifetime = 90 * 24 * time.Hour
+	// sessionTouchInterval is how stale the last-seen time of a session gets before
+	// a request updates it
+	sessionTouchInterval = 5 * time.Minute
+	// maxUserAgentLength bounds the user agent stored with sessions
+	maxUserAgentLength = 256
+	// StopImpersonatingPath is the only request an admin viewing the dashboard as
+	// another user can send besides reading pages
+	StopImpersonatingPath = "/admin/impersonate/stop"
+	// SignOutPath signs out, whether or not the admin is viewing as another user
+	SignOutPath = "/auth/sign-out"
 )
 
-// AuthMiddleware creates a middleware that authenticates requests using session cookies
-func AuthMiddleware(users repositories.UsersRepository) func(http.Handler) http.Handler {
+// AuthMiddleware creates a middleware that authenticates requests using session cookies.
+// Admins, from the database or listed by email in adminEmails, may view the dashboard
+// as another user: requests then act as that user and can't change anything.
+func AuthMiddleware(users repositories.UsersRepository, adminEmails []string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Try to get session cookie
@@ -34,23 +56,24 @@ func AuthMiddleware(users repositories.UsersRepository) func(http.Handler) http.
 			)
 
 			// Validate session and get user
-			user, err := users.GetUserBySessionToken(cookie.Value)
-			if err != nil {
-				slog.Error("failed to get user by session token",
-					"error", err,
+			user, err := users.GetUserBySessionToken(r.Context(), cookie.Value)
+
+			// Session not found or expired
+			if errors.Is(err, repositories.ErrNotFound) {
+				slog.Debug("session not found or expired",
 					"path", r.URL.Path,
 				)
-				// Invalid session - continue without authentication
+				// Continue without authentication
 				next.ServeHTTP(w, r)
 				return
 			}
 
-			// Session not found or expired
-			if user == nil {
-				slog.Debug("session not found or expired",
+			if err != nil {
+				slog.Error("failed to get user by session token",
+					"error", err,
 					"path", r.URL.Path,
 				)
-				// Continue without authentication
+				// Invalid session - continue without authentication
 				next.ServeHTTP(w, r)
 				return
 			}
@@ -61,6 +84,34 @@ func AuthMiddleware(users repositories.UsersRepository) func(http.Handler) http.
 				"user_email", user.Email,
 			)
 
+			// Keep the session list on the settings page current, and slide the
+			// expiration of the session and its cookie
+			userAgent, ipAddress := RequestDetails(r)
+			now := time.Now()
+			touched, err := users.TouchSession(r.Context(), cookie.Value, userAgent, ipAddress, now.Add(SessionIdleTimeout), now.Add(-sessionTouchInterval))
+			if err != nil {
+				slog.Error("failed to touch session",
+					"error", err,
+					"user_id", user.ID,
+				)
+			}
+			if touched {
+				SetSessionCookie(w, r, cookie.Value, SessionIdleTimeout)
+			}
+
+			// Admins keep their role whether it comes from the database or the configuration
+			user.IsAdmin = IsAdmin(user, adminEmails)
+			if user.IsAdmin {
+				if impersonated := impersonatedUser(r, users, cookie.Value); impersonated != nil {
+					if !allowedWhileImpersonating(r) {
+						http.Error(w, "Read-only while viewing as "+impersonated.Email, http.StatusForbidden)
+						return
+					}
+					r = r.WithContext(context.WithValue(r.Context(), ImpersonatorContextKey, user))
+					user = impersonated
+				}
+			}
+
 			// Attach user to request context
 			r = SetCurrentUser(r, user)
 
@@ -69,6 +120,39 @@ func AuthMiddleware(users repositories.UsersRepository) func(http.Handler) http.
 	}
 }
 
+// allowedWhileImpersonating tells whether an admin viewing the dashboard as another
+// user may send the request. Sign in callbacks are GET requests too, but would link
+// accounts to or sign in as the user viewed, so only signing out is left of /auth/.
+func allowedWhileImpersonating(r *http.Request) bool {
+	if r.URL.Path == StopImpersonatingPath || r.URL.Path == SignOutPath {
+		return true
+	}
+	if strings.HasPrefix(r.URL.Path, "/auth/") {
+		return false
+	}
+	return r.Method == http.MethodGet || r.Method == http.MethodHead
+}
+
+// impersonatedUser returns the user the session views the dashboard as, if any
+func impersonatedUser(r *http.Request, users repositories.UsersRepository, token string) *models.User {
+	session, err := users.GetSessionByToken(r.Context(), token)
+	if err != nil {
+		slog.Error("failed to get session", "error", err, "path", r.URL.Path)
+		return nil
+	}
+	if session.ImpersonatedUserID == nil {
+		return nil
+	}
+
+	user, err := users.GetUserByID(r.Context(), *session.ImpersonatedUserID)
+	if err != nil {
+		// The user was deleted meanwhile, the admin is back to their own account
+		slog.Error("failed to get impersonated user", "error", err, "user_id", *session.ImpersonatedUserID)
+		return nil
+	}
+	return user
+}
+
 // RequireAuthMiddleware creates a middleware that requires authentication
 // If the user is not authenticated, it redirects to the login page
 func RequireAuthMiddleware(redirectURL string) func(http.Handler) http.Handler {
@@ -95,3 +179,13 @@ func RequireAuthHandler(redirectURL string, handler http.HandlerFunc) http.Handl
 		handler(w, r)
 	}
 }
+
+// RequestDetails returns the browser and address a request comes from, as stored
+// with sessions
+func RequestDetails(r *http.Request) (userAgent, ipAddress string) {
+	userAgent = r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	return userAgent, router.ClientIP(r)
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hyperstitieux/template/database/dbtest"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+)
+
+func TestImpersonationIsReadOnly(t *testing.T) {
+	ctx := context.Background()
+	users := repositories.NewUsersRepository(dbtest.SQLite(t))
+
+	admin := &models.User{Email: "admin@example.com", Name: "Admin", VerifiedEmail: true}
+	alice := &models.User{Email: "alice@example.com", Name: "Alice", VerifiedEmail: true}
+	for _, user := range []*models.User{admin, alice} {
+		if err := users.CreateUser(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	session := &models.Session{UserID: admin.ID, ExpiresAt: now.Add(time.Hour), MaxExpiresAt: now.Add(time.Hour)}
+	if err := users.CreateSession(ctx, session, "admin-session"); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.SetImpersonation(ctx, "admin-session", &alice.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	var current *models.User
+	handler := AuthMiddleware(users, []string{admin.Email})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current = GetCurrentUser(r)
+	}))
+
+	tests := []struct {
+		method  string
+		path    string
+		allowed bool
+	}{
+		{"GET", "/sites", true},
+		{"HEAD", "/sites", true},
+		{"POST", "/sites", false},
+		{"POST", StopImpersonatingPath, true},
+		{"GET", SignOutPath, true},
+		{"GET", "/auth/github", false},
+		{"GET", "/auth/github/callback", false},
+		{"GET", "/auth/google/callback", false},
+		{"GET", "/auth/oidc/corp/callback", false},
+		{"GET", "/auth/email/verify", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			current = nil
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.AddCookie(&http.Cookie{Name: SessionCookieName, Value: "admin-session"})
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if !tt.allowed {
+				if w.Code != http.StatusForbidden || current != nil {
+					t.Fatalf("status = %d, want %d without reaching the handler", w.Code, http.StatusForbidden)
+				}
+				return
+			}
+			if current == nil || current.ID != alice.ID {
+				t.Fatalf("current user = %+v, want alice", current)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperstitieux/template/database/models"
+)
+
+// client calls the JSON API of a server with a personal access token
+type client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+func newClient(baseURL, token string) *client {
+	return &client{
+		baseURL: baseURL,
+		token:   token,
+		http:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// apiError is an error response of the API
+type apiError struct {
+	Status  int               `json:"-"`
+	Message string            `json:"error"`
+	Details map[string]string `json:"-"`
+}
+
+func (e *apiError) Error() string {
+	if len(e.Details) == 0 {
+		return e.Message
+	}
+	fields := make([]string, 0, len(e.Details))
+	for field := range e.Details {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for i, field := range fields {
+		fields[i] = field + ": " + e.Details[field]
+	}
+	return e.Message + " (" + strings.Join(fields, "; ") + ")"
+}
+
+// do sends a request to the API and decodes the JSON response into out, unless out
+// is nil. Error responses are returned as *apiError.
+func (c *client) do(ctx context.Context, method, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+"/api/v1"+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return decodeAPIError(resp)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode the response of %s %s: %w", method, path, err)
+	}
+	return nil
+}
+
+// decodeAPIError reads the error of a failed response. Validation errors list the
+// first message of each field.
+func decodeAPIError(resp *http.Response) error {
+	var body struct {
+		Message string              `json:"error"`
+		Details map[string][]string `json:"details"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Message == "" {
+		body.Message = strings.ToLower(http.StatusText(resp.StatusCode))
+	}
+
+	apiErr := &apiError{Status: resp.StatusCode, Message: body.Message}
+	for field, messages := range body.Details {
+		if len(messages) > 0 {
+			if apiErr.Details == nil {
+				apiErr.Details = make(map[string]string)
+			}
+			apiErr.Details[field] = messages[0]
+		}
+	}
+	return apiErr
+}
+
+// listSites returns the sites of the token's user
+func (c *client) listSites(ctx context.Context) ([]*models.Site, error) {
+	var resp struct {
+		Sites []*models.Site `json:"sites"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/sites", nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Sites, nil
+}
+
+// findSite returns a site by ID or by slug
+func (c *client) findSite(ctx context.Context, name string) (*models.Site, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		var site models.Site
+		err := c.do(ctx, http.MethodGet, "/sites/"+strconv.Itoa(id), nil, &site)
+		var apiErr *apiError
+		if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+			return nil, fmt.Errorf("no site with ID %d", id)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &site, nil
+	}
+
+	sites, err := c.listSites(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, site := range sites {
+		if site.Slug == name {
+			return site, nil
+		}
+	}
+	return nil, fmt.Errorf("no site named %s", name)
+}
+
+// deployment returns a deployment of a site
+func (c *client) deployment(ctx context.Context, siteID, id int) (*models.Deployment, error) {
+	var deployment models.Deployment
+	path := "/sites/" + strconv.Itoa(siteID) + "/deployments/" + strconv.Itoa(id)
+	if err := c.do(ctx, http.MethodGet, path, nil, &deployment); err != nil {
+		return nil, err
+	}
+	return &deployment, nil
+}
+
+// logs returns the most recent log entries of a site, newest first
+func (c *client) logs(ctx context.Context, siteID int, level string, limit int) ([]*models.SiteLog, error) {
+	query := url.Values{}
+	if level != "" {
+		query.Set("level", level)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	var resp struct {
+		Logs []*models.SiteLog `json:"logs"`
+	}
+	path := "/sites/" + strconv.Itoa(siteID) + "/logs"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	if err := c.do(ctx, http.MethodGet, path, nil, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Logs, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultURL is the server used when none was saved
+const defaultURL = "https://internetpublishing.co"
+
+// config is what login saves between runs
+type config struct {
+	URL   string `json:"url"`
+	Token string `json:"token,omitempty"`
+}
+
+// configPath returns where the configuration is saved: $IPUB_CONFIG, or ipub/config.json
+// in the user's configuration folder
+func configPath() (string, error) {
+	if path := os.Getenv("IPUB_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the configuration folder: %w", err)
+	}
+	return filepath.Join(dir, "ipub", "config.json"), nil
+}
+
+// loadConfig reads the saved configuration. A missing file is an empty configuration.
+func loadConfig() (*config, error) {
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &config{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// save writes the configuration, readable by the user only since it holds the token
+func (cfg *config) save() error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// newClientFromConfig builds an API client from the saved configuration and the
+// IPUB_URL and IPUB_TOKEN environment variables, which take precedence
+func newClientFromConfig() (*client, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	url := cfg.URL
+	if env := os.Getenv("IPUB_URL"); env != "" {
+		url = env
+	}
+	if url == "" {
+		url = defaultURL
+	}
+	token := cfg.Token
+	if env := os.Getenv("IPUB_TOKEN"); env != "" {
+		token = env
+	}
+	if token == "" {
+		return nil, errors.New("not logged in, run ipub login or set IPUB_TOKEN")
+	}
+
+	return newClient(strings.TrimSuffix(url, "/"), token), nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/hyperstitieux/template/auth"
+)
+
+// runLogin checks a token against the server and saves both. The token is read from
+// standard input when --token isn't given, so it stays out of the shell history.
+func runLogin(ctx context.Context, args []string) error {
+	cmd := newCommand("login")
+	serverURL := cmd.flags.String("url", "", "address of the server (default "+defaultURL+")")
+	token := cmd.flags.String("token", "", "API token created in the settings")
+	if _, err := cmd.parse(args, 0, 0); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if *serverURL != "" {
+		cfg.URL = strings.TrimSuffix(*serverURL, "/")
+	}
+	if cfg.URL == "" {
+		cfg.URL = defaultURL
+	}
+
+	if *token == "" {
+		fmt.Fprint(os.Stderr, "API token: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("failed to read the token: %w", err)
+		}
+		*token = strings.TrimSpace(line)
+	}
+	if !strings.HasPrefix(*token, auth.APITokenPrefix) {
+		return fmt.Errorf("API tokens start with %s", auth.APITokenPrefix)
+	}
+
+	// A token without the sites:read scope can't list sites but is still valid
+	_, err = newClient(cfg.URL, *token).listSites(ctx)
+	var apiErr *apiError
+	if err != nil && !(errors.As(err, &apiErr) && apiErr.Status == http.StatusForbidden) {
+		return fmt.Errorf("failed to log in to %s: %w", cfg.URL, err)
+	}
+
+	cfg.Token = *token
+	if err := cfg.save(); err != nil {
+		return err
+	}
+
+	if cmd.json {
+		return printJSON(map[string]string{"url": cfg.URL})
+	}
+	fmt.Println("Logged in to", cfg.URL)
+	return nil
+}
+
+// runLogout forgets the saved token, keeping the server
+func runLogout(args []string) error {
+	cmd := newCommand("logout")
+	if _, err := cmd.parse(args, 0, 0); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	cfg.Token = ""
+	if err := cfg.save(); err != nil {
+		return err
+	}
+
+	if !cmd.json {
+		fmt.Println("Logged out")
+	}
+	return nil
+}
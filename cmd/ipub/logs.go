@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/hyperstitieux/template/database/models"
+)
+
+const (
+	// defaultLogsLimit is how many entries logs prints
+	defaultLogsLimit = 50
+	// logsPollInterval is how often logs --follow checks for new entries
+	logsPollInterval = 5 * time.Second
+)
+
+// runLogs prints the most recent log entries of a site, oldest first. With --follow,
+// it keeps printing new entries until interrupted.
+func runLogs(ctx context.Context, args []string) error {
+	cmd := newCommand("logs")
+	level := cmd.flags.String("level", "", "only print entries of this level: info, warning or error")
+	limit := cmd.flags.Int("limit", defaultLogsLimit, "number of entries to print")
+	follow := cmd.flags.Bool("follow", false, "keep printing new entries")
+	positional, err := cmd.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	c, err := newClientFromConfig()
+	if err != nil {
+		return err
+	}
+	site, err := c.findSite(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+
+	lastID := 0
+	for {
+		logs, err := c.logs(ctx, site.ID, *level, *limit)
+		if err != nil {
+			return err
+		}
+
+		// Entries come newest first
+		slices.Reverse(logs)
+		for _, log := range logs {
+			if log.ID <= lastID {
+				continue
+			}
+			if err := printLog(log, cmd.json); err != nil {
+				return err
+			}
+			lastID = log.ID
+		}
+
+		if !*follow {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(logsPollInterval):
+		}
+	}
+}
+
+// printLog prints a log entry on one line, as text or JSON
+func printLog(log *models.SiteLog, asJSON bool) error {
+	if asJSON {
+		return printJSONLine(log)
+	}
+
+	line := fmt.Sprintf("%s %-7s", log.CreatedAt.Local().Format(time.DateTime), log.Level)
+	if log.Path != "" {
+		line += " /" + log.Path
+	}
+	if log.UpstreamStatus != nil {
+		line += fmt.Sprintf(" (%d)", *log.UpstreamStatus)
+	}
+	fmt.Println(line + " " + log.Message)
+	return nil
+}
@@ -0,0 +1,143 @@
+// Command ipub manages Internet Publishing sites from a terminal or a CI pipeline,
+// through the JSON API and a personal access token.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+const usage = `usage: ipub <command> [flags] [arguments]
+
+commands:
+  login                   save the token and server to use, checking they work
+  logout                  forget the saved token
+  sites                   list your sites
+  sites create <slug>     create a site (--repo, --branch, --subdirectory)
+  sites update <site>     change the repository, branch or subdirectory of a site
+  sites delete <site>     delete a site (--yes)
+  sites resync <site>     sync a site with its repository (--wait)
+  logs <site>             print the sync and render logs of a site (--follow)
+  preview <site> [dir]    serve a local folder with the site's layout
+
+Sites are named by slug or ID. Every command takes --json to print JSON instead of
+text. IPUB_TOKEN and IPUB_URL override the saved token and server.`
+
+// errUsage reports a command line that doesn't make sense, after printing the usage
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:]); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprintln(os.Stderr, usage)
+		} else if !errors.Is(err, context.Canceled) {
+			fmt.Fprintln(os.Stderr, "ipub:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run dispatches a command line to its command
+func run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	switch args[0] {
+	case "login":
+		return runLogin(ctx, args[1:])
+	case "logout":
+		return runLogout(args[1:])
+	case "sites":
+		sub, rest := "list", args[1:]
+		if len(rest) > 0 && !strings.HasPrefix(rest[0], "-") {
+			sub, rest = rest[0], rest[1:]
+		}
+		switch sub {
+		case "list":
+			return runSitesList(ctx, rest)
+		case "create":
+			return runSitesCreate(ctx, rest)
+		case "update":
+			return runSitesUpdate(ctx, rest)
+		case "delete":
+			return runSitesDelete(ctx, rest)
+		case "resync":
+			return runSitesResync(ctx, rest)
+		}
+	case "logs":
+		return runLogs(ctx, args[1:])
+	case "preview":
+		return runPreview(ctx, args[1:])
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+		return nil
+	}
+	return errUsage
+}
+
+// command holds the flags every command takes
+type command struct {
+	flags *flag.FlagSet
+	json  bool
+}
+
+// newCommand creates the flag set of a command, with the --json flag
+func newCommand(name string) *command {
+	c := &command{flags: flag.NewFlagSet(name, flag.ContinueOnError)}
+	c.flags.BoolVar(&c.json, "json", false, "print JSON instead of text")
+	return c
+}
+
+// parse parses the arguments of the command, which must leave between min and max
+// positional arguments. Flags may come before or after them.
+func (c *command) parse(args []string, min, max int) ([]string, error) {
+	var positional []string
+	for {
+		if err := c.flags.Parse(args); err != nil {
+			return nil, errUsage
+		}
+		args = c.flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	if len(positional) < min || len(positional) > max {
+		return nil, errUsage
+	}
+	return positional, nil
+}
+
+// isSet tells whether a flag was given on the command line
+func (c *command) isSet(name string) bool {
+	set := false
+	c.flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// printJSON prints a value as indented JSON
+func printJSON(v any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// printJSONLine prints a value as JSON on a single line, for streams of values
+func printJSONLine(v any) error {
+	return json.NewEncoder(os.Stdout).Encode(v)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hyperstitieux/template/preview"
+)
+
+// runPreview serves a local folder with the layout of a site, to check pages before
+// pushing them. The folder defaults to the site's subdirectory when the command runs
+// at the root of a checkout of its repository.
+func runPreview(ctx context.Context, args []string) error {
+	cmd := newCommand("preview")
+	addr := cmd.flags.String("addr", "localhost:4000", "address to listen on")
+	positional, err := cmd.parse(args, 1, 2)
+	if err != nil {
+		return err
+	}
+
+	c, err := newClientFromConfig()
+	if err != nil {
+		return err
+	}
+	site, err := c.findSite(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+
+	dir := "."
+	if len(positional) == 2 {
+		dir = positional[1]
+	} else if site.Subdirectory != "" {
+		if info, err := os.Stat(site.Subdirectory); err == nil && info.IsDir() {
+			dir = filepath.FromSlash(site.Subdirectory)
+		}
+	}
+
+	server, err := preview.New(dir, site, false)
+	if err != nil {
+		return err
+	}
+	defer server.Close()
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	httpServer := &http.Server{Handler: server, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	url := "http://" + listener.Addr().String()
+	if cmd.json {
+		if err := printJSONLine(map[string]string{"url": url, "dir": dir, "site": site.Slug}); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("Previewing %s as %s on %s, press Ctrl+C to stop\n", dir, site.Slug, url)
+	}
+
+	if err := httpServer.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
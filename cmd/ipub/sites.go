@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hyperstitieux/template/database/models"
+)
+
+// deploymentPollInterval is how often resync --wait checks on the deployment
+const deploymentPollInterval = 2 * time.Second
+
+// runSitesList prints the user's sites
+func runSitesList(ctx context.Context, args []string) error {
+	cmd := newCommand("sites")
+	if _, err := cmd.parse(args, 0, 0); err != nil {
+		return err
+	}
+
+	c, err := newClientFromConfig()
+	if err != nil {
+		return err
+	}
+	sites, err := c.listSites(ctx)
+	if err != nil {
+		return err
+	}
+
+	if cmd.json {
+		return printJSON(sites)
+	}
+	if len(sites) == 0 {
+		fmt.Println("No sites yet, create one with ipub sites create")
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSLUG\tREPOSITORY\tBRANCH\tSUBDIRECTORY")
+	for _, site := range sites {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", site.ID, site.Slug, site.GithubRepo, site.GithubBranch, orDash(site.Subdirectory))
+	}
+	return tw.Flush()
+}
+
+// runSitesCreate creates a site
+func runSitesCreate(ctx context.Context, args []string) error {
+	cmd := newCommand("sites create")
+	repo := cmd.flags.String("repo", "", "GitHub repository, as owner/name")
+	branch := cmd.flags.String("branch", "main", "branch to publish")
+	subdirectory := cmd.flags.String("subdirectory", "", "folder of the repository holding the pages")
+	positional, err := cmd.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if *repo == "" {
+		return errors.New("--repo is required")
+	}
+
+	c, err := newClientFromConfig()
+	if err != nil {
+		return err
+	}
+	body := map[string]string{
+		"slug":          positional[0],
+		"github_repo":   *repo,
+		"github_branch": *branch,
+		"subdirectory":  *subdirectory,
+	}
+	var site models.Site
+	if err := c.do(ctx, http.MethodPost, "/sites", body, &site); err != nil {
+		return err
+	}
+
+	if cmd.json {
+		return printJSON(site)
+	}
+	fmt.Printf("Created site %s (ID %d) from %s@%s\n", site.Slug, site.ID, site.GithubRepo, site.GithubBranch)
+	return nil
+}
+
+// runSitesUpdate changes the settings of a site given on the command line, leaving
+// the others as they are
+func runSitesUpdate(ctx context.Context, args []string) error {
+	cmd := newCommand("sites update")
+	repo := cmd.flags.String("repo", "", "GitHub repository, as owner/name")
+	branch := cmd.flags.String("branch", "", "branch to publish")
+	subdirectory := cmd.flags.String("subdirectory", "", "folder of the repository holding the pages")
+	positional, err := cmd.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	body := map[string]string{}
+	if cmd.isSet("repo") {
+		body["github_repo"] = *repo
+	}
+	if cmd.isSet("branch") {
+		body["github_branch"] = *branch
+	}
+	if cmd.isSet("subdirectory") {
+		body["subdirectory"] = *subdirectory
+	}
+	if len(body) == 0 {
+		return errors.New("nothing to update, give --repo, --branch or --subdirectory")
+	}
+
+	c, err := newClientFromConfig()
+	if err != nil {
+		return err
+	}
+	site, err := c.findSite(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	if err := c.do(ctx, http.MethodPatch, "/sites/"+strconv.Itoa(site.ID), body, site); err != nil {
+		return err
+	}
+
+	if cmd.json {
+		return printJSON(site)
+	}
+	fmt.Printf("Updated site %s, now %s@%s\n", site.Slug, site.GithubRepo, site.GithubBranch)
+	return nil
+}
+
+// runSitesDelete deletes a site. --yes is required since it can't be undone.
+func runSitesDelete(ctx context.Context, args []string) error {
+	cmd := newCommand("sites delete")
+	yes := cmd.flags.Bool("yes", false, "confirm the deletion")
+	positional, err := cmd.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if !*yes {
+		return fmt.Errorf("deleting %s can't be undone, run again with --yes to confirm", positional[0])
+	}
+
+	c, err := newClientFromConfig()
+	if err != nil {
+		return err
+	}
+	site, err := c.findSite(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+	if err := c.do(ctx, http.MethodDelete, "/sites/"+strconv.Itoa(site.ID), nil, nil); err != nil {
+		return err
+	}
+
+	if cmd.json {
+		return printJSON(map[string]any{"id": site.ID, "slug": site.Slug, "deleted": true})
+	}
+	fmt.Printf("Deleted site %s\n", site.Slug)
+	return nil
+}
+
+// runSitesResync starts a deployment of a site. With --wait, it follows the deployment
+// and fails if the deployment does, which is what CI pipelines want.
+func runSitesResync(ctx context.Context, args []string) error {
+	cmd := newCommand("sites resync")
+	wait := cmd.flags.Bool("wait", false, "wait for the sync to finish, failing if it fails")
+	positional, err := cmd.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	c, err := newClientFromConfig()
+	if err != nil {
+		return err
+	}
+	site, err := c.findSite(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+
+	var deployment models.Deployment
+	if err := c.do(ctx, http.MethodPost, "/sites/"+strconv.Itoa(site.ID)+"/resync", nil, &deployment); err != nil {
+		return err
+	}
+	if !cmd.json {
+		fmt.Printf("Syncing %s (deployment %d)\n", site.Slug, deployment.ID)
+	}
+
+	d := &deployment
+	for *wait && d.Status == models.DeploymentRunning {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(deploymentPollInterval):
+		}
+		if d, err = c.deployment(ctx, site.ID, deployment.ID); err != nil {
+			return err
+		}
+	}
+
+	if cmd.json {
+		if err := printJSON(d); err != nil {
+			return err
+		}
+	} else if d.Status != models.DeploymentRunning {
+		printDeployment(d)
+	}
+	if d.Status == models.DeploymentFailed {
+		return fmt.Errorf("sync of %s failed", site.Slug)
+	}
+	return nil
+}
+
+// printDeployment prints the outcome of a finished deployment
+func printDeployment(d *models.Deployment) {
+	switch d.Status {
+	case models.DeploymentSucceeded:
+		fmt.Printf("Synced %d pages at %s\n", d.Pages, shortSHA(d.CommitSHA))
+	case models.DeploymentFailed:
+		fmt.Printf("Sync failed: %s\n", d.Error)
+	}
+}
+
+// shortSHA abbreviates a commit hash the way git does
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// orDash shows empty values as a dash in tables
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/jobs"
+	"github.com/hyperstitieux/template/quota"
+)
+
+// Retention of rows cleaned up by maintenance jobs
+const (
+	siteLogsRetention     = 30 * 24 * time.Hour
+	finishedJobsRetention = 7 * 24 * time.Hour
+	magicLinksRetention   = 24 * time.Hour
+)
+
+// registerMaintenanceJobs registers the recurring housekeeping jobs of the instance
+func registerMaintenanceJobs(ctx context.Context, queue *jobs.Queue, users repositories.UsersRepository, magicLinks repositories.MagicLinksRepository, passkeys repositories.PasskeysRepository, apiTokens repositories.APITokensRepository, invitations repositories.InvitationsRepository, siteTransfers repositories.SiteTransfersRepository, siteLogs repositories.SiteLogsRepository, jobsRepository repositories.JobsRepository, quotas repositories.QuotasRepository) error {
+	queue.Register("sessions.cleanup", func(ctx context.Context, job *models.Job) error {
+		return users.DeleteExpiredSessions(ctx)
+	})
+	queue.Register("magic_links.cleanup", func(ctx context.Context, job *models.Job) error {
+		return magicLinks.DeleteExpiredBefore(ctx, time.Now().Add(-magicLinksRetention))
+	})
+	queue.Register("webauthn_challenges.cleanup", func(ctx context.Context, job *models.Job) error {
+		return passkeys.DeleteExpiredChallenges(ctx, time.Now())
+	})
+	queue.Register("api_tokens.cleanup", func(ctx context.Context, job *models.Job) error {
+		return apiTokens.DeleteExpired(ctx)
+	})
+	queue.Register("invitations.cleanup", func(ctx context.Context, job *models.Job) error {
+		return invitations.DeleteExpired(ctx)
+	})
+	queue.Register("site_transfers.cleanup", func(ctx context.Context, job *models.Job) error {
+		return siteTransfers.DeleteExpired(ctx)
+	})
+	queue.Register("site_logs.cleanup", func(ctx context.Context, job *models.Job) error {
+		return siteLogs.DeleteOlderThan(ctx, time.Now().Add(-siteLogsRetention))
+	})
+	queue.Register("jobs.cleanup", func(ctx context.Context, job *models.Job) error {
+		return jobsRepository.DeleteFinishedBefore(ctx, time.Now().Add(-finishedJobsRetention))
+	})
+	queue.Register("usage.record_storage", func(ctx context.Context, job *models.Job) error {
+		return quotas.RecordStorage(ctx, quota.Day(time.Now()))
+	})
+
+	schedules := []struct {
+		name, spec, kind string
+	}{
+		{"cleanup-expired-sessions", "@hourly", "sessions.cleanup"},
+		{"cleanup-magic-links", "15 * * * *", "magic_links.cleanup"},
+		{"cleanup-webauthn-challenges", "20 * * * *", "webauthn_challenges.cleanup"},
+		{"cleanup-api-tokens", "25 * * * *", "api_tokens.cleanup"},
+		{"cleanup-invitations", "35 * * * *", "invitations.cleanup"},
+		{"cleanup-site-transfers", "40 * * * *", "site_transfers.cleanup"},
+		{"cleanup-site-logs", "30 3 * * *", "site_logs.cleanup"},
+		{"cleanup-finished-jobs", "45 3 * * *", "jobs.cleanup"},
+		{"record-storage-usage", "50 * * * *", "usage.record_storage"},
+	}
+	for _, s := range schedules {
+		if err := queue.Every(ctx, s.name, s.spec, s.kind, struct{}{}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,16 +1,26 @@
 package main
 
 import (
+	"context"
 	"log/slog"
 	"net/http"
 	"os"
 
+	"github.com/hyperstitieux/template/analytics"
+	"github.com/hyperstitieux/template/audit"
 	"github.com/hyperstitieux/template/auth"
 	"github.com/hyperstitieux/template/config"
 	"github.com/hyperstitieux/template/controllers"
 	"github.com/hyperstitieux/template/database"
+	"github.com/hyperstitieux/template/database/models"
 	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/deploy"
+	"github.com/hyperstitieux/template/jobs"
+	"github.com/hyperstitieux/template/linkcheck"
+	"github.com/hyperstitieux/template/livereload"
+	"github.com/hyperstitieux/template/mail"
 	"github.com/hyperstitieux/template/pages"
+	"github.com/hyperstitieux/template/quota"
 	"github.com/hyperstitieux/template/router"
 	"github.com/joho/godotenv"
 )
@@ -23,6 +33,16 @@ func main() {
 
 	cfg := config.New()
 
+	// Schema migrations run as a subcommand: server migrate status|up|down|to
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(cfg, os.Args[2:]))
+	}
+
+	// Local folders are previewed without a database: server preview [dir]
+	if len(os.Args) > 1 && os.Args[1] == "preview" {
+		os.Exit(runPreview(os.Args[2:]))
+	}
+
 	// Initialize database
 	db, err := database.New(cfg.DatabaseURL)
 	if err != nil {
@@ -32,15 +52,93 @@ func main() {
 	defer db.Close()
 
 	// Initialize repositories
-	users := repositories.NewUsersRepository(db.DB)
-	sites := repositories.NewSitesRepository(db.DB)
+	users := repositories.NewUsersRepository(db)
+	sites := repositories.NewSitesRepository(db)
+	identities := repositories.NewIdentitiesRepository(db)
+	magicLinks := repositories.NewMagicLinksRepository(db)
+	passkeys := repositories.NewPasskeysRepository(db)
+	totp := repositories.NewTOTPRepository(db)
+	siteLogs := repositories.NewSiteLogsRepository(db)
+	linkChecks := repositories.NewLinkChecksRepository(db)
+	deployments := repositories.NewDeploymentsRepository(db)
+	apiTokens := repositories.NewAPITokensRepository(db)
+	organizations := repositories.NewOrganizationsRepository(db)
+	invitations := repositories.NewInvitationsRepository(db)
+	siteTransfers := repositories.NewSiteTransfersRepository(db)
+	auditEvents := repositories.NewAuditEventsRepository(db)
+	siteReports := repositories.NewSiteReportsRepository(db)
+	stats := repositories.NewStatsRepository(db)
+	quotasRepository := repositories.NewQuotasRepository(db)
+	pageViews := repositories.NewPageViewsRepository(db)
+
+	jobsRepository := repositories.NewJobsRepository(db)
+
+	// Initialize the mail sender
+	mailer, err := mail.New(cfg.MailConfig)
+	if err != nil {
+		slog.Error("failed to initialize mail sender", "error", err)
+		panic(err)
+	}
+
+	// Record who changes accounts and sites
+	auditLog := audit.New(auditEvents)
+
+	// Enforce the limits of plans and meter usage
+	quotas := quota.New(cfg.QuotaConfig, quotasRepository)
+	go quotas.Run(context.Background())
+
+	// Count the visits of public sites
+	siteAnalytics, err := analytics.New(cfg.AnalyticsConfig, db, pageViews)
+	if err != nil {
+		slog.Error("failed to initialize analytics", "error", err)
+		panic(err)
+	}
+	go siteAnalytics.Run(context.Background())
+
+	// Initialize background job queue and the services running on it
+	queue := jobs.New(jobsRepository, jobs.DefaultConfig())
+	linkCheckRunner := linkcheck.NewRunner(linkcheck.New(cfg.LinkCheckConfig), queue, db, &sites, linkChecks, siteLogs)
+	liveHub := livereload.NewHub(livereload.DefaultConfig())
+	deployRunner := deploy.NewRunner(queue, db, &sites, deployments, siteLogs, liveHub, quotas)
+	if err := registerMaintenanceJobs(context.Background(), queue, users, magicLinks, passkeys, apiTokens, invitations, siteTransfers, siteLogs, jobsRepository, quotasRepository); err != nil {
+		slog.Error("failed to register maintenance jobs", "error", err)
+		panic(err)
+	}
+	queue.Start(context.Background())
 
 	// Initialize controllers
-	googleOAuthController := controllers.NewGoogleOAuthController(users, cfg.GoogleOAuthConfig)
+	// Providers offered on the sign in page, those without credentials are hidden
+	var signInProviders []pages.SignInProvider
+	if cfg.GoogleOAuthConfig.ClientID != "" {
+		signInProviders = append(signInProviders, pages.SignInProvider{ID: models.ProviderGoogle, Name: "Google", Path: "/auth/google"})
+	}
+	if cfg.GitHubOAuthConfig.ClientID != "" {
+		signInProviders = append(signInProviders, pages.SignInProvider{ID: models.ProviderGitHub, Name: "GitHub", Path: "/auth/github"})
+	}
+	for _, provider := range cfg.OIDCProviders {
+		signInProviders = append(signInProviders, pages.SignInProvider{ID: provider.ID, Name: provider.Name, Path: "/auth/oidc/" + provider.ID})
+	}
+
+	// Every way to sign in goes through accounts, which asks for the second factor
+	accounts := controllers.NewAccounts(db, users, identities, passkeys, totp, auditLog)
+	googleOAuthController := controllers.NewGoogleOAuthController(accounts, cfg.GoogleOAuthConfig, cfg.GoogleUserInfoURL)
+	githubOAuthController := controllers.NewGitHubOAuthController(accounts, cfg.GitHubOAuthConfig, cfg.GitHubAPIURL)
+	oidcController := controllers.NewOIDCController(accounts, cfg.OIDCProviders)
+	signInController := controllers.NewSignInController(signInProviders, cfg.EmailSignIn)
+	magicLinkController := controllers.NewMagicLinkController(accounts, magicLinks, mailer, cfg.BaseURL, signInProviders)
+	passkeysController := controllers.NewPasskeysController(accounts, passkeys, cfg.WebAuthnConfig)
+	secondFactorController := controllers.NewSecondFactorController(accounts, passkeys)
+	totpController := controllers.NewTOTPController(accounts, db, totp)
 	signOutController := controllers.NewSignOutController(users)
-	settingsController := controllers.NewSettingsController(users)
-	sitesController := controllers.NewSitesController(&sites)
-	publicSiteController := controllers.NewPublicSiteController(&sites)
+	settingsController := controllers.NewSettingsController(db, users, &sites, identities, passkeys, totp, apiTokens, organizations, auditEvents, auditLog, quotas, signInProviders)
+	sitesController := controllers.NewSitesController(db, &sites, siteLogs, linkChecks, linkCheckRunner, deployments, deployRunner, identities, organizations, siteTransfers, users, pageViews, auditLog, quotas, mailer, cfg.GitHubAPIURL, cfg.BaseURL)
+	sitesAPIController := controllers.NewSitesAPIController(&sites, siteLogs, deployments, deployRunner, organizations, auditLog, quotas)
+	organizationsController := controllers.NewOrganizationsController(db, organizations, invitations, &sites, siteTransfers, auditLog, mailer, cfg.BaseURL)
+	publicSiteController := controllers.NewPublicSiteController(&sites, siteLogs, users, liveHub, quotas, siteAnalytics, cfg.BaseURL)
+	siteReportsController := controllers.NewSiteReportsController(siteReports, &sites, users, organizations, mailer, cfg.BaseURL)
+	adminController := controllers.NewAdminController(users, &sites, organizations, siteReports, stats, jobsRepository, quotasRepository, quotas, auditLog, mailer, cfg.BaseURL, cfg.AdminEmails)
+	adminJobsController := controllers.NewAdminJobsController(jobsRepository, cfg.AdminEmails)
+	adminAuditController := controllers.NewAdminAuditController(auditEvents, cfg.AdminEmails)
 
 	// Initialize router with default configuration
 	// Note: Hot reload endpoints are registered separately to bypass middleware
@@ -58,12 +156,20 @@ func main() {
 		}
 	})
 
+	// Open pages of public sites subscribe to their site's updates, this websocket
+	// bypasses the middlewares like the hot reload ones
+	r.HandleWebSocket(livereload.Path, publicSiteController.Live)
+
 	// Apply subdomain routing middleware first (before auth)
 	// This intercepts all subdomain requests and routes them to the public site controller
 	r.Use(router.SubdomainHandler(publicSiteController.Render))
 
 	// Apply authentication middleware globally
-	r.Use(auth.AuthMiddleware(users))
+	r.Use(auth.AuthMiddleware(users, cfg.AdminEmails))
+
+	// Check the CSRF token of every form and script posting to the dashboard. The API
+	// only accepts bearer tokens, which another site can't make a browser send.
+	r.Use(auth.CSRFMiddleware(controllers.CSRFFailure, "/api/"))
 
 	// Serve static files from public directory (without /public/ prefix)
 	fileServer := http.FileServer(http.Dir("./public"))
@@ -80,22 +186,110 @@ func main() {
 
 	// Register routes
 	r.Get("/", pages.Home)
-	r.Get("/settings", pages.Settings)
+	r.Get("/sign-in", signInController.Show)
+	r.Get("/sign-in/second-factor", secondFactorController.Show)
+	r.Get("/settings", settingsController.Show)
 
 	// OAuth routes
 	r.Get("/auth/google", googleOAuthController.Redirect)
 	r.Get("/auth/google/callback", googleOAuthController.Callback)
-	r.Get("/auth/sign-out", signOutController.Handle)
+	r.Get("/auth/github", githubOAuthController.Redirect)
+	r.Get("/auth/github/callback", githubOAuthController.Callback)
+	r.Get("/auth/oidc/{provider}", oidcController.Redirect)
+	r.Get("/auth/oidc/{provider}/callback", oidcController.Callback)
+	if cfg.EmailSignIn {
+		r.Post("/auth/email", magicLinkController.Request)
+		r.Get("/auth/email/verify", magicLinkController.Confirm)
+		r.Post("/auth/email/verify", magicLinkController.Verify)
+	}
+	r.Get(auth.SignOutPath, signOutController.Handle)
+
+	// Passkey routes, called by passkeys.js
+	r.Post("/auth/passkey/options", passkeysController.SignInOptions)
+	r.Post("/auth/passkey", passkeysController.SignIn)
+	r.Post("/sign-in/second-factor/passkey/options", passkeysController.SecondFactorOptions)
+	r.Post("/sign-in/second-factor/passkey", passkeysController.SecondFactor)
+	r.Post("/sign-in/second-factor/code", totpController.Verify)
 
 	// Settings routes
 	r.Post("/settings/update-profile", settingsController.UpdateProfile)
 	r.Post("/settings/delete-account", settingsController.DeleteAccount)
+	r.Post("/settings/identities/{provider}/delete", settingsController.DisconnectIdentity)
+	r.Post("/settings/sessions/delete-others", settingsController.RevokeOtherSessions)
+	r.Post("/settings/sessions/{id}/delete", settingsController.RevokeSession)
+	r.Post("/settings/passkeys/options", passkeysController.RegisterOptions)
+	r.Post("/settings/passkeys", passkeysController.Register)
+	r.Post("/settings/passkeys/{id}/rename", passkeysController.Rename)
+	r.Post("/settings/passkeys/{id}/delete", passkeysController.Delete)
+	r.Get("/settings/two-factor", totpController.Show)
+	r.Post("/settings/two-factor", totpController.Enable)
+	r.Post("/settings/two-factor/recovery-codes", totpController.RegenerateRecoveryCodes)
+	r.Post("/settings/two-factor/delete", totpController.Disable)
+	r.Post("/settings/tokens", settingsController.CreateAPIToken)
+	r.Post("/settings/tokens/{id}/delete", settingsController.RevokeAPIToken)
+	r.Get("/settings/audit", settingsController.Audit)
 
 	// Sites routes
 	r.Get("/sites", sitesController.List)
 	r.Get("/sites/new", sitesController.New)
 	r.Post("/sites/create", sitesController.Create)
+	r.Get("/sites/{id}", sitesController.Show)
+	r.Post("/sites/{id}/check-links", sitesController.CheckLinks)
+	r.Post("/sites/{id}/sync", sitesController.Sync)
 	r.Post("/sites/{id}/delete", sitesController.Delete)
+	r.Post("/sites/{id}/transfer", sitesController.Transfer)
+	r.Post("/sites/{id}/transfer/cancel", sitesController.CancelTransfer)
+	r.Post("/transfers/{id}/accept", sitesController.AcceptTransfer)
+	r.Post("/transfers/{id}/decline", sitesController.DeclineTransfer)
+
+	// Abuse reports, linked from the footer of public sites
+	r.Get("/report", siteReportsController.New)
+	r.Post("/report", siteReportsController.Create)
+
+	// Organizations routes
+	r.Get("/orgs/new", organizationsController.New)
+	r.Post("/orgs", organizationsController.Create)
+	r.Get("/orgs/{id}", organizationsController.Show)
+	r.Post("/orgs/{id}/delete", organizationsController.Delete)
+	r.Post("/orgs/{id}/invitations", organizationsController.Invite)
+	r.Post("/orgs/{id}/invitations/{invitation}/delete", organizationsController.RevokeInvitation)
+	r.Post("/orgs/{id}/members/{user}/role", organizationsController.UpdateMember)
+	r.Post("/orgs/{id}/members/{user}/delete", organizationsController.RemoveMember)
+	r.Get("/invitations/{token}", organizationsController.ShowInvitation)
+	r.Post("/invitations/{token}", organizationsController.AcceptInvitation)
+
+	// API routes, authenticated with personal access tokens
+	api := router.WrapRouter(r.PathPrefix("/api/v1").Subrouter())
+	api.Use(router.APIVersion("v1"), router.NoCache(), auth.APITokenMiddleware(apiTokens, users))
+	api.Get("/sites", sitesAPIController.List)
+	api.Post("/sites", sitesAPIController.Create)
+	api.Get("/sites/{id}", sitesAPIController.Show)
+	api.Patch("/sites/{id}", sitesAPIController.Update)
+	api.Delete("/sites/{id}", sitesAPIController.Delete)
+	api.Post("/sites/{id}/resync", sitesAPIController.Resync)
+	api.Get("/sites/{id}/deployments", sitesAPIController.Deployments)
+	api.Get("/sites/{id}/deployments/{deployment}", sitesAPIController.Deployment)
+	api.Get("/sites/{id}/logs", sitesAPIController.Logs)
+
+	// Admin routes
+	r.Get("/admin", adminController.Dashboard)
+	r.Get("/admin/users", adminController.Users)
+	r.Post("/admin/users/{id}/suspend", adminController.SuspendUser)
+	r.Post("/admin/users/{id}/unsuspend", adminController.UnsuspendUser)
+	r.Post("/admin/users/{id}/admin", adminController.UpdateAdmin)
+	r.Post("/admin/users/{id}/impersonate", adminController.Impersonate)
+	r.Get("/admin/users/{id}/limits", adminController.Limits)
+	r.Post("/admin/users/{id}/limits", adminController.UpdateLimits)
+	r.Post(auth.StopImpersonatingPath, adminController.StopImpersonating)
+	r.Get("/admin/sites", adminController.Sites)
+	r.Post("/admin/sites/{id}/suspend", adminController.SuspendSite)
+	r.Post("/admin/sites/{id}/unsuspend", adminController.UnsuspendSite)
+	r.Get("/admin/reports", adminController.Reports)
+	r.Post("/admin/reports/{id}/resolve", adminController.ResolveReport)
+	r.Post("/admin/reports/{id}/suspend", adminController.SuspendReported)
+	r.Get("/admin/jobs", adminJobsController.List)
+	r.Post("/admin/jobs/{id}/retry", adminJobsController.Retry)
+	r.Get("/admin/audit", adminAuditController.List)
 
 	// Start HTTP server
 	slog.Info("http server listening", "addr", cfg.HTTPAddr)
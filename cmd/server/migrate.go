@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/hyperstitieux/template/config"
+	"github.com/hyperstitieux/template/database"
+)
+
+const migrateUsage = `usage: server migrate <command>
+
+commands:
+  status          list migrations and whether they are applied
+  up              apply every pending migration
+  down [n]        revert the last n applied migrations (default 1)
+  to <version>    apply or revert migrations until the schema is at version`
+
+// runMigrate handles the migrate subcommand and returns the process exit code
+func runMigrate(cfg config.Config, args []string) int {
+	if err := migrate(cfg, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func migrate(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	db, err := database.Open(cfg.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	var done []*database.Migration
+	switch args[0] {
+	case "status":
+		return printMigrationStatus(ctx, db)
+	case "up":
+		done, err = db.MigrateUp(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		done, err = db.MigrateDown(ctx, steps)
+	case "to":
+		if len(args) < 2 {
+			return errors.New(migrateUsage)
+		}
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil || version < 0 {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		done, err = db.MigrateTo(ctx, version)
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	for _, m := range done {
+		fmt.Printf("migrated %04d_%s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if len(done) == 0 {
+		fmt.Println("nothing to migrate")
+	}
+
+	version, err := db.Version(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("schema version: %d\n", version)
+	return nil
+}
+
+// printMigrationStatus prints every known migration with the time it was applied
+func printMigrationStatus(ctx context.Context, db *database.Database) error {
+	statuses, err := db.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range statuses {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%04d_%-40s %s\n", s.Version, s.Name, applied)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/preview"
+	"github.com/hyperstitieux/template/public"
+	"github.com/hyperstitieux/template/router"
+)
+
+const previewUsage = `usage: server preview [flags] [dir]
+
+Serves the Markdown pages of dir (default .) with the public site layout, and
+reloads open pages when files change.
+
+flags:
+  --addr <addr>    address to listen on (default localhost:4000)
+  --slug <slug>    name shown in page titles (default: the folder name)
+  --repo <repo>    repository shown in page titles`
+
+// previewScanInterval is how often the previewed folder is checked for changes
+const previewScanInterval = 300 * time.Millisecond
+
+// runPreview handles the preview subcommand and returns the process exit code
+func runPreview(args []string) int {
+	if err := servePreview(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func servePreview(args []string) error {
+	flags := flag.NewFlagSet("preview", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprintln(os.Stderr, previewUsage) }
+	addr := flags.String("addr", "localhost:4000", "")
+	slug := flags.String("slug", "", "")
+	repo := flags.String("repo", "local", "")
+	if err := flags.Parse(args); errors.Is(err, flag.ErrHelp) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		return errors.New(previewUsage)
+	}
+
+	dir := "."
+	if flags.NArg() == 1 {
+		dir = flags.Arg(0)
+	}
+	if *slug == "" {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		*slug = filepath.Base(abs)
+	}
+
+	site := &models.Site{Slug: *slug, GithubRepo: *repo}
+	server, err := preview.New(dir, site, true)
+	if err != nil {
+		return err
+	}
+	defer server.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	go server.Watch(ctx, previewScanInterval, router.NotifyReload)
+
+	// Pages load the hot reload script like the dashboard in development, from the
+	// binary as the working directory is the previewed folder
+	mux := http.NewServeMux()
+	mux.HandleFunc("/__hotreload", router.HotReloadHandler)
+	mux.Handle("/js/hotreload.js", http.FileServerFS(public.HotReload))
+	mux.Handle("/", server)
+
+	httpServer := &http.Server{Addr: *addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("previewing folder", "dir", dir, "url", "http://"+*addr)
+	if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
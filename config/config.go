@@ -1,16 +1,43 @@
 package config
 
 import (
+	"log/slog"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hyperstitieux/template/analytics"
+	"github.com/hyperstitieux/template/database/models"
 	"github.com/hyperstitieux/template/env"
+	"github.com/hyperstitieux/template/github"
+	"github.com/hyperstitieux/template/linkcheck"
+	"github.com/hyperstitieux/template/mail"
+	"github.com/hyperstitieux/template/oidc"
+	"github.com/hyperstitieux/template/quota"
+	"github.com/hyperstitieux/template/webauthn"
 	"golang.org/x/oauth2"
+	githuboauth "golang.org/x/oauth2/github"
 	"golang.org/x/oauth2/google"
 )
 
 type config struct {
-	HTTPAddr         string
-	DatabaseURL      string
+	HTTPAddr          string
+	DatabaseURL       string
 	GoogleOAuthConfig *oauth2.Config
-	BaseURL          string
+	GoogleUserInfoURL string
+	GitHubOAuthConfig *oauth2.Config
+	GitHubAPIURL      string
+	OIDCProviders     []oidc.Config
+	EmailSignIn       bool
+	MailConfig        mail.Config
+	WebAuthnConfig    webauthn.Config
+	BaseURL           string
+	LinkCheckConfig   linkcheck.Config
+	AdminEmails       []string
+	QuotaConfig       quota.Config
+	AnalyticsConfig   analytics.Config
 }
 
 type Config *config
@@ -30,7 +57,135 @@ func New() Config {
 				"https://www.googleapis.com/auth/userinfo.email",
 				"https://www.googleapis.com/auth/userinfo.profile",
 			},
-			Endpoint: google.Endpoint,
+			// Endpoints can point at a local fake OAuth server in development
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  env.GetVar("GOOGLE_AUTH_URL", google.Endpoint.AuthURL),
+				TokenURL: env.GetVar("GOOGLE_TOKEN_URL", google.Endpoint.TokenURL),
+			},
+		},
+		GoogleUserInfoURL: env.GetVar("GOOGLE_USERINFO_URL", "https://www.googleapis.com/oauth2/v2/userinfo"),
+		GitHubOAuthConfig: &oauth2.Config{
+			ClientID:     env.GetVar("GITHUB_CLIENT_ID", ""),
+			ClientSecret: env.GetVar("GITHUB_CLIENT_SECRET", ""),
+			RedirectURL:  baseURL + "/auth/github/callback",
+			Scopes:       []string{"read:user", "user:email"},
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  env.GetVar("GITHUB_AUTH_URL", githuboauth.Endpoint.AuthURL),
+				TokenURL: env.GetVar("GITHUB_TOKEN_URL", githuboauth.Endpoint.TokenURL),
+			},
+		},
+		GitHubAPIURL:  env.GetVar("GITHUB_API_URL", github.DefaultAPIURL),
+		OIDCProviders: oidcProviders(baseURL),
+		EmailSignIn:   env.GetBool("EMAIL_SIGN_IN", true),
+		MailConfig: mail.Config{
+			Driver:       env.GetVar("MAIL_DRIVER", mail.DriverLog),
+			From:         env.GetVar("MAIL_FROM", "Internet Publishing <noreply@localhost>"),
+			Dir:          env.GetVar("MAIL_DIR", "tmp/mail"),
+			SMTPAddr:     env.GetVar("SMTP_ADDR", "localhost:25"),
+			SMTPUsername: env.GetVar("SMTP_USERNAME", ""),
+			SMTPPassword: env.GetVar("SMTP_PASSWORD", ""),
+		},
+		WebAuthnConfig: webAuthnConfig(baseURL),
+		AdminEmails:    env.GetList("ADMIN_EMAILS"),
+		QuotaConfig: quota.Config{
+			Plans:         quotaPlans(),
+			FlushInterval: time.Minute,
 		},
+		AnalyticsConfig: analytics.Config{
+			GeoIPFile:     env.GetVar("GEOIP_FILE", "geoip.csv"),
+			FlushInterval: time.Minute,
+		},
+		LinkCheckConfig: linkcheck.Config{
+			CheckExternal: env.GetBool("LINK_CHECK_EXTERNAL", false),
+			AllowedHosts:  env.GetList("LINK_CHECK_ALLOWED_HOSTS"),
+		},
+	}
+}
+
+var oidcProviderIDPattern = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// reservedProviderIDs are the built-in sign-in providers, whose linked identities an
+// OpenID Connect provider of the same ID would take over
+var reservedProviderIDs = []string{models.ProviderGoogle, models.ProviderGitHub, models.ProviderEmail}
+
+// oidcProviders reads the OpenID Connect providers listed in OIDC_PROVIDERS. Each one is
+// configured by variables prefixed with its ID, e.g. OIDC_KEYCLOAK_ISSUER for "keycloak".
+func oidcProviders(baseURL string) []oidc.Config {
+	var providers []oidc.Config
+	for _, id := range env.GetList("OIDC_PROVIDERS") {
+		id = strings.ToLower(id)
+		if !oidcProviderIDPattern.MatchString(id) || slices.Contains(reservedProviderIDs, id) {
+			slog.Warn("skipping oidc provider with invalid id", "id", id)
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(id, "-", "_")) + "_"
+		defaults := oidc.DefaultClaimMapping()
+		provider := oidc.Config{
+			ID:           id,
+			Name:         env.GetVar(prefix+"NAME", id),
+			Issuer:       env.GetVar(prefix+"ISSUER", ""),
+			ClientID:     env.GetVar(prefix+"CLIENT_ID", ""),
+			ClientSecret: env.GetVar(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  baseURL + "/auth/oidc/" + id + "/callback",
+			Scopes:       env.GetList(prefix + "SCOPES"),
+			Claims: oidc.ClaimMapping{
+				Email:         env.GetVar(prefix+"CLAIM_EMAIL", defaults.Email),
+				EmailVerified: env.GetVar(prefix+"CLAIM_EMAIL_VERIFIED", defaults.EmailVerified),
+				Name:          env.GetVar(prefix+"CLAIM_NAME", defaults.Name),
+				Username:      env.GetVar(prefix+"CLAIM_USERNAME", defaults.Username),
+				GivenName:     env.GetVar(prefix+"CLAIM_GIVEN_NAME", defaults.GivenName),
+				FamilyName:    env.GetVar(prefix+"CLAIM_FAMILY_NAME", defaults.FamilyName),
+				Picture:       env.GetVar(prefix+"CLAIM_PICTURE", defaults.Picture),
+				Locale:        env.GetVar(prefix+"CLAIM_LOCALE", defaults.Locale),
+			},
+		}
+		if len(provider.Scopes) == 0 {
+			provider.Scopes = []string{"openid", "email", "profile"}
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			slog.Warn("skipping oidc provider without issuer or client id", "id", id)
+			continue
+		}
+
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
+// quotaPlans reads the plans listed in PLANS, the first one being the default. Each
+// one is configured by variables prefixed with its ID, e.g. PLAN_PRO_SITES for "pro",
+// and a limit of 0 is unlimited. Without plans, everyone is on quota.DefaultPlan.
+func quotaPlans() []quota.Plan {
+	defaults := quota.DefaultPlan().Limits
+	var plans []quota.Plan
+	for _, id := range env.GetList("PLANS") {
+		id = strings.ToLower(id)
+		prefix := "PLAN_" + strings.ToUpper(strings.ReplaceAll(id, "-", "_")) + "_"
+		plans = append(plans, quota.Plan{
+			ID:   id,
+			Name: env.GetVar(prefix+"NAME", strings.ToUpper(id[:1])+id[1:]),
+			Limits: models.Limits{
+				Sites:          env.GetInt(prefix+"SITES", defaults.Sites),
+				StorageBytes:   int64(env.GetInt(prefix+"STORAGE_MB", int(defaults.StorageBytes>>20))) << 20,
+				BandwidthBytes: int64(env.GetInt(prefix+"BANDWIDTH_GB", int(defaults.BandwidthBytes>>30))) << 30,
+				SyncsPerDay:    env.GetInt(prefix+"SYNCS_PER_DAY", defaults.SyncsPerDay),
+			},
+		})
+	}
+	return plans
+}
+
+// webAuthnConfig scopes passkeys to the host of the base URL, which browsers report as
+// the origin of the sign in pages
+func webAuthnConfig(baseURL string) webauthn.Config {
+	config := webauthn.Config{RPName: "Internet Publishing"}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		slog.Warn("invalid base url, passkeys won't work", "base_url", baseURL, "error", err)
+		return config
 	}
+	config.RPID = u.Hostname()
+	config.Origin = u.Scheme + "://" + u.Host
+	return config
 }
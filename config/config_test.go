@@ -0,0 +1,24 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestOIDCProviders(t *testing.T) {
+	t.Setenv("OIDC_PROVIDERS", "keycloak,Okta,email,google,github,bad_id")
+	for _, id := range []string{"KEYCLOAK", "OKTA", "EMAIL", "GOOGLE", "GITHUB", "BAD_ID"} {
+		t.Setenv("OIDC_"+id+"_ISSUER", "https://id.example.com")
+		t.Setenv("OIDC_"+id+"_CLIENT_ID", "client")
+	}
+	// Providers need an issuer and a client ID
+	t.Setenv("OIDC_OKTA_CLIENT_ID", "")
+
+	var ids []string
+	for _, provider := range oidcProviders("https://example.com") {
+		ids = append(ids, provider.ID)
+	}
+	if !slices.Equal(ids, []string{"keycloak"}) {
+		t.Errorf("providers = %v, want [keycloak]", ids)
+	}
+}
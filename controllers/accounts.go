@@ -0,0 +1,294 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/hyperstitieux/template/audit"
+	"github.com/hyperstitieux/template/auth"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/router"
+)
+
+// secondFactorDuration is how long a user has to complete their second factor
+const secondFactorDuration = 10 * time.Minute
+
+// Accounts turns provider profiles into signed-in users. Users with a second factor
+// only get a pending session until they complete it.
+type Accounts struct {
+	tx         repositories.Transactor
+	users      repositories.UsersRepository
+	identities repositories.IdentitiesRepository
+	passkeys   repositories.PasskeysRepository
+	totp       repositories.TOTPRepository
+	auditLog   *audit.Log
+}
+
+func NewAccounts(tx repositories.Transactor, users repositories.UsersRepository, identities repositories.IdentitiesRepository, passkeys repositories.PasskeysRepository, totp repositories.TOTPRepository, auditLog *audit.Log) *Accounts {
+	return &Accounts{
+		tx:         tx,
+		users:      users,
+		identities: identities,
+		passkeys:   passkeys,
+		totp:       totp,
+		auditLog:   auditLog,
+	}
+}
+
+// signIn finds or creates the user behind a provider profile, links the provider
+// account to it and starts a session. A user already signed in links the provider
+// to their own account instead.
+func (a *Accounts) signIn(w http.ResponseWriter, r *http.Request, profile *oauthProfile, redirectTo string) error {
+	return a.authenticate(w, r, auth.GetCurrentUser(r), profile, redirectTo)
+}
+
+// signInWithoutLinking signs in as the user behind a profile, ending the session of
+// whoever is signed in rather than linking the profile to them. Sign in links prove an
+// address, not who opened them, so they never link to the current user.
+func (a *Accounts) signInWithoutLinking(w http.ResponseWriter, r *http.Request, profile *oauthProfile, redirectTo string) error {
+	if token, err := auth.GetSessionToken(r); err == nil {
+		err := a.users.DeleteSession(r.Context(), token)
+		if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+			return err
+		}
+	}
+	return a.authenticate(w, r, nil, profile, redirectTo)
+}
+
+// authenticate links the profile to current if set, and otherwise signs in as its user
+func (a *Accounts) authenticate(w http.ResponseWriter, r *http.Request, current *models.User, profile *oauthProfile, redirectTo string) error {
+	var user *models.User
+	err := a.tx.Transaction(r.Context(), func(ctx context.Context) error {
+		var err error
+		user, err = a.resolveUser(ctx, current, profile)
+		if err != nil {
+			return err
+		}
+
+		return a.identities.Save(ctx, &models.UserIdentity{
+			UserID:         user.ID,
+			Provider:       profile.Provider,
+			ProviderUserID: profile.ProviderUserID,
+			Email:          profile.Email,
+			Username:       profile.Username,
+			AccessToken:    profile.AccessToken,
+		})
+	})
+	switch {
+	case errors.Is(err, errIdentityTaken), errors.Is(err, repositories.ErrConflict):
+		http.Error(w, fmt.Sprintf("This %s account is already linked to another user", profile.ProviderName), http.StatusConflict)
+		return nil
+	case errors.Is(err, errEmailTaken):
+		http.Error(w, "An account already uses this email address. Sign in the way you did before, then connect "+profile.ProviderName+" from your settings.", http.StatusConflict)
+		return nil
+	case err != nil:
+		return err
+	}
+
+	// Linking a provider keeps the current session, under a new token
+	if current != nil {
+		if err := rotateSession(w, r, a.users); err != nil {
+			return err
+		}
+	} else {
+		hasSecondFactor, err := a.hasSecondFactor(r.Context(), user.ID)
+		if err != nil {
+			return err
+		}
+		if err := a.startSession(w, r, user.ID, hasSecondFactor, profile.Provider); err != nil {
+			return err
+		}
+		if hasSecondFactor {
+			http.Redirect(w, r, "/sign-in/second-factor?redirect="+url.QueryEscape(redirectTo), http.StatusSeeOther)
+			return nil
+		}
+	}
+
+	// Redirect to original page or home page, as a GET whatever method got us here
+	http.Redirect(w, r, redirectTo, http.StatusSeeOther)
+	return nil
+}
+
+// resolveUser returns the user a provider profile signs in as, creating it if needed
+func (a *Accounts) resolveUser(ctx context.Context, current *models.User, profile *oauthProfile) (*models.User, error) {
+	identity, err := a.identities.GetByProviderUserID(ctx, profile.Provider, profile.ProviderUserID)
+	if err == nil {
+		if current != nil && current.ID != identity.UserID {
+			return nil, errIdentityTaken
+		}
+		return a.users.GetUserByID(ctx, identity.UserID)
+	}
+	if !errors.Is(err, repositories.ErrNotFound) {
+		return nil, err
+	}
+
+	// First sign-in with this provider account
+	if current != nil {
+		return current, nil
+	}
+
+	if profile.Email == "" {
+		return nil, fmt.Errorf("%s did not share an email address", profile.ProviderName)
+	}
+
+	// Link to the existing account with the same address, but only when both
+	// sides verified it, otherwise anyone could claim an account by its email
+	if profile.VerifiedEmail {
+		user, err := a.users.GetUserByEmail(ctx, profile.Email)
+		if err == nil && user.VerifiedEmail {
+			return user, nil
+		}
+		if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	user := &models.User{
+		Email:         profile.Email,
+		Name:          profile.Name,
+		GivenName:     stringPtr(profile.GivenName),
+		FamilyName:    stringPtr(profile.FamilyName),
+		Picture:       stringPtr(profile.Picture),
+		Locale:        stringPtr(profile.Locale),
+		VerifiedEmail: profile.VerifiedEmail,
+	}
+	if user.Name == "" {
+		user.Name = profile.Username
+	}
+	if err := a.users.CreateUser(ctx, user); err != nil {
+		if errors.Is(err, repositories.ErrConflict) {
+			return nil, errEmailTaken
+		}
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return user, nil
+}
+
+// hasSecondFactor tells whether the user must complete a second factor to sign in
+func (a *Accounts) hasSecondFactor(ctx context.Context, userID int64) (bool, error) {
+	passkeys, err := a.passkeys.GetByUserID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if len(passkeys) > 0 {
+		return true, nil
+	}
+	return a.hasTOTP(ctx, userID)
+}
+
+// hasTOTP tells whether the user confirmed an authenticator app
+func (a *Accounts) hasTOTP(ctx context.Context, userID int64) (bool, error) {
+	credential, err := a.totp.Get(ctx, userID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return credential.ConfirmedAt != nil, nil
+}
+
+// startSession creates a session for the user and sets its cookie. A pending session
+// only lasts long enough to complete the second factor. Completed sign ins are audited
+// with the method used last. Suspended users are refused.
+func (a *Accounts) startSession(w http.ResponseWriter, r *http.Request, userID int64, secondFactorPending bool, method string) error {
+	user, err := a.users.GetUserByID(r.Context(), userID)
+	if err != nil {
+		return err
+	}
+	if user.SuspendedAt != nil {
+		return router.NewHTTPError(http.StatusForbidden, suspendedMessage(user))
+	}
+
+	sessionToken, err := generateRandomToken(32)
+	if err != nil {
+		return fmt.Errorf("failed to generate session token: %w", err)
+	}
+
+	duration, maxDuration := auth.SessionIdleTimeout, auth.SessionMaxLifetime
+	if secondFactorPending {
+		duration, maxDuration = secondFactorDuration, secondFactorDuration
+	}
+
+	now := time.Now()
+	userAgent, ipAddress := auth.RequestDetails(r)
+	session := &models.Session{
+		UserID:              userID,
+		ExpiresAt:           now.Add(duration),
+		MaxExpiresAt:        now.Add(maxDuration),
+		SecondFactorPending: secondFactorPending,
+		UserAgent:           userAgent,
+		IPAddress:           ipAddress,
+	}
+	if err := a.users.CreateSession(r.Context(), session, sessionToken); err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+
+	// Set session cookie using secure cookie helper
+	auth.SetSessionCookie(w, r, sessionToken, duration)
+
+	if !secondFactorPending {
+		a.auditLog.Record(r, user, models.AuditSignIn, models.AuditTargetUser, user.ID, map[string]models.AuditChange{
+			"method": {After: method},
+		})
+	}
+	return nil
+}
+
+// pendingSession returns the session of the request if it waits for a second factor,
+// and ErrNotFound otherwise
+func (a *Accounts) pendingSession(r *http.Request) (*models.Session, error) {
+	token, err := auth.GetSessionToken(r)
+	if err != nil {
+		return nil, repositories.ErrNotFound
+	}
+	session, err := a.users.GetSessionByToken(r.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+	if !session.SecondFactorPending {
+		return nil, repositories.ErrNotFound
+	}
+	return session, nil
+}
+
+// completeSecondFactor replaces the pending session with a signed-in one. The token
+// changes, so a pending session token seen by someone else is worth nothing.
+func (a *Accounts) completeSecondFactor(w http.ResponseWriter, r *http.Request, session *models.Session, method string) error {
+	// Deleting first makes sure the pending session completes only once
+	if err := a.users.DeleteUserSession(r.Context(), session.UserID, session.ID); err != nil {
+		return err
+	}
+	return a.startSession(w, r, session.UserID, false, method)
+}
+
+// rotateSession gives the session of the request a new token after a change to how
+// the account signs in, so a copy of the token taken before stops working
+func rotateSession(w http.ResponseWriter, r *http.Request, users repositories.UsersRepository) error {
+	token, err := auth.GetSessionToken(r)
+	if err != nil {
+		return nil
+	}
+
+	newToken, err := generateRandomToken(32)
+	if err != nil {
+		return fmt.Errorf("failed to generate session token: %w", err)
+	}
+
+	err = users.RotateSession(r.Context(), token, newToken)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	auth.SetSessionCookie(w, r, newToken, auth.SessionIdleTimeout)
+	return nil
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/hyperstitieux/template/audit"
+	"github.com/hyperstitieux/template/auth"
+	"github.com/hyperstitieux/template/database"
+	"github.com/hyperstitieux/template/database/dbtest"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+)
+
+// testAccounts signs users in on a fresh SQLite database
+type testAccounts struct {
+	*Accounts
+	db         *database.Database
+	users      repositories.UsersRepository
+	identities repositories.IdentitiesRepository
+}
+
+func newTestAccounts(t *testing.T) *testAccounts {
+	t.Helper()
+
+	db := dbtest.SQLite(t)
+	users := repositories.NewUsersRepository(db)
+	identities := repositories.NewIdentitiesRepository(db)
+	accounts := NewAccounts(db, users, identities, repositories.NewPasskeysRepository(db), repositories.NewTOTPRepository(db),
+		audit.New(repositories.NewAuditEventsRepository(db)))
+
+	return &testAccounts{Accounts: accounts, db: db, users: users, identities: identities}
+}
+
+// createUser inserts a user, verified or not
+func (a *testAccounts) createUser(t *testing.T, email string, verified bool) *models.User {
+	t.Helper()
+
+	user := &models.User{Email: email, Name: email, VerifiedEmail: verified}
+	if err := a.users.CreateUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// link links a provider account to a user
+func (a *testAccounts) link(t *testing.T, user *models.User, provider, providerUserID string) {
+	t.Helper()
+
+	err := a.identities.Save(context.Background(), &models.UserIdentity{
+		UserID:         user.ID,
+		Provider:       provider,
+		ProviderUserID: providerUserID,
+		Email:          user.Email,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sessionUser returns the user signed in by the session cookie set on a response, or
+// nil without one
+func (a *testAccounts) sessionUser(t *testing.T, resp *http.Response) *models.User {
+	t.Helper()
+
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == auth.SessionCookieName && cookie.Value != "" {
+			user, err := a.users.GetUserBySessionToken(context.Background(), cookie.Value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return user
+		}
+	}
+	return nil
+}
+
+// identityOwner returns the ID of the user a provider account is linked to, or 0
+func (a *testAccounts) identityOwner(t *testing.T, provider, providerUserID string) int64 {
+	t.Helper()
+
+	identity, err := a.identities.GetByProviderUserID(context.Background(), provider, providerUserID)
+	if err != nil {
+		return 0
+	}
+	return identity.UserID
+}
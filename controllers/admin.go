@@ -0,0 +1,409 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/frenchsoftware/libvalidator/validator"
+	"github.com/gorilla/mux"
+	"github.com/hyperstitieux/template/audit"
+	"github.com/hyperstitieux/template/auth"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/mail"
+	"github.com/hyperstitieux/template/pages"
+	"github.com/hyperstitieux/template/quota"
+)
+
+// adminListLimit is the number of users or sites listed on the admin pages
+const adminListLimit = 100
+
+// AdminController serves the admin console: instance statistics, the users and sites
+// admins suspend, promote, put on plans or view the dashboard as, and the queue of
+// site reports
+type AdminController struct {
+	users         repositories.UsersRepository
+	sites         *repositories.SitesRepository
+	organizations repositories.OrganizationsRepository
+	reports       repositories.SiteReportsRepository
+	stats         repositories.StatsRepository
+	jobs          repositories.JobsRepository
+	limits        repositories.QuotasRepository
+	quotas        *quota.Quotas
+	auditLog      *audit.Log
+	mailer        mail.Sender
+	baseURL       string
+	adminEmails   []string
+}
+
+func NewAdminController(users repositories.UsersRepository, sites *repositories.SitesRepository, organizations repositories.OrganizationsRepository, reports repositories.SiteReportsRepository, stats repositories.StatsRepository, jobs repositories.JobsRepository, limits repositories.QuotasRepository, quotas *quota.Quotas, auditLog *audit.Log, mailer mail.Sender, baseURL string, adminEmails []string) *AdminController {
+	return &AdminController{
+		users:         users,
+		sites:         sites,
+		organizations: organizations,
+		reports:       reports,
+		stats:         stats,
+		jobs:          jobs,
+		limits:        limits,
+		quotas:        quotas,
+		auditLog:      auditLog,
+		mailer:        mailer,
+		baseURL:       baseURL,
+		adminEmails:   adminEmails,
+	}
+}
+
+// Dashboard shows what the instance holds and how its job queue is doing
+func (c *AdminController) Dashboard(w http.ResponseWriter, r *http.Request) error {
+	if c.admin(w, r) == nil {
+		return nil
+	}
+
+	stats, err := c.stats.Get(r.Context())
+	if err != nil {
+		return err
+	}
+
+	jobCounts, err := c.jobs.CountByStatus(r.Context())
+	if err != nil {
+		return err
+	}
+
+	return pages.AdminDashboard(w, r, stats, jobCounts)
+}
+
+// Users lists the users of the instance, searched by email, name or id
+func (c *AdminController) Users(w http.ResponseWriter, r *http.Request) error {
+	if c.admin(w, r) == nil {
+		return nil
+	}
+	return c.renderUsers(w, r, strings.TrimSpace(r.URL.Query().Get("q")), nil)
+}
+
+func (c *AdminController) renderUsers(w http.ResponseWriter, r *http.Request, search string, errs validator.ValidationErrors) error {
+	users, err := c.users.List(r.Context(), search, adminListLimit)
+	if err != nil {
+		return err
+	}
+
+	// Admins listed in the configuration have the role whatever the database says
+	for _, user := range users {
+		user.IsAdmin = auth.IsAdmin(user, c.adminEmails)
+	}
+
+	return pages.AdminUsers(w, r, users, search, errs)
+}
+
+// SuspendUser keeps a user from signing in and stops serving their personal sites
+func (c *AdminController) SuspendUser(w http.ResponseWriter, r *http.Request) error {
+	admin := c.admin(w, r)
+	if admin == nil {
+		return nil
+	}
+
+	user, err := c.user(w, r)
+	if user == nil {
+		return err
+	}
+
+	field := fmt.Sprintf("user_%d", user.ID)
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	switch {
+	case reason == "":
+		return c.renderUsers(w, r, user.Email, validator.ValidationErrors{field: {"Give a reason for the suspension"}})
+	case auth.IsAdmin(user, c.adminEmails):
+		return c.renderUsers(w, r, user.Email, validator.ValidationErrors{field: {"Admins can't be suspended, revoke their role first"}})
+	}
+
+	if err := c.users.Suspend(r.Context(), user.ID, reason); err != nil {
+		return err
+	}
+	slog.Info("suspended user", "user_id", user.ID, "admin_id", admin.ID)
+	c.auditLog.Record(r, admin, models.AuditUserSuspend, models.AuditTargetUser, user.ID, map[string]models.AuditChange{
+		"suspended_reason": {After: reason},
+	})
+
+	http.Redirect(w, r, "/admin/users?q="+url.QueryEscape(user.Email), http.StatusSeeOther)
+	return nil
+}
+
+// UnsuspendUser lets a suspended user sign in again
+func (c *AdminController) UnsuspendUser(w http.ResponseWriter, r *http.Request) error {
+	admin := c.admin(w, r)
+	if admin == nil {
+		return nil
+	}
+
+	user, err := c.user(w, r)
+	if user == nil {
+		return err
+	}
+
+	if err := c.users.Unsuspend(r.Context(), user.ID); err != nil {
+		return err
+	}
+	slog.Info("unsuspended user", "user_id", user.ID, "admin_id", admin.ID)
+	c.auditLog.Record(r, admin, models.AuditUserUnsuspend, models.AuditTargetUser, user.ID, map[string]models.AuditChange{
+		"suspended_reason": {Before: user.SuspendedReason},
+	})
+
+	http.Redirect(w, r, "/admin/users?q="+url.QueryEscape(user.Email), http.StatusSeeOther)
+	return nil
+}
+
+// UpdateAdmin grants or revokes the admin role of a user. Admins listed in the
+// configuration keep it.
+func (c *AdminController) UpdateAdmin(w http.ResponseWriter, r *http.Request) error {
+	admin := c.admin(w, r)
+	if admin == nil {
+		return nil
+	}
+
+	user, err := c.user(w, r)
+	if user == nil {
+		return err
+	}
+
+	isAdmin := r.FormValue("admin") == "true"
+	if !isAdmin {
+		field := fmt.Sprintf("user_%d", user.ID)
+		switch {
+		case user.ID == admin.ID:
+			return c.renderUsers(w, r, user.Email, validator.ValidationErrors{field: {"You can't revoke your own admin role"}})
+		case auth.IsListedAdmin(user, c.adminEmails):
+			return c.renderUsers(w, r, user.Email, validator.ValidationErrors{field: {"This admin is listed in the configuration"}})
+		}
+	}
+
+	if err := c.users.SetAdmin(r.Context(), user.ID, isAdmin); err != nil {
+		return err
+	}
+	slog.Info("updated admin role", "user_id", user.ID, "is_admin", isAdmin, "admin_id", admin.ID)
+	action := models.AuditAdminGrant
+	if !isAdmin {
+		action = models.AuditAdminRevoke
+	}
+	c.auditLog.Record(r, admin, action, models.AuditTargetUser, user.ID, audit.Diff(
+		map[string]any{"is_admin": user.IsAdmin},
+		map[string]any{"is_admin": isAdmin},
+	))
+
+	http.Redirect(w, r, "/admin/users?q="+url.QueryEscape(user.Email), http.StatusSeeOther)
+	return nil
+}
+
+// Impersonate lets the admin view the dashboard as a user, to help them. Nothing can
+// be changed until the admin stops.
+func (c *AdminController) Impersonate(w http.ResponseWriter, r *http.Request) error {
+	admin := c.admin(w, r)
+	if admin == nil {
+		return nil
+	}
+
+	user, err := c.user(w, r)
+	if user == nil {
+		return err
+	}
+
+	if auth.IsAdmin(user, c.adminEmails) {
+		return c.renderUsers(w, r, user.Email, validator.ValidationErrors{fmt.Sprintf("user_%d", user.ID): {"Admins can't be impersonated"}})
+	}
+
+	token, err := auth.GetSessionToken(r)
+	if err != nil {
+		return err
+	}
+	if err := c.users.SetImpersonation(r.Context(), token, &user.ID); err != nil {
+		return err
+	}
+	slog.Info("started impersonation", "user_id", user.ID, "admin_id", admin.ID)
+	c.auditLog.Record(r, admin, models.AuditImpersonationStart, models.AuditTargetUser, user.ID, nil)
+
+	http.Redirect(w, r, "/sites", http.StatusSeeOther)
+	return nil
+}
+
+// StopImpersonating brings the admin back to their own account. It is the only change
+// the auth middleware lets through while impersonating.
+func (c *AdminController) StopImpersonating(w http.ResponseWriter, r *http.Request) error {
+	admin := auth.GetImpersonator(r)
+	if admin == nil {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return nil
+	}
+	user := auth.GetCurrentUser(r)
+
+	token, err := auth.GetSessionToken(r)
+	if err != nil {
+		return err
+	}
+	if err := c.users.SetImpersonation(r.Context(), token, nil); err != nil {
+		return err
+	}
+	slog.Info("stopped impersonation", "user_id", user.ID, "admin_id", admin.ID)
+	c.auditLog.Record(r, admin, models.AuditImpersonationStop, models.AuditTargetUser, user.ID, nil)
+
+	http.Redirect(w, r, "/admin/users?q="+url.QueryEscape(user.Email), http.StatusSeeOther)
+	return nil
+}
+
+// Sites lists the sites of the instance, searched by slug, repository, creator's email
+// or id
+func (c *AdminController) Sites(w http.ResponseWriter, r *http.Request) error {
+	if c.admin(w, r) == nil {
+		return nil
+	}
+	return c.renderSites(w, r, strings.TrimSpace(r.URL.Query().Get("q")), nil)
+}
+
+func (c *AdminController) renderSites(w http.ResponseWriter, r *http.Request, search string, errs validator.ValidationErrors) error {
+	sites, err := (*c.sites).List(r.Context(), search, adminListLimit)
+	if err != nil {
+		return err
+	}
+	return pages.AdminSites(w, r, sites, search, errs)
+}
+
+// SuspendSite stops serving a site and syncing it
+func (c *AdminController) SuspendSite(w http.ResponseWriter, r *http.Request) error {
+	admin := c.admin(w, r)
+	if admin == nil {
+		return nil
+	}
+
+	site, err := c.site(w, r)
+	if site == nil {
+		return err
+	}
+
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if reason == "" {
+		return c.renderSites(w, r, site.Slug, validator.ValidationErrors{fmt.Sprintf("site_%d", site.ID): {"Give a reason for the suspension"}})
+	}
+
+	if err := c.suspendSite(r, admin, site, reason); err != nil {
+		return err
+	}
+
+	http.Redirect(w, r, "/admin/sites?q="+url.QueryEscape(site.Slug), http.StatusSeeOther)
+	return nil
+}
+
+// suspendSite suspends a site, closes its open reports and tells its owners why
+func (c *AdminController) suspendSite(r *http.Request, admin *models.User, site *models.Site, reason string) error {
+	if err := (*c.sites).Suspend(r.Context(), site.ID, reason); err != nil {
+		return err
+	}
+	slog.Info("suspended site", "site_id", site.ID, "admin_id", admin.ID)
+	c.auditLog.Record(r, admin, models.AuditSiteSuspend, models.AuditTargetSite, site.ID, map[string]models.AuditChange{
+		"suspended_reason": {After: reason},
+	})
+
+	if err := c.reports.ResolveSite(r.Context(), site.ID, admin.ID, models.ReportSuspended); err != nil {
+		return err
+	}
+
+	emails, err := siteOwnerEmails(r.Context(), c.users, c.organizations, site)
+	if err != nil {
+		slog.Error("failed to get site owners", "error", err, "site_id", site.ID)
+		return nil
+	}
+	for _, email := range emails {
+		err := c.mailer.Send(r.Context(), &mail.Message{
+			To:      email,
+			Subject: fmt.Sprintf("%s was suspended", site.Slug),
+			Body: fmt.Sprintf("The admins of Internet Publishing suspended your site %s. It is no longer served nor synced.\n\n", site.Slug) +
+				"Reason: " + reason + "\n\n" +
+				"You can still see the site and its history from your dashboard:\n\n" +
+				fmt.Sprintf("%s/sites/%d\n", c.baseURL, site.ID),
+		})
+		if err != nil {
+			// The suspension is also shown on the site's page
+			slog.Error("failed to send site suspension email", "error", err, "site_id", site.ID)
+		}
+	}
+	return nil
+}
+
+// UnsuspendSite serves a suspended site again
+func (c *AdminController) UnsuspendSite(w http.ResponseWriter, r *http.Request) error {
+	admin := c.admin(w, r)
+	if admin == nil {
+		return nil
+	}
+
+	site, err := c.site(w, r)
+	if site == nil {
+		return err
+	}
+
+	if err := (*c.sites).Unsuspend(r.Context(), site.ID); err != nil {
+		return err
+	}
+	slog.Info("unsuspended site", "site_id", site.ID, "admin_id", admin.ID)
+	c.auditLog.Record(r, admin, models.AuditSiteUnsuspend, models.AuditTargetSite, site.ID, map[string]models.AuditChange{
+		"suspended_reason": {Before: site.SuspendedReason},
+	})
+
+	http.Redirect(w, r, "/admin/sites?q="+url.QueryEscape(site.Slug), http.StatusSeeOther)
+	return nil
+}
+
+// admin returns the current user if they are an admin. Others are answered, and no
+// user is returned.
+func (c *AdminController) admin(w http.ResponseWriter, r *http.Request) *models.User {
+	user := auth.GetCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in?redirect="+url.QueryEscape(r.URL.Path), http.StatusTemporaryRedirect)
+		return nil
+	}
+	if !auth.IsAdmin(user, c.adminEmails) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil
+	}
+	return user
+}
+
+// user loads the user of the URL. Requests for a user that doesn't exist are answered,
+// and no user is returned.
+func (c *AdminController) user(w http.ResponseWriter, r *http.Request) (*models.User, error) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, nil
+	}
+
+	user, err := c.users.GetUserByID(r.Context(), id)
+	if errors.Is(err, repositories.ErrNotFound) {
+		http.NotFound(w, r)
+		return nil, nil
+	}
+	return user, err
+}
+
+// site loads the site of the URL. Requests for a site that doesn't exist are answered,
+// and no site is returned.
+func (c *AdminController) site(w http.ResponseWriter, r *http.Request) (*models.Site, error) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, nil
+	}
+
+	site, err := (*c.sites).GetByID(r.Context(), id)
+	if errors.Is(err, repositories.ErrNotFound) {
+		http.NotFound(w, r)
+		return nil, nil
+	}
+	return site, err
+}
+
+// suspendedMessage tells a suspended user why they can't sign in
+func suspendedMessage(user *models.User) string {
+	return "This account is suspended: " + user.SuspendedReason
+}
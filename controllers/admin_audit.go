@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hyperstitieux/template/auth"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/pages"
+)
+
+// auditEventsLimit is the number of audit events listed per page
+const auditEventsLimit = 100
+
+type AdminAuditController struct {
+	events      repositories.AuditEventsRepository
+	adminEmails []string
+}
+
+func NewAdminAuditController(events repositories.AuditEventsRepository, adminEmails []string) *AdminAuditController {
+	return &AdminAuditController{
+		events:      events,
+		adminEmails: adminEmails,
+	}
+}
+
+// List shows the audit log of every user, filtered by action and searched by actor
+// email or target id
+func (c *AdminAuditController) List(w http.ResponseWriter, r *http.Request) error {
+	user := auth.GetCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in?redirect=/admin/audit", http.StatusTemporaryRedirect)
+		return nil
+	}
+	if !auth.IsAdmin(user, c.adminEmails) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil
+	}
+
+	// Filter events by action, ignoring unknown actions
+	query := r.URL.Query()
+	action := query.Get("action")
+	if !slices.Contains(models.AuditActions, action) {
+		action = ""
+	}
+	search := strings.TrimSpace(query.Get("q"))
+	before, _ := strconv.ParseInt(query.Get("before"), 10, 64)
+
+	events, err := c.events.List(r.Context(), action, search, before, auditEventsLimit)
+	if err != nil {
+		return err
+	}
+
+	return pages.AdminAudit(w, r, pages.AdminAuditProps{
+		Events:     events,
+		Action:     action,
+		Search:     search,
+		NextBefore: nextAuditPage(events),
+	})
+}
+
+// nextAuditPage returns the cursor of the page after events, 0 if it was the last
+func nextAuditPage(events []*models.AuditEvent) int64 {
+	if len(events) < auditEventsLimit {
+		return 0
+	}
+	return events[len(events)-1].ID
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/hyperstitieux/template/auth"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/pages"
+)
+
+// adminJobsLimit is the number of jobs listed on the admin page
+const adminJobsLimit = 100
+
+type AdminJobsController struct {
+	jobs        repositories.JobsRepository
+	adminEmails []string
+}
+
+func NewAdminJobsController(jobs repositories.JobsRepository, adminEmails []string) *AdminJobsController {
+	return &AdminJobsController{
+		jobs:        jobs,
+		adminEmails: adminEmails,
+	}
+}
+
+// List shows queue statistics, recent jobs and recurring schedules
+func (c *AdminJobsController) List(w http.ResponseWriter, r *http.Request) error {
+	user := auth.GetCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in?redirect=/admin/jobs", http.StatusTemporaryRedirect)
+		return nil
+	}
+	if !auth.IsAdmin(user, c.adminEmails) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil
+	}
+
+	// Filter jobs by status, ignoring unknown statuses
+	status := r.URL.Query().Get("status")
+	if !slices.Contains(models.JobStatuses, status) {
+		status = ""
+	}
+
+	counts, err := c.jobs.CountByStatus(r.Context())
+	if err != nil {
+		return err
+	}
+
+	jobs, err := c.jobs.List(r.Context(), status, adminJobsLimit)
+	if err != nil {
+		return err
+	}
+
+	schedules, err := c.jobs.ListSchedules(r.Context())
+	if err != nil {
+		return err
+	}
+
+	return pages.AdminJobs(w, r, pages.AdminJobsProps{
+		Counts:    counts,
+		Jobs:      jobs,
+		Schedules: schedules,
+		Status:    status,
+	})
+}
+
+// Retry puts a finished job back in the queue
+func (c *AdminJobsController) Retry(w http.ResponseWriter, r *http.Request) error {
+	user := auth.GetCurrentUser(r)
+	if !auth.IsAdmin(user, c.adminEmails) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil
+	}
+
+	// Get job ID from URL
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid job ID", http.StatusBadRequest)
+		return nil
+	}
+
+	if err := c.jobs.Requeue(r.Context(), id); err != nil {
+		http.Error(w, "Job cannot be retried", http.StatusConflict)
+		return nil
+	}
+
+	http.Redirect(w, r, "/admin/jobs", http.StatusSeeOther)
+	return nil
+}
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/frenchsoftware/libvalidator/validator"
+	"github.com/hyperstitieux/template/audit"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/pages"
+)
+
+const (
+	// adminUsageDays is the number of days of usage shown with the limits of a user
+	adminUsageDays = 30
+	// maxLimit bounds the limits admins set, in the units of their field
+	maxLimit = 1_000_000
+)
+
+// Limits shows the plan of a user and the limits admins set for them, with their usage
+func (c *AdminController) Limits(w http.ResponseWriter, r *http.Request) error {
+	if c.admin(w, r) == nil {
+		return nil
+	}
+
+	user, err := c.user(w, r)
+	if user == nil {
+		return err
+	}
+
+	limits, err := c.limits.GetLimits(r.Context(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	props := pages.AdminLimitsProps{
+		User:        user,
+		Plan:        c.quotas.Plan(limits.Plan).ID,
+		Sites:       formatLimit(limits.Sites, 1),
+		StorageMB:   formatLimit(limits.StorageBytes, 1<<20),
+		BandwidthGB: formatLimit(limits.BandwidthBytes, 1<<30),
+		SyncsPerDay: formatLimit(limits.SyncsPerDay, 1),
+	}
+	return c.renderLimits(w, r, props)
+}
+
+func (c *AdminController) renderLimits(w http.ResponseWriter, r *http.Request, props pages.AdminLimitsProps) error {
+	report, err := c.quotas.Report(r.Context(), props.User.ID, adminUsageDays)
+	if err != nil {
+		return err
+	}
+	props.Plans = c.quotas.Plans()
+	props.Usage = report
+	return pages.AdminLimits(w, r, props)
+}
+
+// UpdateLimits puts a user on a plan, replacing the limits of the plan with the ones
+// filled in. Blank limits are those of the plan.
+func (c *AdminController) UpdateLimits(w http.ResponseWriter, r *http.Request) error {
+	admin := c.admin(w, r)
+	if admin == nil {
+		return nil
+	}
+
+	user, err := c.user(w, r)
+	if user == nil {
+		return err
+	}
+
+	props := pages.AdminLimitsProps{
+		User:        user,
+		Plan:        r.FormValue("plan"),
+		Sites:       strings.TrimSpace(r.FormValue("sites")),
+		StorageMB:   strings.TrimSpace(r.FormValue("storage_mb")),
+		BandwidthGB: strings.TrimSpace(r.FormValue("bandwidth_gb")),
+		SyncsPerDay: strings.TrimSpace(r.FormValue("syncs_per_day")),
+	}
+
+	v := validator.New(
+		validator.Field("plan").Custom(func(value string) string {
+			if c.quotas.Plan(value).ID != value {
+				return "Choose a plan"
+			}
+			return ""
+		}),
+		validator.Field("sites").Custom(validateLimit),
+		validator.Field("storage_mb").Custom(validateLimit),
+		validator.Field("bandwidth_gb").Custom(validateLimit),
+		validator.Field("syncs_per_day").Custom(validateLimit),
+	)
+	ok, errs := v.ValidateData(map[string]string{
+		"plan":          props.Plan,
+		"sites":         props.Sites,
+		"storage_mb":    props.StorageMB,
+		"bandwidth_gb":  props.BandwidthGB,
+		"syncs_per_day": props.SyncsPerDay,
+	})
+	if !ok {
+		props.Errors = errs
+		return c.renderLimits(w, r, props)
+	}
+
+	before, err := c.limits.GetLimits(r.Context(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	limits := &models.UserLimits{
+		UserID:         user.ID,
+		Plan:           props.Plan,
+		Sites:          parseLimit[int](props.Sites, 1),
+		StorageBytes:   parseLimit[int64](props.StorageMB, 1<<20),
+		BandwidthBytes: parseLimit[int64](props.BandwidthGB, 1<<30),
+		SyncsPerDay:    parseLimit[int](props.SyncsPerDay, 1),
+	}
+	if err := c.limits.SetLimits(r.Context(), limits); err != nil {
+		return err
+	}
+	slog.Info("updated user limits", "user_id", user.ID, "plan", limits.Plan, "admin_id", admin.ID)
+	c.auditLog.Record(r, admin, models.AuditLimitsUpdate, models.AuditTargetUser, user.ID, audit.Diff(audit.Limits(before), audit.Limits(limits)))
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/users/%d/limits", user.ID), http.StatusSeeOther)
+	return nil
+}
+
+// validateLimit accepts a blank limit, taken from the plan, or a whole number, 0 being
+// unlimited
+func validateLimit(value string) string {
+	if value == "" {
+		return ""
+	}
+	if n, err := strconv.ParseInt(value, 10, 64); err != nil || n < 0 || n > maxLimit {
+		return fmt.Sprintf("Enter a whole number up to %d, 0 for unlimited, or leave blank for the plan's", maxLimit)
+	}
+	return ""
+}
+
+// parseLimit converts a validated limit given in units of unit, nil when blank
+func parseLimit[T int | int64](value string, unit T) *T {
+	if value == "" {
+		return nil
+	}
+	n, _ := strconv.ParseInt(value, 10, 64)
+	limit := T(n) * unit
+	return &limit
+}
+
+// formatLimit shows a limit in units of unit, blank when taken from the plan
+func formatLimit[T int | int64](limit *T, unit T) string {
+	if limit == nil {
+		return ""
+	}
+	return strconv.FormatInt(int64(*limit/unit), 10)
+}
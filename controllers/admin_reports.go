@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/frenchsoftware/libvalidator/validator"
+	"github.com/gorilla/mux"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/pages"
+)
+
+// Reports lists the open site reports, oldest first, or the resolved ones with
+// ?resolved=1
+func (c *AdminController) Reports(w http.ResponseWriter, r *http.Request) error {
+	if c.admin(w, r) == nil {
+		return nil
+	}
+	return c.renderReports(w, r, r.URL.Query().Get("resolved") != "", nil)
+}
+
+func (c *AdminController) renderReports(w http.ResponseWriter, r *http.Request, resolved bool, errs validator.ValidationErrors) error {
+	reports, err := c.reports.List(r.Context(), resolved, adminListLimit)
+	if err != nil {
+		return err
+	}
+	return pages.AdminReports(w, r, reports, resolved, errs)
+}
+
+// ResolveReport dismisses a report, leaving its site as it is
+func (c *AdminController) ResolveReport(w http.ResponseWriter, r *http.Request) error {
+	admin := c.admin(w, r)
+	if admin == nil {
+		return nil
+	}
+
+	report, err := c.report(w, r)
+	if report == nil {
+		return err
+	}
+
+	err = c.reports.Resolve(r.Context(), report.ID, admin.ID, models.ReportDismissed)
+	if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		return err
+	}
+	slog.Info("dismissed site report", "report_id", report.ID, "site_id", report.SiteID, "admin_id", admin.ID)
+	c.auditLog.Record(r, admin, models.AuditReportResolve, models.AuditTargetSiteReport, report.ID, map[string]models.AuditChange{
+		"resolution": {After: models.ReportDismissed},
+	})
+
+	http.Redirect(w, r, "/admin/reports", http.StatusSeeOther)
+	return nil
+}
+
+// SuspendReported suspends the site of a report, which resolves every open report of
+// the site
+func (c *AdminController) SuspendReported(w http.ResponseWriter, r *http.Request) error {
+	admin := c.admin(w, r)
+	if admin == nil {
+		return nil
+	}
+
+	report, err := c.report(w, r)
+	if report == nil {
+		return err
+	}
+
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if reason == "" {
+		return c.renderReports(w, r, false, validator.ValidationErrors{fmt.Sprintf("report_%d", report.ID): {"Give a reason for the suspension"}})
+	}
+
+	site, err := (*c.sites).GetByID(r.Context(), report.SiteID)
+	if err != nil {
+		return err
+	}
+	if site.SuspendedAt == nil {
+		if err := c.suspendSite(r, admin, site, reason); err != nil {
+			return err
+		}
+	} else if err := c.reports.ResolveSite(r.Context(), site.ID, admin.ID, models.ReportSuspended); err != nil {
+		return err
+	}
+	c.auditLog.Record(r, admin, models.AuditReportResolve, models.AuditTargetSiteReport, report.ID, map[string]models.AuditChange{
+		"resolution": {After: models.ReportSuspended},
+	})
+
+	http.Redirect(w, r, "/admin/reports", http.StatusSeeOther)
+	return nil
+}
+
+// report loads the report of the URL. Requests for a report that doesn't exist are
+// answered, and no report is returned.
+func (c *AdminController) report(w http.ResponseWriter, r *http.Request) (*models.SiteReport, error) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, nil
+	}
+
+	report, err := c.reports.GetByID(r.Context(), id)
+	if errors.Is(err, repositories.ErrNotFound) {
+		http.NotFound(w, r)
+		return nil, nil
+	}
+	return report, err
+}
@@ -0,0 +1,434 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/frenchsoftware/libvalidator/validator"
+	"github.com/gorilla/mux"
+	"github.com/hyperstitieux/template/audit"
+	"github.com/hyperstitieux/template/auth"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/deploy"
+	"github.com/hyperstitieux/template/quota"
+	"github.com/hyperstitieux/template/router"
+)
+
+const (
+	// defaultAPILogsLimit and maxAPILogsLimit bound the log entries of one API response
+	defaultAPILogsLimit = 100
+	maxAPILogsLimit     = 500
+	// defaultAPIDeploymentsLimit and maxAPIDeploymentsLimit bound the deployments of
+	// one API response
+	defaultAPIDeploymentsLimit = 20
+	maxAPIDeploymentsLimit     = 100
+)
+
+var (
+	errSiteNotFound       = router.NewHTTPError(http.StatusNotFound, "site not found")
+	errDeploymentNotFound = router.NewHTTPError(http.StatusNotFound, "deployment not found")
+	errSiteSuspended      = router.NewHTTPError(http.StatusConflict, "the site is suspended")
+)
+
+type SitesAPIController interface {
+	List(w http.ResponseWriter, r *http.Request) error
+	Create(w http.ResponseWriter, r *http.Request) error
+	Show(w http.ResponseWriter, r *http.Request) error
+	Update(w http.ResponseWriter, r *http.Request) error
+	Delete(w http.ResponseWriter, r *http.Request) error
+	Resync(w http.ResponseWriter, r *http.Request) error
+	Deployments(w http.ResponseWriter, r *http.Request) error
+	Deployment(w http.ResponseWriter, r *http.Request) error
+	Logs(w http.ResponseWriter, r *http.Request) error
+}
+
+type sitesAPIController struct {
+	sites         *repositories.SitesRepository
+	logs          repositories.SiteLogsRepository
+	deployments   repositories.DeploymentsRepository
+	deployRunner  *deploy.Runner
+	organizations repositories.OrganizationsRepository
+	auditLog      *audit.Log
+	quotas        *quota.Quotas
+}
+
+// NewSitesAPIController serves the sites of the token's user and of their
+// organizations as JSON under /api/v1
+func NewSitesAPIController(sites *repositories.SitesRepository, logs repositories.SiteLogsRepository, deployments repositories.DeploymentsRepository, deployRunner *deploy.Runner, organizations repositories.OrganizationsRepository, auditLog *audit.Log, quotas *quota.Quotas) SitesAPIController {
+	return &sitesAPIController{
+		sites:         sites,
+		logs:          logs,
+		deployments:   deployments,
+		deployRunner:  deployRunner,
+		organizations: organizations,
+		auditLog:      auditLog,
+		quotas:        quotas,
+	}
+}
+
+// siteRequest is the body of site creations and updates. Fields left out of an
+// update keep their value. Sites created without an organization are personal.
+type siteRequest struct {
+	OrganizationID *int64  `json:"organization_id"`
+	Slug           *string `json:"slug"`
+	GithubRepo     *string `json:"github_repo"`
+	GithubBranch   *string `json:"github_branch"`
+	Subdirectory   *string `json:"subdirectory"`
+}
+
+// List returns the sites of the user and of their organizations
+func (c *sitesAPIController) List(w http.ResponseWriter, r *http.Request) error {
+	if err := requireScope(r, models.ScopeSitesRead); err != nil {
+		return err
+	}
+
+	sites, err := (*c.sites).GetAccessibleByUserID(r.Context(), int(auth.GetCurrentUser(r).ID))
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, map[string]any{"sites": sites})
+}
+
+// Create creates a site, with the same rules as the new site form
+func (c *sitesAPIController) Create(w http.ResponseWriter, r *http.Request) error {
+	if err := requireScope(r, models.ScopeSitesWrite); err != nil {
+		return err
+	}
+
+	var body siteRequest
+	if err := readJSON(w, r, &body); err != nil {
+		return err
+	}
+
+	slug, githubRepo := deref(body.Slug), deref(body.GithubRepo)
+	githubBranch, subdirectory := deref(body.GithubBranch), deref(body.Subdirectory)
+
+	errs := make(validator.ValidationErrors)
+	switch {
+	case slug == "":
+		errs.Add("slug", "Slug is required")
+	case len(slug) > 50:
+		errs.Add("slug", "Slug must be at most 50 characters")
+	}
+	if githubRepo == "" {
+		errs.Add("github_repo", "Repository is required")
+	}
+	if githubBranch == "" {
+		errs.Add("github_branch", "Branch is required")
+	}
+	if errs.IsEmpty() {
+		errs = siteErrors(slug, githubRepo, githubBranch, subdirectory)
+	}
+	user := auth.GetCurrentUser(r)
+	if body.OrganizationID != nil {
+		allowed, err := canCreateSiteFor(r.Context(), c.organizations, *body.OrganizationID, user.ID)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			errs.Add("organization_id", "You can't create sites for this organization")
+		}
+	}
+	if !errs.IsEmpty() {
+		return errInvalidSite(errs)
+	}
+
+	var exceeded *quota.ExceededError
+	if err := c.quotas.CheckSites(r.Context(), user.ID); errors.As(err, &exceeded) {
+		return router.NewHTTPError(http.StatusForbidden, exceeded.Message)
+	} else if err != nil {
+		return err
+	}
+
+	site, err := (*c.sites).Create(r.Context(), int(user.ID), body.OrganizationID, slug, githubRepo, githubBranch, subdirectory)
+	if errors.Is(err, repositories.ErrConflict) {
+		return errInvalidSite(validator.ValidationErrors{"slug": {"This slug is already taken"}})
+	}
+	if err != nil {
+		return err
+	}
+	c.auditLog.Record(r, user, models.AuditSiteCreate, models.AuditTargetSite, site.ID, audit.Diff(nil, audit.Site(site)))
+
+	w.Header().Set("Location", "/api/v1/sites/"+strconv.Itoa(site.ID))
+	return writeJSONStatus(w, http.StatusCreated, site)
+}
+
+// Show returns one of the user's sites
+func (c *sitesAPIController) Show(w http.ResponseWriter, r *http.Request) error {
+	if err := requireScope(r, models.ScopeSitesRead); err != nil {
+		return err
+	}
+
+	site, err := c.authorizedSite(r, siteReadRole)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, site)
+}
+
+// Update changes the repository, branch or subdirectory of a site. The slug is the
+// site's address and can't change.
+func (c *sitesAPIController) Update(w http.ResponseWriter, r *http.Request) error {
+	if err := requireScope(r, models.ScopeSitesWrite); err != nil {
+		return err
+	}
+
+	site, err := c.authorizedSite(r, siteWriteRole)
+	if err != nil {
+		return err
+	}
+
+	var body siteRequest
+	if err := readJSON(w, r, &body); err != nil {
+		return err
+	}
+	before := audit.Site(site)
+
+	errs := make(validator.ValidationErrors)
+	if body.Slug != nil && *body.Slug != site.Slug {
+		errs.Add("slug", "The slug of a site can't be changed")
+	}
+	if body.OrganizationID != nil && (site.OrganizationID == nil || *body.OrganizationID != *site.OrganizationID) {
+		errs.Add("organization_id", "The owner of a site can't be changed")
+	}
+	if body.GithubRepo != nil {
+		if !repoPattern.MatchString(*body.GithubRepo) {
+			errs.Add("github_repo", "Invalid repository format (use: username/repository)")
+		}
+		site.GithubRepo = *body.GithubRepo
+	}
+	if body.GithubBranch != nil {
+		switch {
+		case *body.GithubBranch == "":
+			errs.Add("github_branch", "Branch is required")
+		case !validBranch(*body.GithubBranch):
+			errs.Add("github_branch", "Invalid branch name")
+		}
+		site.GithubBranch = *body.GithubBranch
+	}
+	if body.Subdirectory != nil {
+		if !validSubdirectory(*body.Subdirectory) {
+			errs.Add("subdirectory", "Subdirectory must be a path inside the repository, like docs or site/content")
+		}
+		site.Subdirectory = *body.Subdirectory
+	}
+	if !errs.IsEmpty() {
+		return errInvalidSite(errs)
+	}
+
+	if err := (*c.sites).Update(r.Context(), site); err != nil {
+		return err
+	}
+	if changes := audit.Diff(before, audit.Site(site)); len(changes) > 0 {
+		c.auditLog.Record(r, auth.GetCurrentUser(r), models.AuditSiteUpdate, models.AuditTargetSite, site.ID, changes)
+	}
+
+	return writeJSON(w, site)
+}
+
+// Delete deletes one of the user's sites
+func (c *sitesAPIController) Delete(w http.ResponseWriter, r *http.Request) error {
+	if err := requireScope(r, models.ScopeSitesWrite); err != nil {
+		return err
+	}
+
+	site, err := c.authorizedSite(r, siteManageRole)
+	if err != nil {
+		return err
+	}
+
+	if err := (*c.sites).Delete(r.Context(), site.ID); err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		return err
+	}
+	c.auditLog.Record(r, auth.GetCurrentUser(r), models.AuditSiteDelete, models.AuditTargetSite, site.ID, audit.Diff(audit.Site(site), nil))
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// Resync starts a deployment of the site, or returns the one already running
+func (c *sitesAPIController) Resync(w http.ResponseWriter, r *http.Request) error {
+	if err := requireScope(r, models.ScopeSitesWrite); err != nil {
+		return err
+	}
+
+	site, err := c.authorizedSite(r, siteWriteRole)
+	if err != nil {
+		return err
+	}
+
+	deployment, err := c.deployRunner.Start(r.Context(), site, models.DeploymentTriggerAPI)
+	if errors.Is(err, deploy.ErrSuspended) {
+		return errSiteSuspended
+	}
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		return router.NewHTTPError(http.StatusTooManyRequests, exceeded.Message)
+	}
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Location", "/api/v1/sites/"+strconv.Itoa(site.ID)+"/deployments/"+strconv.Itoa(deployment.ID))
+	return writeJSONStatus(w, http.StatusAccepted, deployment)
+}
+
+// Deployments returns the most recent deployments of a site, newest first
+func (c *sitesAPIController) Deployments(w http.ResponseWriter, r *http.Request) error {
+	if err := requireScope(r, models.ScopeSitesRead); err != nil {
+		return err
+	}
+
+	site, err := c.authorizedSite(r, siteReadRole)
+	if err != nil {
+		return err
+	}
+
+	limit, err := queryLimit(r, defaultAPIDeploymentsLimit, maxAPIDeploymentsLimit)
+	if err != nil {
+		return err
+	}
+
+	deployments, err := c.deployments.GetBySiteID(r.Context(), site.ID, limit)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, map[string]any{"deployments": deployments})
+}
+
+// Deployment returns one deployment of a site, to follow its progress
+func (c *sitesAPIController) Deployment(w http.ResponseWriter, r *http.Request) error {
+	if err := requireScope(r, models.ScopeSitesRead); err != nil {
+		return err
+	}
+
+	site, err := c.authorizedSite(r, siteReadRole)
+	if err != nil {
+		return err
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["deployment"])
+	if err != nil {
+		return errDeploymentNotFound
+	}
+	deployment, err := c.deployments.GetByID(r.Context(), id)
+	if errors.Is(err, repositories.ErrNotFound) || (err == nil && deployment.SiteID != site.ID) {
+		return errDeploymentNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, deployment)
+}
+
+// Logs returns the most recent log entries of a site, newest first, optionally of
+// one severity
+func (c *sitesAPIController) Logs(w http.ResponseWriter, r *http.Request) error {
+	if err := requireScope(r, models.ScopeSitesRead); err != nil {
+		return err
+	}
+
+	site, err := c.authorizedSite(r, siteReadRole)
+	if err != nil {
+		return err
+	}
+
+	level := r.URL.Query().Get("level")
+	if level != "" && !slices.Contains(models.LogLevels, level) {
+		return router.NewHTTPError(http.StatusBadRequest, "level must be one of "+strings.Join(models.LogLevels, ", "))
+	}
+
+	limit, err := queryLimit(r, defaultAPILogsLimit, maxAPILogsLimit)
+	if err != nil {
+		return err
+	}
+
+	logs, err := c.logs.GetBySiteID(r.Context(), site.ID, level, limit)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, map[string]any{"logs": logs})
+}
+
+// authorizedSite loads the site from the URL and checks the user has at least the
+// role on it. Sites the user has no role on are reported as not found, like sites
+// that don't exist.
+func (c *sitesAPIController) authorizedSite(r *http.Request, min string) (*models.Site, error) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		return nil, errSiteNotFound
+	}
+
+	site, err := (*c.sites).GetByID(r.Context(), id)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, errSiteNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := siteRole(r.Context(), c.organizations, site, auth.GetCurrentUser(r).ID)
+	if err != nil {
+		return nil, err
+	}
+	if role == "" {
+		return nil, errSiteNotFound
+	}
+	if !models.RoleAtLeast(role, min) {
+		return nil, router.NewHTTPError(http.StatusForbidden, "your role on this site doesn't allow this")
+	}
+
+	return site, nil
+}
+
+// requireScope refuses requests made with a token that wasn't granted the scope
+func requireScope(r *http.Request, scope string) error {
+	token := auth.GetAPIToken(r)
+	if token == nil || !token.HasScope(scope) {
+		return router.NewHTTPError(http.StatusForbidden, "this token is missing the "+scope+" scope")
+	}
+	return nil
+}
+
+// errInvalidSite reports the fields of a site request that didn't validate
+func errInvalidSite(errs validator.ValidationErrors) error {
+	return router.NewHTTPError(http.StatusUnprocessableEntity, "invalid site").WithDetails(errs)
+}
+
+// queryLimit reads the limit query parameter, capped at max
+func queryLimit(r *http.Request, fallback, max int) (int, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return fallback, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 {
+		return 0, router.NewHTTPError(http.StatusBadRequest, "limit must be a positive number")
+	}
+	return min(limit, max), nil
+}
+
+// writeJSONStatus writes a JSON response with a status other than 200
+func writeJSONStatus(w http.ResponseWriter, status int, v any) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(v)
+}
+
+// deref returns the value of a string pointer, or "" if nil
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
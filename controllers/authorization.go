@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+)
+
+// Roles needed on a site for each kind of action
+const (
+	// siteReadRole sees the site, its logs, deployments and link checks
+	siteReadRole = models.RoleViewer
+	// siteWriteRole syncs the site, checks its links and changes its repository
+	siteWriteRole = models.RoleEditor
+	// siteManageRole creates sites for an organization and deletes them
+	siteManageRole = models.RoleAdmin
+	// siteTransferRole gives the site away to another user or organization
+	siteTransferRole = models.RoleOwner
+)
+
+// siteRole returns the role of a user on a site: owner of their personal sites, and
+// their role in the organization owning the others. An empty role grants nothing.
+func siteRole(ctx context.Context, organizations repositories.OrganizationsRepository, site *models.Site, userID int64) (string, error) {
+	if site.OrganizationID == nil {
+		if site.UserID == int(userID) {
+			return models.RoleOwner, nil
+		}
+		return "", nil
+	}
+
+	role, err := organizations.GetRole(ctx, *site.OrganizationID, userID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return "", nil
+	}
+	return role, err
+}
+
+// canReceiveTransfer tells whether a user may accept or decline a site transfer: its
+// recipient, or the admins of the recipient organization
+func canReceiveTransfer(ctx context.Context, organizations repositories.OrganizationsRepository, transfer *models.SiteTransfer, userID int64) (bool, error) {
+	if transfer.ToUserID != nil {
+		return *transfer.ToUserID == userID, nil
+	}
+	return canCreateSiteFor(ctx, organizations, *transfer.ToOrganizationID, userID)
+}
+
+// canCreateSiteFor tells whether a user may create sites owned by the organization
+func canCreateSiteFor(ctx context.Context, organizations repositories.OrganizationsRepository, organizationID, userID int64) (bool, error) {
+	role, err := organizations.GetRole(ctx, organizationID, userID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return models.RoleAtLeast(role, siteManageRole), nil
+}
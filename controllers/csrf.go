@@ -0,0 +1,21 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/hyperstitieux/template/pages"
+	"github.com/hyperstitieux/template/router"
+)
+
+// errCSRF is what scripts are told when their CSRF token doesn't match
+var errCSRF = router.NewHTTPError(http.StatusForbidden, "This page expired, reload it and try again")
+
+// CSRFFailure answers requests refused by the CSRF middleware: an error page for
+// forms, and a JSON error for scripts
+func CSRFFailure(w http.ResponseWriter, r *http.Request) error {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return errCSRF
+	}
+	return pages.CSRFError(w, r)
+}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/hyperstitieux/template/database/models"
+	githubpkg "github.com/hyperstitieux/template/github"
+	"golang.org/x/oauth2"
+)
+
+type GitHubOAuthController interface {
+	Redirect(w http.ResponseWriter, r *http.Request) error
+	Callback(w http.ResponseWriter, r *http.Request) error
+}
+
+type githubOAuthController struct {
+	accounts    *Accounts
+	oauthConfig *oauth2.Config
+	apiURL      string
+}
+
+func NewGitHubOAuthController(accounts *Accounts, oauthConfig *oauth2.Config, apiURL string) GitHubOAuthController {
+	return &githubOAuthController{
+		accounts:    accounts,
+		oauthConfig: oauthConfig,
+		apiURL:      apiURL,
+	}
+}
+
+// Redirect initiates the OAuth2 flow by redirecting to GitHub
+func (c *githubOAuthController) Redirect(w http.ResponseWriter, r *http.Request) error {
+	return beginOAuth(w, r, c.oauthConfig)
+}
+
+// Callback handles the OAuth2 callback from GitHub
+func (c *githubOAuthController) Callback(w http.ResponseWriter, r *http.Request) error {
+	token, redirectTo, err := finishOAuth(w, r, c.oauthConfig)
+	if err != nil {
+		return err
+	}
+
+	client := githubpkg.NewClient(c.apiURL, c.oauthConfig.Client(r.Context(), token))
+
+	user, err := client.User(r.Context())
+	if err != nil {
+		return fmt.Errorf("failed to get github user: %w", err)
+	}
+
+	// The public profile email may be hidden, the emails endpoint tells the primary one
+	// and whether GitHub verified it
+	email, verified, err := client.PrimaryEmail(r.Context())
+	if err != nil {
+		return fmt.Errorf("failed to get github email: %w", err)
+	}
+	if email == "" {
+		email, verified = user.Email, false
+	}
+
+	return c.accounts.signIn(w, r, &oauthProfile{
+		Provider:       models.ProviderGitHub,
+		ProviderName:   "GitHub",
+		ProviderUserID: strconv.FormatInt(user.ID, 10),
+		Email:          email,
+		VerifiedEmail:  verified,
+		Name:           user.Name,
+		Username:       user.Login,
+		Picture:        user.AvatarURL,
+		AccessToken:    token.AccessToken,
+	}, redirectTo)
+}
@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hyperstitieux/template/auth"
+	"github.com/hyperstitieux/template/database/models"
+	githubpkg "github.com/hyperstitieux/template/github"
+	"golang.org/x/oauth2"
+)
+
+// fakeGitHub serves the token endpoint and the API calls of a GitHub sign in, for the
+// account and primary email it is given
+type fakeGitHub struct {
+	*httptest.Server
+	user  githubpkg.User
+	email githubpkg.Email
+}
+
+func newFakeGitHub(t *testing.T) *fakeGitHub {
+	t.Helper()
+
+	f := &fakeGitHub{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "code" {
+			http.Error(w, `{"error":"bad_verification_code"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"gho_token","token_type":"bearer"}`))
+	})
+	mux.HandleFunc("GET /user", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(f.user)
+	})
+	mux.HandleFunc("GET /user/emails", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]githubpkg.Email{f.email})
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+// callback returns from GitHub to the callback with a valid state, as the current
+// user if not nil
+func (f *fakeGitHub) callback(t *testing.T, controller GitHubOAuthController, current *models.User) *http.Response {
+	t.Helper()
+
+	r := httptest.NewRequest("GET", "/auth/github/callback?state=state&code=code", nil)
+	r.AddCookie(&http.Cookie{Name: stateCookieName, Value: "state"})
+	r.AddCookie(&http.Cookie{Name: redirectCookieName, Value: "/sites"})
+	if current != nil {
+		r = auth.SetCurrentUser(r, current)
+	}
+
+	w := httptest.NewRecorder()
+	if err := controller.Callback(w, r); err != nil {
+		t.Fatal(err)
+	}
+	return w.Result()
+}
+
+func TestGitHubCallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    githubpkg.Email
+		existing bool // Whether a user already has the address
+		verified bool // Whether that user verified it
+		linked   bool // Whether the GitHub account is linked to that user already
+		signedIn bool // Whether that user is signed in
+		status   int
+		signsIn  string // Email of the user signed in, if any
+		linksTo  string // Email of the user the GitHub account ends up linked to, if any
+	}{
+		{
+			name:    "new user",
+			email:   githubpkg.Email{Email: "alice@example.com", Primary: true, Verified: true},
+			status:  http.StatusSeeOther,
+			signsIn: "alice@example.com",
+			linksTo: "alice@example.com",
+		},
+		{
+			name:     "linked identity",
+			email:    githubpkg.Email{Email: "other@example.com", Primary: true, Verified: true},
+			existing: true,
+			verified: true,
+			linked:   true,
+			status:   http.StatusSeeOther,
+			signsIn:  "alice@example.com",
+			linksTo:  "alice@example.com",
+		},
+		{
+			name:     "verified on both sides links by email",
+			email:    githubpkg.Email{Email: "alice@example.com", Primary: true, Verified: true},
+			existing: true,
+			verified: true,
+			status:   http.StatusSeeOther,
+			signsIn:  "alice@example.com",
+			linksTo:  "alice@example.com",
+		},
+		{
+			name:     "unverified on github",
+			email:    githubpkg.Email{Email: "alice@example.com", Primary: true, Verified: false},
+			existing: true,
+			verified: true,
+			status:   http.StatusConflict,
+		},
+		{
+			name:     "unverified on our side",
+			email:    githubpkg.Email{Email: "alice@example.com", Primary: true, Verified: true},
+			existing: true,
+			verified: false,
+			status:   http.StatusConflict,
+		},
+		{
+			name:     "signed in links to the current user",
+			email:    githubpkg.Email{Email: "other@example.com", Primary: true, Verified: true},
+			existing: true,
+			verified: true,
+			signedIn: true,
+			status:   http.StatusSeeOther,
+			linksTo:  "alice@example.com",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accounts := newTestAccounts(t)
+			github := newFakeGitHub(t)
+			github.user = githubpkg.User{ID: 42, Login: "alice", Name: "Alice"}
+			github.email = tt.email
+			controller := NewGitHubOAuthController(accounts.Accounts, &oauth2.Config{
+				ClientID:     "client",
+				ClientSecret: "secret",
+				Endpoint:     oauth2.Endpoint{TokenURL: github.URL + "/login/oauth/access_token"},
+			}, github.URL)
+
+			var current *models.User
+			if tt.existing {
+				alice := accounts.createUser(t, "alice@example.com", tt.verified)
+				if tt.linked {
+					accounts.link(t, alice, models.ProviderGitHub, "42")
+				}
+				if tt.signedIn {
+					current = alice
+				}
+			}
+
+			resp := github.callback(t, controller, current)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if tt.status == http.StatusSeeOther && resp.Header.Get("Location") != "/sites" {
+				t.Errorf("redirected to %q, want /sites", resp.Header.Get("Location"))
+			}
+
+			signedIn := accounts.sessionUser(t, resp)
+			switch {
+			case tt.signsIn == "" && signedIn != nil:
+				t.Errorf("signed in as %s, want no session", signedIn.Email)
+			case tt.signsIn != "" && (signedIn == nil || signedIn.Email != tt.signsIn):
+				t.Errorf("signed in as %v, want %s", signedIn, tt.signsIn)
+			}
+
+			owner := accounts.identityOwner(t, models.ProviderGitHub, "42")
+			if tt.linksTo == "" {
+				if owner != 0 {
+					t.Errorf("github account linked to user %d, want unlinked", owner)
+				}
+				return
+			}
+			user, err := accounts.users.GetUserByEmail(t.Context(), tt.linksTo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if owner != user.ID {
+				t.Errorf("github account linked to user %d, want %d", owner, user.ID)
+			}
+		})
+	}
+}
+
+func TestGitHubCallbackIdentityTaken(t *testing.T) {
+	accounts := newTestAccounts(t)
+	github := newFakeGitHub(t)
+	github.user = githubpkg.User{ID: 42, Login: "bob"}
+	github.email = githubpkg.Email{Email: "bob@example.com", Primary: true, Verified: true}
+	controller := NewGitHubOAuthController(accounts.Accounts, &oauth2.Config{
+		Endpoint: oauth2.Endpoint{TokenURL: github.URL + "/login/oauth/access_token"},
+	}, github.URL)
+
+	alice := accounts.createUser(t, "alice@example.com", true)
+	bob := accounts.createUser(t, "bob@example.com", true)
+	accounts.link(t, bob, models.ProviderGitHub, "42")
+
+	resp := github.callback(t, controller, alice)
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusConflict)
+	}
+	if owner := accounts.identityOwner(t, models.ProviderGitHub, "42"); owner != bob.ID {
+		t.Errorf("github account linked to user %d, want %d", owner, bob.ID)
+	}
+}
+
+func TestGitHubCallbackState(t *testing.T) {
+	accounts := newTestAccounts(t)
+	github := newFakeGitHub(t)
+	controller := NewGitHubOAuthController(accounts.Accounts, &oauth2.Config{
+		Endpoint: oauth2.Endpoint{TokenURL: github.URL + "/login/oauth/access_token"},
+	}, github.URL)
+
+	tests := []struct {
+		name   string
+		query  string
+		cookie string
+	}{
+		{"no cookie", "?state=state&code=code", ""},
+		{"other state", "?state=other&code=code", "state"},
+		{"no code", "?state=state", "state"},
+		{"bad code", "?state=state&code=bad", "state"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/auth/github/callback"+tt.query, nil)
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: stateCookieName, Value: tt.cookie})
+			}
+			w := httptest.NewRecorder()
+			if err := controller.Callback(w, r); err == nil {
+				t.Fatal("callback succeeded")
+			}
+			if user := accounts.sessionUser(t, w.Result()); user != nil {
+				t.Errorf("signed in as %s", user.Email)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/frenchsoftware/libvalidator/validator"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/mail"
+	"github.com/hyperstitieux/template/pages"
+	"github.com/hyperstitieux/template/router"
+)
+
+const (
+	// magicLinkDuration is how long a sign in link works
+	magicLinkDuration = 15 * time.Minute
+	// magicLinkWindow is the period the rate limits below apply to
+	magicLinkWindow = time.Hour
+	// magicLinksPerEmail and magicLinksPerIP limit the links sent per window, so the
+	// form can't be used to flood an inbox or send mail in bulk
+	magicLinksPerEmail = 5
+	magicLinksPerIP    = 20
+)
+
+type MagicLinkController interface {
+	Request(w http.ResponseWriter, r *http.Request) error
+	Confirm(w http.ResponseWriter, r *http.Request) error
+	Verify(w http.ResponseWriter, r *http.Request) error
+}
+
+type magicLinkController struct {
+	accounts  *Accounts
+	links     repositories.MagicLinksRepository
+	mailer    mail.Sender
+	baseURL   string
+	providers []pages.SignInProvider
+}
+
+func NewMagicLinkController(accounts *Accounts, links repositories.MagicLinksRepository, mailer mail.Sender, baseURL string, providers []pages.SignInProvider) MagicLinkController {
+	return &magicLinkController{
+		accounts:  accounts,
+		links:     links,
+		mailer:    mailer,
+		baseURL:   baseURL,
+		providers: providers,
+	}
+}
+
+// Request emails a sign in link to the address entered on the sign in page
+func (c *magicLinkController) Request(w http.ResponseWriter, r *http.Request) error {
+	v := validator.New(
+		validator.Field("email").Required().IsValidEmail().MaxLength(254),
+	)
+
+	email := strings.ToLower(strings.TrimSpace(r.FormValue("email")))
+	redirectTo := safeRedirect(r.FormValue("redirect"))
+
+	ok, errs := v.ValidateData(map[string]string{"email": email})
+	if !ok {
+		return c.renderSignIn(w, r, email, errs)
+	}
+
+	byEmail, byIP, err := c.links.CountSince(r.Context(), email, router.ClientIP(r), time.Now().Add(-magicLinkWindow))
+	if err != nil {
+		return err
+	}
+	if byEmail >= magicLinksPerEmail || byIP >= magicLinksPerIP {
+		errs := make(validator.ValidationErrors)
+		errs.Add("email", "Too many sign in links were requested, try again in an hour")
+		return c.renderSignIn(w, r, email, errs)
+	}
+
+	token, err := generateRandomToken(32)
+	if err != nil {
+		return fmt.Errorf("failed to generate magic link token: %w", err)
+	}
+
+	link := &models.MagicLink{
+		Email:      email,
+		TokenHash:  repositories.HashToken(token),
+		IP:         router.ClientIP(r),
+		RedirectTo: redirectTo,
+		ExpiresAt:  time.Now().Add(magicLinkDuration),
+	}
+	if err := c.links.Create(r.Context(), link); err != nil {
+		return err
+	}
+
+	// Sent right away rather than through the job queue, whose payloads would keep
+	// the token in clear in the database
+	err = c.mailer.Send(r.Context(), &mail.Message{
+		To:      email,
+		Subject: "Sign in to Internet Publishing",
+		Body: "Follow this link to sign in to Internet Publishing:\n\n" +
+			c.baseURL + "/auth/email/verify?token=" + url.QueryEscape(token) + "\n\n" +
+			fmt.Sprintf("The link works once and expires in %d minutes. If you didn't ask for it, you can ignore this email.\n", int(magicLinkDuration.Minutes())),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send magic link: %w", err)
+	}
+
+	return pages.MagicLinkSent(w, r, email)
+}
+
+// Confirm asks to confirm the sign in. Following the link doesn't use it up, as mail
+// scanners open links before the recipient does.
+func (c *magicLinkController) Confirm(w http.ResponseWriter, r *http.Request) error {
+	return pages.ConfirmMagicLink(w, r, r.URL.Query().Get("token"))
+}
+
+// Verify uses up the sign in link and signs its recipient in, as their own user even
+// if someone else is signed in
+func (c *magicLinkController) Verify(w http.ResponseWriter, r *http.Request) error {
+	link, err := c.links.Consume(r.Context(), repositories.HashToken(r.FormValue("token")), time.Now())
+	if errors.Is(err, repositories.ErrNotFound) {
+		errs := make(validator.ValidationErrors)
+		errs.Add("email", "This sign in link is invalid, expired or was already used. Request a new one.")
+		return c.renderSignIn(w, r, "", errs)
+	}
+	if err != nil {
+		return err
+	}
+
+	name, _, _ := strings.Cut(link.Email, "@")
+	return c.accounts.signInWithoutLinking(w, r, &oauthProfile{
+		Provider:       models.ProviderEmail,
+		ProviderName:   "Email",
+		ProviderUserID: link.Email,
+		Email:          link.Email,
+		VerifiedEmail:  true, // Following the link proves the address
+		Name:           name,
+	}, safeRedirect(link.RedirectTo))
+}
+
+func (c *magicLinkController) renderSignIn(w http.ResponseWriter, r *http.Request, email string, errs validator.ValidationErrors) error {
+	return pages.SignIn(w, r, pages.SignInProps{
+		Providers:   c.providers,
+		EmailSignIn: true,
+		Email:       email,
+		Errors:      errs,
+	})
+}
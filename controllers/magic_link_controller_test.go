@@ -0,0 +1,249 @@
+package controllers
+
+import (
+	"context"
+	"io"
+	"mime/quotedprintable"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperstitieux/template/auth"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/mail"
+	"github.com/hyperstitieux/template/mail/mailtest"
+)
+
+var magicLinkPattern = regexp.MustCompile(`http://localhost:8080/auth/email/verify\?token=(\S+)`)
+
+type testMagicLinks struct {
+	*testAccounts
+	controller MagicLinkController
+	smtp       *mailtest.Server
+}
+
+func newTestMagicLinks(t *testing.T) *testMagicLinks {
+	t.Helper()
+
+	smtp, err := mailtest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { smtp.Close() })
+
+	mailer, err := mail.New(mail.Config{Driver: mail.DriverSMTP, From: "hello@example.com", SMTPAddr: smtp.Addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accounts := newTestAccounts(t)
+	links := repositories.NewMagicLinksRepository(accounts.db)
+	return &testMagicLinks{
+		testAccounts: accounts,
+		controller:   NewMagicLinkController(accounts.Accounts, links, mailer, "http://localhost:8080", nil),
+		smtp:         smtp,
+	}
+}
+
+// request asks for a sign in link for email and returns the token it was mailed
+func (m *testMagicLinks) request(t *testing.T, email string) string {
+	t.Helper()
+
+	sent := len(m.smtp.Messages())
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/auth/email", strings.NewReader(url.Values{"email": {email}, "redirect": {"/sites"}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := m.controller.Request(w, r); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := m.smtp.Messages()
+	if len(messages) != sent+1 {
+		t.Fatalf("%d emails sent, want 1", len(messages)-sent)
+	}
+	message := messages[len(messages)-1]
+	// Addresses are entered in any case, with stray spaces
+	if want := strings.ToLower(strings.TrimSpace(email)); len(message.To) != 1 || message.To[0] != want {
+		t.Fatalf("email sent to %v, want %s", message.To, want)
+	}
+
+	_, body, _ := strings.Cut(message.Data, "\r\n\r\n")
+	decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	match := magicLinkPattern.FindStringSubmatch(string(decoded))
+	if match == nil {
+		t.Fatalf("no sign in link in:\n%s", decoded)
+	}
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// verify posts the token of a link from the confirmation page, as the current user if
+// not nil
+func (m *testMagicLinks) verify(t *testing.T, token string, current *models.User, sessionToken string) *http.Response {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/auth/email/verify", strings.NewReader(url.Values{"token": {token}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if sessionToken != "" {
+		r.AddCookie(&http.Cookie{Name: auth.SessionCookieName, Value: sessionToken})
+	}
+	if current != nil {
+		r = auth.SetCurrentUser(r, current)
+	}
+	if err := m.controller.Verify(w, r); err != nil {
+		t.Fatal(err)
+	}
+	return w.Result()
+}
+
+func TestMagicLinkSignIn(t *testing.T) {
+	m := newTestMagicLinks(t)
+	token := m.request(t, "Alice@Example.com ")
+
+	// Opening the link only asks to confirm, mail scanners following it don't use it up
+	w := httptest.NewRecorder()
+	if err := m.controller.Confirm(w, httptest.NewRequest("GET", "/auth/email/verify?token="+url.QueryEscape(token), nil)); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `name="token"`) {
+		t.Fatalf("confirmation page: status %d, body:\n%s", w.Code, w.Body.String())
+	}
+	if user := m.sessionUser(t, w.Result()); user != nil {
+		t.Fatalf("opening the link signed in as %s", user.Email)
+	}
+
+	resp := m.verify(t, token, nil, "")
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/sites" {
+		t.Fatalf("verify: status %d to %q, want %d to /sites", resp.StatusCode, resp.Header.Get("Location"), http.StatusSeeOther)
+	}
+	user := m.sessionUser(t, resp)
+	if user == nil || user.Email != "alice@example.com" || !user.VerifiedEmail {
+		t.Fatalf("signed in as %+v, want alice@example.com verified", user)
+	}
+
+	// Links work once
+	resp = m.verify(t, token, nil, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("second verify: status %d, want the sign in page", resp.StatusCode)
+	}
+	if user := m.sessionUser(t, resp); user != nil {
+		t.Fatalf("used link signed in as %s", user.Email)
+	}
+}
+
+func TestMagicLinkInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  func(m *testMagicLinks, token string) string
+		before func(t *testing.T, m *testMagicLinks)
+	}{
+		{
+			name:  "unknown token",
+			token: func(m *testMagicLinks, token string) string { return token + "x" },
+		},
+		{
+			name:  "empty token",
+			token: func(m *testMagicLinks, token string) string { return "" },
+		},
+		{
+			name:  "expired",
+			token: func(m *testMagicLinks, token string) string { return token },
+			before: func(t *testing.T, m *testMagicLinks) {
+				_, err := m.db.ExecContext(context.Background(), `UPDATE magic_links SET expires_at = ?`, "2000-01-01 00:00:00")
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMagicLinks(t)
+			token := m.request(t, "alice@example.com")
+			if tt.before != nil {
+				tt.before(t, m)
+			}
+
+			resp := m.verify(t, tt.token(m, token), nil, "")
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d, want the sign in page", resp.StatusCode)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if !strings.Contains(string(body), "invalid, expired or was already used") {
+				t.Errorf("sign in page doesn't explain the link doesn't work:\n%s", body)
+			}
+			if user := m.sessionUser(t, resp); user != nil {
+				t.Errorf("signed in as %s", user.Email)
+			}
+		})
+	}
+}
+
+func TestMagicLinkNeverLinksCurrentUser(t *testing.T) {
+	m := newTestMagicLinks(t)
+	bob := m.createUser(t, "bob@example.com", true)
+	alice := m.createUser(t, "alice@example.com", true)
+
+	// Bob is signed in when he follows a link mailed to Alice
+	now := time.Now()
+	session := &models.Session{UserID: bob.ID, ExpiresAt: now.Add(time.Hour), MaxExpiresAt: now.Add(time.Hour)}
+	if err := m.users.CreateSession(context.Background(), session, "bob-session"); err != nil {
+		t.Fatal(err)
+	}
+
+	token := m.request(t, "alice@example.com")
+	resp := m.verify(t, token, bob, "bob-session")
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusSeeOther)
+	}
+
+	if user := m.sessionUser(t, resp); user == nil || user.ID != alice.ID {
+		t.Fatalf("signed in as %+v, want alice", user)
+	}
+	if owner := m.identityOwner(t, models.ProviderEmail, "alice@example.com"); owner != alice.ID {
+		t.Errorf("alice@example.com linked to user %d, want alice (%d)", owner, alice.ID)
+	}
+	identities, err := m.identities.GetByUserID(context.Background(), bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 0 {
+		t.Errorf("bob got identities %+v", identities)
+	}
+	if _, err := m.users.GetSessionByToken(context.Background(), "bob-session"); err == nil {
+		t.Error("bob's session was kept")
+	}
+}
+
+func TestMagicLinkRateLimit(t *testing.T) {
+	m := newTestMagicLinks(t)
+	for range magicLinksPerEmail {
+		m.request(t, "alice@example.com")
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/auth/email", strings.NewReader("email=alice%40example.com"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := m.controller.Request(w, r); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(w.Body.String(), "Too many sign in links") {
+		t.Errorf("sign in page doesn't refuse another link:\n%s", w.Body.String())
+	}
+	if sent := len(m.smtp.Messages()); sent != magicLinksPerEmail {
+		t.Errorf("%d emails sent, want %d", sent, magicLinksPerEmail)
+	}
+}
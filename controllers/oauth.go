@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+var (
+	// errIdentityTaken means the provider account is already linked to another user
+	errIdentityTaken = errors.New("provider account linked to another user")
+	// errEmailTaken means another account uses the email and it can't be linked safely
+	errEmailTaken = errors.New("email used by another account")
+)
+
+// oauthProfile is what a sign-in provider tells us about the account signing in
+type oauthProfile struct {
+	Provider       string
+	ProviderName   string // Display name of the provider, used in messages
+	ProviderUserID string
+	Email          string
+	VerifiedEmail  bool
+	Name           string
+	Username       string
+	GivenName      string
+	FamilyName     string
+	Picture        string
+	Locale         string
+	AccessToken    string
+}
+
+// beginOAuth stores the state and the page to return to in cookies, then redirects
+// to the provider's consent page
+func beginOAuth(w http.ResponseWriter, r *http.Request, oauthConfig *oauth2.Config, opts ...oauth2.AuthCodeOption) error {
+	// Generate a random state token
+	state, err := generateRandomToken(32)
+	if err != nil {
+		return fmt.Errorf("failed to generate state token: %w", err)
+	}
+
+	// Store state in a cookie for verification in callback
+	setOAuthCookie(w, r, stateCookieName, state)
+
+	// Store redirect URL from query parameter (where to go after auth)
+	setOAuthCookie(w, r, redirectCookieName, safeRedirect(r.URL.Query().Get("redirect")))
+
+	url := oauthConfig.AuthCodeURL(state, opts...)
+	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+	return nil
+}
+
+// finishOAuth verifies the state of a provider callback, clears the OAuth cookies and
+// exchanges the authorization code. It returns the token and the page to return to.
+func finishOAuth(w http.ResponseWriter, r *http.Request, oauthConfig *oauth2.Config, opts ...oauth2.AuthCodeOption) (*oauth2.Token, string, error) {
+	// Verify state token
+	stateCookie, err := r.Cookie(stateCookieName)
+	if err != nil {
+		return nil, "", fmt.Errorf("state cookie not found: %w", err)
+	}
+
+	state := r.URL.Query().Get("state")
+	if state != stateCookie.Value {
+		return nil, "", fmt.Errorf("invalid state token")
+	}
+
+	// Get redirect URL from cookie
+	redirectTo := "/"
+	if redirectCookie, err := r.Cookie(redirectCookieName); err == nil {
+		redirectTo = safeRedirect(redirectCookie.Value)
+	}
+
+	// Clear state and redirect cookies
+	clearOAuthCookie(w, stateCookieName)
+	clearOAuthCookie(w, redirectCookieName)
+
+	// Get authorization code
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		return nil, "", fmt.Errorf("authorization code not found")
+	}
+
+	// Exchange code for token
+	token, err := oauthConfig.Exchange(r.Context(), code, opts...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to exchange code for token: %w", err)
+	}
+
+	return token, redirectTo, nil
+}
+
+// setOAuthCookie stores a value for the duration of a sign-in flow
+func setOAuthCookie(w http.ResponseWriter, r *http.Request, name, value string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   600, // 10 minutes
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// clearOAuthCookie removes a value stored by setOAuthCookie
+func clearOAuthCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+}
+
+// safeRedirect only keeps local paths so sign-in can't be used as an open redirect
+func safeRedirect(redirectTo string) string {
+	if !strings.HasPrefix(redirectTo, "/") || strings.HasPrefix(redirectTo, "//") || strings.HasPrefix(redirectTo, "/\\") {
+		return "/"
+	}
+	return redirectTo
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/hyperstitieux/template/oidc"
+	"golang.org/x/oauth2"
+)
+
+const (
+	nonceCookieName    = "oidc_nonce"
+	verifierCookieName = "oidc_verifier"
+)
+
+type OIDCController interface {
+	Redirect(w http.ResponseWriter, r *http.Request) error
+	Callback(w http.ResponseWriter, r *http.Request) error
+}
+
+type oidcController struct {
+	accounts  *Accounts
+	providers map[string]*oidc.Provider
+}
+
+// NewOIDCController signs users in with the configured OpenID Connect providers, each
+// served under /auth/oidc/{provider}
+func NewOIDCController(accounts *Accounts, configs []oidc.Config) OIDCController {
+	providers := make(map[string]*oidc.Provider, len(configs))
+	for _, config := range configs {
+		providers[config.ID] = oidc.NewProvider(config)
+	}
+
+	return &oidcController{
+		accounts:  accounts,
+		providers: providers,
+	}
+}
+
+// Redirect initiates the authorization code flow with PKCE at the provider
+func (c *oidcController) Redirect(w http.ResponseWriter, r *http.Request) error {
+	provider, ok := c.providers[mux.Vars(r)["provider"]]
+	if !ok {
+		http.NotFound(w, r)
+		return nil
+	}
+
+	oauthConfig, err := provider.OAuth2Config(r.Context())
+	if err != nil {
+		return err
+	}
+
+	// The nonce ties the ID token to this browser, the verifier the authorization code
+	nonce, err := generateRandomToken(32)
+	if err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	setOAuthCookie(w, r, nonceCookieName, nonce)
+	setOAuthCookie(w, r, verifierCookieName, verifier)
+
+	return beginOAuth(w, r, oauthConfig,
+		oauth2.S256ChallengeOption(verifier),
+		oauth2.SetAuthURLParam("nonce", nonce),
+	)
+}
+
+// Callback verifies the ID token returned by the provider and signs the user in
+func (c *oidcController) Callback(w http.ResponseWriter, r *http.Request) error {
+	provider, ok := c.providers[mux.Vars(r)["provider"]]
+	if !ok {
+		http.NotFound(w, r)
+		return nil
+	}
+
+	nonceCookie, err := r.Cookie(nonceCookieName)
+	if err != nil {
+		return fmt.Errorf("nonce cookie not found: %w", err)
+	}
+	verifierCookie, err := r.Cookie(verifierCookieName)
+	if err != nil {
+		return fmt.Errorf("verifier cookie not found: %w", err)
+	}
+	clearOAuthCookie(w, nonceCookieName)
+	clearOAuthCookie(w, verifierCookieName)
+
+	oauthConfig, err := provider.OAuth2Config(r.Context())
+	if err != nil {
+		return err
+	}
+
+	token, redirectTo, err := finishOAuth(w, r, oauthConfig, oauth2.VerifierOption(verifierCookie.Value))
+	if err != nil {
+		return err
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return fmt.Errorf("no id token in token response")
+	}
+
+	claims, err := provider.VerifyIDToken(r.Context(), rawIDToken, nonceCookie.Value)
+	if err != nil {
+		return err
+	}
+
+	// Many providers keep the ID token small and only return the profile from the
+	// userinfo endpoint. Claims of the verified ID token win.
+	userInfo, err := provider.UserInfo(r.Context(), token)
+	if err != nil {
+		return err
+	}
+	if len(userInfo) > 0 {
+		if userInfo.String("sub") != claims.String("sub") {
+			return fmt.Errorf("user info is for another subject")
+		}
+		for name, value := range userInfo {
+			if _, ok := claims[name]; !ok {
+				claims[name] = value
+			}
+		}
+	}
+
+	config := provider.Config()
+	mapping := config.Claims
+	return c.accounts.signIn(w, r, &oauthProfile{
+		Provider:       config.ID,
+		ProviderName:   config.Name,
+		ProviderUserID: claims.String("sub"),
+		Email:          claims.String(mapping.Email),
+		VerifiedEmail:  claims.Bool(mapping.EmailVerified),
+		Name:           claims.String(mapping.Name),
+		Username:       claims.String(mapping.Username),
+		GivenName:      claims.String(mapping.GivenName),
+		FamilyName:     claims.String(mapping.FamilyName),
+		Picture:        claims.String(mapping.Picture),
+		Locale:         claims.String(mapping.Locale),
+	}, redirectTo)
+}
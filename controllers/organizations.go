@@ -0,0 +1,540 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/frenchsoftware/libvalidator/validator"
+	"github.com/gorilla/mux"
+	"github.com/hyperstitieux/template/audit"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/mail"
+	"github.com/hyperstitieux/template/pages"
+	"github.com/hyperstitieux/template/router"
+	"github.com/hyperstitieux/template/views"
+)
+
+// invitationDuration is how long an invitation to an organization can be accepted
+const invitationDuration = 7 * 24 * time.Hour
+
+var errInvitationNotFound = router.NewHTTPError(http.StatusNotFound, "This invitation is invalid, expired or was already accepted")
+
+type OrganizationsController struct {
+	tx            repositories.Transactor
+	organizations repositories.OrganizationsRepository
+	invitations   repositories.InvitationsRepository
+	sites         *repositories.SitesRepository
+	transfers     repositories.SiteTransfersRepository
+	auditLog      *audit.Log
+	mailer        mail.Sender
+	baseURL       string
+}
+
+func NewOrganizationsController(tx repositories.Transactor, organizations repositories.OrganizationsRepository, invitations repositories.InvitationsRepository, sites *repositories.SitesRepository, transfers repositories.SiteTransfersRepository, auditLog *audit.Log, mailer mail.Sender, baseURL string) *OrganizationsController {
+	return &OrganizationsController{
+		tx:            tx,
+		organizations: organizations,
+		invitations:   invitations,
+		sites:         sites,
+		transfers:     transfers,
+		auditLog:      auditLog,
+		mailer:        mailer,
+		baseURL:       baseURL,
+	}
+}
+
+// New renders the form creating an organization
+func (c *OrganizationsController) New(w http.ResponseWriter, r *http.Request) error {
+	if views.GetUser(r) == nil {
+		http.Redirect(w, r, "/sign-in?redirect=/orgs/new", http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	return pages.NewOrganization(w, r, nil)
+}
+
+// Create creates an organization with the user as its owner
+func (c *OrganizationsController) Create(w http.ResponseWriter, r *http.Request) error {
+	user := views.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in?redirect=/orgs/new", http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	v := validator.New(
+		validator.Field("name").Required().MinLength(1).MaxLength(50),
+		validator.Field("slug").Required().MinLength(3).MaxLength(63),
+	)
+	ok, errs := v.Validate(r)
+	if !ok {
+		return pages.NewOrganization(w, r, errs)
+	}
+
+	slug := r.FormValue("slug")
+	if !slugPattern.MatchString(slug) {
+		errs := make(validator.ValidationErrors)
+		errs.Add("slug", "Slug can only contain lowercase letters, numbers, and hyphens")
+		return pages.NewOrganization(w, r, errs)
+	}
+
+	org := &models.Organization{Name: strings.TrimSpace(r.FormValue("name")), Slug: slug}
+	err := c.tx.Transaction(r.Context(), func(ctx context.Context) error {
+		if err := c.organizations.Create(ctx, org); err != nil {
+			return err
+		}
+		return c.organizations.AddMember(ctx, org.ID, user.ID, models.RoleOwner)
+	})
+	if errors.Is(err, repositories.ErrConflict) {
+		errs := make(validator.ValidationErrors)
+		errs.Add("slug", "This slug is already taken")
+		return pages.NewOrganization(w, r, errs)
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("created organization", "organization_id", org.ID, "user_id", user.ID)
+	c.auditLog.Record(r, user, models.AuditOrganizationCreate, models.AuditTargetOrganization, org.ID, audit.Diff(nil, map[string]any{"name": org.Name, "slug": org.Slug}))
+
+	http.Redirect(w, r, fmt.Sprintf("/orgs/%d", org.ID), http.StatusSeeOther)
+	return nil
+}
+
+// Show renders an organization with its members, pending invitations and sites
+func (c *OrganizationsController) Show(w http.ResponseWriter, r *http.Request) error {
+	user := views.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in?redirect="+url.QueryEscape(r.URL.Path), http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	org, role, err := c.authorizedOrganization(w, r, user, models.RoleViewer)
+	if org == nil {
+		return err
+	}
+
+	return c.render(w, r, user, org, role, nil)
+}
+
+// render renders the page of an organization, with the errors of its forms
+func (c *OrganizationsController) render(w http.ResponseWriter, r *http.Request, user *models.User, org *models.Organization, role string, errs validator.ValidationErrors) error {
+	props := pages.OrganizationProps{
+		Organization: org,
+		Role:         role,
+		UserID:       user.ID,
+		Errors:       errs,
+	}
+
+	var err error
+	props.Members, err = c.organizations.GetMembers(r.Context(), org.ID)
+	if err != nil {
+		return err
+	}
+
+	// Only those who can invite see who was invited
+	if models.RoleAtLeast(role, models.RoleAdmin) {
+		props.Invitations, err = c.invitations.GetByOrganizationID(r.Context(), org.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	props.Sites, err = (*c.sites).GetByOrganizationID(r.Context(), org.ID)
+	if err != nil {
+		return err
+	}
+
+	return pages.Organization(w, r, props)
+}
+
+// Delete deletes an organization along with its sites
+func (c *OrganizationsController) Delete(w http.ResponseWriter, r *http.Request) error {
+	user := views.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in", http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	org, _, err := c.authorizedOrganization(w, r, user, models.RoleOwner)
+	if org == nil {
+		return err
+	}
+
+	err = c.tx.Transaction(r.Context(), func(ctx context.Context) error {
+		sites, err := (*c.sites).GetByOrganizationID(ctx, org.ID)
+		if err != nil {
+			return err
+		}
+		for _, site := range sites {
+			if err := (*c.sites).Delete(ctx, site.ID); err != nil {
+				return err
+			}
+		}
+		return c.organizations.Delete(ctx, org.ID)
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("deleted organization", "organization_id", org.ID, "user_id", user.ID)
+	c.auditLog.Record(r, user, models.AuditOrganizationDelete, models.AuditTargetOrganization, org.ID, audit.Diff(map[string]any{"name": org.Name, "slug": org.Slug}, nil))
+
+	http.Redirect(w, r, "/sites", http.StatusSeeOther)
+	return nil
+}
+
+// Invite emails an invitation to join the organization with a role
+func (c *OrganizationsController) Invite(w http.ResponseWriter, r *http.Request) error {
+	user := views.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in", http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	org, role, err := c.authorizedOrganization(w, r, user, models.RoleAdmin)
+	if org == nil {
+		return err
+	}
+
+	email := strings.ToLower(strings.TrimSpace(r.FormValue("email")))
+	v := validator.New(
+		validator.Field("email").Required().IsValidEmail().MaxLength(254),
+	)
+	ok, errs := v.ValidateData(map[string]string{"email": email})
+	if !ok {
+		return c.render(w, r, user, org, role, errs)
+	}
+
+	invitedRole := r.FormValue("role")
+	if !slices.Contains(models.Roles, invitedRole) {
+		return c.render(w, r, user, org, role, validator.ValidationErrors{"role": {"Choose a role"}})
+	}
+	if invitedRole == models.RoleOwner && role != models.RoleOwner {
+		return c.render(w, r, user, org, role, validator.ValidationErrors{"role": {"Only owners can invite owners"}})
+	}
+
+	random, err := generateRandomToken(32)
+	if err != nil {
+		return fmt.Errorf("failed to generate invitation token: %w", err)
+	}
+	token := strings.TrimRight(random, "=")
+
+	invitation := &models.Invitation{
+		OrganizationID: org.ID,
+		Email:          email,
+		Role:           invitedRole,
+		InvitedBy:      &user.ID,
+		ExpiresAt:      time.Now().Add(invitationDuration),
+	}
+	if err := c.invitations.Create(r.Context(), invitation, token); err != nil {
+		return err
+	}
+
+	// Sent right away like sign in links, the token is only kept hashed
+	err = c.mailer.Send(r.Context(), &mail.Message{
+		To:      email,
+		Subject: fmt.Sprintf("Join %s on Internet Publishing", org.Name),
+		Body: fmt.Sprintf("%s invited you to join %s on Internet Publishing as %s.\n\n", user.Name, org.Name, invitedRole) +
+			"Follow this link to accept the invitation:\n\n" +
+			c.baseURL + "/invitations/" + token + "\n\n" +
+			fmt.Sprintf("The invitation expires in %d days. If you didn't expect it, you can ignore this email.\n", int(invitationDuration.Hours()/24)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send invitation: %w", err)
+	}
+	slog.Info("invited member", "organization_id", org.ID, "invitation_id", invitation.ID, "role", invitedRole, "user_id", user.ID)
+
+	http.Redirect(w, r, fmt.Sprintf("/orgs/%d#members", org.ID), http.StatusSeeOther)
+	return nil
+}
+
+// RevokeInvitation deletes a pending invitation, whose link stops working
+func (c *OrganizationsController) RevokeInvitation(w http.ResponseWriter, r *http.Request) error {
+	user := views.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in", http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	org, _, err := c.authorizedOrganization(w, r, user, models.RoleAdmin)
+	if org == nil {
+		return err
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["invitation"], 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil
+	}
+
+	err = c.invitations.Delete(r.Context(), org.ID, id)
+	if errors.Is(err, repositories.ErrNotFound) {
+		http.NotFound(w, r)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/orgs/%d#members", org.ID), http.StatusSeeOther)
+	return nil
+}
+
+// UpdateMember changes the role of a member. Admins manage the roles below owner,
+// owners manage every role, and the last owner can't be demoted.
+func (c *OrganizationsController) UpdateMember(w http.ResponseWriter, r *http.Request) error {
+	user := views.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in", http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	org, role, err := c.authorizedOrganization(w, r, user, models.RoleAdmin)
+	if org == nil {
+		return err
+	}
+
+	member, members, err := c.member(w, r, org)
+	if member == nil {
+		return err
+	}
+
+	newRole := r.FormValue("role")
+	if !slices.Contains(models.Roles, newRole) {
+		return c.render(w, r, user, org, role, validator.ValidationErrors{"members": {"Choose a role"}})
+	}
+	if (newRole == models.RoleOwner || member.Role == models.RoleOwner) && role != models.RoleOwner {
+		return c.render(w, r, user, org, role, validator.ValidationErrors{"members": {"Only owners can change who owns the organization"}})
+	}
+	if member.Role == models.RoleOwner && newRole != models.RoleOwner && countOwners(members) == 1 {
+		return c.render(w, r, user, org, role, validator.ValidationErrors{"members": {"The organization needs at least one owner"}})
+	}
+
+	// The transfers offered by a member no longer allowed to make them are withdrawn
+	err = c.tx.Transaction(r.Context(), func(ctx context.Context) error {
+		if err := c.organizations.UpdateRole(ctx, org.ID, member.UserID, newRole); err != nil {
+			return err
+		}
+		if models.RoleAtLeast(newRole, siteTransferRole) {
+			return nil
+		}
+		return c.transfers.DeleteFromMember(ctx, org.ID, member.UserID)
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("changed member role", "organization_id", org.ID, "member_id", member.UserID, "role", newRole, "user_id", user.ID)
+	c.auditLog.Record(r, user, models.AuditMemberRoleUpdate, models.AuditTargetOrganization, org.ID, map[string]models.AuditChange{
+		"member": {Before: member.Email, After: member.Email},
+		"role":   {Before: member.Role, After: newRole},
+	})
+
+	http.Redirect(w, r, fmt.Sprintf("/orgs/%d#members", org.ID), http.StatusSeeOther)
+	return nil
+}
+
+// RemoveMember removes a member from the organization, or lets a member leave it.
+// The sites they created stay with the organization, credited to another member.
+func (c *OrganizationsController) RemoveMember(w http.ResponseWriter, r *http.Request) error {
+	user := views.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in", http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	org, role, err := c.authorizedOrganization(w, r, user, models.RoleViewer)
+	if org == nil {
+		return err
+	}
+
+	member, members, err := c.member(w, r, org)
+	if member == nil {
+		return err
+	}
+
+	leaving := member.UserID == user.ID
+	if !leaving && !models.RoleAtLeast(role, models.RoleAdmin) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil
+	}
+	if !leaving && member.Role == models.RoleOwner && role != models.RoleOwner {
+		return c.render(w, r, user, org, role, validator.ValidationErrors{"members": {"Only owners can remove owners"}})
+	}
+	if member.Role == models.RoleOwner && countOwners(members) == 1 {
+		return c.render(w, r, user, org, role, validator.ValidationErrors{"members": {"The organization needs at least one owner, make someone else owner or delete the organization"}})
+	}
+
+	// The sites the member created are credited to the most privileged remaining
+	// member, who always exists as the last owner can't leave, and the transfers they
+	// offered are withdrawn
+	successorID := successor(members, member.UserID)
+	err = c.tx.Transaction(r.Context(), func(ctx context.Context) error {
+		if err := c.organizations.RemoveMember(ctx, org.ID, member.UserID); err != nil {
+			return err
+		}
+		if err := c.transfers.DeleteFromMember(ctx, org.ID, member.UserID); err != nil {
+			return err
+		}
+		return (*c.sites).ReassignCreator(ctx, org.ID, int(member.UserID), int(successorID))
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("removed member", "organization_id", org.ID, "member_id", member.UserID, "user_id", user.ID)
+	c.auditLog.Record(r, user, models.AuditMemberRemove, models.AuditTargetOrganization, org.ID, audit.Diff(map[string]any{"member": member.Email, "role": member.Role}, nil))
+
+	if leaving {
+		http.Redirect(w, r, "/sites", http.StatusSeeOther)
+		return nil
+	}
+	http.Redirect(w, r, fmt.Sprintf("/orgs/%d#members", org.ID), http.StatusSeeOther)
+	return nil
+}
+
+// ShowInvitation asks the user to accept an invitation. Signing in comes first, with
+// whichever account the invitee wants to join with.
+func (c *OrganizationsController) ShowInvitation(w http.ResponseWriter, r *http.Request) error {
+	if views.GetUser(r) == nil {
+		http.Redirect(w, r, "/sign-in?redirect="+url.QueryEscape(r.URL.Path), http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	invitation, org, err := c.invitation(r)
+	if err != nil {
+		return err
+	}
+
+	return pages.Invitation(w, r, invitation, org, mux.Vars(r)["token"])
+}
+
+// AcceptInvitation makes the user a member of the organization with the invited role
+func (c *OrganizationsController) AcceptInvitation(w http.ResponseWriter, r *http.Request) error {
+	user := views.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in?redirect="+url.QueryEscape(r.URL.Path), http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	invitation, org, err := c.invitation(r)
+	if err != nil {
+		return err
+	}
+
+	// Members following an invitation again keep their role
+	err = c.tx.Transaction(r.Context(), func(ctx context.Context) error {
+		err := c.organizations.AddMember(ctx, org.ID, user.ID, invitation.Role)
+		if err != nil && !errors.Is(err, repositories.ErrConflict) {
+			return err
+		}
+		return c.invitations.Delete(ctx, org.ID, invitation.ID)
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("accepted invitation", "organization_id", org.ID, "invitation_id", invitation.ID, "user_id", user.ID)
+	c.auditLog.Record(r, user, models.AuditInvitationAccept, models.AuditTargetOrganization, org.ID, audit.Diff(nil, map[string]any{"member": user.Email, "role": invitation.Role}))
+
+	http.Redirect(w, r, fmt.Sprintf("/orgs/%d", org.ID), http.StatusSeeOther)
+	return nil
+}
+
+// invitation loads the invitation of the token in the URL and its organization
+func (c *OrganizationsController) invitation(r *http.Request) (*models.Invitation, *models.Organization, error) {
+	invitation, err := c.invitations.GetByToken(r.Context(), mux.Vars(r)["token"])
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, nil, errInvitationNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	org, err := c.organizations.GetByID(r.Context(), invitation.OrganizationID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return invitation, org, nil
+}
+
+// authorizedOrganization loads the organization from the URL and checks the user has
+// at least the role in it. Organizations the user isn't a member of are reported as
+// not found.
+func (c *OrganizationsController) authorizedOrganization(w http.ResponseWriter, r *http.Request, user *models.User, min string) (*models.Organization, string, error) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid organization ID", http.StatusBadRequest)
+		return nil, "", nil
+	}
+
+	role, err := c.organizations.GetRole(r.Context(), id, user.ID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		http.Error(w, "Organization not found", http.StatusNotFound)
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if !models.RoleAtLeast(role, min) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, "", nil
+	}
+
+	org, err := c.organizations.GetByID(r.Context(), id)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return org, role, nil
+}
+
+// member finds the member of the URL among the members of the organization, which
+// are returned too
+func (c *OrganizationsController) member(w http.ResponseWriter, r *http.Request, org *models.Organization) (*models.Membership, []*models.Membership, error) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["user"], 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, nil, nil
+	}
+
+	members, err := c.organizations.GetMembers(r.Context(), org.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, member := range members {
+		if member.UserID == userID {
+			return member, members, nil
+		}
+	}
+
+	http.NotFound(w, r)
+	return nil, nil, nil
+}
+
+// successor returns the most privileged member other than userID, members being
+// sorted by role, or 0 if there is none
+func successor(members []*models.Membership, userID int64) int64 {
+	for _, member := range members {
+		if member.UserID != userID {
+			return member.UserID
+		}
+	}
+	return 0
+}
+
+// countOwners counts the owners among the members of an organization
+func countOwners(members []*models.Membership) int {
+	owners := 0
+	for _, member := range members {
+		if member.Role == models.RoleOwner {
+			owners++
+		}
+	}
+	return owners
+}
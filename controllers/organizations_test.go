@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestSignInRedirectKeepsPath(t *testing.T) {
+	organizations := &OrganizationsController{}
+	sites := &SitesController{}
+
+	tests := []struct {
+		name    string
+		handler func(w http.ResponseWriter, r *http.Request) error
+		method  string
+		target  string
+		path    string
+	}{
+		{"show invitation", organizations.ShowInvitation, "GET", "/invitations/a%26redirect=%2F%2Fevil.example", "/invitations/a&redirect=//evil.example"},
+		{"accept invitation", organizations.AcceptInvitation, "POST", "/invitations/a%3Fx=1%23y", "/invitations/a?x=1#y"},
+		{"show site", sites.Show, "GET", "/sites/1%26redirect=%2F%2Fevil.example", "/sites/1&redirect=//evil.example"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			if err := tt.handler(w, httptest.NewRequest(tt.method, tt.target, nil)); err != nil {
+				t.Fatal(err)
+			}
+
+			location, err := url.Parse(w.Header().Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			query := location.Query()
+			if location.Path != "/sign-in" || len(query) != 1 || query.Get("redirect") != tt.path {
+				t.Errorf("redirected to %s, want the sign in page back to %s", location, tt.path)
+			}
+		})
+	}
+}
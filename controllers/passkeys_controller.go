@@ -0,0 +1,414 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/frenchsoftware/libvalidator/validator"
+	"github.com/gorilla/mux"
+	"github.com/hyperstitieux/template/auth"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/router"
+	"github.com/hyperstitieux/template/webauthn"
+)
+
+const (
+	// challengeCookieName ties a WebAuthn challenge to the browser it was issued to
+	challengeCookieName = "webauthn_challenge"
+	// challengeDuration is how long the browser has to answer a challenge
+	challengeDuration = 5 * time.Minute
+	// maxJSONBody bounds the JSON request bodies
+	maxJSONBody = 64 << 10
+)
+
+// errInvalidPasskey is what the browser is told when an assertion doesn't check out,
+// whatever the reason
+var errInvalidPasskey = router.NewHTTPError(http.StatusUnauthorized, "This passkey couldn't be verified, try again")
+
+type PasskeysController interface {
+	RegisterOptions(w http.ResponseWriter, r *http.Request) error
+	Register(w http.ResponseWriter, r *http.Request) error
+	Rename(w http.ResponseWriter, r *http.Request) error
+	Delete(w http.ResponseWriter, r *http.Request) error
+	SignInOptions(w http.ResponseWriter, r *http.Request) error
+	SignIn(w http.ResponseWriter, r *http.Request) error
+	SecondFactorOptions(w http.ResponseWriter, r *http.Request) error
+	SecondFactor(w http.ResponseWriter, r *http.Request) error
+}
+
+type passkeysController struct {
+	accounts *Accounts
+	passkeys repositories.PasskeysRepository
+	webauthn *webauthn.WebAuthn
+}
+
+// NewPasskeysController registers passkeys and signs in with them, either on their
+// own or as the second factor of another sign in
+func NewPasskeysController(accounts *Accounts, passkeys repositories.PasskeysRepository, config webauthn.Config) PasskeysController {
+	return &passkeysController{
+		accounts: accounts,
+		passkeys: passkeys,
+		webauthn: webauthn.New(config),
+	}
+}
+
+// RegisterOptions starts registering a passkey for the signed in user
+func (c *passkeysController) RegisterOptions(w http.ResponseWriter, r *http.Request) error {
+	user := auth.GetCurrentUser(r)
+	if user == nil {
+		return router.ErrUnauthorized
+	}
+
+	passkeys, err := c.passkeys.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		return err
+	}
+	exclude := make([]webauthn.CredentialDescriptor, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		exclude = append(exclude, webauthn.Descriptor(passkey.CredentialID, passkey.Transports))
+	}
+
+	challenge, err := c.issueChallenge(w, r, &user.ID, models.ChallengeRegister)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, c.webauthn.CreationOptions(webauthn.User{
+		Handle:      userHandle(user.ID),
+		Name:        user.Email,
+		DisplayName: user.Name,
+	}, challenge, exclude))
+}
+
+// Register stores the passkey created by the browser
+func (c *passkeysController) Register(w http.ResponseWriter, r *http.Request) error {
+	user := auth.GetCurrentUser(r)
+	if user == nil {
+		return router.ErrUnauthorized
+	}
+
+	var body struct {
+		Name       string                        `json:"name"`
+		Credential webauthn.RegistrationResponse `json:"credential"`
+	}
+	if err := readJSON(w, r, &body); err != nil {
+		return err
+	}
+
+	challenge, err := c.consumeChallenge(w, r, models.ChallengeRegister)
+	if err != nil {
+		return err
+	}
+	if challenge.UserID == nil || *challenge.UserID != user.ID {
+		return errInvalidPasskey
+	}
+
+	credential, err := c.webauthn.VerifyRegistration(&body.Credential, challenge.Challenge)
+	if err != nil {
+		slog.Warn("passkey registration rejected", "error", err, "user_id", user.ID)
+		return router.NewHTTPError(http.StatusBadRequest, "This passkey couldn't be registered, try again")
+	}
+
+	name := strings.TrimSpace(body.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+	if len(name) > 50 {
+		name = name[:50]
+	}
+
+	passkey := &models.Passkey{
+		UserID:       user.ID,
+		CredentialID: credential.ID,
+		PublicKey:    credential.PublicKey,
+		SignCount:    credential.SignCount,
+		Transports:   credential.Transports,
+		Name:         name,
+	}
+	err = c.passkeys.Create(r.Context(), passkey)
+	if errors.Is(err, repositories.ErrConflict) {
+		return router.NewHTTPError(http.StatusConflict, "This passkey is already registered")
+	}
+	if err != nil {
+		return err
+	}
+	c.accounts.auditLog.Record(r, user, models.AuditPasskeyAdd, models.AuditTargetUser, user.ID, map[string]models.AuditChange{
+		"passkey": {After: name},
+	})
+
+	if err := rotateSession(w, r, c.accounts.users); err != nil {
+		return err
+	}
+
+	return writeJSON(w, map[string]string{"redirect": "/settings"})
+}
+
+// Rename renames one of the user's passkeys
+func (c *passkeysController) Rename(w http.ResponseWriter, r *http.Request) error {
+	user := auth.GetCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in?redirect=/settings", http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil
+	}
+
+	v := validator.New(
+		validator.Field("name").Required().MaxLength(50),
+	)
+	if ok, errs := v.Validate(r); !ok {
+		http.Error(w, errs.Get("name"), http.StatusUnprocessableEntity)
+		return nil
+	}
+
+	err = c.passkeys.Rename(r.Context(), user.ID, id, strings.TrimSpace(r.FormValue("name")))
+	if errors.Is(err, repositories.ErrNotFound) {
+		http.NotFound(w, r)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+	return nil
+}
+
+// Delete removes one of the user's passkeys
+func (c *passkeysController) Delete(w http.ResponseWriter, r *http.Request) error {
+	user := auth.GetCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in?redirect=/settings", http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil
+	}
+
+	err = c.passkeys.Delete(r.Context(), user.ID, id)
+	if errors.Is(err, repositories.ErrNotFound) {
+		http.NotFound(w, r)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.accounts.auditLog.Record(r, user, models.AuditPasskeyDelete, models.AuditTargetUser, user.ID, map[string]models.AuditChange{
+		"passkey_id": {Before: id},
+	})
+
+	if err := rotateSession(w, r, c.accounts.users); err != nil {
+		return err
+	}
+
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+	return nil
+}
+
+// SignInOptions starts a passwordless sign in with any passkey of this site
+func (c *passkeysController) SignInOptions(w http.ResponseWriter, r *http.Request) error {
+	challenge, err := c.issueChallenge(w, r, nil, models.ChallengeSignIn)
+	if err != nil {
+		return err
+	}
+
+	// The passkey itself is the only factor, so the authenticator must verify the user
+	return writeJSON(w, c.webauthn.RequestOptions(challenge, nil, webauthn.VerificationRequired))
+}
+
+// SignIn signs in the owner of the passkey
+func (c *passkeysController) SignIn(w http.ResponseWriter, r *http.Request) error {
+	var body struct {
+		Redirect   string                     `json:"redirect"`
+		Credential webauthn.AssertionResponse `json:"credential"`
+	}
+	if err := readJSON(w, r, &body); err != nil {
+		return err
+	}
+
+	challenge, err := c.consumeChallenge(w, r, models.ChallengeSignIn)
+	if err != nil {
+		return err
+	}
+
+	passkey, err := c.verifyAssertion(r, &body.Credential, challenge.Challenge, webauthn.VerificationRequired)
+	if err != nil {
+		return err
+	}
+
+	// A user verified passkey is two factors on its own
+	if err := c.accounts.startSession(w, r, passkey.UserID, false, "passkey"); err != nil {
+		return err
+	}
+
+	return writeJSON(w, map[string]string{"redirect": safeRedirect(body.Redirect)})
+}
+
+// SecondFactorOptions asks for one of the user's passkeys to complete a sign in
+func (c *passkeysController) SecondFactorOptions(w http.ResponseWriter, r *http.Request) error {
+	session, err := c.accounts.pendingSession(r)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return router.ErrUnauthorized
+	}
+	if err != nil {
+		return err
+	}
+
+	passkeys, err := c.passkeys.GetByUserID(r.Context(), session.UserID)
+	if err != nil {
+		return err
+	}
+	allow := make([]webauthn.CredentialDescriptor, 0, len(passkeys))
+	for _, passkey := range passkeys {
+		allow = append(allow, webauthn.Descriptor(passkey.CredentialID, passkey.Transports))
+	}
+
+	challenge, err := c.issueChallenge(w, r, &session.UserID, models.ChallengeSecondFactor)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(w, c.webauthn.RequestOptions(challenge, allow, webauthn.VerificationPreferred))
+}
+
+// SecondFactor completes a pending sign in with one of the user's passkeys
+func (c *passkeysController) SecondFactor(w http.ResponseWriter, r *http.Request) error {
+	session, err := c.accounts.pendingSession(r)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return router.ErrUnauthorized
+	}
+	if err != nil {
+		return err
+	}
+
+	var body struct {
+		Redirect   string                     `json:"redirect"`
+		Credential webauthn.AssertionResponse `json:"credential"`
+	}
+	if err := readJSON(w, r, &body); err != nil {
+		return err
+	}
+
+	challenge, err := c.consumeChallenge(w, r, models.ChallengeSecondFactor)
+	if err != nil {
+		return err
+	}
+	if challenge.UserID == nil || *challenge.UserID != session.UserID {
+		return errInvalidPasskey
+	}
+
+	passkey, err := c.verifyAssertion(r, &body.Credential, challenge.Challenge, webauthn.VerificationPreferred)
+	if err != nil {
+		return err
+	}
+	if passkey.UserID != session.UserID {
+		return errInvalidPasskey
+	}
+
+	if err := c.accounts.completeSecondFactor(w, r, session, "passkey"); err != nil {
+		return err
+	}
+
+	return writeJSON(w, map[string]string{"redirect": safeRedirect(body.Redirect)})
+}
+
+// verifyAssertion checks an assertion against the stored passkey and records its use
+func (c *passkeysController) verifyAssertion(r *http.Request, credential *webauthn.AssertionResponse, challenge, userVerification string) (*models.Passkey, error) {
+	passkey, err := c.passkeys.GetByCredentialID(r.Context(), credential.ID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, errInvalidPasskey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Discoverable credentials say who they belong to, which must match
+	if handle := credential.UserHandle(); handle != nil && string(handle) != string(userHandle(passkey.UserID)) {
+		return nil, errInvalidPasskey
+	}
+
+	signCount, err := c.webauthn.VerifyAssertion(credential, challenge, passkey.PublicKey, passkey.SignCount, userVerification)
+	if err != nil {
+		slog.Warn("passkey assertion rejected", "error", err, "passkey_id", passkey.ID, "user_id", passkey.UserID)
+		return nil, errInvalidPasskey
+	}
+
+	if err := c.passkeys.RecordUse(r.Context(), passkey.ID, signCount); err != nil {
+		return nil, err
+	}
+
+	return passkey, nil
+}
+
+// issueChallenge stores a new challenge for a ceremony and binds it to the browser
+func (c *passkeysController) issueChallenge(w http.ResponseWriter, r *http.Request, userID *int64, purpose string) (string, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate webauthn challenge: %w", err)
+	}
+
+	err = c.passkeys.CreateChallenge(r.Context(), &models.WebAuthnChallenge{
+		Challenge: challenge,
+		UserID:    userID,
+		Purpose:   purpose,
+		ExpiresAt: time.Now().Add(challengeDuration),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	setOAuthCookie(w, r, challengeCookieName, challenge)
+	return challenge, nil
+}
+
+// consumeChallenge uses up the challenge issued to the browser for a ceremony
+func (c *passkeysController) consumeChallenge(w http.ResponseWriter, r *http.Request, purpose string) (*models.WebAuthnChallenge, error) {
+	cookie, err := r.Cookie(challengeCookieName)
+	if err != nil {
+		return nil, errInvalidPasskey
+	}
+	clearOAuthCookie(w, challengeCookieName)
+
+	challenge, err := c.passkeys.ConsumeChallenge(r.Context(), cookie.Value, purpose, time.Now())
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, router.NewHTTPError(http.StatusUnauthorized, "This request expired, try again")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// userHandle identifies the user to authenticators without giving away their email
+func userHandle(userID int64) []byte {
+	return []byte(strconv.FormatInt(userID, 10))
+}
+
+// readJSON decodes a JSON request body of bounded size
+func readJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBody)).Decode(v); err != nil {
+		return router.NewHTTPError(http.StatusBadRequest, "invalid JSON body")
+	}
+	return nil
+}
+
+// writeJSON writes a JSON response
+func writeJSON(w http.ResponseWriter, v any) error {
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(v)
+}
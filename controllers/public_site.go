@@ -1,25 +1,145 @@
 package controllers
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
+	"github.com/hyperstitieux/template/analytics"
+	"github.com/hyperstitieux/template/database/models"
 	"github.com/hyperstitieux/template/database/repositories"
 	githubpkg "github.com/hyperstitieux/template/github"
+	"github.com/hyperstitieux/template/livereload"
 	"github.com/hyperstitieux/template/markdown"
 	"github.com/hyperstitieux/template/pages"
+	"github.com/hyperstitieux/template/quota"
+	"github.com/hyperstitieux/template/router"
+)
+
+const (
+	// fetchFailureWindow is the period fetch failures are deduplicated and limited over
+	fetchFailureWindow = time.Hour
+	// fetchFailuresPerSite limits the entries a site gets per window
+	fetchFailuresPerSite = 100
 )
 
 type PublicSiteController struct {
-	sites *repositories.SitesRepository
+	sites     *repositories.SitesRepository
+	logs      repositories.SiteLogsRepository
+	users     repositories.UsersRepository
+	live      *livereload.Hub
+	quotas    *quota.Quotas
+	analytics *analytics.Analytics
+	baseURL   string // Of the dashboard, where visitors report sites
 }
 
-func NewPublicSiteController(sites *repositories.SitesRepository) *PublicSiteController {
-	return &PublicSiteController{sites: sites}
+func NewPublicSiteController(sites *repositories.SitesRepository, logs repositories.SiteLogsRepository, users repositories.UsersRepository, live *livereload.Hub, quotas *quota.Quotas, analytics *analytics.Analytics, baseURL string) *PublicSiteController {
+	return &PublicSiteController{sites: sites, logs: logs, users: users, live: live, quotas: quotas, analytics: analytics, baseURL: baseURL}
 }
 
 func (c *PublicSiteController) Render(w http.ResponseWriter, r *http.Request) error {
+	site, err := c.site(w, r)
+	if site == nil {
+		return err
+	}
+
+	path := pagePath(site, r.URL.Path)
+
+	// Fetch file from GitHub
+	content, err := githubpkg.FetchRawFile(site.GithubRepo, site.GithubBranch, path)
+	if err != nil {
+		// Try index.md if README.md doesn't exist
+		if strings.HasSuffix(path, "README.md") {
+			indexPath := strings.Replace(path, "README.md", "index.md", 1)
+			content, err = githubpkg.FetchRawFile(site.GithubRepo, site.GithubBranch, indexPath)
+			if err != nil {
+				c.recordFetchFailure(r.Context(), site, indexPath, err)
+				http.Error(w, "Page not found", http.StatusNotFound)
+				return nil
+			}
+		} else {
+			c.recordFetchFailure(r.Context(), site, path, err)
+			http.Error(w, "Page not found", http.StatusNotFound)
+			return nil
+		}
+	}
+
+	// Render markdown to HTML
+	htmlContent, err := markdown.RenderMarkdown(content)
+	if err != nil {
+		err = fmt.Errorf("failed to render markdown: %w", err)
+		c.record(r.Context(), site, models.LogLevelError, path, 0, err)
+		return err
+	}
+
+	// Pages served count against the bandwidth of the site's creator
+	counter := &countingWriter{ResponseWriter: w}
+	err = pages.PublicSite(counter, r, site, htmlContent, c.reportURL(r, site))
+	c.quotas.Serve(int64(site.UserID), counter.written)
+	if err != nil {
+		return err
+	}
+
+	c.analytics.Record(r, site.ID, r.URL.Path)
+	return nil
+}
+
+// countingWriter counts the bytes of a response body
+type countingWriter struct {
+	http.ResponseWriter
+	written int64
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+// reportURL links to the report form of the dashboard, filled in with the page being
+// read. Public sites are served with the scheme of the dashboard.
+func (c *PublicSiteController) reportURL(r *http.Request, site *models.Site) string {
+	scheme := "http"
+	if strings.HasPrefix(c.baseURL, "https://") {
+		scheme = "https"
+	}
+	query := url.Values{
+		"site": {site.Slug},
+		"url":  {scheme + "://" + r.Host + r.URL.Path},
+	}
+	return c.baseURL + "/report?" + query.Encode()
+}
+
+// Live subscribes an open page of a public site to the updates of the site. The page
+// sends its own path, the websocket endpoint has one of its own.
+func (c *PublicSiteController) Live(w http.ResponseWriter, r *http.Request) {
+	if !router.IsSubdomain(r.Host) {
+		http.NotFound(w, r)
+		return
+	}
+
+	site, err := c.site(w, r)
+	if err != nil {
+		slog.Error("failed to get site", "error", err, "host", r.Host)
+		http.Error(w, "Failed to get site", http.StatusInternalServerError)
+		return
+	}
+	if site == nil {
+		return
+	}
+
+	c.live.Serve(w, r, site, pagePath(site, r.URL.Query().Get("path")))
+}
+
+// site loads the site of the subdomain the request was sent to. Requests for a site
+// that doesn't exist, is suspended or went over its bandwidth are answered, and no
+// site is returned.
+func (c *PublicSiteController) site(w http.ResponseWriter, r *http.Request) (*models.Site, error) {
 	// Extract slug from subdomain
 	host := r.Host
 	parts := strings.Split(host, ".")
@@ -27,23 +147,47 @@ func (c *PublicSiteController) Render(w http.ResponseWriter, r *http.Request) er
 	// Check if this is a subdomain request (e.g., slug.internetpublishing.co)
 	if len(parts) < 3 {
 		http.Error(w, "Invalid subdomain", http.StatusBadRequest)
-		return nil
+		return nil, nil
 	}
 
 	slug := parts[0]
 
 	// Get site from database
-	site, err := (*c.sites).GetBySlug(slug)
+	site, err := (*c.sites).GetBySlug(r.Context(), slug)
+	if errors.Is(err, repositories.ErrNotFound) {
+		http.Error(w, "Site not found", http.StatusNotFound)
+		return nil, nil
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if site == nil {
-		http.Error(w, "Site not found", http.StatusNotFound)
-		return nil
+
+	// Suspended sites, and personal sites of suspended users, aren't served
+	if site.SuspendedAt != nil {
+		return nil, pages.SiteUnavailable(w, r, site, http.StatusUnavailableForLegalReasons, "This site was suspended by the operators of Internet Publishing.")
+	}
+	if site.OrganizationID == nil {
+		owner, err := c.users.GetUserByID(r.Context(), int64(site.UserID))
+		if err != nil {
+			return nil, err
+		}
+		if owner.SuspendedAt != nil {
+			return nil, pages.SiteUnavailable(w, r, site, http.StatusForbidden, "The account publishing this site is suspended.")
+		}
+	}
+
+	// Sites of creators over their monthly bandwidth are off until the next month
+	if c.quotas.Throttled(int64(site.UserID)) {
+		return nil, pages.SiteUnavailable(w, r, site, http.StatusTooManyRequests, "This site went over the monthly bandwidth of its plan, it is back next month.")
 	}
 
+	return site, nil
+}
+
+// pagePath returns the file of the repository a page of the site is rendered from
+func pagePath(site *models.Site, urlPath string) string {
 	// Get requested path (default to README.md)
-	path := strings.TrimPrefix(r.URL.Path, "/")
+	path := strings.TrimPrefix(urlPath, "/")
 	if path == "" {
 		path = "README.md"
 	}
@@ -58,28 +202,35 @@ func (c *PublicSiteController) Render(w http.ResponseWriter, r *http.Request) er
 		path = strings.TrimSuffix(site.Subdirectory, "/") + "/" + path
 	}
 
-	// Fetch file from GitHub
-	content, err := githubpkg.FetchRawFile(site.GithubRepo, site.GithubBranch, path)
-	if err != nil {
-		// Try index.md if README.md doesn't exist
-		if strings.HasSuffix(path, "README.md") {
-			indexPath := strings.Replace(path, "README.md", "index.md", 1)
-			content, err = githubpkg.FetchRawFile(site.GithubRepo, site.GithubBranch, indexPath)
-			if err != nil {
-				http.Error(w, fmt.Sprintf("File not found: %s", err), http.StatusNotFound)
-				return nil
-			}
-		} else {
-			http.Error(w, fmt.Sprintf("File not found: %s", err), http.StatusNotFound)
-			return nil
-		}
+	return path
+}
+
+// recordFetchFailure stores a log entry for a file that could not be fetched from GitHub.
+// Missing files are warnings, anything else (network errors, rate limits) is an error.
+// Anyone can request missing pages, so a failure already logged for the path within
+// fetchFailureWindow is skipped, and so is any once the site has fetchFailuresPerSite.
+func (c *PublicSiteController) recordFetchFailure(ctx context.Context, site *models.Site, path string, err error) {
+	status := githubpkg.StatusCode(err)
+	level := models.LogLevelError
+	if status == http.StatusNotFound {
+		level = models.LogLevelWarning
 	}
 
-	// Render markdown to HTML
-	htmlContent, err := markdown.RenderMarkdown(content)
-	if err != nil {
-		return fmt.Errorf("failed to render markdown: %w", err)
+	byPath, bySite, countErr := c.logs.CountSince(ctx, site.ID, path, status, time.Now().Add(-fetchFailureWindow))
+	if countErr != nil {
+		slog.Error("failed to count site logs", "error", countErr, "site_id", site.ID, "path", path)
+		return
+	}
+	if byPath > 0 || bySite >= fetchFailuresPerSite {
+		return
 	}
+	c.record(ctx, site, level, path, status, fmt.Errorf("failed to fetch %s from %s@%s: %w", path, site.GithubRepo, site.GithubBranch, err))
+}
 
-	return pages.PublicSite(w, r, site, htmlContent)
+// record stores a log entry for the site, logging instead if the entry cannot be saved.
+// The entry is kept even when the visitor has already gone away.
+func (c *PublicSiteController) record(ctx context.Context, site *models.Site, level, path string, status int, err error) {
+	if err := c.logs.Create(context.WithoutCancel(ctx), models.NewSiteLog(site.ID, level, path, status, err)); err != nil {
+		slog.Error("failed to record site log", "error", err, "site_id", site.ID, "path", path)
+	}
 }
@@ -0,0 +1,57 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/pages"
+)
+
+type SecondFactorController interface {
+	Show(w http.ResponseWriter, r *http.Request) error
+}
+
+type secondFactorController struct {
+	accounts *Accounts
+	passkeys repositories.PasskeysRepository
+}
+
+func NewSecondFactorController(accounts *Accounts, passkeys repositories.PasskeysRepository) SecondFactorController {
+	return &secondFactorController{
+		accounts: accounts,
+		passkeys: passkeys,
+	}
+}
+
+// Show asks for the second factor of a pending sign in
+func (c *secondFactorController) Show(w http.ResponseWriter, r *http.Request) error {
+	redirectTo := safeRedirect(r.URL.Query().Get("redirect"))
+
+	session, err := c.accounts.pendingSession(r)
+	if errors.Is(err, repositories.ErrNotFound) {
+		// Expired, or already completed
+		http.Redirect(w, r, "/sign-in?redirect="+url.QueryEscape(redirectTo), http.StatusSeeOther)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	passkeys, err := c.passkeys.GetByUserID(r.Context(), session.UserID)
+	if err != nil {
+		return err
+	}
+
+	hasTOTP, err := c.accounts.hasTOTP(r.Context(), session.UserID)
+	if err != nil {
+		return err
+	}
+
+	return pages.SecondFactor(w, r, pages.SecondFactorProps{
+		Redirect: redirectTo,
+		Passkey:  len(passkeys) > 0,
+		TOTP:     hasTOTP,
+	})
+}
@@ -1,31 +1,142 @@
 package controllers
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/frenchsoftware/libvalidator/validator"
+	"github.com/gorilla/mux"
+	"github.com/hyperstitieux/template/audit"
 	"github.com/hyperstitieux/template/auth"
+	"github.com/hyperstitieux/template/database/models"
 	"github.com/hyperstitieux/template/database/repositories"
 	"github.com/hyperstitieux/template/pages"
+	"github.com/hyperstitieux/template/quota"
 )
 
+// errLastIdentity means the account would be left without a way to sign in
+var errLastIdentity = errors.New("last sign-in provider")
+
+// errAccountKept rolls back the deletion of an account that still has sites or
+// organizations depending on it
+var errAccountKept = errors.New("account kept")
+
+// settingsUsageDays is the number of days of usage shown on the settings page
+const settingsUsageDays = 14
+
+// apiTokenExpirations are the lifetimes offered for API tokens, zero never expires
+var apiTokenExpirations = map[string]time.Duration{
+	"30":    30 * 24 * time.Hour,
+	"90":    90 * 24 * time.Hour,
+	"365":   365 * 24 * time.Hour,
+	"never": 0,
+}
+
 type SettingsController struct {
-	users repositories.UsersRepository
+	tx          repositories.Transactor
+	users       repositories.UsersRepository
+	sites       *repositories.SitesRepository
+	identities  repositories.IdentitiesRepository
+	passkeys    repositories.PasskeysRepository
+	totp        repositories.TOTPRepository
+	apiTokens   repositories.APITokensRepository
+	orgs        repositories.OrganizationsRepository
+	auditEvents repositories.AuditEventsRepository
+	auditLog    *audit.Log
+	quotas      *quota.Quotas
+	providers   []pages.SignInProvider
 }
 
-func NewSettingsController(users repositories.UsersRepository) *SettingsController {
+func NewSettingsController(tx repositories.Transactor, users repositories.UsersRepository, sites *repositories.SitesRepository, identities repositories.IdentitiesRepository, passkeys repositories.PasskeysRepository, totp repositories.TOTPRepository, apiTokens repositories.APITokensRepository, orgs repositories.OrganizationsRepository, auditEvents repositories.AuditEventsRepository, auditLog *audit.Log, quotas *quota.Quotas, providers []pages.SignInProvider) *SettingsController {
 	return &SettingsController{
-		users: users,
+		tx:          tx,
+		users:       users,
+		sites:       sites,
+		identities:  identities,
+		passkeys:    passkeys,
+		totp:        totp,
+		apiTokens:   apiTokens,
+		orgs:        orgs,
+		auditEvents: auditEvents,
+		auditLog:    auditLog,
+		quotas:      quotas,
+		providers:   providers,
 	}
 }
 
+// Show renders the settings page
+func (c *SettingsController) Show(w http.ResponseWriter, r *http.Request) error {
+	return c.render(w, r, nil)
+}
+
+// render renders the settings page with the user's connected accounts, second factors,
+// sessions and API tokens
+func (c *SettingsController) render(w http.ResponseWriter, r *http.Request, errs validator.ValidationErrors) error {
+	props := pages.SettingsProps{Errors: errs, Providers: c.providers}
+
+	if user := auth.GetCurrentUser(r); user != nil {
+		identities, err := c.identities.GetByUserID(r.Context(), user.ID)
+		if err != nil {
+			return err
+		}
+		props.Identities = identities
+
+		passkeys, err := c.passkeys.GetByUserID(r.Context(), user.ID)
+		if err != nil {
+			return err
+		}
+		props.Passkeys = passkeys
+
+		sessions, err := c.users.GetSessionsByUserID(r.Context(), user.ID)
+		if err != nil {
+			return err
+		}
+		props.Sessions = sessions
+		if token, err := auth.GetSessionToken(r); err == nil {
+			if current, err := c.users.GetSessionByToken(r.Context(), token); err == nil {
+				props.CurrentSessionID = current.ID
+			}
+		}
+
+		credential, err := c.totp.Get(r.Context(), user.ID)
+		if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+			return err
+		}
+		if credential != nil && credential.ConfirmedAt != nil {
+			props.TOTPEnabled = true
+			props.RecoveryCodesLeft, err = c.totp.CountRecoveryCodes(r.Context(), user.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		props.APITokens, err = c.apiTokens.GetByUserID(r.Context(), user.ID)
+		if err != nil {
+			return err
+		}
+
+		props.Usage, err = c.quotas.Report(r.Context(), user.ID, settingsUsageDays)
+		if err != nil {
+			return err
+		}
+	}
+
+	return pages.Settings(w, r, props)
+}
+
 // UpdateProfile handles profile update requests
 func (c *SettingsController) UpdateProfile(w http.ResponseWriter, r *http.Request) error {
 	// Get authenticated user
 	user := auth.GetCurrentUser(r)
 	if user == nil {
-		http.Redirect(w, r, "/auth/google?redirect=/settings", http.StatusTemporaryRedirect)
+		http.Redirect(w, r, "/sign-in?redirect=/settings", http.StatusTemporaryRedirect)
 		return nil
 	}
 
@@ -37,40 +148,336 @@ func (c *SettingsController) UpdateProfile(w http.ResponseWriter, r *http.Reques
 	ok, errs := v.Validate(r)
 	if !ok {
 		// Render settings page with validation errors
-		return pages.SettingsWithErrors(w, r, errs)
+		return c.render(w, r, errs)
 	}
 
 	// Get name from form
 	name := r.FormValue("name")
 
 	// Update user name
+	before := map[string]any{"name": user.Name}
 	user.Name = name
-	if err := c.users.UpdateUser(user); err != nil {
+	if err := c.users.UpdateUser(r.Context(), user); err != nil {
 		slog.Error("failed to update user", "error", err, "user_id", user.ID)
 		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
 		return nil
 	}
+	if changes := audit.Diff(before, map[string]any{"name": user.Name}); len(changes) > 0 {
+		c.auditLog.Record(r, user, models.AuditProfileUpdate, models.AuditTargetUser, user.ID, changes)
+	}
 
 	// Redirect back to settings page
 	http.Redirect(w, r, "/settings", http.StatusSeeOther)
 	return nil
 }
 
+// DisconnectIdentity unlinks a sign-in provider from the account, as long as another
+// one is left to sign in with
+func (c *SettingsController) DisconnectIdentity(w http.ResponseWriter, r *http.Request) error {
+	// Get authenticated user
+	user := auth.GetCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in?redirect=/settings", http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	provider := mux.Vars(r)["provider"]
+
+	err := c.tx.Transaction(r.Context(), func(ctx context.Context) error {
+		identities, err := c.identities.GetByUserID(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		if len(identities) < 2 {
+			return errLastIdentity
+		}
+		return c.identities.Delete(ctx, user.ID, provider)
+	})
+	switch {
+	case errors.Is(err, errLastIdentity):
+		http.Error(w, "Connect another account before disconnecting this one", http.StatusConflict)
+		return nil
+	case errors.Is(err, repositories.ErrNotFound):
+		http.NotFound(w, r)
+		return nil
+	case err != nil:
+		slog.Error("failed to disconnect identity", "error", err, "user_id", user.ID, "provider", provider)
+		http.Error(w, "Failed to disconnect account", http.StatusInternalServerError)
+		return nil
+	}
+	c.auditLog.Record(r, user, models.AuditIdentityDisconnect, models.AuditTargetUser, user.ID, map[string]models.AuditChange{
+		"provider": {Before: provider},
+	})
+
+	if err := rotateSession(w, r, c.users); err != nil {
+		return err
+	}
+
+	// Redirect back to settings page
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+	return nil
+}
+
+// Audit lists the sign-ins and changes of the user's account, a page at a time
+func (c *SettingsController) Audit(w http.ResponseWriter, r *http.Request) error {
+	user := auth.GetCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in?redirect=/settings/audit", http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	before, _ := strconv.ParseInt(r.URL.Query().Get("before"), 10, 64)
+	events, err := c.auditEvents.GetByUserID(r.Context(), user.ID, before, auditEventsLimit)
+	if err != nil {
+		return err
+	}
+
+	return pages.AuditLog(w, r, events, nextAuditPage(events))
+}
+
+// RevokeSession signs the user out of one of their other sessions
+func (c *SettingsController) RevokeSession(w http.ResponseWriter, r *http.Request) error {
+	// Get authenticated user
+	user := auth.GetCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in?redirect=/settings", http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil
+	}
+
+	err = c.users.DeleteUserSession(r.Context(), user.ID, id)
+	if errors.Is(err, repositories.ErrNotFound) {
+		http.NotFound(w, r)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// Revoking the current session signs out, settings then asks to sign in again
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+	return nil
+}
+
+// RevokeOtherSessions signs the user out everywhere but here
+func (c *SettingsController) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) error {
+	// Get authenticated user
+	user := auth.GetCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in?redirect=/settings", http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	token, err := auth.GetSessionToken(r)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := c.users.DeleteOtherSessions(r.Context(), user.ID, token)
+	if err != nil {
+		return err
+	}
+	slog.Info("signed out other sessions", "user_id", user.ID, "sessions", revoked)
+
+	// Whoever had those sessions may have seen this one's token too
+	if err := rotateSession(w, r, c.users); err != nil {
+		return err
+	}
+
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+	return nil
+}
+
+// CreateAPIToken creates a personal access token and shows it, the only time it can
+// be seen
+func (c *SettingsController) CreateAPIToken(w http.ResponseWriter, r *http.Request) error {
+	// Get authenticated user
+	user := auth.GetCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in?redirect=/settings", http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	v := validator.New(
+		validator.Field("token_name").Required().MinLength(1).MaxLength(50),
+	)
+	ok, errs := v.Validate(r)
+	if !ok {
+		return c.render(w, r, errs)
+	}
+
+	var scopes []string
+	for _, scope := range models.APITokenScopes {
+		if slices.Contains(r.Form["scopes"], scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return c.render(w, r, validator.ValidationErrors{"scopes": {"Choose at least one permission"}})
+	}
+
+	expiresIn, ok := apiTokenExpirations[r.FormValue("expires_in")]
+	if !ok {
+		return c.render(w, r, validator.ValidationErrors{"expires_in": {"Choose when the token expires"}})
+	}
+
+	random, err := generateRandomToken(32)
+	if err != nil {
+		return err
+	}
+	secret := auth.APITokenPrefix + strings.TrimRight(random, "=")
+
+	token := &models.APIToken{
+		UserID: user.ID,
+		Name:   r.FormValue("token_name"),
+		Prefix: secret[:len(auth.APITokenPrefix)+6],
+		Scopes: scopes,
+	}
+	if expiresIn > 0 {
+		expiresAt := time.Now().Add(expiresIn)
+		token.ExpiresAt = &expiresAt
+	}
+	if err := c.apiTokens.Create(r.Context(), token, secret); err != nil {
+		return err
+	}
+	slog.Info("created api token", "user_id", user.ID, "token_id", token.ID, "scopes", scopes)
+	c.auditLog.Record(r, user, models.AuditAPITokenCreate, models.AuditTargetAPIToken, token.ID, audit.Diff(nil, map[string]any{
+		"name":       token.Name,
+		"scopes":     scopes,
+		"expires_at": token.ExpiresAt,
+	}))
+
+	return pages.APITokenCreated(w, r, token, secret)
+}
+
+// RevokeAPIToken deletes one of the user's API tokens, which stops working at once
+func (c *SettingsController) RevokeAPIToken(w http.ResponseWriter, r *http.Request) error {
+	// Get authenticated user
+	user := auth.GetCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in?redirect=/settings", http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil
+	}
+
+	err = c.apiTokens.Delete(r.Context(), user.ID, id)
+	if errors.Is(err, repositories.ErrNotFound) {
+		http.NotFound(w, r)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.auditLog.Record(r, user, models.AuditAPITokenRevoke, models.AuditTargetAPIToken, id, nil)
+
+	http.Redirect(w, r, "/settings#api-tokens", http.StatusSeeOther)
+	return nil
+}
+
+// deleteAccount deletes the user, or returns why they can't be deleted yet
+//
+// Sites are kept: the user gives them away or deletes them first. Organizations the
+// user is alone in go away with the account, once their sites are transferred or
+// deleted. In the others, the sites they created are credited to the most privileged
+// remaining member, unless the organization would be left without an owner.
+func (c *SettingsController) deleteAccount(ctx context.Context, user *models.User) (string, error) {
+	sites, err := (*c.sites).GetByUserID(ctx, int(user.ID))
+	if err != nil {
+		return "", err
+	}
+	if len(sites) > 0 {
+		return fmt.Sprintf("You still own %d site(s), transfer them to another user or organization or delete them first", len(sites)), nil
+	}
+
+	orgs, err := c.orgs.GetByUserID(ctx, user.ID)
+	if err != nil {
+		return "", err
+	}
+	var emptied []int64
+	successors := make(map[int64]int64)
+	for _, org := range orgs {
+		members, err := c.orgs.GetMembers(ctx, org.ID)
+		if err != nil {
+			return "", err
+		}
+		if len(members) == 1 {
+			orgSites, err := (*c.sites).GetByOrganizationID(ctx, org.ID)
+			if err != nil {
+				return "", err
+			}
+			if len(orgSites) > 0 {
+				return fmt.Sprintf("%s still has %d site(s) and no other member, transfer them or delete them first", org.Name, len(orgSites)), nil
+			}
+			emptied = append(emptied, org.ID)
+			continue
+		}
+		if org.Role == models.RoleOwner && countOwners(members) == 1 {
+			return "You are the only owner of " + org.Name + ", make another member owner or delete the organization first", nil
+		}
+		successors[org.ID] = successor(members, user.ID)
+	}
+
+	for _, id := range emptied {
+		if err := c.orgs.Delete(ctx, id); err != nil {
+			return "", err
+		}
+	}
+	for orgID, successorID := range successors {
+		if err := (*c.sites).ReassignCreator(ctx, orgID, int(user.ID), int(successorID)); err != nil {
+			return "", err
+		}
+	}
+	return "", c.users.DeleteUser(ctx, user.ID)
+}
+
 // DeleteAccount handles account deletion requests
 func (c *SettingsController) DeleteAccount(w http.ResponseWriter, r *http.Request) error {
 	// Get authenticated user
 	user := auth.GetCurrentUser(r)
 	if user == nil {
-		http.Redirect(w, r, "/auth/google", http.StatusTemporaryRedirect)
+		http.Redirect(w, r, "/sign-in", http.StatusTemporaryRedirect)
 		return nil
 	}
 
-	// Delete user account
-	if err := c.users.DeleteUser(user.ID); err != nil {
+	// The checks run in the transaction deleting the account, so a site created or
+	// transferred in meanwhile can't go away with it. The database refuses to delete
+	// users and organizations that still have sites anyway.
+	var refusal string
+	err := c.tx.Transaction(r.Context(), func(ctx context.Context) error {
+		var err error
+		refusal, err = c.deleteAccount(ctx, user)
+		if err == nil && refusal != "" {
+			return errAccountKept
+		}
+		return err
+	})
+	if errors.Is(err, errAccountKept) {
+		return c.render(w, r, validator.ValidationErrors{"delete_account": {refusal}})
+	}
+	if errors.Is(err, repositories.ErrConflict) {
+		return c.render(w, r, validator.ValidationErrors{
+			"delete_account": {"Your sites changed while deleting your account, try again"},
+		})
+	}
+	if err != nil {
 		slog.Error("failed to delete user", "error", err, "user_id", user.ID)
 		http.Error(w, "Failed to delete account", http.StatusInternalServerError)
 		return nil
 	}
+	c.auditLog.Record(r, user, models.AuditAccountDelete, models.AuditTargetUser, user.ID, audit.Diff(map[string]any{
+		"email": user.Email,
+		"name":  user.Name,
+	}, nil))
 
 	// Clear session cookie
 	auth.ClearSessionCookie(w, r)
@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/hyperstitieux/template/pages"
+)
+
+type SignInController interface {
+	Show(w http.ResponseWriter, r *http.Request) error
+}
+
+type signInController struct {
+	providers   []pages.SignInProvider
+	emailSignIn bool
+}
+
+func NewSignInController(providers []pages.SignInProvider, emailSignIn bool) SignInController {
+	return &signInController{
+		providers:   providers,
+		emailSignIn: emailSignIn,
+	}
+}
+
+// Show renders the sign in page with a button per configured provider and, when
+// enabled, the form requesting a sign in link by email
+func (c *signInController) Show(w http.ResponseWriter, r *http.Request) error {
+	return pages.SignIn(w, r, pages.SignInProps{
+		Providers:   c.providers,
+		EmailSignIn: c.emailSignIn,
+	})
+}
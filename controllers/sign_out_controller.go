@@ -33,7 +33,7 @@ func (c *signOutController) Handle(w http.ResponseWriter, r *http.Request) error
 	}
 
 	// Delete session from database
-	if err := c.users.DeleteSession(token); err != nil {
+	if err := c.users.DeleteSession(r.Context(), token); err != nil {
 		// Log error but continue with logout
 		fmt.Printf("failed to delete session: %v\n", err)
 	}
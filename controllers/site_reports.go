@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/frenchsoftware/libvalidator/validator"
+	"github.com/hyperstitieux/template/auth"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/mail"
+	"github.com/hyperstitieux/template/pages"
+	"github.com/hyperstitieux/template/router"
+)
+
+const (
+	// siteReportWindow is the period over which reports are counted per IP address
+	siteReportWindow = time.Hour
+	// siteReportsPerIP is the number of reports an IP address may send per window
+	siteReportsPerIP = 5
+)
+
+// SiteReportsController takes the reports of abuse visitors send from the footer of
+// public sites
+type SiteReportsController struct {
+	reports       repositories.SiteReportsRepository
+	sites         *repositories.SitesRepository
+	users         repositories.UsersRepository
+	organizations repositories.OrganizationsRepository
+	mailer        mail.Sender
+	baseURL       string
+	// domain is the host of the dashboard, sites being served on its subdomains
+	domain string
+}
+
+func NewSiteReportsController(reports repositories.SiteReportsRepository, sites *repositories.SitesRepository, users repositories.UsersRepository, organizations repositories.OrganizationsRepository, mailer mail.Sender, baseURL string) *SiteReportsController {
+	return &SiteReportsController{
+		reports:       reports,
+		sites:         sites,
+		users:         users,
+		organizations: organizations,
+		mailer:        mailer,
+		baseURL:       baseURL,
+		domain:        baseHostname(baseURL),
+	}
+}
+
+// baseHostname returns the host of the base URL, without its port
+func baseHostname(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// New shows the report form of the site given by slug, filled in with the page the
+// visitor came from
+func (c *SiteReportsController) New(w http.ResponseWriter, r *http.Request) error {
+	site, err := c.site(w, r)
+	if site == nil {
+		return err
+	}
+
+	props := pages.ReportSiteProps{Site: site, URL: r.URL.Query().Get("url")}
+	if user := auth.GetCurrentUser(r); user != nil {
+		props.Email = user.Email
+	}
+	return pages.ReportSite(w, r, props)
+}
+
+// Create stores a report for the admins and tells the owners of the site it was
+// reported
+func (c *SiteReportsController) Create(w http.ResponseWriter, r *http.Request) error {
+	site, err := c.site(w, r)
+	if site == nil {
+		return err
+	}
+
+	props := pages.ReportSiteProps{
+		Site:     site,
+		Category: r.FormValue("category"),
+		URL:      strings.TrimSpace(r.FormValue("url")),
+		Details:  strings.TrimSpace(r.FormValue("details")),
+		Email:    strings.ToLower(strings.TrimSpace(r.FormValue("email"))),
+	}
+
+	v := validator.New(
+		validator.Field("category").Custom(func(value string) string {
+			if !slices.Contains(models.ReportCategories, value) {
+				return "Choose what is wrong with the site"
+			}
+			return ""
+		}),
+		validator.Field("url").Required().MaxLength(2048).Custom(func(value string) string {
+			if value != "" && !isSitePage(site, c.domain, value) {
+				return "Enter the address of a page of " + site.Slug
+			}
+			return ""
+		}),
+		validator.Field("details").MaxLength(2000),
+		validator.Field("email").Required().IsValidEmail().MaxLength(254),
+	)
+	ok, errs := v.ValidateData(map[string]string{
+		"category": props.Category,
+		"url":      props.URL,
+		"details":  props.Details,
+		"email":    props.Email,
+	})
+	if !ok {
+		props.Errors = errs
+		return pages.ReportSite(w, r, props)
+	}
+
+	ip := router.ClientIP(r)
+	count, err := c.reports.CountSince(r.Context(), ip, time.Now().Add(-siteReportWindow))
+	if err != nil {
+		return err
+	}
+	if count >= siteReportsPerIP {
+		props.Errors = validator.ValidationErrors{"email": {"Too many reports were sent, try again in an hour"}}
+		return pages.ReportSite(w, r, props)
+	}
+
+	report := &models.SiteReport{
+		SiteID:        site.ID,
+		Category:      props.Category,
+		URL:           props.URL,
+		Details:       props.Details,
+		ReporterEmail: props.Email,
+		IP:            ip,
+	}
+	if err := c.reports.Create(r.Context(), report); err != nil {
+		return err
+	}
+	slog.Info("reported site", "site_id", site.ID, "report_id", report.ID, "category", report.Category)
+
+	// Owners are told of the first open report only, further ones would repeat it
+	open, err := c.reports.CountOpen(r.Context(), site.ID)
+	if err != nil {
+		return err
+	}
+	if open == 1 {
+		c.notifyOwners(r.Context(), site, report)
+	}
+
+	return pages.SiteReportSent(w, r, site)
+}
+
+// notifyOwners emails the owners of a reported site. The reporter's contact and
+// details are only shown to the admins.
+func (c *SiteReportsController) notifyOwners(ctx context.Context, site *models.Site, report *models.SiteReport) {
+	emails, err := siteOwnerEmails(ctx, c.users, c.organizations, site)
+	if err != nil {
+		slog.Error("failed to get site owners", "error", err, "site_id", site.ID)
+		return
+	}
+
+	for _, email := range emails {
+		err := c.mailer.Send(ctx, &mail.Message{
+			To:      email,
+			Subject: fmt.Sprintf("%s was reported", site.Slug),
+			Body: fmt.Sprintf("A visitor reported %s on your site %s for: %s.\n\n", report.URL, site.Slug, models.ReportCategoryNames[report.Category]) +
+				"The admins of Internet Publishing will review the report, and may suspend the site if it breaks the rules. You can review the site from your dashboard:\n\n" +
+				fmt.Sprintf("%s/sites/%d\n", c.baseURL, site.ID),
+		})
+		if err != nil {
+			// The report is still in the admins' queue
+			slog.Error("failed to send site report email", "error", err, "report_id", report.ID)
+		}
+	}
+}
+
+// site loads the site given by slug in the query or form. Requests for a site that
+// doesn't exist are answered, and no site is returned.
+func (c *SiteReportsController) site(w http.ResponseWriter, r *http.Request) (*models.Site, error) {
+	site, err := (*c.sites).GetBySlug(r.Context(), r.FormValue("site"))
+	if errors.Is(err, repositories.ErrNotFound) {
+		http.NotFound(w, r)
+		return nil, nil
+	}
+	return site, err
+}
+
+// isSitePage tells whether rawURL is the address of a page on the subdomain of site
+// under domain
+func isSitePage(site *models.Site, domain, rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || domain == "" {
+		return false
+	}
+	return strings.EqualFold(u.Hostname(), site.Slug+"."+domain)
+}
+
+// siteOwnerEmails returns who answers for a site: its user for a personal site, or the
+// members of its organization who manage sites
+func siteOwnerEmails(ctx context.Context, users repositories.UsersRepository, organizations repositories.OrganizationsRepository, site *models.Site) ([]string, error) {
+	if site.OrganizationID == nil {
+		user, err := users.GetUserByID(ctx, int64(site.UserID))
+		if err != nil {
+			return nil, err
+		}
+		return []string{user.Email}, nil
+	}
+
+	members, err := organizations.GetMembers(ctx, *site.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	var emails []string
+	for _, member := range members {
+		if models.RoleAtLeast(member.Role, siteManageRole) {
+			emails = append(emails, member.Email)
+		}
+	}
+	return emails, nil
+}
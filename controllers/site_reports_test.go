@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"testing"
+
+	"github.com/hyperstitieux/template/database/models"
+)
+
+func TestIsSitePage(t *testing.T) {
+	site := &models.Site{Slug: "docs"}
+
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://docs.internetpublishing.co/", true},
+		{"http://docs.internetpublishing.co:8080/guide?x=1", true},
+		{"https://DOCS.InternetPublishing.co/guide", true},
+		{"https://docs.attacker.com/", false},
+		{"https://docs.internetpublishing.co.attacker.com/", false},
+		{"https://blog.internetpublishing.co/", false},
+		{"https://internetpublishing.co/sites", false},
+		{"javascript://docs.internetpublishing.co/%0aalert(1)", false},
+		{"docs.internetpublishing.co/guide", false},
+	}
+
+	for _, tt := range tests {
+		if got := isSitePage(site, baseHostname("https://internetpublishing.co"), tt.url); got != tt.want {
+			t.Errorf("isSitePage(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/frenchsoftware/libvalidator/validator"
+	"github.com/gorilla/mux"
+	"github.com/hyperstitieux/template/audit"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/mail"
+	"github.com/hyperstitieux/template/quota"
+	"github.com/hyperstitieux/template/router"
+	"github.com/hyperstitieux/template/views"
+)
+
+// siteTransferDuration is how long the recipient of a site transfer has to accept it
+const siteTransferDuration = 7 * 24 * time.Hour
+
+var errTransferWithdrawn = router.NewHTTPError(http.StatusConflict, "This transfer was withdrawn, its sender can no longer give the site away")
+
+// Transfer offers the site to another user, by email, or to an organization, by slug.
+// The site changes hands once the recipient accepts.
+func (c *SitesController) Transfer(w http.ResponseWriter, r *http.Request) error {
+	user := views.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in", http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	site, role, err := c.authorizedSite(w, r, user, siteTransferRole)
+	if site == nil {
+		return err
+	}
+
+	transfer := &models.SiteTransfer{
+		SiteID:     site.ID,
+		FromUserID: user.ID,
+		ExpiresAt:  time.Now().Add(siteTransferDuration),
+	}
+
+	// Recipients are told by email: the user, or the admins of the organization
+	var notify []string
+	recipient := strings.TrimSpace(r.FormValue("recipient"))
+	switch {
+	case recipient == "":
+		return c.render(w, r, site, role, validator.ValidationErrors{"recipient": {"Enter an email address or an organization slug"}})
+	case strings.Contains(recipient, "@"):
+		to, err := c.users.GetUserByEmail(r.Context(), strings.ToLower(recipient))
+		if errors.Is(err, repositories.ErrNotFound) {
+			return c.render(w, r, site, role, validator.ValidationErrors{"recipient": {"No account uses this email address"}})
+		}
+		if err != nil {
+			return err
+		}
+		if site.OrganizationID == nil && int64(site.UserID) == to.ID {
+			return c.render(w, r, site, role, validator.ValidationErrors{"recipient": {"The site already belongs to this user"}})
+		}
+		transfer.ToUserID = &to.ID
+		transfer.Recipient = to.Email
+		notify = append(notify, to.Email)
+	default:
+		org, err := c.organizations.GetBySlug(r.Context(), recipient)
+		if errors.Is(err, repositories.ErrNotFound) {
+			return c.render(w, r, site, role, validator.ValidationErrors{"recipient": {"No organization has this slug"}})
+		}
+		if err != nil {
+			return err
+		}
+		if site.OrganizationID != nil && *site.OrganizationID == org.ID {
+			return c.render(w, r, site, role, validator.ValidationErrors{"recipient": {"The site already belongs to this organization"}})
+		}
+		transfer.ToOrganizationID = &org.ID
+		transfer.Recipient = org.Name
+
+		members, err := c.organizations.GetMembers(r.Context(), org.ID)
+		if err != nil {
+			return err
+		}
+		for _, member := range members {
+			if models.RoleAtLeast(member.Role, siteManageRole) {
+				notify = append(notify, member.Email)
+			}
+		}
+	}
+
+	err = c.transfers.Create(r.Context(), transfer)
+	if errors.Is(err, repositories.ErrConflict) {
+		return c.render(w, r, site, role, validator.ValidationErrors{"recipient": {"A transfer of this site is already pending, cancel it first"}})
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("offered site transfer", "site_id", site.ID, "transfer_id", transfer.ID, "user_id", user.ID)
+
+	for _, email := range notify {
+		err := c.mailer.Send(r.Context(), &mail.Message{
+			To:      email,
+			Subject: fmt.Sprintf("%s wants to transfer %s to you", user.Name, site.Slug),
+			Body: fmt.Sprintf("%s wants to transfer the site %s to %s on Internet Publishing. The site keeps its address and history.\n\n", user.Name, site.Slug, transfer.Recipient) +
+				"Accept or decline it from your sites:\n\n" +
+				c.baseURL + "/sites\n\n" +
+				fmt.Sprintf("The offer expires in %d days.\n", int(siteTransferDuration.Hours()/24)),
+		})
+		if err != nil {
+			// The transfer is still listed on the recipient's sites page
+			slog.Error("failed to send site transfer email", "error", err, "transfer_id", transfer.ID)
+		}
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/sites/%d#transfer", site.ID), http.StatusSeeOther)
+	return nil
+}
+
+// CancelTransfer withdraws the pending transfer of the site
+func (c *SitesController) CancelTransfer(w http.ResponseWriter, r *http.Request) error {
+	user := views.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in", http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	site, _, err := c.authorizedSite(w, r, user, siteTransferRole)
+	if site == nil {
+		return err
+	}
+
+	transfer, err := c.transfers.GetBySiteID(r.Context(), site.ID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		http.NotFound(w, r)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := c.transfers.Delete(r.Context(), transfer.ID); err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		return err
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/sites/%d#transfer", site.ID), http.StatusSeeOther)
+	return nil
+}
+
+// AcceptTransfer hands the site over to the user, or to their organization with the
+// user credited for it
+func (c *SitesController) AcceptTransfer(w http.ResponseWriter, r *http.Request) error {
+	user := views.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in?redirect=/sites", http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	transfer, err := c.receivedTransfer(w, r, user)
+	if transfer == nil {
+		return err
+	}
+
+	var site *models.Site
+	var withdrawn bool
+	err = c.tx.Transaction(r.Context(), func(ctx context.Context) error {
+		site, err = (*c.sites).GetByID(ctx, transfer.SiteID)
+		if err != nil {
+			return err
+		}
+
+		// The offer only holds while its sender may still give the site away
+		role, err := siteRole(ctx, c.organizations, site, transfer.FromUserID)
+		if err != nil {
+			return err
+		}
+		if !models.RoleAtLeast(role, siteTransferRole) {
+			withdrawn = true
+			return c.transfers.Delete(ctx, transfer.ID)
+		}
+
+		// The site counts against the plan of the user credited for it, as when creating one
+		if err := c.quotas.CheckSites(ctx, user.ID); err != nil {
+			return err
+		}
+
+		if err := (*c.sites).UpdateOwner(ctx, transfer.SiteID, int(user.ID), transfer.ToOrganizationID); err != nil {
+			return err
+		}
+		return c.transfers.Delete(ctx, transfer.ID)
+	})
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		return router.NewHTTPError(http.StatusForbidden, exceeded.Message)
+	}
+	if err != nil {
+		return err
+	}
+	if withdrawn {
+		return errTransferWithdrawn
+	}
+	before := audit.Site(site)
+	slog.Info("accepted site transfer", "site_id", transfer.SiteID, "transfer_id", transfer.ID, "user_id", user.ID)
+	site.UserID = int(user.ID)
+	site.OrganizationID = transfer.ToOrganizationID
+	c.auditLog.Record(r, user, models.AuditSiteTransferAccept, models.AuditTargetSite, site.ID, audit.Diff(before, audit.Site(site)))
+
+	http.Redirect(w, r, fmt.Sprintf("/sites/%d", transfer.SiteID), http.StatusSeeOther)
+	return nil
+}
+
+// DeclineTransfer refuses a site transfer, which stays with its owner
+func (c *SitesController) DeclineTransfer(w http.ResponseWriter, r *http.Request) error {
+	user := views.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in?redirect=/sites", http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	transfer, err := c.receivedTransfer(w, r, user)
+	if transfer == nil {
+		return err
+	}
+
+	if err := c.transfers.Delete(r.Context(), transfer.ID); err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		return err
+	}
+	slog.Info("declined site transfer", "site_id", transfer.SiteID, "transfer_id", transfer.ID, "user_id", user.ID)
+
+	http.Redirect(w, r, "/sites", http.StatusSeeOther)
+	return nil
+}
+
+// receivedTransfer loads the transfer from the URL if the user may answer it. Others
+// are reported as not found.
+func (c *SitesController) receivedTransfer(w http.ResponseWriter, r *http.Request, user *models.User) (*models.SiteTransfer, error) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, nil
+	}
+
+	transfer, err := c.transfers.GetByID(r.Context(), id)
+	if errors.Is(err, repositories.ErrNotFound) {
+		http.NotFound(w, r)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := canReceiveTransfer(r.Context(), c.organizations, transfer, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		http.NotFound(w, r)
+		return nil, nil
+	}
+
+	return transfer, nil
+}
@@ -1,51 +1,311 @@
 package controllers
 
 import (
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"regexp"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/frenchsoftware/libvalidator/validator"
 	"github.com/gorilla/mux"
+	"github.com/hyperstitieux/template/audit"
+	"github.com/hyperstitieux/template/database/models"
 	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/deploy"
+	"github.com/hyperstitieux/template/github"
+	"github.com/hyperstitieux/template/linkcheck"
+	"github.com/hyperstitieux/template/mail"
 	"github.com/hyperstitieux/template/pages"
+	"github.com/hyperstitieux/template/quota"
 	"github.com/hyperstitieux/template/views"
+	"golang.org/x/oauth2"
 )
 
 type SitesController struct {
-	sites *repositories.SitesRepository
+	sites         *repositories.SitesRepository
+	logs          repositories.SiteLogsRepository
+	linkChecks    repositories.LinkChecksRepository
+	linkRunner    *linkcheck.Runner
+	deployments   repositories.DeploymentsRepository
+	deployRunner  *deploy.Runner
+	identities    repositories.IdentitiesRepository
+	organizations repositories.OrganizationsRepository
+	transfers     repositories.SiteTransfersRepository
+	users         repositories.UsersRepository
+	pageViews     repositories.PageViewsRepository
+	auditLog      *audit.Log
+	quotas        *quota.Quotas
+	tx            repositories.Transactor
+	mailer        mail.Sender
+	githubAPIURL  string
+	baseURL       string
 }
 
-func NewSitesController(sites *repositories.SitesRepository) *SitesController {
-	return &SitesController{sites: sites}
+func NewSitesController(tx repositories.Transactor, sites *repositories.SitesRepository, logs repositories.SiteLogsRepository, linkChecks repositories.LinkChecksRepository, linkRunner *linkcheck.Runner, deployments repositories.DeploymentsRepository, deployRunner *deploy.Runner, identities repositories.IdentitiesRepository, organizations repositories.OrganizationsRepository, transfers repositories.SiteTransfersRepository, users repositories.UsersRepository, pageViews repositories.PageViewsRepository, auditLog *audit.Log, quotas *quota.Quotas, mailer mail.Sender, githubAPIURL, baseURL string) *SitesController {
+	return &SitesController{
+		sites:         sites,
+		logs:          logs,
+		linkChecks:    linkChecks,
+		linkRunner:    linkRunner,
+		deployments:   deployments,
+		deployRunner:  deployRunner,
+		identities:    identities,
+		organizations: organizations,
+		transfers:     transfers,
+		users:         users,
+		pageViews:     pageViews,
+		auditLog:      auditLog,
+		quotas:        quotas,
+		tx:            tx,
+		mailer:        mailer,
+		githubAPIURL:  githubAPIURL,
+		baseURL:       baseURL,
+	}
 }
 
+const (
+	// siteLogsLimit is the number of log entries shown on the site page
+	siteLogsLimit = 100
+	// siteDeploymentsLimit is the number of deployments shown on the site page
+	siteDeploymentsLimit = 5
+	// siteAnalyticsDays is the number of days of page views charted on the site page
+	siteAnalyticsDays = 30
+	// siteAnalyticsTop is the number of pages, referrers, countries or devices listed
+	siteAnalyticsTop = 10
+	// staleLinkCheckAfter is when a link check still marked running may be replaced
+	staleLinkCheckAfter = time.Hour
+)
+
 var slugPattern = regexp.MustCompile(`^[a-z0-9-]+$`)
 var repoPattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]+/[a-zA-Z0-9_.-]+$`)
 
+// pathPattern matches the slash separated names of branches and subdirectories
+var pathPattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]+(/[a-zA-Z0-9_.-]+)*$`)
+
+// reservedSlugs are subdomains that can't be used by sites
+var reservedSlugs = []string{"www", "api", "admin", "app", "mail", "ftp", "blog", "shop", "store"}
+
 func (c *SitesController) List(w http.ResponseWriter, r *http.Request) error {
 	user := views.GetUser(r)
 	if user == nil {
-		http.Redirect(w, r, "/auth/google?redirect=/sites", http.StatusTemporaryRedirect)
+		http.Redirect(w, r, "/sign-in?redirect=/sites", http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	sites, err := (*c.sites).GetAccessibleByUserID(r.Context(), int(user.ID))
+	if err != nil {
+		return err
+	}
+
+	organizations, err := c.organizations.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	// Sites offered to the user or their organizations, waiting for an answer
+	transfers, err := c.transfers.GetIncoming(r.Context(), user.ID)
+	if err != nil {
+		return err
+	}
+
+	return pages.Sites(w, r, sites, organizations, transfers)
+}
+
+func (c *SitesController) Show(w http.ResponseWriter, r *http.Request) error {
+	user := views.GetUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in?redirect="+url.QueryEscape(r.URL.Path), http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	site, role, err := c.authorizedSite(w, r, user, siteReadRole)
+	if site == nil {
+		return err
+	}
+
+	return c.render(w, r, site, role, nil)
+}
+
+// render renders the dashboard page of a site, with the errors of its forms
+func (c *SitesController) render(w http.ResponseWriter, r *http.Request, site *models.Site, role string, errs validator.ValidationErrors) error {
+	// Filter logs by severity, ignoring unknown levels
+	level := r.URL.Query().Get("level")
+	if !slices.Contains(models.LogLevels, level) {
+		level = ""
+	}
+
+	logs, err := c.logs.GetBySiteID(r.Context(), site.ID, level, siteLogsLimit)
+	if err != nil {
+		return err
+	}
+
+	// Latest link check report, if the site was ever checked
+	check, err := c.linkChecks.GetLatestBySiteID(r.Context(), site.ID)
+	if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		return err
+	}
+	var brokenLinks []*models.BrokenLink
+	if check != nil {
+		brokenLinks, err = c.linkChecks.GetBrokenLinks(r.Context(), check.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	deployments, err := c.deployments.GetBySiteID(r.Context(), site.ID, siteDeploymentsLimit)
+	if err != nil {
+		return err
+	}
+
+	// Pending transfer of the site, only shown to who can cancel it
+	var transfer *models.SiteTransfer
+	if models.RoleAtLeast(role, siteTransferRole) {
+		transfer, err = c.transfers.GetBySiteID(r.Context(), site.ID)
+		if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+			return err
+		}
+	}
+
+	// Page views of the last days, by day and by what they came from
+	from := time.Now().UTC().AddDate(0, 0, 1-siteAnalyticsDays).Format(time.DateOnly)
+	analytics := &pages.SiteAnalytics{From: from, Counts: make(map[string][]*models.PageViewCount)}
+	if analytics.Days, err = c.pageViews.GetDaily(r.Context(), site.ID, from); err != nil {
+		return err
+	}
+	for _, dimension := range models.PageViewDimensions {
+		if analytics.Counts[dimension], err = c.pageViews.TopCounts(r.Context(), site.ID, from, dimension, siteAnalyticsTop); err != nil {
+			return err
+		}
+	}
+
+	return pages.Site(w, r, pages.SiteProps{
+		Site:        site,
+		Analytics:   analytics,
+		Role:        role,
+		Transfer:    transfer,
+		Errors:      errs,
+		Logs:        logs,
+		Level:       level,
+		LinkCheck:   check,
+		BrokenLinks: brokenLinks,
+		Deployments: deployments,
+	})
+}
+
+// Sync starts a deployment of the site in the background
+func (c *SitesController) Sync(w http.ResponseWriter, r *http.Request) error {
+	user := views.GetUser(r)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return nil
 	}
 
-	sites, err := (*c.sites).GetByUserID(int(user.ID))
+	site, role, err := c.authorizedSite(w, r, user, siteWriteRole)
+	if site == nil {
+		return err
+	}
+
+	_, err = c.deployRunner.Start(r.Context(), site, models.DeploymentTriggerDashboard)
+	if errors.Is(err, deploy.ErrSuspended) {
+		http.Error(w, "This site is suspended", http.StatusConflict)
+		return nil
+	}
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		return c.render(w, r, site, role, validator.ValidationErrors{"sync": {exceeded.Message}})
+	}
 	if err != nil {
 		return err
 	}
 
-	return pages.Sites(w, r, sites)
+	http.Redirect(w, r, fmt.Sprintf("/sites/%d#deployments", site.ID), http.StatusSeeOther)
+	return nil
+}
+
+// CheckLinks starts a broken link check of the site in the background
+func (c *SitesController) CheckLinks(w http.ResponseWriter, r *http.Request) error {
+	user := views.GetUser(r)
+	if user == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil
+	}
+
+	site, _, err := c.authorizedSite(w, r, user, siteWriteRole)
+	if site == nil {
+		return err
+	}
+
+	// Only one check at a time per site, unless the running one looks abandoned
+	check, err := c.linkChecks.GetLatestBySiteID(r.Context(), site.ID)
+	if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		return err
+	}
+	if check == nil || check.Status != models.LinkCheckRunning || time.Since(check.StartedAt) > staleLinkCheckAfter {
+		if _, err := c.linkRunner.Start(r.Context(), site); err != nil {
+			return err
+		}
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/sites/%d#links", site.ID), http.StatusSeeOther)
+	return nil
 }
 
 func (c *SitesController) New(w http.ResponseWriter, r *http.Request) error {
-	return pages.NewSite(w, r, nil)
+	return c.renderNewSite(w, r, nil)
+}
+
+// renderNewSite renders the new site form, offering the repositories of the user's
+// GitHub account when one is connected. GitHub being unavailable only hides the picker.
+func (c *SitesController) renderNewSite(w http.ResponseWriter, r *http.Request, errs validator.ValidationErrors) error {
+	props := pages.NewSiteProps{Errors: errs}
+
+	user := views.GetUser(r)
+	if user == nil {
+		return pages.NewSite(w, r, props)
+	}
+
+	// Organizations the user may create sites for
+	organizations, err := c.organizations.GetByUserID(r.Context(), user.ID)
+	if err != nil {
+		return err
+	}
+	for _, org := range organizations {
+		if models.RoleAtLeast(org.Role, siteManageRole) {
+			props.Organizations = append(props.Organizations, org)
+		}
+	}
+	props.OrganizationID, _ = strconv.ParseInt(r.FormValue("organization_id"), 10, 64)
+
+	identity, err := c.identities.GetByUserAndProvider(r.Context(), user.ID, models.ProviderGitHub)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return pages.NewSite(w, r, props)
+	}
+	if err != nil {
+		return err
+	}
+	props.GitHubConnected = true
+
+	token := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: identity.AccessToken})
+	client := github.NewClient(c.githubAPIURL, oauth2.NewClient(r.Context(), token))
+	repos, err := client.Repositories(r.Context())
+	if err != nil {
+		slog.Warn("failed to list github repositories", "error", err, "user_id", user.ID)
+	}
+	props.Repositories = repos
+
+	return pages.NewSite(w, r, props)
 }
 
 func (c *SitesController) Create(w http.ResponseWriter, r *http.Request) error {
 	user := views.GetUser(r)
 	if user == nil {
-		http.Redirect(w, r, "/auth/google?redirect=/sites/new", http.StatusTemporaryRedirect)
+		http.Redirect(w, r, "/sign-in?redirect=/sites/new", http.StatusTemporaryRedirect)
 		return nil
 	}
 
@@ -58,7 +318,7 @@ func (c *SitesController) Create(w http.ResponseWriter, r *http.Request) error {
 
 	ok, errs := v.Validate(r)
 	if !ok {
-		return pages.NewSite(w, r, errs)
+		return c.renderNewSite(w, r, errs)
 	}
 
 	// Get form values
@@ -68,43 +328,55 @@ func (c *SitesController) Create(w http.ResponseWriter, r *http.Request) error {
 	subdirectory := r.FormValue("subdirectory") // Optional
 
 	// Additional validation
-	additionalErrs := make(validator.ValidationErrors)
+	additionalErrs := siteErrors(slug, githubRepo, githubBranch, subdirectory)
 
-	// Reserved slugs that cannot be used
-	reservedSlugs := []string{"www", "api", "admin", "app", "mail", "ftp", "blog", "shop", "store"}
-	for _, reserved := range reservedSlugs {
-		if slug == reserved {
-			additionalErrs.Add("slug", "This slug is reserved and cannot be used")
-			break
+	// Sites are personal unless created for one of the user's organizations
+	var organizationID *int64
+	if value := r.FormValue("organization_id"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		allowed := false
+		if err == nil {
+			if allowed, err = canCreateSiteFor(r.Context(), c.organizations, id, user.ID); err != nil {
+				return err
+			}
+		}
+		if !allowed {
+			additionalErrs.Add("organization_id", "You can't create sites for this organization")
 		}
+		organizationID = &id
 	}
 
-	if !slugPattern.MatchString(slug) {
-		additionalErrs.Add("slug", "Slug must contain only lowercase letters, numbers, and hyphens")
+	// Check if slug already exists
+	_, err := (*c.sites).GetBySlug(r.Context(), slug)
+	if err == nil {
+		additionalErrs.Add("slug", "This slug is already taken")
+	} else if !errors.Is(err, repositories.ErrNotFound) {
+		return err
 	}
 
-	if !repoPattern.MatchString(githubRepo) {
-		additionalErrs.Add("github_repo", "Invalid repository format (use: username/repository)")
+	if !additionalErrs.IsEmpty() {
+		return c.renderNewSite(w, r, additionalErrs)
 	}
 
-	// Check if slug already exists
-	existing, err := (*c.sites).GetBySlug(slug)
-	if err != nil {
+	// Sites count against the plan of the user creating them
+	var exceeded *quota.ExceededError
+	if err := c.quotas.CheckSites(r.Context(), user.ID); errors.As(err, &exceeded) {
+		additionalErrs.Add("quota", exceeded.Message)
+		return c.renderNewSite(w, r, additionalErrs)
+	} else if err != nil {
 		return err
 	}
-	if existing != nil {
-		additionalErrs.Add("slug", "This slug is already taken")
-	}
 
-	if !additionalErrs.IsEmpty() {
-		return pages.NewSite(w, r, additionalErrs)
+	// Create site, the slug may have been taken since the check above
+	site, err := (*c.sites).Create(r.Context(), int(user.ID), organizationID, slug, githubRepo, githubBranch, subdirectory)
+	if errors.Is(err, repositories.ErrConflict) {
+		additionalErrs.Add("slug", "This slug is already taken")
+		return c.renderNewSite(w, r, additionalErrs)
 	}
-
-	// Create site
-	_, err = (*c.sites).Create(int(user.ID), slug, githubRepo, githubBranch, subdirectory)
 	if err != nil {
 		return err
 	}
+	c.auditLog.Record(r, user, models.AuditSiteCreate, models.AuditTargetSite, site.ID, audit.Diff(nil, audit.Site(site)))
 
 	// Redirect to sites list
 	http.Redirect(w, r, "/sites", http.StatusSeeOther)
@@ -118,33 +390,113 @@ func (c *SitesController) Delete(w http.ResponseWriter, r *http.Request) error {
 		return nil
 	}
 
+	site, _, err := c.authorizedSite(w, r, user, siteManageRole)
+	if site == nil {
+		return err
+	}
+
+	// Delete site
+	if err := (*c.sites).Delete(r.Context(), site.ID); err != nil {
+		return err
+	}
+	c.auditLog.Record(r, user, models.AuditSiteDelete, models.AuditTargetSite, site.ID, audit.Diff(audit.Site(site), nil))
+
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// siteErrors checks the slug, repository, branch and subdirectory of a new site beyond
+// their presence
+func siteErrors(slug, githubRepo, githubBranch, subdirectory string) validator.ValidationErrors {
+	errs := make(validator.ValidationErrors)
+
+	// Reserved slugs that cannot be used
+	if slices.Contains(reservedSlugs, slug) {
+		errs.Add("slug", "This slug is reserved and cannot be used")
+	}
+
+	if !slugPattern.MatchString(slug) {
+		errs.Add("slug", "Slug must contain only lowercase letters, numbers, and hyphens")
+	}
+
+	if !repoPattern.MatchString(githubRepo) {
+		errs.Add("github_repo", "Invalid repository format (use: username/repository)")
+	}
+
+	if !validBranch(githubBranch) {
+		errs.Add("github_branch", "Invalid branch name")
+	}
+
+	if !validSubdirectory(subdirectory) {
+		errs.Add("subdirectory", "Subdirectory must be a path inside the repository, like docs or site/content")
+	}
+
+	return errs
+}
+
+// validBranch tells whether the branch is a git branch name, without the characters
+// and sequences git refuses in refs
+func validBranch(branch string) bool {
+	if len(branch) > 255 || !pathPattern.MatchString(branch) || strings.Contains(branch, "..") {
+		return false
+	}
+	for _, part := range strings.Split(branch, "/") {
+		if strings.HasPrefix(part, ".") || strings.HasPrefix(part, "-") || strings.HasSuffix(part, ".lock") {
+			return false
+		}
+	}
+	return true
+}
+
+// validSubdirectory tells whether the subdirectory is empty, for the root of the
+// repository, or a relative path that stays inside it
+func validSubdirectory(subdirectory string) bool {
+	subdirectory = strings.TrimSuffix(subdirectory, "/")
+	if subdirectory == "" {
+		return true
+	}
+	if len(subdirectory) > 255 || !pathPattern.MatchString(subdirectory) {
+		return false
+	}
+	for _, part := range strings.Split(subdirectory, "/") {
+		if part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// authorizedSite loads the site from the URL and checks the user has at least the
+// role on it, returning their actual role. Sites the user has no role on are reported
+// as not found. It writes the error response itself and returns a nil site when the
+// request should stop.
+func (c *SitesController) authorizedSite(w http.ResponseWriter, r *http.Request, user *models.User, min string) (*models.Site, string, error) {
 	// Get site ID from URL
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
 		http.Error(w, "Invalid site ID", http.StatusBadRequest)
-		return nil
+		return nil, "", nil
 	}
 
-	// Get site to verify ownership
-	site, err := (*c.sites).GetByID(id)
-	if err != nil {
-		return err
+	site, err := (*c.sites).GetByID(r.Context(), id)
+	if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		return nil, "", err
 	}
-	if site == nil {
+	role := ""
+	if site != nil {
+		if role, err = siteRole(r.Context(), c.organizations, site, user.ID); err != nil {
+			return nil, "", err
+		}
+	}
+	if role == "" {
 		http.Error(w, "Site not found", http.StatusNotFound)
-		return nil
+		return nil, "", nil
 	}
-	if site.UserID != int(user.ID) {
+	if !models.RoleAtLeast(role, min) {
 		http.Error(w, "Forbidden", http.StatusForbidden)
-		return nil
+		return nil, "", nil
 	}
 
-	// Delete site
-	if err := (*c.sites).Delete(id); err != nil {
-		return err
-	}
-
-	w.WriteHeader(http.StatusOK)
-	return nil
+	return site, role, nil
 }
@@ -0,0 +1,63 @@
+package controllers
+
+import "testing"
+
+func TestValidBranch(t *testing.T) {
+	tests := []struct {
+		branch string
+		want   bool
+	}{
+		{"main", true},
+		{"feature/new-docs", true},
+		{"release-1.2", true},
+		{"v1.2.3_rc", true},
+		{"", false},
+		{"<script>alert(1)</script>", false},
+		{"main branch", false},
+		{"../main", false},
+		{"a..b", false},
+		{"/main", false},
+		{"main/", false},
+		{"feature//docs", false},
+		{".hidden", false},
+		{"feature/.hidden", false},
+		{"-main", false},
+		{"main.lock", false},
+		{"main~1", false},
+		{"main^", false},
+		{"main:docs", false},
+	}
+
+	for _, tt := range tests {
+		if got := validBranch(tt.branch); got != tt.want {
+			t.Errorf("validBranch(%q) = %v, want %v", tt.branch, got, tt.want)
+		}
+	}
+}
+
+func TestValidSubdirectory(t *testing.T) {
+	tests := []struct {
+		subdirectory string
+		want         bool
+	}{
+		{"", true},
+		{"docs", true},
+		{"docs/", true},
+		{"site/content", true},
+		{".vitepress/dist", true},
+		{"/docs", false},
+		{"../secrets", false},
+		{"docs/../..", false},
+		{"./docs", false},
+		{"docs//content", false},
+		{"<script>alert(1)</script>", false},
+		{"my docs", false},
+		{`docs\content`, false},
+	}
+
+	for _, tt := range tests {
+		if got := validSubdirectory(tt.subdirectory); got != tt.want {
+			t.Errorf("validSubdirectory(%q) = %v, want %v", tt.subdirectory, got, tt.want)
+		}
+	}
+}
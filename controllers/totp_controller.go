@@ -0,0 +1,357 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/frenchsoftware/libvalidator/validator"
+	"github.com/hyperstitieux/template/auth"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/pages"
+	"github.com/hyperstitieux/template/totp"
+)
+
+const (
+	// totpIssuer names the account in authenticator apps
+	totpIssuer = "Internet Publishing"
+	// recoveryCodeCount is how many recovery codes a user gets at once
+	recoveryCodeCount = 10
+	// maxCodeAttempts is how many wrong codes in a row end the session
+	maxCodeAttempts = 5
+)
+
+// recoveryCodeEncoding writes recovery codes in lowercase letters and digits
+var recoveryCodeEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+var errInvalidCode = validator.ValidationErrors{"code": {"This code is not valid, try again"}}
+
+type TOTPController interface {
+	Show(w http.ResponseWriter, r *http.Request) error
+	Enable(w http.ResponseWriter, r *http.Request) error
+	RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) error
+	Disable(w http.ResponseWriter, r *http.Request) error
+	Verify(w http.ResponseWriter, r *http.Request) error
+}
+
+type totpController struct {
+	accounts *Accounts
+	tx       repositories.Transactor
+	totp     repositories.TOTPRepository
+}
+
+// NewTOTPController sets up authenticator apps and checks their codes, or recovery
+// codes, as the second factor of a sign in
+func NewTOTPController(accounts *Accounts, tx repositories.Transactor, totp repositories.TOTPRepository) TOTPController {
+	return &totpController{
+		accounts: accounts,
+		tx:       tx,
+		totp:     totp,
+	}
+}
+
+// Show renders the authenticator app settings, with a new secret to scan when none
+// is set up yet
+func (c *totpController) Show(w http.ResponseWriter, r *http.Request) error {
+	user := auth.GetCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in?redirect=/settings/two-factor", http.StatusTemporaryRedirect)
+		return nil
+	}
+	return c.render(w, r, user, nil)
+}
+
+// render shows the setup page until the user confirmed a code, and the management
+// page after that
+func (c *totpController) render(w http.ResponseWriter, r *http.Request, user *models.User, errs validator.ValidationErrors) error {
+	credential, err := c.totp.Get(r.Context(), user.ID)
+	if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		return err
+	}
+
+	if credential != nil && credential.ConfirmedAt != nil {
+		left, err := c.totp.CountRecoveryCodes(r.Context(), user.ID)
+		if err != nil {
+			return err
+		}
+		return pages.TwoFactor(w, r, pages.TwoFactorProps{
+			EnabledAt:         *credential.ConfirmedAt,
+			RecoveryCodesLeft: left,
+			Errors:            errs,
+		})
+	}
+
+	// Keep the secret the user may already have scanned
+	if credential == nil {
+		secret, err := totp.GenerateSecret()
+		if err != nil {
+			return err
+		}
+		if err := c.totp.SaveUnconfirmed(r.Context(), user.ID, secret); err != nil {
+			return err
+		}
+		credential = &models.TOTPCredential{UserID: user.ID, Secret: secret}
+	}
+
+	return pages.TwoFactorSetup(w, r, pages.TwoFactorSetupProps{
+		Secret: credential.Secret,
+		URI:    totp.URI(totpIssuer, user.Email, credential.Secret),
+		Errors: errs,
+	})
+}
+
+// Enable turns on the authenticator app once the user typed a code from it, and
+// shows their recovery codes
+func (c *totpController) Enable(w http.ResponseWriter, r *http.Request) error {
+	user := auth.GetCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in?redirect=/settings/two-factor", http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	credential, err := c.totp.Get(r.Context(), user.ID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		http.Redirect(w, r, "/settings/two-factor", http.StatusSeeOther)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	step, ok := totp.Validate(credential.Secret, r.FormValue("code"), time.Now())
+	if !ok {
+		return c.render(w, r, user, errInvalidCode)
+	}
+
+	var codes []string
+	err = c.tx.Transaction(r.Context(), func(ctx context.Context) error {
+		if err := c.totp.Confirm(ctx, user.ID, step); err != nil {
+			return err
+		}
+		codes, err = c.replaceRecoveryCodes(ctx, user.ID)
+		return err
+	})
+	if errors.Is(err, repositories.ErrNotFound) {
+		// Already confirmed, from another tab
+		http.Redirect(w, r, "/settings/two-factor", http.StatusSeeOther)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.accounts.auditLog.Record(r, user, models.AuditTwoFactorEnable, models.AuditTargetUser, user.ID, nil)
+
+	if err := rotateSession(w, r, c.accounts.users); err != nil {
+		return err
+	}
+
+	return pages.RecoveryCodes(w, r, codes)
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after checking a code
+func (c *totpController) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) error {
+	user := auth.GetCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in?redirect=/settings/two-factor", http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	credential, ok, err := c.checkSettingsCode(w, r, user)
+	if err != nil || !ok {
+		return err
+	}
+
+	codes, err := c.replaceRecoveryCodes(r.Context(), credential.UserID)
+	if err != nil {
+		return err
+	}
+
+	return pages.RecoveryCodes(w, r, codes)
+}
+
+// Disable turns off the authenticator app after checking a code
+func (c *totpController) Disable(w http.ResponseWriter, r *http.Request) error {
+	user := auth.GetCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/sign-in?redirect=/settings/two-factor", http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	credential, ok, err := c.checkSettingsCode(w, r, user)
+	if err != nil || !ok {
+		return err
+	}
+
+	if err := c.tx.Transaction(r.Context(), func(ctx context.Context) error {
+		return c.totp.Delete(ctx, credential.UserID)
+	}); err != nil {
+		return err
+	}
+	c.accounts.auditLog.Record(r, user, models.AuditTwoFactorDisable, models.AuditTargetUser, user.ID, nil)
+
+	if err := rotateSession(w, r, c.accounts.users); err != nil {
+		return err
+	}
+
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+	return nil
+}
+
+// Verify completes a pending sign in with a code from the authenticator app or a
+// recovery code
+func (c *totpController) Verify(w http.ResponseWriter, r *http.Request) error {
+	redirectTo := safeRedirect(r.FormValue("redirect"))
+
+	session, err := c.accounts.pendingSession(r)
+	if errors.Is(err, repositories.ErrNotFound) {
+		http.Redirect(w, r, "/sign-in?redirect="+url.QueryEscape(redirectTo), http.StatusSeeOther)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	credential, err := c.totp.Get(r.Context(), session.UserID)
+	if errors.Is(err, repositories.ErrNotFound) || (err == nil && credential.ConfirmedAt == nil) {
+		http.Redirect(w, r, "/sign-in/second-factor?redirect="+url.QueryEscape(redirectTo), http.StatusSeeOther)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	ok, err := c.checkCode(r.Context(), credential, r.FormValue("code"))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		lockedOut, err := c.recordFailure(w, r, credential.UserID)
+		if err != nil || lockedOut {
+			return err
+		}
+		return pages.SecondFactor(w, r, pages.SecondFactorProps{
+			Redirect: redirectTo,
+			Passkey:  c.hasPasskeys(r.Context(), session.UserID),
+			TOTP:     true,
+			Errors:   errInvalidCode,
+		})
+	}
+
+	if err := c.accounts.completeSecondFactor(w, r, session, "totp"); err != nil {
+		return err
+	}
+
+	http.Redirect(w, r, redirectTo, http.StatusSeeOther)
+	return nil
+}
+
+// checkSettingsCode checks the code confirming a change to the authenticator app. It
+// answers the request itself when the code is wrong.
+func (c *totpController) checkSettingsCode(w http.ResponseWriter, r *http.Request, user *models.User) (*models.TOTPCredential, bool, error) {
+	credential, err := c.totp.Get(r.Context(), user.ID)
+	if errors.Is(err, repositories.ErrNotFound) || (err == nil && credential.ConfirmedAt == nil) {
+		http.Redirect(w, r, "/settings/two-factor", http.StatusSeeOther)
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	ok, err := c.checkCode(r.Context(), credential, r.FormValue("code"))
+	if err != nil || ok {
+		return credential, ok, err
+	}
+
+	lockedOut, err := c.recordFailure(w, r, user.ID)
+	if err != nil || lockedOut {
+		return nil, false, err
+	}
+	return nil, false, c.render(w, r, user, errInvalidCode)
+}
+
+// checkCode accepts a code from the authenticator app, once, or an unused recovery code
+func (c *totpController) checkCode(ctx context.Context, credential *models.TOTPCredential, input string) (bool, error) {
+	if step, ok := totp.Validate(credential.Secret, input, time.Now()); ok {
+		err := c.totp.RecordUse(ctx, credential.UserID, step)
+		if errors.Is(err, repositories.ErrConflict) {
+			// Replayed, or older than the last code used
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	code := normalizeRecoveryCode(input)
+	if code == "" {
+		return false, nil
+	}
+	err := c.totp.ConsumeRecoveryCode(ctx, credential.UserID, repositories.HashToken(code))
+	if errors.Is(err, repositories.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// recordFailure counts a wrong code. Past maxCodeAttempts in a row the session ends,
+// so guessing takes a new sign in with the first factor every few tries.
+func (c *totpController) recordFailure(w http.ResponseWriter, r *http.Request, userID int64) (bool, error) {
+	failures, err := c.totp.RecordFailure(r.Context(), userID)
+	if err != nil {
+		return false, err
+	}
+	if failures < maxCodeAttempts {
+		return false, nil
+	}
+
+	if token, err := auth.GetSessionToken(r); err == nil {
+		if err := c.accounts.users.DeleteSession(r.Context(), token); err != nil && !errors.Is(err, repositories.ErrNotFound) {
+			return false, err
+		}
+	}
+	auth.ClearSessionCookie(w, r)
+
+	http.Error(w, "Too many wrong codes. Sign in again to try more.", http.StatusTooManyRequests)
+	return true, nil
+}
+
+// replaceRecoveryCodes stores hashes of new recovery codes and returns the codes,
+// which are shown only once
+func (c *totpController) replaceRecoveryCodes(ctx context.Context, userID int64) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		random := make([]byte, 10)
+		if _, err := rand.Read(random); err != nil {
+			return nil, err
+		}
+		code := recoveryCodeEncoding.EncodeToString(random)
+		codes[i] = code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+		hashes[i] = repositories.HashToken(code)
+	}
+
+	if err := c.totp.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// hasPasskeys tells whether the passkey button belongs on the second factor page
+func (c *totpController) hasPasskeys(ctx context.Context, userID int64) bool {
+	passkeys, err := c.accounts.passkeys.GetByUserID(ctx, userID)
+	return err == nil && len(passkeys) > 0
+}
+
+// normalizeRecoveryCode drops the dashes and spaces people type or paste in codes
+func normalizeRecoveryCode(input string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(strings.TrimSpace(input)))
+}
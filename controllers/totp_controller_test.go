@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/totp"
+)
+
+// newTestTOTP sets up a confirmed authenticator app for a new user
+func newTestTOTP(t *testing.T) (*totpController, *models.TOTPCredential) {
+	t.Helper()
+
+	accounts := newTestAccounts(t)
+	credentials := repositories.NewTOTPRepository(accounts.db)
+	controller := NewTOTPController(accounts.Accounts, accounts.db, credentials).(*totpController)
+	user := accounts.createUser(t, "alice@example.com", true)
+
+	ctx := context.Background()
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := credentials.SaveUnconfirmed(ctx, user.ID, secret); err != nil {
+		t.Fatal(err)
+	}
+	// Confirmed with a code from a while ago, so the codes around now are unused
+	if err := credentials.Confirm(ctx, user.ID, totp.Step(time.Now())-10); err != nil {
+		t.Fatal(err)
+	}
+	credential, err := credentials.Get(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return controller, credential
+}
+
+func TestTOTPCodeReplay(t *testing.T) {
+	controller, credential := newTestTOTP(t)
+	ctx := context.Background()
+
+	// Wait out the end of a period, so that every case runs in the same one
+	if time.Until(time.Unix((totp.Step(time.Now())+1)*int64(totp.Period/time.Second), 0)) < time.Second {
+		time.Sleep(time.Second)
+	}
+	codeAt := func(offset time.Duration) string {
+		code, err := totp.Code(credential.Secret, time.Now().Add(offset))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name string
+		code string
+		want bool
+	}{
+		{"previous code", codeAt(-totp.Period), true},
+		{"previous code again", codeAt(-totp.Period), false},
+		{"current code", codeAt(0), true},
+		{"current code again", codeAt(0), false},
+		{"older code after a newer one", codeAt(-totp.Period), false},
+		{"wrong code", "000000", false},
+	}
+
+	for _, tt := range tests {
+		ok, err := controller.checkCode(ctx, credential, tt.code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != tt.want {
+			t.Errorf("%s: accepted = %v, want %v", tt.name, ok, tt.want)
+		}
+	}
+}
+
+func TestRecoveryCodesWorkOnce(t *testing.T) {
+	controller, credential := newTestTOTP(t)
+	ctx := context.Background()
+
+	codes, err := controller.replaceRecoveryCodes(ctx, credential.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("%d recovery codes, want %d", len(codes), recoveryCodeCount)
+	}
+
+	tests := []struct {
+		name string
+		code string
+		want bool
+	}{
+		{"as shown", codes[0], true},
+		{"used", codes[0], false},
+		{"typed in upper case without dashes", strings.ToUpper(strings.ReplaceAll(codes[1], "-", "")), true},
+		{"used in another format", codes[1], false},
+		{"unknown", "aaaa-bbbb-cccc-dddd", false},
+		{"empty", " - ", false},
+	}
+
+	for _, tt := range tests {
+		ok, err := controller.checkCode(ctx, credential, tt.code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != tt.want {
+			t.Errorf("%s: accepted = %v, want %v", tt.name, ok, tt.want)
+		}
+	}
+
+	left, err := controller.totp.CountRecoveryCodes(ctx, credential.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left != recoveryCodeCount-2 {
+		t.Errorf("%d recovery codes left, want %d", left, recoveryCodeCount-2)
+	}
+
+	// New codes replace the old ones
+	if _, err := controller.replaceRecoveryCodes(ctx, credential.UserID); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := controller.checkCode(ctx, credential, codes[2]); ok {
+		t.Error("a replaced recovery code still works")
+	}
+}
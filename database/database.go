@@ -1,43 +1,74 @@
 package database
 
 import (
+	"context"
 	"database/sql"
-	"embed"
 	"fmt"
+	"strings"
 
+	_ "github.com/jackc/pgx/v5/stdlib"
 	_ "modernc.org/sqlite"
 )
 
-//go:embed schema.sql
-var schemaFS embed.FS
-
 type Database struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Dialect Dialect
 }
 
-// New initializes a new SQLite database connection and runs migrations
+// New initializes a new database connection and applies pending migrations
 func New(databaseURL string) (*Database, error) {
-	db, err := sql.Open("sqlite", databaseURL)
+	d, err := Open(databaseURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, err
 	}
 
-	// Enable foreign keys (disabled by default in SQLite)
-	if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
-		return nil, fmt.Errorf("failed to enable foreign keys: %w", err)
+	if _, err := d.MigrateUp(context.Background()); err != nil {
+		d.Close()
+		return nil, err
 	}
 
-	// Read and execute schema
-	schema, err := schemaFS.ReadFile("schema.sql")
+	return d, nil
+}
+
+// Open initializes a new database connection without touching the schema. The
+// DATABASE_URL scheme picks the backend: PostgreSQL for postgres:// URLs, SQLite otherwise.
+func Open(databaseURL string) (*Database, error) {
+	dialect := DialectFromURL(databaseURL)
+	if dialect == SQLite {
+		databaseURL = withPragmas(databaseURL)
+	}
+
+	db, err := sql.Open(dialect.driverName(), databaseURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read schema file: %w", err)
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	if _, err := db.Exec(string(schema)); err != nil {
-		return nil, fmt.Errorf("failed to execute schema: %w", err)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	return &Database{DB: db}, nil
+	return &Database{DB: db, Dialect: dialect}, nil
+}
+
+// connectionPragmas are set on every connection of the pool. Running them with db.Exec
+// would only configure whichever connection happened to execute the statement.
+var connectionPragmas = []string{
+	"foreign_keys(1)",    // Enable foreign keys (disabled by default in SQLite)
+	"busy_timeout(5000)", // Wait for locks instead of failing when background jobs write concurrently
+}
+
+// withPragmas appends the connection pragmas to a SQLite database URL
+func withPragmas(databaseURL string) string {
+	separator := "?"
+	if strings.Contains(databaseURL, "?") {
+		separator = "&"
+	}
+	for _, pragma := range connectionPragmas {
+		databaseURL += separator + "_pragma=" + pragma
+		separator = "&"
+	}
+	return databaseURL
 }
 
 // Close closes the database connection
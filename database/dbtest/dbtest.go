@@ -0,0 +1,136 @@
+// Package dbtest opens throwaway databases with every migration applied, to test code
+// against SQLite and PostgreSQL. Each PostgreSQL database is a schema of its own on the
+// server at DATABASE_URL, dropped when the test ends, or without one a server started
+// for the test when PostgreSQL is installed.
+package dbtest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/hyperstitieux/template/database"
+)
+
+// Run runs test once on SQLite and once on PostgreSQL, each time on an empty database
+// with the schema migrated
+func Run(t *testing.T, test func(t *testing.T, db *database.Database)) {
+	t.Run(string(database.SQLite), func(t *testing.T) {
+		test(t, SQLite(t))
+	})
+	t.Run(string(database.Postgres), func(t *testing.T) {
+		test(t, Postgres(t))
+	})
+}
+
+// SQLite opens a migrated SQLite database in a temporary directory
+func SQLite(t testing.TB) *database.Database {
+	t.Helper()
+
+	return open(t, "file:"+filepath.Join(t.TempDir(), "test.db"))
+}
+
+// Postgres opens a migrated database in a new schema of the PostgreSQL server at
+// DATABASE_URL. Without one, it starts a server for the test, and skips the test when
+// PostgreSQL isn't installed.
+func Postgres(t testing.TB) *database.Database {
+	t.Helper()
+
+	serverURL := os.Getenv("DATABASE_URL")
+	if database.DialectFromURL(serverURL) != database.Postgres {
+		return open(t, startPostgres(t))
+	}
+
+	admin, err := database.Open(serverURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	suffix := make([]byte, 8)
+	rand.Read(suffix)
+	schema := "dbtest_" + hex.EncodeToString(suffix)
+	if _, err := admin.DB.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.DB.Exec("DROP SCHEMA " + schema + " CASCADE"); err != nil {
+			t.Errorf("failed to drop schema %s: %v", schema, err)
+		}
+	})
+
+	// Unknown parameters of the URL are set on every connection of the pool
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+
+	return open(t, u.String())
+}
+
+// startPostgres initializes a cluster in a temporary directory and runs a server on it
+// until the test ends, listening only on a Unix socket in that directory. It returns the
+// URL of the server's database.
+func startPostgres(t testing.TB) string {
+	t.Helper()
+
+	initdb, err := exec.LookPath("initdb")
+	if err != nil {
+		t.Skip("DATABASE_URL doesn't point to a PostgreSQL server and initdb isn't on PATH")
+	}
+	pgCtl, err := exec.LookPath("pg_ctl")
+	if err != nil {
+		t.Skip("DATABASE_URL doesn't point to a PostgreSQL server and pg_ctl isn't on PATH")
+	}
+	if os.Geteuid() == 0 {
+		t.Skip("DATABASE_URL doesn't point to a PostgreSQL server and PostgreSQL refuses to run as root")
+	}
+
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data")
+	if out, err := exec.Command(initdb, "--pgdata", data, "--username", "postgres", "--auth", "trust", "--no-sync").CombinedOutput(); err != nil {
+		t.Fatalf("failed to initialize PostgreSQL: %v\n%s", err, out)
+	}
+
+	// Durability doesn't matter for a database thrown away at the end of the test
+	options := fmt.Sprintf("-c listen_addresses='' -c unix_socket_directories='%s' -c fsync=off", dir)
+	start := exec.Command(pgCtl, "start", "--pgdata", data, "--log", filepath.Join(dir, "postgres.log"), "--options", options, "--wait")
+	if out, err := start.CombinedOutput(); err != nil {
+		log, _ := os.ReadFile(filepath.Join(dir, "postgres.log"))
+		t.Fatalf("failed to start PostgreSQL: %v\n%s%s", err, out, log)
+	}
+	// Stopped before the directory is removed, as cleanups run last in first
+	t.Cleanup(func() {
+		if out, err := exec.Command(pgCtl, "stop", "--pgdata", data, "--mode", "immediate", "--wait").CombinedOutput(); err != nil {
+			t.Errorf("failed to stop PostgreSQL: %v\n%s", err, out)
+		}
+	})
+
+	return "postgres://postgres@/postgres?sslmode=disable&host=" + url.QueryEscape(dir)
+}
+
+// open connects to a database, migrates it and closes it when the test ends
+func open(t testing.TB, databaseURL string) *database.Database {
+	t.Helper()
+
+	db, err := database.Open(databaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Closed before the schema is dropped, as cleanups run last in first
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.MigrateUp(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Dialect identifies the SQL database behind a connection
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
+
+// DialectFromURL picks the dialect from the scheme of a DATABASE_URL.
+// postgres:// and postgresql:// URLs use PostgreSQL, anything else is a SQLite file.
+func DialectFromURL(databaseURL string) Dialect {
+	if strings.HasPrefix(databaseURL, "postgres://") || strings.HasPrefix(databaseURL, "postgresql://") {
+		return Postgres
+	}
+	return SQLite
+}
+
+// driverName returns the database/sql driver registered for the dialect
+func (d Dialect) driverName() string {
+	if d == Postgres {
+		return "pgx"
+	}
+	return "sqlite"
+}
+
+// Rebind rewrites the ? placeholders of a query into the dialect's own syntax.
+// Question marks inside quoted literals are left alone.
+func (d Dialect) Rebind(query string) string {
+	if d != Postgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+
+	n := 0
+	var quote rune
+	for _, c := range query {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,314 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations/*/*.sql
+var migrationsFS embed.FS
+
+// migrationFile matches migration file names such as 0002_add_tokens.up.sql
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is one versioned schema change with the SQL to apply and revert it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus describes a known migration and whether it has been applied
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrations returns the embedded migrations of the database's dialect ordered by version.
+// Each dialect keeps its own copy of every migration under migrations/<dialect>.
+func (d *Database) Migrations() ([]*Migration, error) {
+	return loadMigrations(migrationsFS, path.Join("migrations", string(d.Dialect)))
+}
+
+// loadMigrations reads the up and down files of every migration in a directory
+func loadMigrations(fsys fs.FS, dir string) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d is used by both %q and %q", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, m)
+	}
+	slices.SortFunc(migrations, func(a, b *Migration) int { return a.Version - b.Version })
+
+	return migrations, nil
+}
+
+// ensureMigrationsTable creates the table recording applied migrations
+func (d *Database) ensureMigrationsTable(ctx context.Context) error {
+	timestampType := "DATETIME"
+	if d.Dialect == Postgres {
+		timestampType = "TIMESTAMPTZ"
+	}
+
+	query := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at ` + timestampType + ` DEFAULT CURRENT_TIMESTAMP
+		)
+	`
+	if _, err := d.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// appliedMigrations returns when each applied migration version was applied
+func (d *Database) appliedMigrations(ctx context.Context) (map[int]time.Time, error) {
+	if err := d.ensureMigrationsTable(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := d.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan applied migration: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// MigrationStatus lists every known migration along with when it was applied
+func (d *Database) MigrationStatus(ctx context.Context) ([]*MigrationStatus, error) {
+	migrations, err := d.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := d.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := &MigrationStatus{Migration: *m}
+		if appliedAt, ok := applied[m.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Version returns the highest applied migration version, or 0 on an empty database
+func (d *Database) Version(ctx context.Context) (int, error) {
+	if err := d.ensureMigrationsTable(ctx); err != nil {
+		return 0, err
+	}
+
+	var version int
+	if err := d.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to get schema version: %w", err)
+	}
+	return version, nil
+}
+
+// MigrateUp applies every pending migration and returns the ones it applied
+func (d *Database) MigrateUp(ctx context.Context) ([]*Migration, error) {
+	migrations, err := d.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	if len(migrations) == 0 {
+		return nil, nil
+	}
+	return d.MigrateTo(ctx, migrations[len(migrations)-1].Version)
+}
+
+// MigrateDown reverts the given number of most recently applied migrations
+func (d *Database) MigrateDown(ctx context.Context, steps int) ([]*Migration, error) {
+	statuses, err := d.MigrationStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []*Migration
+	for _, s := range statuses {
+		if s.AppliedAt != nil {
+			applied = append(applied, &s.Migration)
+		}
+	}
+
+	target := 0
+	if steps < len(applied) {
+		target = applied[len(applied)-steps-1].Version
+	}
+	return d.MigrateTo(ctx, target)
+}
+
+// MigrateTo applies or reverts migrations until the schema is at the given version.
+// Each migration runs in its own transaction, so a failure leaves the schema at the
+// last migration that succeeded.
+func (d *Database) MigrateTo(ctx context.Context, version int) ([]*Migration, error) {
+	statuses, err := d.MigrationStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if version != 0 && !slices.ContainsFunc(statuses, func(s *MigrationStatus) bool { return s.Version == version }) {
+		return nil, fmt.Errorf("unknown migration version %d", version)
+	}
+
+	var done []*Migration
+
+	// Apply pending migrations up to the target, oldest first
+	for _, s := range statuses {
+		if s.AppliedAt == nil && s.Version <= version {
+			if err := d.runMigration(ctx, &s.Migration, true); err != nil {
+				return done, err
+			}
+			done = append(done, &s.Migration)
+		}
+	}
+
+	// Revert applied migrations above the target, newest first
+	for _, s := range slices.Backward(statuses) {
+		if s.AppliedAt != nil && s.Version > version {
+			if err := d.runMigration(ctx, &s.Migration, false); err != nil {
+				return done, err
+			}
+			done = append(done, &s.Migration)
+		}
+	}
+
+	return done, nil
+}
+
+// runMigration applies or reverts a single migration and records it in one transaction.
+// SQLite can only change most table definitions by rebuilding the table, which would
+// cascade deletes to referencing rows, so its migrations run with foreign keys off on
+// a dedicated connection and are checked for violations before committing.
+func (d *Database) runMigration(ctx context.Context, m *Migration, up bool) error {
+	c, err := d.DB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer c.Close()
+
+	if d.Dialect == SQLite {
+		if _, err := c.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); err != nil {
+			return fmt.Errorf("failed to disable foreign keys: %w", err)
+		}
+		defer c.ExecContext(context.WithoutCancel(ctx), `PRAGMA foreign_keys = ON`)
+	}
+
+	tx, err := c.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	ctx = context.WithValue(ctx, txKey{}, tx)
+
+	// Migration files may contain several statements and are run as written,
+	// without placeholder rebinding
+	action, script := "apply", m.Up
+	record := `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`
+	args := []any{m.Version, m.Name, time.Now().UTC()}
+	if !up {
+		action, script = "revert", m.Down
+		record = `DELETE FROM schema_migrations WHERE version = ?`
+		args = []any{m.Version}
+	}
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("failed to %s migration %04d_%s: %w", action, m.Version, m.Name, err)
+	}
+	if _, err := d.ExecContext(ctx, record, args...); err != nil {
+		return fmt.Errorf("failed to record migration %04d_%s: %w", m.Version, m.Name, err)
+	}
+
+	if d.Dialect == SQLite {
+		if err := checkForeignKeys(ctx, tx); err != nil {
+			return fmt.Errorf("migration %04d_%s broke foreign keys: %w", m.Version, m.Name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %04d_%s: %w", m.Version, m.Name, err)
+	}
+	return nil
+}
+
+// checkForeignKeys fails when SQLite reports rows referencing missing parents
+func checkForeignKeys(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `PRAGMA foreign_key_check`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		var table string
+		var rowID sql.NullInt64
+		var parent string
+		var fkID int
+		if err := rows.Scan(&table, &rowID, &parent, &fkID); err != nil {
+			return err
+		}
+		return fmt.Errorf("row %d of %s references a missing %s", rowID.Int64, table, parent)
+	}
+	return rows.Err()
+}
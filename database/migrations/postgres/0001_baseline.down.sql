@@ -0,0 +1,11 @@
+-- Drop the baseline schema, children before parents
+
+DROP TABLE IF EXISTS job_schedules;
+DROP TABLE IF EXISTS jobs;
+DROP TABLE IF EXISTS broken_links;
+DROP TABLE IF EXISTS link_checks;
+DROP TABLE IF EXISTS site_logs;
+DROP TABLE IF EXISTS sites;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS users;
+DROP FUNCTION IF EXISTS set_updated_at();
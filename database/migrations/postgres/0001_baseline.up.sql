@@ -0,0 +1,140 @@
+-- Baseline schema: users, sessions, sites, site logs, link checks and jobs
+
+-- Users table
+-- Stores user information from Google OAuth
+CREATE TABLE IF NOT EXISTS users (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    google_id TEXT NOT NULL UNIQUE,
+    email TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    given_name TEXT,
+    family_name TEXT,
+    picture TEXT,
+    locale TEXT,
+    verified_email BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Sessions table
+-- Manages user sessions with token-based authentication
+CREATE TABLE IF NOT EXISTS sessions (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Indexes for performance
+CREATE INDEX IF NOT EXISTS idx_users_google_id ON users(google_id);
+CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
+CREATE INDEX IF NOT EXISTS idx_sessions_token ON sessions(token);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
+
+-- Trigger to update updated_at timestamp automatically
+CREATE OR REPLACE FUNCTION set_updated_at() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS update_users_timestamp ON users;
+CREATE TRIGGER update_users_timestamp
+BEFORE UPDATE ON users
+FOR EACH ROW
+EXECUTE FUNCTION set_updated_at();
+
+-- Sites table
+-- Stores published sites with GitHub repo configuration
+CREATE TABLE IF NOT EXISTS sites (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    slug TEXT NOT NULL UNIQUE,
+    github_repo TEXT NOT NULL,
+    github_branch TEXT NOT NULL DEFAULT 'main',
+    subdirectory TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sites_user_id ON sites(user_id);
+CREATE INDEX IF NOT EXISTS idx_sites_slug ON sites(slug);
+
+-- Site logs table
+-- Records sync and render failures per site so owners can see why a page failed
+CREATE TABLE IF NOT EXISTS site_logs (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    site_id BIGINT NOT NULL REFERENCES sites(id) ON DELETE CASCADE,
+    level TEXT NOT NULL DEFAULT 'error',
+    path TEXT NOT NULL DEFAULT '',
+    upstream_status INTEGER,
+    message TEXT NOT NULL,
+    error_chain TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_site_logs_site_id ON site_logs(site_id);
+CREATE INDEX IF NOT EXISTS idx_site_logs_created_at ON site_logs(created_at);
+
+-- Link checks table
+-- One row per broken link checker run over a site
+CREATE TABLE IF NOT EXISTS link_checks (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    site_id BIGINT NOT NULL REFERENCES sites(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'running',
+    pages_checked INTEGER NOT NULL DEFAULT 0,
+    links_checked INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMPTZ
+);
+
+-- Broken links table
+-- Links, anchors and images found broken by a link check
+CREATE TABLE IF NOT EXISTS broken_links (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    link_check_id BIGINT NOT NULL REFERENCES link_checks(id) ON DELETE CASCADE,
+    source_path TEXT NOT NULL,
+    line INTEGER NOT NULL DEFAULT 0,
+    target TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    reason TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_link_checks_site_id ON link_checks(site_id);
+CREATE INDEX IF NOT EXISTS idx_broken_links_link_check_id ON broken_links(link_check_id);
+
+-- Jobs table
+-- Durable background job queue, claimed by workers with at-least-once semantics
+CREATE TABLE IF NOT EXISTS jobs (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    kind TEXT NOT NULL,
+    payload TEXT NOT NULL DEFAULT '{}',
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 5,
+    run_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_by TEXT NOT NULL DEFAULT '',
+    locked_at TIMESTAMPTZ,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_status_run_at ON jobs(status, run_at);
+
+-- Job schedules table
+-- Recurring jobs enqueued on a cron-like schedule
+CREATE TABLE IF NOT EXISTS job_schedules (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    spec TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    payload TEXT NOT NULL DEFAULT '{}',
+    next_run_at TIMESTAMPTZ NOT NULL,
+    last_run_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
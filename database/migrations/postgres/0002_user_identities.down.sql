@@ -0,0 +1,16 @@
+-- Move Google identities back to users.google_id and drop user_identities.
+-- Accounts without a Google identity get a placeholder so google_id stays unique.
+
+ALTER TABLE users ADD COLUMN google_id TEXT;
+
+UPDATE users u
+SET google_id = COALESCE(
+    (SELECT i.provider_user_id FROM user_identities i WHERE i.user_id = u.id AND i.provider = 'google'),
+    'unlinked-' || u.id
+);
+
+ALTER TABLE users ALTER COLUMN google_id SET NOT NULL;
+ALTER TABLE users ADD CONSTRAINT users_google_id_key UNIQUE (google_id);
+CREATE INDEX idx_users_google_id ON users(google_id);
+
+DROP TABLE user_identities;
@@ -0,0 +1,25 @@
+-- Sign-in identities: one account can link several OAuth providers
+
+-- User identities table
+-- One row per provider account linked to a user
+CREATE TABLE user_identities (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL,
+    provider_user_id TEXT NOT NULL,
+    email TEXT NOT NULL DEFAULT '',
+    username TEXT NOT NULL DEFAULT '',
+    access_token TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (provider, provider_user_id),
+    UNIQUE (user_id, provider)
+);
+
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
+
+-- Existing accounts all signed in with Google
+INSERT INTO user_identities (user_id, provider, provider_user_id, email, created_at, updated_at)
+SELECT id, 'google', google_id, email, created_at, updated_at FROM users;
+
+ALTER TABLE users DROP COLUMN google_id;
@@ -0,0 +1,3 @@
+-- Drop the magic links table, pending links stop working
+
+DROP TABLE IF EXISTS magic_links;
@@ -0,0 +1,18 @@
+-- Passwordless sign-in links sent by email
+
+-- Magic links table
+-- Only a hash of the token is stored, the token itself is in the email
+CREATE TABLE magic_links (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    email TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    ip TEXT NOT NULL,
+    redirect_to TEXT NOT NULL DEFAULT '/',
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Rate limits count the recent links per email and per IP
+CREATE INDEX idx_magic_links_email_created_at ON magic_links(email, created_at);
+CREATE INDEX idx_magic_links_ip_created_at ON magic_links(ip, created_at);
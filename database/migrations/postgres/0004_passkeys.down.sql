@@ -0,0 +1,7 @@
+-- Drop passkeys and pending sessions, accounts are back to a single factor
+
+DELETE FROM sessions WHERE second_factor_pending;
+ALTER TABLE sessions DROP COLUMN second_factor_pending;
+
+DROP TABLE IF EXISTS webauthn_challenges;
+DROP TABLE IF EXISTS passkeys;
@@ -0,0 +1,33 @@
+-- WebAuthn passkeys, used to sign in without a password or as a second factor
+
+-- Passkeys table
+-- Credential IDs are base64url encoded, public keys are COSE encoded
+CREATE TABLE passkeys (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    credential_id TEXT NOT NULL UNIQUE,
+    public_key BYTEA NOT NULL,
+    sign_count BIGINT NOT NULL DEFAULT 0,
+    transports TEXT NOT NULL DEFAULT '',
+    name TEXT NOT NULL,
+    last_used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_passkeys_user_id ON passkeys(user_id);
+
+-- WebAuthn challenges table
+-- Each challenge is used once, by the ceremony it was issued for
+CREATE TABLE webauthn_challenges (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    challenge TEXT NOT NULL UNIQUE,
+    user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+    purpose TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_webauthn_challenges_expires_at ON webauthn_challenges(expires_at);
+
+-- Sessions waiting for a second factor don't sign their user in yet
+ALTER TABLE sessions ADD COLUMN second_factor_pending BOOLEAN NOT NULL DEFAULT FALSE;
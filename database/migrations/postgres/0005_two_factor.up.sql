@@ -0,0 +1,25 @@
+-- Authenticator app (TOTP) second factor and recovery codes
+
+-- TOTP credentials table
+-- The secret stays unconfirmed until the user enters a first code from their app.
+-- It is stored as is, codes can't be checked from a hash of it.
+CREATE TABLE totp_credentials (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret TEXT NOT NULL,
+    confirmed_at TIMESTAMPTZ,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Recovery codes table
+-- Single-use codes to sign in without the app, only their hash is stored
+CREATE TABLE recovery_codes (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL UNIQUE,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_recovery_codes_user_id ON recovery_codes(user_id);
@@ -0,0 +1,23 @@
+-- Hashed session tokens, and a maximum lifetime for sessions that slide while in use
+
+-- Tokens in the database can't be hashed from SQL, so everyone signs in again
+DROP TABLE sessions;
+
+-- Sessions table
+-- Only a hash of the token is stored. expires_at moves forward as the session is
+-- used, up to max_expires_at.
+CREATE TABLE sessions (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    max_expires_at TIMESTAMPTZ NOT NULL,
+    second_factor_pending BOOLEAN NOT NULL DEFAULT FALSE,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip_address TEXT NOT NULL DEFAULT '',
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_sessions_user_id ON sessions(user_id);
+CREATE INDEX idx_sessions_expires_at ON sessions(expires_at);
@@ -0,0 +1,7 @@
+-- Drop organizations, their sites go back to the users who created them
+
+ALTER TABLE sites DROP COLUMN organization_id;
+
+DROP TABLE IF EXISTS invitations;
+DROP TABLE IF EXISTS memberships;
+DROP TABLE IF EXISTS organizations;
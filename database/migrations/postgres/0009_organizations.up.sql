@@ -0,0 +1,42 @@
+-- Organizations owning sites, their members and invitations
+
+-- Organizations table
+CREATE TABLE organizations (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    name TEXT NOT NULL,
+    slug TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Memberships table
+-- Role of each member: owner, admin, editor or viewer
+CREATE TABLE memberships (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    organization_id BIGINT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (organization_id, user_id)
+);
+
+CREATE INDEX idx_memberships_user_id ON memberships(user_id);
+
+-- Invitations table
+-- Pending invitations sent by email. Only a hash of the token is stored.
+CREATE TABLE invitations (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    organization_id BIGINT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    role TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    invited_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_invitations_organization_id ON invitations(organization_id);
+
+-- Sites of an organization keep the user who created them in user_id
+ALTER TABLE sites ADD COLUMN organization_id BIGINT REFERENCES organizations(id) ON DELETE CASCADE;
+
+CREATE INDEX idx_sites_organization_id ON sites(organization_id);
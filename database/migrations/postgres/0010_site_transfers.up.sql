@@ -0,0 +1,17 @@
+-- Transfers of sites to another user or organization, waiting for the recipient
+
+-- Site transfers table
+-- One pending transfer per site, to a user or to an organization
+CREATE TABLE site_transfers (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    site_id BIGINT NOT NULL UNIQUE REFERENCES sites(id) ON DELETE CASCADE,
+    from_user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    to_user_id BIGINT REFERENCES users(id) ON DELETE CASCADE,
+    to_organization_id BIGINT REFERENCES organizations(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((to_user_id IS NULL) <> (to_organization_id IS NULL))
+);
+
+CREATE INDEX idx_site_transfers_to_user_id ON site_transfers(to_user_id);
+CREATE INDEX idx_site_transfers_to_organization_id ON site_transfers(to_organization_id);
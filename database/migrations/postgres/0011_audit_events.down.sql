@@ -0,0 +1,4 @@
+-- Drop the audit log
+
+DROP TABLE IF EXISTS audit_events;
+DROP FUNCTION IF EXISTS forbid_audit_event_changes();
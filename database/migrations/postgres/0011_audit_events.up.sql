@@ -0,0 +1,32 @@
+-- Append-only log of changes to accounts and sites
+
+-- Audit events table
+-- The actor is kept by id and email without a foreign key, so events outlive accounts.
+-- Changes hold the before and after values of each changed field as JSON.
+CREATE TABLE audit_events (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    actor_id BIGINT,
+    actor_email TEXT NOT NULL DEFAULT '',
+    action TEXT NOT NULL,
+    target_type TEXT NOT NULL,
+    target_id TEXT NOT NULL,
+    ip TEXT NOT NULL DEFAULT '',
+    request_id TEXT NOT NULL DEFAULT '',
+    changes TEXT NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_audit_events_actor_id ON audit_events(actor_id);
+CREATE INDEX idx_audit_events_target ON audit_events(target_type, target_id);
+
+-- Events are never changed nor deleted
+CREATE OR REPLACE FUNCTION forbid_audit_event_changes() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit events are append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+BEFORE UPDATE OR DELETE ON audit_events
+FOR EACH ROW
+EXECUTE FUNCTION forbid_audit_event_changes();
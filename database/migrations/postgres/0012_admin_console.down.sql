@@ -0,0 +1,8 @@
+-- Drop instance administration
+
+ALTER TABLE sessions DROP COLUMN impersonated_user_id;
+ALTER TABLE sites DROP COLUMN suspended_reason;
+ALTER TABLE sites DROP COLUMN suspended_at;
+ALTER TABLE users DROP COLUMN suspended_reason;
+ALTER TABLE users DROP COLUMN suspended_at;
+ALTER TABLE users DROP COLUMN is_admin;
@@ -0,0 +1,22 @@
+-- Reports of abuse on public sites, sent by visitors for the admins to review
+
+-- Site reports table
+-- Reports stay open until an admin resolves them, dismissing the report or suspending
+-- the site
+CREATE TABLE site_reports (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    site_id BIGINT NOT NULL REFERENCES sites(id) ON DELETE CASCADE,
+    category TEXT NOT NULL,
+    url TEXT NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    reporter_email TEXT NOT NULL,
+    ip TEXT NOT NULL DEFAULT '',
+    resolution TEXT NOT NULL DEFAULT '',
+    resolved_by BIGINT REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_site_reports_site_id ON site_reports(site_id);
+CREATE INDEX idx_site_reports_resolved_at ON site_reports(resolved_at);
+CREATE INDEX idx_site_reports_ip_created_at ON site_reports(ip, created_at);
@@ -0,0 +1,31 @@
+-- Quotas: plans and limits of users, and their daily usage
+
+-- Size of the pages found by a deployment, counted in the storage of the site's creator
+ALTER TABLE deployments ADD COLUMN size_bytes BIGINT NOT NULL DEFAULT 0;
+
+-- User limits table
+-- Plan of a user and the limits admins set for them, replacing those of the plan.
+-- Users without a row, an empty plan or NULL limits get the defaults of the configuration.
+CREATE TABLE user_limits (
+    user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    plan TEXT NOT NULL DEFAULT '',
+    sites INTEGER,
+    storage_bytes BIGINT,
+    bandwidth_bytes BIGINT,
+    syncs_per_day INTEGER
+);
+
+-- Usage table
+-- What each user used per day (UTC, formatted YYYY-MM-DD): bytes and pages served by
+-- their public sites, syncs started, and the storage of their sites at the end of the day
+CREATE TABLE usage_daily (
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    day TEXT NOT NULL,
+    bandwidth_bytes BIGINT NOT NULL DEFAULT 0,
+    requests BIGINT NOT NULL DEFAULT 0,
+    syncs INTEGER NOT NULL DEFAULT 0,
+    storage_bytes BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, day)
+);
+
+CREATE INDEX idx_usage_daily_day ON usage_daily(day);
@@ -0,0 +1,25 @@
+-- Page views: daily rollups of the visits of public sites, without IP addresses
+
+-- Page views table
+-- Views and unique visitors of each site per day (UTC, formatted YYYY-MM-DD). Visitors
+-- are told apart by a hash of their IP address and user agent salted for the day,
+-- which is kept in memory only.
+CREATE TABLE page_views_daily (
+    site_id BIGINT NOT NULL REFERENCES sites(id) ON DELETE CASCADE,
+    day TEXT NOT NULL,
+    views BIGINT NOT NULL DEFAULT 0,
+    visitors BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (site_id, day)
+);
+
+-- Page view breakdowns table
+-- Views of each site per day by page path, referrer host, country or device class.
+-- An empty value is a direct visit for referrers and an unknown country.
+CREATE TABLE page_view_breakdowns_daily (
+    site_id BIGINT NOT NULL REFERENCES sites(id) ON DELETE CASCADE,
+    day TEXT NOT NULL,
+    dimension TEXT NOT NULL,
+    value TEXT NOT NULL,
+    views BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (site_id, day, dimension, value)
+);
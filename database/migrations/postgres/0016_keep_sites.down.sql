@@ -0,0 +1,7 @@
+-- Delete sites again along with their user or organization
+
+ALTER TABLE sites DROP CONSTRAINT sites_user_id_fkey;
+ALTER TABLE sites ADD CONSTRAINT sites_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE sites DROP CONSTRAINT sites_organization_id_fkey;
+ALTER TABLE sites ADD CONSTRAINT sites_organization_id_fkey FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE CASCADE;
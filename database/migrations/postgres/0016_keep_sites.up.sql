@@ -0,0 +1,8 @@
+-- Keep sites when their user or organization is deleted: the database refuses it
+-- until the sites are transferred or deleted, instead of deleting them with it
+
+ALTER TABLE sites DROP CONSTRAINT sites_user_id_fkey;
+ALTER TABLE sites ADD CONSTRAINT sites_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE RESTRICT;
+
+ALTER TABLE sites DROP CONSTRAINT sites_organization_id_fkey;
+ALTER TABLE sites ADD CONSTRAINT sites_organization_id_fkey FOREIGN KEY (organization_id) REFERENCES organizations(id) ON DELETE RESTRICT;
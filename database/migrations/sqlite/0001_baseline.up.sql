@@ -0,0 +1,139 @@
+-- Baseline schema: users, sessions, sites, site logs, link checks and jobs
+
+-- Users table
+-- Stores user information from Google OAuth
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    google_id TEXT NOT NULL UNIQUE,
+    email TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    given_name TEXT,
+    family_name TEXT,
+    picture TEXT,
+    locale TEXT,
+    verified_email BOOLEAN NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Sessions table
+-- Manages user sessions with token-based authentication
+CREATE TABLE IF NOT EXISTS sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    token TEXT NOT NULL UNIQUE,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Indexes for performance
+CREATE INDEX IF NOT EXISTS idx_users_google_id ON users(google_id);
+CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
+CREATE INDEX IF NOT EXISTS idx_sessions_token ON sessions(token);
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
+
+-- Trigger to update updated_at timestamp automatically
+CREATE TRIGGER IF NOT EXISTS update_users_timestamp
+AFTER UPDATE ON users
+FOR EACH ROW
+BEGIN
+    UPDATE users SET updated_at = CURRENT_TIMESTAMP WHERE id = OLD.id;
+END;
+
+-- Sites table
+-- Stores published sites with GitHub repo configuration
+CREATE TABLE IF NOT EXISTS sites (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    slug TEXT NOT NULL UNIQUE,
+    github_repo TEXT NOT NULL,
+    github_branch TEXT NOT NULL DEFAULT 'main',
+    subdirectory TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_sites_user_id ON sites(user_id);
+CREATE INDEX IF NOT EXISTS idx_sites_slug ON sites(slug);
+
+-- Site logs table
+-- Records sync and render failures per site so owners can see why a page failed
+CREATE TABLE IF NOT EXISTS site_logs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    site_id INTEGER NOT NULL,
+    level TEXT NOT NULL DEFAULT 'error',
+    path TEXT NOT NULL DEFAULT '',
+    upstream_status INTEGER,
+    message TEXT NOT NULL,
+    error_chain TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (site_id) REFERENCES sites(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_site_logs_site_id ON site_logs(site_id);
+CREATE INDEX IF NOT EXISTS idx_site_logs_created_at ON site_logs(created_at);
+
+-- Link checks table
+-- One row per broken link checker run over a site
+CREATE TABLE IF NOT EXISTS link_checks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    site_id INTEGER NOT NULL,
+    status TEXT NOT NULL DEFAULT 'running',
+    pages_checked INTEGER NOT NULL DEFAULT 0,
+    links_checked INTEGER NOT NULL DEFAULT 0,
+    error TEXT NOT NULL DEFAULT '',
+    started_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at DATETIME,
+    FOREIGN KEY (site_id) REFERENCES sites(id) ON DELETE CASCADE
+);
+
+-- Broken links table
+-- Links, anchors and images found broken by a link check
+CREATE TABLE IF NOT EXISTS broken_links (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    link_check_id INTEGER NOT NULL,
+    source_path TEXT NOT NULL,
+    line INTEGER NOT NULL DEFAULT 0,
+    target TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    reason TEXT NOT NULL,
+    FOREIGN KEY (link_check_id) REFERENCES link_checks(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_link_checks_site_id ON link_checks(site_id);
+CREATE INDEX IF NOT EXISTS idx_broken_links_link_check_id ON broken_links(link_check_id);
+
+-- Jobs table
+-- Durable background job queue, claimed by workers with at-least-once semantics
+CREATE TABLE IF NOT EXISTS jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind TEXT NOT NULL,
+    payload TEXT NOT NULL DEFAULT '{}',
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL DEFAULT 5,
+    run_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_by TEXT NOT NULL DEFAULT '',
+    locked_at DATETIME,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_jobs_status_run_at ON jobs(status, run_at);
+
+-- Job schedules table
+-- Recurring jobs enqueued on a cron-like schedule
+CREATE TABLE IF NOT EXISTS job_schedules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    spec TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    payload TEXT NOT NULL DEFAULT '{}',
+    next_run_at DATETIME NOT NULL,
+    last_run_at DATETIME,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,35 @@
+-- Move Google identities back to users.google_id and drop user_identities.
+-- Accounts without a Google identity get a placeholder so google_id stays unique.
+
+CREATE TABLE users_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    google_id TEXT NOT NULL UNIQUE,
+    email TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    given_name TEXT,
+    family_name TEXT,
+    picture TEXT,
+    locale TEXT,
+    verified_email BOOLEAN NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO users_old (id, google_id, email, name, given_name, family_name, picture, locale, verified_email, created_at, updated_at)
+SELECT u.id, COALESCE(i.provider_user_id, 'unlinked-' || u.id), u.email, u.name, u.given_name, u.family_name, u.picture, u.locale, u.verified_email, u.created_at, u.updated_at
+FROM users u
+LEFT JOIN user_identities i ON i.user_id = u.id AND i.provider = 'google';
+
+DROP TABLE user_identities;
+DROP TABLE users;
+ALTER TABLE users_old RENAME TO users;
+
+CREATE INDEX idx_users_google_id ON users(google_id);
+CREATE INDEX idx_users_email ON users(email);
+
+CREATE TRIGGER update_users_timestamp
+AFTER UPDATE ON users
+FOR EACH ROW
+BEGIN
+    UPDATE users SET updated_at = CURRENT_TIMESTAMP WHERE id = OLD.id;
+END;
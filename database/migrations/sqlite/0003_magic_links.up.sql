@@ -0,0 +1,18 @@
+-- Passwordless sign-in links sent by email
+
+-- Magic links table
+-- Only a hash of the token is stored, the token itself is in the email
+CREATE TABLE IF NOT EXISTS magic_links (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    email TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    ip TEXT NOT NULL,
+    redirect_to TEXT NOT NULL DEFAULT '/',
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Rate limits count the recent links per email and per IP
+CREATE INDEX IF NOT EXISTS idx_magic_links_email_created_at ON magic_links(email, created_at);
+CREATE INDEX IF NOT EXISTS idx_magic_links_ip_created_at ON magic_links(ip, created_at);
@@ -0,0 +1,4 @@
+-- Drop authenticator apps and recovery codes, accounts keep their passkeys
+
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS totp_credentials;
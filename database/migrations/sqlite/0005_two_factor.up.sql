@@ -0,0 +1,27 @@
+-- Authenticator app (TOTP) second factor and recovery codes
+
+-- TOTP credentials table
+-- The secret stays unconfirmed until the user enters a first code from their app.
+-- It is stored as is, codes can't be checked from a hash of it.
+CREATE TABLE IF NOT EXISTS totp_credentials (
+    user_id INTEGER PRIMARY KEY,
+    secret TEXT NOT NULL,
+    confirmed_at DATETIME,
+    last_used_step INTEGER NOT NULL DEFAULT 0,
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Recovery codes table
+-- Single-use codes to sign in without the app, only their hash is stored
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    code_hash TEXT NOT NULL UNIQUE,
+    used_at DATETIME,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes(user_id);
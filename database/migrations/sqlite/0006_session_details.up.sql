@@ -0,0 +1,8 @@
+-- Session details, so users can tell their sessions apart and revoke them
+
+-- Sessions started before keep empty details, last seen when they were created.
+-- SQLite can't add a column defaulting to the current time.
+ALTER TABLE sessions ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN ip_address TEXT NOT NULL DEFAULT '';
+ALTER TABLE sessions ADD COLUMN last_seen_at DATETIME;
+UPDATE sessions SET last_seen_at = created_at;
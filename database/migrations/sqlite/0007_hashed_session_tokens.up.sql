@@ -0,0 +1,24 @@
+-- Hashed session tokens, and a maximum lifetime for sessions that slide while in use
+
+-- Tokens in the database can't be hashed from SQL, so everyone signs in again
+DROP TABLE sessions;
+
+-- Sessions table
+-- Only a hash of the token is stored. expires_at moves forward as the session is
+-- used, up to max_expires_at.
+CREATE TABLE sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at DATETIME NOT NULL,
+    max_expires_at DATETIME NOT NULL,
+    second_factor_pending BOOLEAN NOT NULL DEFAULT 0,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip_address TEXT NOT NULL DEFAULT '',
+    last_seen_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_sessions_user_id ON sessions(user_id);
+CREATE INDEX idx_sessions_expires_at ON sessions(expires_at);
@@ -0,0 +1,4 @@
+-- Drop API tokens and deployments
+
+DROP TABLE IF EXISTS deployments;
+DROP TABLE IF EXISTS api_tokens;
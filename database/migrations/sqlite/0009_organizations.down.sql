@@ -0,0 +1,8 @@
+-- Drop organizations, their sites go back to the users who created them
+
+DROP INDEX IF EXISTS idx_sites_organization_id;
+ALTER TABLE sites DROP COLUMN organization_id;
+
+DROP TABLE IF EXISTS invitations;
+DROP TABLE IF EXISTS memberships;
+DROP TABLE IF EXISTS organizations;
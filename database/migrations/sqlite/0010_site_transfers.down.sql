@@ -0,0 +1,3 @@
+-- Drop pending site transfers
+
+DROP TABLE IF EXISTS site_transfers;
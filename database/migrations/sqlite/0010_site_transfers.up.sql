@@ -0,0 +1,21 @@
+-- Transfers of sites to another user or organization, waiting for the recipient
+
+-- Site transfers table
+-- One pending transfer per site, to a user or to an organization
+CREATE TABLE IF NOT EXISTS site_transfers (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    site_id INTEGER NOT NULL UNIQUE,
+    from_user_id INTEGER NOT NULL,
+    to_user_id INTEGER,
+    to_organization_id INTEGER,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((to_user_id IS NULL) <> (to_organization_id IS NULL)),
+    FOREIGN KEY (site_id) REFERENCES sites(id) ON DELETE CASCADE,
+    FOREIGN KEY (from_user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (to_user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (to_organization_id) REFERENCES organizations(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_site_transfers_to_user_id ON site_transfers(to_user_id);
+CREATE INDEX IF NOT EXISTS idx_site_transfers_to_organization_id ON site_transfers(to_organization_id);
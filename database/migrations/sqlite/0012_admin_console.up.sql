@@ -0,0 +1,16 @@
+-- Instance administration: admins, suspended users and sites, and impersonation
+
+-- Admins are also listed by email in the configuration
+ALTER TABLE users ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT 0;
+
+-- Suspended users can't sign in, and their personal sites aren't served
+ALTER TABLE users ADD COLUMN suspended_at DATETIME;
+ALTER TABLE users ADD COLUMN suspended_reason TEXT NOT NULL DEFAULT '';
+
+-- Suspended sites aren't served
+ALTER TABLE sites ADD COLUMN suspended_at DATETIME;
+ALTER TABLE sites ADD COLUMN suspended_reason TEXT NOT NULL DEFAULT '';
+
+-- User an admin's session is viewing the dashboard as, read-only.
+-- No foreign key, SQLite can't drop a column used by one.
+ALTER TABLE sessions ADD COLUMN impersonated_user_id INTEGER;
@@ -0,0 +1,3 @@
+-- Drop site reports
+
+DROP TABLE IF EXISTS site_reports;
@@ -0,0 +1,24 @@
+-- Reports of abuse on public sites, sent by visitors for the admins to review
+
+-- Site reports table
+-- Reports stay open until an admin resolves them, dismissing the report or suspending
+-- the site
+CREATE TABLE IF NOT EXISTS site_reports (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    site_id INTEGER NOT NULL,
+    category TEXT NOT NULL,
+    url TEXT NOT NULL,
+    details TEXT NOT NULL DEFAULT '',
+    reporter_email TEXT NOT NULL,
+    ip TEXT NOT NULL DEFAULT '',
+    resolution TEXT NOT NULL DEFAULT '',
+    resolved_by INTEGER,
+    resolved_at DATETIME,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (site_id) REFERENCES sites(id) ON DELETE CASCADE,
+    FOREIGN KEY (resolved_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_site_reports_site_id ON site_reports(site_id);
+CREATE INDEX IF NOT EXISTS idx_site_reports_resolved_at ON site_reports(resolved_at);
+CREATE INDEX IF NOT EXISTS idx_site_reports_ip_created_at ON site_reports(ip, created_at);
@@ -0,0 +1,5 @@
+-- Drop quotas and usage
+
+DROP TABLE IF EXISTS usage_daily;
+DROP TABLE IF EXISTS user_limits;
+ALTER TABLE deployments DROP COLUMN size_bytes;
@@ -0,0 +1,33 @@
+-- Quotas: plans and limits of users, and their daily usage
+
+-- Size of the pages found by a deployment, counted in the storage of the site's creator
+ALTER TABLE deployments ADD COLUMN size_bytes INTEGER NOT NULL DEFAULT 0;
+
+-- User limits table
+-- Plan of a user and the limits admins set for them, replacing those of the plan.
+-- Users without a row, an empty plan or NULL limits get the defaults of the configuration.
+CREATE TABLE IF NOT EXISTS user_limits (
+    user_id INTEGER PRIMARY KEY,
+    plan TEXT NOT NULL DEFAULT '',
+    sites INTEGER,
+    storage_bytes INTEGER,
+    bandwidth_bytes INTEGER,
+    syncs_per_day INTEGER,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Usage table
+-- What each user used per day (UTC, formatted YYYY-MM-DD): bytes and pages served by
+-- their public sites, syncs started, and the storage of their sites at the end of the day
+CREATE TABLE IF NOT EXISTS usage_daily (
+    user_id INTEGER NOT NULL,
+    day TEXT NOT NULL,
+    bandwidth_bytes INTEGER NOT NULL DEFAULT 0,
+    requests INTEGER NOT NULL DEFAULT 0,
+    syncs INTEGER NOT NULL DEFAULT 0,
+    storage_bytes INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, day),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_usage_daily_day ON usage_daily(day);
@@ -0,0 +1,4 @@
+-- Drop page views
+
+DROP TABLE IF EXISTS page_view_breakdowns_daily;
+DROP TABLE IF EXISTS page_views_daily;
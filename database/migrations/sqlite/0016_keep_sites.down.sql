@@ -0,0 +1,25 @@
+-- Delete sites again along with their user or organization
+
+CREATE TABLE sites_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    slug TEXT NOT NULL UNIQUE,
+    github_repo TEXT NOT NULL,
+    github_branch TEXT NOT NULL DEFAULT 'main',
+    subdirectory TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    organization_id INTEGER REFERENCES organizations(id) ON DELETE CASCADE,
+    suspended_at DATETIME,
+    suspended_reason TEXT NOT NULL DEFAULT '',
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+INSERT INTO sites_new (id, user_id, slug, github_repo, github_branch, subdirectory, created_at, organization_id, suspended_at, suspended_reason)
+SELECT id, user_id, slug, github_repo, github_branch, subdirectory, created_at, organization_id, suspended_at, suspended_reason FROM sites;
+
+DROP TABLE sites;
+ALTER TABLE sites_new RENAME TO sites;
+
+CREATE INDEX idx_sites_user_id ON sites(user_id);
+CREATE INDEX idx_sites_slug ON sites(slug);
+CREATE INDEX idx_sites_organization_id ON sites(organization_id);
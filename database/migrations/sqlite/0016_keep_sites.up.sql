@@ -0,0 +1,27 @@
+-- Keep sites when their user or organization is deleted: the database refuses it
+-- until the sites are transferred or deleted, instead of deleting them with it
+
+-- Rebuild sites with restricting foreign keys, SQLite can't change them in place
+CREATE TABLE sites_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    slug TEXT NOT NULL UNIQUE,
+    github_repo TEXT NOT NULL,
+    github_branch TEXT NOT NULL DEFAULT 'main',
+    subdirectory TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    organization_id INTEGER REFERENCES organizations(id) ON DELETE RESTRICT,
+    suspended_at DATETIME,
+    suspended_reason TEXT NOT NULL DEFAULT '',
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE RESTRICT
+);
+
+INSERT INTO sites_new (id, user_id, slug, github_repo, github_branch, subdirectory, created_at, organization_id, suspended_at, suspended_reason)
+SELECT id, user_id, slug, github_repo, github_branch, subdirectory, created_at, organization_id, suspended_at, suspended_reason FROM sites;
+
+DROP TABLE sites;
+ALTER TABLE sites_new RENAME TO sites;
+
+CREATE INDEX idx_sites_user_id ON sites(user_id);
+CREATE INDEX idx_sites_slug ON sites(slug);
+CREATE INDEX idx_sites_organization_id ON sites(organization_id);
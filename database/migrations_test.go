@@ -0,0 +1,56 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hyperstitieux/template/database"
+	"github.com/hyperstitieux/template/database/dbtest"
+)
+
+func TestMigrations(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.Database) {
+		ctx := context.Background()
+
+		migrations, err := db.Migrations()
+		if err != nil {
+			t.Fatal(err)
+		}
+		latest := migrations[len(migrations)-1].Version
+
+		version, err := db.Version(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if version != latest {
+			t.Fatalf("version = %d after migrating up, want %d", version, latest)
+		}
+
+		// Every migration reverts, then applies again on the schema it left
+		reverted, err := db.MigrateTo(ctx, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(reverted) != len(migrations) {
+			t.Errorf("reverted %d migrations, want %d", len(reverted), len(migrations))
+		}
+		if version, _ := db.Version(ctx); version != 0 {
+			t.Errorf("version = %d after reverting everything, want 0", version)
+		}
+
+		applied, err := db.MigrateUp(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(applied) != len(migrations) {
+			t.Errorf("applied %d migrations, want %d", len(applied), len(migrations))
+		}
+
+		if _, err := db.MigrateDown(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+		if version, _ := db.Version(ctx); version != migrations[len(migrations)-2].Version {
+			t.Errorf("version = %d after reverting one migration, want %d", version, migrations[len(migrations)-2].Version)
+		}
+	})
+}
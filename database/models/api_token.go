@@ -0,0 +1,34 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// Scopes an API token can be granted
+const (
+	ScopeSitesRead  = "sites:read"  // List sites, their deployments and logs
+	ScopeSitesWrite = "sites:write" // Create, update, delete and resync sites
+)
+
+// APITokenScopes lists every scope, in the order they are offered
+var APITokenScopes = []string{ScopeSitesRead, ScopeSitesWrite}
+
+// APIToken is a personal access token used by scripts and CI to call the API as a
+// user. Only the hash of the token is stored.
+type APIToken struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"` // Start of the token, to recognize it
+	TokenHash  string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"` // Nil for tokens that never expire
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// HasScope tells whether the token was granted a scope
+func (t *APIToken) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
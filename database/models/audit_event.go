@@ -0,0 +1,78 @@
+package models
+
+import "time"
+
+// Audited actions
+const (
+	AuditSignIn             = "user.sign_in"
+	AuditProfileUpdate      = "user.update_profile"
+	AuditAccountDelete      = "user.delete"
+	AuditIdentityDisconnect = "user.disconnect_identity"
+	AuditTwoFactorEnable    = "user.enable_two_factor"
+	AuditTwoFactorDisable   = "user.disable_two_factor"
+	AuditPasskeyAdd         = "user.add_passkey"
+	AuditPasskeyDelete      = "user.delete_passkey"
+	AuditAPITokenCreate     = "api_token.create"
+	AuditAPITokenRevoke     = "api_token.revoke"
+	AuditSiteCreate         = "site.create"
+	AuditSiteUpdate         = "site.update"
+	AuditSiteDelete         = "site.delete"
+	AuditSiteTransferAccept = "site.transfer"
+	AuditOrganizationCreate = "organization.create"
+	AuditOrganizationDelete = "organization.delete"
+	AuditMemberRoleUpdate   = "organization.update_member"
+	AuditMemberRemove       = "organization.remove_member"
+	AuditInvitationAccept   = "organization.accept_invitation"
+	AuditUserSuspend        = "admin.suspend_user"
+	AuditUserUnsuspend      = "admin.unsuspend_user"
+	AuditAdminGrant         = "admin.grant_admin"
+	AuditAdminRevoke        = "admin.revoke_admin"
+	AuditImpersonationStart = "admin.impersonate"
+	AuditImpersonationStop  = "admin.stop_impersonating"
+	AuditSiteSuspend        = "admin.suspend_site"
+	AuditSiteUnsuspend      = "admin.unsuspend_site"
+	AuditReportResolve      = "admin.resolve_report"
+	AuditLimitsUpdate       = "admin.update_limits"
+)
+
+// AuditActions lists every audited action, to filter the log by
+var AuditActions = []string{
+	AuditSignIn, AuditProfileUpdate, AuditAccountDelete, AuditIdentityDisconnect,
+	AuditTwoFactorEnable, AuditTwoFactorDisable, AuditPasskeyAdd, AuditPasskeyDelete,
+	AuditAPITokenCreate, AuditAPITokenRevoke,
+	AuditSiteCreate, AuditSiteUpdate, AuditSiteDelete, AuditSiteTransferAccept,
+	AuditOrganizationCreate, AuditOrganizationDelete, AuditMemberRoleUpdate, AuditMemberRemove, AuditInvitationAccept,
+	AuditUserSuspend, AuditUserUnsuspend, AuditAdminGrant, AuditAdminRevoke, AuditImpersonationStart, AuditImpersonationStop,
+	AuditSiteSuspend, AuditSiteUnsuspend, AuditReportResolve, AuditLimitsUpdate,
+}
+
+// Kinds of audited targets
+const (
+	AuditTargetUser         = "user"
+	AuditTargetSite         = "site"
+	AuditTargetAPIToken     = "api_token"
+	AuditTargetOrganization = "organization"
+	AuditTargetSiteReport   = "site_report"
+)
+
+// AuditChange is the value of a field before and after a change, nil when the field
+// didn't exist before or doesn't anymore
+type AuditChange struct {
+	Before any `json:"before,omitempty"`
+	After  any `json:"after,omitempty"`
+}
+
+// AuditEvent records who did what to which account or site. Events are never changed
+// nor deleted.
+type AuditEvent struct {
+	ID         int64                  `json:"id"`
+	ActorID    *int64                 `json:"actor_id,omitempty"`
+	ActorEmail string                 `json:"actor_email"`
+	Action     string                 `json:"action"`
+	TargetType string                 `json:"target_type"`
+	TargetID   string                 `json:"target_id"`
+	IP         string                 `json:"ip"`
+	RequestID  string                 `json:"request_id"`
+	Changes    map[string]AuditChange `json:"changes"`
+	CreatedAt  time.Time              `json:"created_at"`
+}
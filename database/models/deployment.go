@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Deployment statuses
+const (
+	DeploymentRunning   = "running"
+	DeploymentSucceeded = "succeeded"
+	DeploymentFailed    = "failed"
+)
+
+// What started a deployment
+const (
+	DeploymentTriggerDashboard = "dashboard"
+	DeploymentTriggerAPI       = "api"
+)
+
+// Deployment is one sync of a site with its repository. Pages are rendered from
+// GitHub on each request, a deployment records the commit the branch pointed to and
+// the pages found there.
+type Deployment struct {
+	ID          int        `json:"id"`
+	SiteID      int        `json:"site_id"`
+	Status      string     `json:"status"`
+	TriggeredBy string     `json:"triggered_by"`
+	CommitSHA   string     `json:"commit_sha,omitempty"`
+	Pages       int        `json:"pages"`
+	SizeBytes   int64      `json:"size_bytes"` // Of the pages, counted in the storage of the site's creator
+	Error       string     `json:"error,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
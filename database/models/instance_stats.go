@@ -0,0 +1,13 @@
+package models
+
+// InstanceStats counts what an instance holds, for its admins
+type InstanceStats struct {
+	Users             int `json:"users"`
+	SuspendedUsers    int `json:"suspended_users"`
+	ActiveUsers       int `json:"active_users"` // Signed in within the last 30 days
+	Organizations     int `json:"organizations"`
+	Sites             int `json:"sites"`
+	SuspendedSites    int `json:"suspended_sites"`
+	RecentDeployments int `json:"recent_deployments"` // Started within the last 24 hours
+	OpenReports       int `json:"open_reports"`       // Site reports waiting for an admin
+}
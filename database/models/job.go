@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Job statuses
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+// JobStatuses lists job statuses in lifecycle order
+var JobStatuses = []string{JobPending, JobRunning, JobSucceeded, JobFailed}
+
+type Job struct {
+	ID          int64      `json:"id"`
+	Kind        string     `json:"kind"`
+	Payload     string     `json:"payload"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	MaxAttempts int        `json:"max_attempts"`
+	RunAt       time.Time  `json:"run_at"`
+	LockedBy    string     `json:"locked_by,omitempty"`
+	LockedAt    *time.Time `json:"locked_at,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+type JobSchedule struct {
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	Spec      string     `json:"spec"`
+	Kind      string     `json:"kind"`
+	Payload   string     `json:"payload"`
+	NextRunAt time.Time  `json:"next_run_at"`
+	LastRunAt *time.Time `json:"last_run_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+// Link check statuses
+const (
+	LinkCheckRunning  = "running"
+	LinkCheckFinished = "finished"
+	LinkCheckFailed   = "failed"
+)
+
+// Broken link kinds
+const (
+	LinkKindInternal = "internal"
+	LinkKindAnchor   = "anchor"
+	LinkKindImage    = "image"
+	LinkKindExternal = "external"
+)
+
+type LinkCheck struct {
+	ID           int        `json:"id"`
+	SiteID       int        `json:"site_id"`
+	Status       string     `json:"status"`
+	PagesChecked int        `json:"pages_checked"`
+	LinksChecked int        `json:"links_checked"`
+	Error        string     `json:"error,omitempty"`
+	StartedAt    time.Time  `json:"started_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+}
+
+type BrokenLink struct {
+	ID          int    `json:"id"`
+	LinkCheckID int    `json:"link_check_id"`
+	SourcePath  string `json:"source_path"`
+	Line        int    `json:"line"`
+	Target      string `json:"target"`
+	Kind        string `json:"kind"`
+	Reason      string `json:"reason"`
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// Roles of organization members, from most to least privileged. Owners manage the
+// organization and its owners, admins manage members and sites, editors sync and
+// update sites, and viewers see sites and their logs.
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// Roles lists the roles from most to least privileged
+var Roles = []string{RoleOwner, RoleAdmin, RoleEditor, RoleViewer}
+
+// RoleAtLeast tells whether role grants everything min does. An empty or unknown
+// role grants nothing.
+func RoleAtLeast(role, min string) bool {
+	i := slices.Index(Roles, role)
+	return i >= 0 && i <= slices.Index(Roles, min)
+}
+
+// Organization owns sites managed by its members
+type Organization struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	CreatedAt time.Time `json:"created_at"`
+	// Role of the user the organization was listed for
+	Role string `json:"role,omitempty"`
+}
+
+// Membership gives a user a role in an organization
+type Membership struct {
+	ID             int64     `json:"id"`
+	OrganizationID int64     `json:"organization_id"`
+	UserID         int64     `json:"user_id"`
+	Role           string    `json:"role"`
+	CreatedAt      time.Time `json:"created_at"`
+	// Name and email of the member, loaded with the members of an organization
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// Invitation asks someone by email to join an organization with a role
+type Invitation struct {
+	ID             int64     `json:"id"`
+	OrganizationID int64     `json:"organization_id"`
+	Email          string    `json:"email"`
+	Role           string    `json:"role"`
+	TokenHash      string    `json:"-"`
+	InvitedBy      *int64    `json:"invited_by,omitempty"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	CreatedAt      time.Time `json:"created_at"`
+}
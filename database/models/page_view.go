@@ -0,0 +1,35 @@
+package models
+
+// Dimensions page views are broken down by
+const (
+	PageViewPath     = "path"
+	PageViewReferrer = "referrer" // Host of the referring page, empty for direct visits
+	PageViewCountry  = "country"  // ISO 3166 code, empty when unknown
+	PageViewDevice   = "device"
+)
+
+// PageViewDimensions lists the dimensions page views are broken down by
+var PageViewDimensions = []string{PageViewPath, PageViewReferrer, PageViewCountry, PageViewDevice}
+
+// Device classes of visitors
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+)
+
+// PageViews is the traffic of a site on a day, in UTC
+type PageViews struct {
+	SiteID   int    `json:"site_id"`
+	Day      string `json:"day"` // Formatted YYYY-MM-DD
+	Views    int64  `json:"views"`
+	Visitors int64  `json:"visitors"` // Unique per day, counted without cookies
+}
+
+// PageViewCount is the number of views of a value of a dimension, e.g. the views
+// of a page path
+type PageViewCount struct {
+	Dimension string `json:"dimension"`
+	Value     string `json:"value"`
+	Views     int64  `json:"views"`
+}
@@ -3,11 +3,14 @@ package models
 import "time"
 
 type Site struct {
-	ID           int       `json:"id"`
-	UserID       int       `json:"user_id"`
-	Slug         string    `json:"slug"`
-	GithubRepo   string    `json:"github_repo"`
-	GithubBranch string    `json:"github_branch"`
-	Subdirectory string    `json:"subdirectory"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID              int        `json:"id"`
+	UserID          int        `json:"user_id"`
+	OrganizationID  *int64     `json:"organization_id,omitempty"` // Owner of the site, UserID is then who created it
+	Slug            string     `json:"slug"`
+	GithubRepo      string     `json:"github_repo"`
+	GithubBranch    string     `json:"github_branch"`
+	Subdirectory    string     `json:"subdirectory"`
+	SuspendedAt     *time.Time `json:"suspended_at,omitempty"` // Set while an admin keeps the site from being served
+	SuspendedReason string     `json:"suspended_reason,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
 }
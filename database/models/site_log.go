@@ -0,0 +1,60 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Site log severity levels
+const (
+	LogLevelInfo    = "info"
+	LogLevelWarning = "warning"
+	LogLevelError   = "error"
+)
+
+// LogLevels lists the severity levels from least to most severe
+var LogLevels = []string{LogLevelInfo, LogLevelWarning, LogLevelError}
+
+type SiteLog struct {
+	ID             int       `json:"id"`
+	SiteID         int       `json:"site_id"`
+	Level          string    `json:"level"`
+	Path           string    `json:"path"`
+	UpstreamStatus *int      `json:"upstream_status,omitempty"`
+	Message        string    `json:"message"`
+	ErrorChain     []string  `json:"error_chain,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// NewSiteLog builds a log entry from an error, keeping every message of its chain.
+// A zero upstream status is left unset.
+func NewSiteLog(siteID int, level, path string, upstreamStatus int, err error) *SiteLog {
+	log := &SiteLog{
+		SiteID:     siteID,
+		Level:      level,
+		Path:       path,
+		Message:    err.Error(),
+		ErrorChain: errorChain(err),
+	}
+	if upstreamStatus != 0 {
+		log.UpstreamStatus = &upstreamStatus
+	}
+	return log
+}
+
+// errorChain flattens an error and everything it wraps into a list of messages,
+// outermost first
+func errorChain(err error) []string {
+	var chain []string
+	for err != nil {
+		chain = append(chain, err.Error())
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, e := range joined.Unwrap() {
+				chain = append(chain, errorChain(e)...)
+			}
+			return chain
+		}
+		err = errors.Unwrap(err)
+	}
+	return chain
+}
@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// Categories of site reports
+const (
+	ReportSpam       = "spam"
+	ReportPhishing   = "phishing"
+	ReportMalware    = "malware"
+	ReportHarassment = "harassment"
+	ReportCopyright  = "copyright"
+	ReportIllegal    = "illegal"
+	ReportOther      = "other"
+)
+
+// ReportCategories lists the categories visitors pick from, in the order shown
+var ReportCategories = []string{ReportSpam, ReportPhishing, ReportMalware, ReportHarassment, ReportCopyright, ReportIllegal, ReportOther}
+
+// ReportCategoryNames describes the categories to visitors and admins
+var ReportCategoryNames = map[string]string{
+	ReportSpam:       "Spam or misleading content",
+	ReportPhishing:   "Phishing or scam",
+	ReportMalware:    "Malware or unwanted software",
+	ReportHarassment: "Harassment or hate speech",
+	ReportCopyright:  "Copyright infringement",
+	ReportIllegal:    "Other illegal content",
+	ReportOther:      "Something else",
+}
+
+// How an admin resolved a report
+const (
+	ReportDismissed = "dismissed"
+	ReportSuspended = "suspended" // The site was suspended
+)
+
+// SiteReport is a visitor's report of abuse on a public site, open until an admin
+// resolves it
+type SiteReport struct {
+	ID            int64      `json:"id"`
+	SiteID        int        `json:"site_id"`
+	Category      string     `json:"category"`
+	URL           string     `json:"url"`
+	Details       string     `json:"details"`
+	ReporterEmail string     `json:"reporter_email"`
+	IP            string     `json:"ip"`
+	Resolution    string     `json:"resolution,omitempty"`
+	ResolvedBy    *int64     `json:"resolved_by,omitempty"`
+	ResolvedAt    *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+
+	// Joined for display
+	SiteSlug      string `json:"site_slug"`
+	SiteSuspended bool   `json:"site_suspended"`
+	ResolverEmail string `json:"resolver_email,omitempty"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// SiteTransfer hands a site over to another user or organization once the recipient
+// accepts it. The site keeps its slug, deployments and logs.
+type SiteTransfer struct {
+	ID               int64     `json:"id"`
+	SiteID           int       `json:"site_id"`
+	FromUserID       int64     `json:"from_user_id"`
+	ToUserID         *int64    `json:"to_user_id,omitempty"`
+	ToOrganizationID *int64    `json:"to_organization_id,omitempty"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	CreatedAt        time.Time `json:"created_at"`
+
+	// Joined for display
+	SiteSlug  string `json:"site_slug"`
+	FromName  string `json:"from_name"`
+	Recipient string `json:"recipient"` // Email of the user or name of the organization
+}
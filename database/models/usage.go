@@ -0,0 +1,30 @@
+package models
+
+// Limits caps what a user may use, zero meaning unlimited
+type Limits struct {
+	Sites          int   `json:"sites"`           // Sites created, for themselves or their organizations
+	StorageBytes   int64 `json:"storage_bytes"`   // Size of the pages of the last sync of every site
+	BandwidthBytes int64 `json:"bandwidth_bytes"` // Served by public sites per calendar month
+	SyncsPerDay    int   `json:"syncs_per_day"`
+}
+
+// UserLimits is the plan of a user and the limits admins set for them. Nil limits
+// are those of the plan, an empty plan is the default one.
+type UserLimits struct {
+	UserID         int64  `json:"user_id"`
+	Plan           string `json:"plan"`
+	Sites          *int   `json:"sites,omitempty"`
+	StorageBytes   *int64 `json:"storage_bytes,omitempty"`
+	BandwidthBytes *int64 `json:"bandwidth_bytes,omitempty"`
+	SyncsPerDay    *int   `json:"syncs_per_day,omitempty"`
+}
+
+// Usage is what a user used on a day, in UTC
+type Usage struct {
+	UserID         int64  `json:"user_id"`
+	Day            string `json:"day"` // Formatted YYYY-MM-DD
+	BandwidthBytes int64  `json:"bandwidth_bytes"`
+	Requests       int64  `json:"requests"` // Pages served by public sites
+	Syncs          int    `json:"syncs"`
+	StorageBytes   int64  `json:"storage_bytes"` // At the end of the day, or now for today
+}
@@ -3,23 +3,121 @@ package models
 import "time"
 
 type User struct {
-	ID            int64     `json:"id"`
-	GoogleID      string    `json:"google_id"`
-	Email         string    `json:"email"`
-	Name          string    `json:"name"`
-	GivenName     *string   `json:"given_name,omitempty"`
-	FamilyName    *string   `json:"family_name,omitempty"`
-	Picture       *string   `json:"picture,omitempty"`
-	Locale        *string   `json:"locale,omitempty"`
-	VerifiedEmail bool      `json:"verified_email"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID              int64      `json:"id"`
+	Email           string     `json:"email"`
+	Name            string     `json:"name"`
+	GivenName       *string    `json:"given_name,omitempty"`
+	FamilyName      *string    `json:"family_name,omitempty"`
+	Picture         *string    `json:"picture,omitempty"`
+	Locale          *string    `json:"locale,omitempty"`
+	VerifiedEmail   bool       `json:"verified_email"`
+	IsAdmin         bool       `json:"is_admin"`               // Also set for the admins listed by email in the configuration
+	SuspendedAt     *time.Time `json:"suspended_at,omitempty"` // Set while an admin keeps the user from signing in
+	SuspendedReason string     `json:"suspended_reason,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
 }
 
 type Session struct {
 	ID        int64     `json:"id"`
 	UserID    int64     `json:"user_id"`
-	Token     string    `json:"token"`
+	TokenHash string    `json:"-"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// MaxExpiresAt bounds ExpiresAt, which moves forward as the session is used
+	MaxExpiresAt time.Time `json:"max_expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+	// SecondFactorPending is set until the user completes a second factor, the
+	// session doesn't sign them in before that
+	SecondFactorPending bool `json:"second_factor_pending"`
+	// Browser and address the session was last used from
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	// ImpersonatedUserID is the user an admin views the dashboard as, read-only
+	ImpersonatedUserID *int64 `json:"impersonated_user_id,omitempty"`
+}
+
+// Sign-in providers a user identity can come from
+const (
+	ProviderGoogle = "google"
+	ProviderGitHub = "github"
+	ProviderEmail  = "email"
+)
+
+// UserIdentity links an account at a sign-in provider to a user
+type UserIdentity struct {
+	ID             int64     `json:"id"`
+	UserID         int64     `json:"user_id"`
+	Provider       string    `json:"provider"`
+	ProviderUserID string    `json:"provider_user_id"`
+	Email          string    `json:"email"`
+	Username       string    `json:"username"`
+	AccessToken    string    `json:"-"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// MagicLink is a single-use sign-in link sent by email. Only the hash of its token
+// is stored.
+type MagicLink struct {
+	ID         int64      `json:"id"`
+	Email      string     `json:"email"`
+	TokenHash  string     `json:"-"`
+	IP         string     `json:"ip"`
+	RedirectTo string     `json:"redirect_to"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	UsedAt     *time.Time `json:"used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Passkey is a WebAuthn credential registered by a user
+type Passkey struct {
+	ID           int64      `json:"id"`
+	UserID       int64      `json:"user_id"`
+	CredentialID string     `json:"credential_id"` // base64url encoded
+	PublicKey    []byte     `json:"-"`             // COSE encoded
+	SignCount    uint32     `json:"sign_count"`
+	Transports   []string   `json:"transports"`
+	Name         string     `json:"name"`
+	LastUsedAt   *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// Purposes of a WebAuthn challenge
+const (
+	ChallengeRegister     = "register"
+	ChallengeSignIn       = "sign_in"
+	ChallengeSecondFactor = "second_factor"
+)
+
+// WebAuthnChallenge is a challenge issued for one WebAuthn ceremony. UserID is nil
+// for passwordless sign in, where the user is only known from the response.
+type WebAuthnChallenge struct {
+	ID        int64     `json:"id"`
+	Challenge string    `json:"challenge"`
+	UserID    *int64    `json:"user_id,omitempty"`
+	Purpose   string    `json:"purpose"`
 	ExpiresAt time.Time `json:"expires_at"`
 	CreatedAt time.Time `json:"created_at"`
 }
+
+// TOTPCredential is the authenticator app secret of a user. It only counts as a
+// second factor once confirmed with a first code.
+type TOTPCredential struct {
+	UserID         int64      `json:"user_id"`
+	Secret         string     `json:"-"`
+	ConfirmedAt    *time.Time `json:"confirmed_at,omitempty"`
+	LastUsedStep   int64      `json:"-"` // Codes of this step or earlier are refused
+	FailedAttempts int        `json:"-"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// RecoveryCode is a single-use code to complete a sign in without the authenticator
+// app. Only the hash of the code is stored.
+type RecoveryCode struct {
+	ID        int64      `json:"id"`
+	UserID    int64      `json:"user_id"`
+	CodeHash  string     `json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,185 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperstitieux/template/database"
+	"github.com/hyperstitieux/template/database/models"
+)
+
+type APITokensRepository interface {
+	Create(ctx context.Context, token *models.APIToken, secret string) error
+	GetBySecret(ctx context.Context, secret string) (*models.APIToken, error)
+	GetByUserID(ctx context.Context, userID int64) ([]*models.APIToken, error)
+	Touch(ctx context.Context, id int64, since time.Time) error
+	Delete(ctx context.Context, userID, id int64) error
+	DeleteExpired(ctx context.Context) error
+}
+
+type apiTokensRepository struct {
+	db *database.Database
+}
+
+func NewAPITokensRepository(db *database.Database) APITokensRepository {
+	return &apiTokensRepository{db: db}
+}
+
+// Create stores a new token of a user, keeping only a hash of its secret
+func (r *apiTokensRepository) Create(ctx context.Context, token *models.APIToken, secret string) error {
+	query := `
+		INSERT INTO api_tokens (user_id, name, token_prefix, token_hash, scopes, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`
+
+	var expiresAt *time.Time
+	if token.ExpiresAt != nil {
+		utc := token.ExpiresAt.UTC()
+		expiresAt = &utc
+	}
+
+	now := time.Now()
+	token.TokenHash = HashToken(secret)
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		token.UserID,
+		token.Name,
+		token.Prefix,
+		token.TokenHash,
+		strings.Join(token.Scopes, ","),
+		expiresAt,
+		now.UTC(),
+	).Scan(&token.ID)
+	if err != nil {
+		return writeError("create api token", err)
+	}
+
+	token.CreatedAt = now
+
+	return nil
+}
+
+const apiTokenColumns = `id, user_id, name, token_prefix, token_hash, scopes, last_used_at, expires_at, created_at`
+
+func scanAPIToken(row scanner) (*models.APIToken, error) {
+	token := &models.APIToken{}
+	var scopes string
+	var lastUsedAt, expiresAt sql.NullTime
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		&token.Prefix,
+		&token.TokenHash,
+		&scopes,
+		&lastUsedAt,
+		&expiresAt,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if scopes != "" {
+		token.Scopes = strings.Split(scopes, ",")
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	return token, nil
+}
+
+// GetBySecret retrieves the token matching a secret sent by a client, unless it expired
+func (r *apiTokensRepository) GetBySecret(ctx context.Context, secret string) (*models.APIToken, error) {
+	query := `
+		SELECT ` + apiTokenColumns + `
+		FROM api_tokens
+		WHERE token_hash = ? AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+	`
+
+	token, err := scanAPIToken(r.db.QueryRowContext(ctx, query, HashToken(secret)))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api token: %w", err)
+	}
+
+	return token, nil
+}
+
+// GetByUserID lists the tokens of a user, newest first, including expired ones
+func (r *apiTokensRepository) GetByUserID(ctx context.Context, userID int64) ([]*models.APIToken, error) {
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens WHERE user_id = ? ORDER BY created_at DESC, id DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []*models.APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan api token: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// Touch records that a token was just used, unless it already was since the given
+// time, which keeps busy CI jobs from writing on every request
+func (r *apiTokensRepository) Touch(ctx context.Context, id int64, since time.Time) error {
+	query := `
+		UPDATE api_tokens SET last_used_at = ?
+		WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, time.Now().UTC(), id, since.UTC()); err != nil {
+		return fmt.Errorf("failed to touch api token: %w", err)
+	}
+
+	return nil
+}
+
+// Delete revokes one of the user's tokens
+func (r *apiTokensRepository) Delete(ctx context.Context, userID, id int64) error {
+	query := `DELETE FROM api_tokens WHERE id = ? AND user_id = ?`
+
+	result, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete api token: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// DeleteExpired removes tokens past their expiration date
+func (r *apiTokensRepository) DeleteExpired(ctx context.Context) error {
+	query := `DELETE FROM api_tokens WHERE expires_at <= CURRENT_TIMESTAMP`
+
+	if _, err := r.db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to delete expired api tokens: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperstitieux/template/database"
+	"github.com/hyperstitieux/template/database/models"
+)
+
+// AuditEventsRepository appends to the audit log and reads it back, newest first.
+// Listings are paged with the id of the last event seen, 0 starting from the newest.
+type AuditEventsRepository interface {
+	Create(ctx context.Context, event *models.AuditEvent) error
+	GetByUserID(ctx context.Context, userID int64, beforeID int64, limit int) ([]*models.AuditEvent, error)
+	List(ctx context.Context, action, search string, beforeID int64, limit int) ([]*models.AuditEvent, error)
+}
+
+type auditEventsRepository struct {
+	db *database.Database
+}
+
+func NewAuditEventsRepository(db *database.Database) AuditEventsRepository {
+	return &auditEventsRepository{db: db}
+}
+
+const auditEventColumns = `id, actor_id, actor_email, action, target_type, target_id, ip, request_id, changes, created_at`
+
+func scanAuditEvent(row scanner) (*models.AuditEvent, error) {
+	event := &models.AuditEvent{}
+	var actorID sql.NullInt64
+	var changes string
+	err := row.Scan(
+		&event.ID,
+		&actorID,
+		&event.ActorEmail,
+		&event.Action,
+		&event.TargetType,
+		&event.TargetID,
+		&event.IP,
+		&event.RequestID,
+		&changes,
+		&event.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if actorID.Valid {
+		event.ActorID = &actorID.Int64
+	}
+	if err := json.Unmarshal([]byte(changes), &event.Changes); err != nil {
+		return nil, fmt.Errorf("failed to decode audit event changes: %w", err)
+	}
+	return event, nil
+}
+
+// Create appends an event to the audit log
+func (r *auditEventsRepository) Create(ctx context.Context, event *models.AuditEvent) error {
+	query := `
+		INSERT INTO audit_events (actor_id, actor_email, action, target_type, target_id, ip, request_id, changes, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`
+
+	changes, err := json.Marshal(event.Changes)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit event changes: %w", err)
+	}
+	if event.Changes == nil {
+		changes = []byte("{}")
+	}
+
+	now := time.Now()
+	err = r.db.QueryRowContext(
+		ctx,
+		query,
+		event.ActorID,
+		event.ActorEmail,
+		event.Action,
+		event.TargetType,
+		event.TargetID,
+		event.IP,
+		event.RequestID,
+		string(changes),
+		now.UTC(),
+	).Scan(&event.ID)
+	if err != nil {
+		return writeError("create audit event", err)
+	}
+
+	event.CreatedAt = now
+	return nil
+}
+
+// GetByUserID lists the events of a user: what they did, and what was done to their
+// account
+func (r *auditEventsRepository) GetByUserID(ctx context.Context, userID int64, beforeID int64, limit int) ([]*models.AuditEvent, error) {
+	query := `
+		SELECT ` + auditEventColumns + `
+		FROM audit_events
+		WHERE (actor_id = ? OR (target_type = 'user' AND target_id = ?))
+			AND (? = 0 OR id < ?)
+		ORDER BY id DESC
+		LIMIT ?
+	`
+	return r.list(ctx, query, userID, strconv.FormatInt(userID, 10), beforeID, beforeID, limit)
+}
+
+// List lists the events of every user, optionally of one action and matching a search
+// on the actor's email or the target's id
+func (r *auditEventsRepository) List(ctx context.Context, action, search string, beforeID int64, limit int) ([]*models.AuditEvent, error) {
+	query := `
+		SELECT ` + auditEventColumns + `
+		FROM audit_events
+		WHERE (? = '' OR action = ?)
+			AND (? = '' OR LOWER(actor_email) LIKE LOWER(?) OR target_id = ?)
+			AND (? = 0 OR id < ?)
+		ORDER BY id DESC
+		LIMIT ?
+	`
+	return r.list(ctx, query, action, action, search, "%"+search+"%", search, beforeID, beforeID, limit)
+}
+
+func (r *auditEventsRepository) list(ctx context.Context, query string, args ...any) ([]*models.AuditEvent, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []*models.AuditEvent{}
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,177 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/hyperstitieux/template/database"
+	"github.com/hyperstitieux/template/database/models"
+)
+
+type DeploymentsRepository interface {
+	Create(ctx context.Context, siteID int, triggeredBy string) (*models.Deployment, error)
+	Finish(ctx context.Context, deployment *models.Deployment) error
+	GetByID(ctx context.Context, id int) (*models.Deployment, error)
+	GetLatestBySiteID(ctx context.Context, siteID int) (*models.Deployment, error)
+	GetLatestSucceededBySiteID(ctx context.Context, siteID int) (*models.Deployment, error)
+	GetBySiteID(ctx context.Context, siteID int, limit int) ([]*models.Deployment, error)
+}
+
+type deploymentsRepository struct {
+	db *database.Database
+}
+
+func NewDeploymentsRepository(db *database.Database) DeploymentsRepository {
+	return &deploymentsRepository{db: db}
+}
+
+// Create starts a new deployment of a site
+func (r *deploymentsRepository) Create(ctx context.Context, siteID int, triggeredBy string) (*models.Deployment, error) {
+	query := `INSERT INTO deployments (site_id, status, triggered_by, started_at) VALUES (?, ?, ?, ?) RETURNING id`
+
+	now := time.Now()
+	var id int
+	if err := r.db.QueryRowContext(ctx, query, siteID, models.DeploymentRunning, triggeredBy, now.UTC()).Scan(&id); err != nil {
+		return nil, fmt.Errorf("failed to create deployment: %w", err)
+	}
+
+	return &models.Deployment{
+		ID:          id,
+		SiteID:      siteID,
+		Status:      models.DeploymentRunning,
+		TriggeredBy: triggeredBy,
+		StartedAt:   now,
+	}, nil
+}
+
+// Finish stores the outcome of a deployment
+func (r *deploymentsRepository) Finish(ctx context.Context, deployment *models.Deployment) error {
+	query := `
+		UPDATE deployments
+		SET status = ?, commit_sha = ?, pages = ?, size_bytes = ?, error = ?, finished_at = ?
+		WHERE id = ?
+	`
+
+	now := time.Now()
+	_, err := r.db.ExecContext(ctx, query, deployment.Status, deployment.CommitSHA, deployment.Pages, deployment.SizeBytes, deployment.Error, now.UTC(), deployment.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update deployment: %w", err)
+	}
+
+	deployment.FinishedAt = &now
+	return nil
+}
+
+const deploymentColumns = `id, site_id, status, triggered_by, commit_sha, pages, size_bytes, error, started_at, finished_at`
+
+func scanDeployment(row scanner) (*models.Deployment, error) {
+	deployment := &models.Deployment{}
+	var finishedAt sql.NullTime
+	err := row.Scan(
+		&deployment.ID,
+		&deployment.SiteID,
+		&deployment.Status,
+		&deployment.TriggeredBy,
+		&deployment.CommitSHA,
+		&deployment.Pages,
+		&deployment.SizeBytes,
+		&deployment.Error,
+		&deployment.StartedAt,
+		&finishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if finishedAt.Valid {
+		deployment.FinishedAt = &finishedAt.Time
+	}
+	return deployment, nil
+}
+
+// GetByID retrieves a deployment
+func (r *deploymentsRepository) GetByID(ctx context.Context, id int) (*models.Deployment, error) {
+	query := `SELECT ` + deploymentColumns + ` FROM deployments WHERE id = ?`
+
+	deployment, err := scanDeployment(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment: %w", err)
+	}
+
+	return deployment, nil
+}
+
+// GetLatestBySiteID retrieves the most recent deployment of a site
+func (r *deploymentsRepository) GetLatestBySiteID(ctx context.Context, siteID int) (*models.Deployment, error) {
+	query := `
+		SELECT ` + deploymentColumns + `
+		FROM deployments
+		WHERE site_id = ?
+		ORDER BY started_at DESC, id DESC
+		LIMIT 1
+	`
+
+	deployment, err := scanDeployment(r.db.QueryRowContext(ctx, query, siteID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest deployment: %w", err)
+	}
+
+	return deployment, nil
+}
+
+// GetLatestSucceededBySiteID retrieves the most recent successful deployment of a site,
+// the one the site was last known to serve
+func (r *deploymentsRepository) GetLatestSucceededBySiteID(ctx context.Context, siteID int) (*models.Deployment, error) {
+	query := `
+		SELECT ` + deploymentColumns + `
+		FROM deployments
+		WHERE site_id = ? AND status = ?
+		ORDER BY started_at DESC, id DESC
+		LIMIT 1
+	`
+
+	deployment, err := scanDeployment(r.db.QueryRowContext(ctx, query, siteID, models.DeploymentSucceeded))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest successful deployment: %w", err)
+	}
+
+	return deployment, nil
+}
+
+// GetBySiteID lists the most recent deployments of a site, newest first
+func (r *deploymentsRepository) GetBySiteID(ctx context.Context, siteID int, limit int) ([]*models.Deployment, error) {
+	query := `
+		SELECT ` + deploymentColumns + `
+		FROM deployments
+		WHERE site_id = ?
+		ORDER BY started_at DESC, id DESC
+		LIMIT ?
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, siteID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list deployments: %w", err)
+	}
+	defer rows.Close()
+
+	deployments := []*models.Deployment{}
+	for rows.Next() {
+		deployment, err := scanDeployment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan deployment: %w", err)
+		}
+		deployments = append(deployments, deployment)
+	}
+
+	return deployments, rows.Err()
+}
@@ -0,0 +1,23 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hyperstitieux/template/database"
+)
+
+var (
+	// ErrNotFound is returned when the requested record doesn't exist
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write clashes with existing data, such as a taken slug
+	ErrConflict = errors.New("conflict")
+)
+
+// writeError wraps a failed write, marking unique constraint violations as ErrConflict
+func writeError(action string, err error) error {
+	if database.IsUniqueViolation(err) {
+		return fmt.Errorf("failed to %s: %w: %w", action, ErrConflict, err)
+	}
+	return fmt.Errorf("failed to %s: %w", action, err)
+}
@@ -0,0 +1,159 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/hyperstitieux/template/database"
+	"github.com/hyperstitieux/template/database/models"
+)
+
+type IdentitiesRepository interface {
+	Save(ctx context.Context, identity *models.UserIdentity) error
+	GetByProviderUserID(ctx context.Context, provider, providerUserID string) (*models.UserIdentity, error)
+	GetByUserAndProvider(ctx context.Context, userID int64, provider string) (*models.UserIdentity, error)
+	GetByUserID(ctx context.Context, userID int64) ([]*models.UserIdentity, error)
+	Delete(ctx context.Context, userID int64, provider string) error
+}
+
+type identitiesRepository struct {
+	db *database.Database
+}
+
+func NewIdentitiesRepository(db *database.Database) IdentitiesRepository {
+	return &identitiesRepository{db: db}
+}
+
+const identityColumns = `id, user_id, provider, provider_user_id, email, username, access_token, created_at, updated_at`
+
+func scanIdentity(row scanner) (*models.UserIdentity, error) {
+	identity := &models.UserIdentity{}
+	err := row.Scan(
+		&identity.ID,
+		&identity.UserID,
+		&identity.Provider,
+		&identity.ProviderUserID,
+		&identity.Email,
+		&identity.Username,
+		&identity.AccessToken,
+		&identity.CreatedAt,
+		&identity.UpdatedAt,
+	)
+	return identity, err
+}
+
+// Save links a provider account to a user, or refreshes its email, username and token
+// if it is already linked to that user. It returns ErrConflict when the provider
+// account belongs to another user or the user already has an account at the provider.
+func (r *identitiesRepository) Save(ctx context.Context, identity *models.UserIdentity) error {
+	query := `
+		INSERT INTO user_identities (user_id, provider, provider_user_id, email, username, access_token, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (provider, provider_user_id) DO UPDATE SET
+			email = excluded.email,
+			username = excluded.username,
+			access_token = excluded.access_token,
+			updated_at = excluded.updated_at
+		WHERE user_identities.user_id = excluded.user_id
+		RETURNING id, created_at
+	`
+
+	now := time.Now().UTC()
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		identity.UserID,
+		identity.Provider,
+		identity.ProviderUserID,
+		identity.Email,
+		identity.Username,
+		identity.AccessToken,
+		now,
+		now,
+	).Scan(&identity.ID, &identity.CreatedAt)
+	if err == sql.ErrNoRows {
+		// The conflicting row belongs to another user, so nothing was updated
+		return fmt.Errorf("%s account %s is linked to another user: %w", identity.Provider, identity.ProviderUserID, ErrConflict)
+	}
+	if err != nil {
+		return writeError("save user identity", err)
+	}
+
+	identity.UpdatedAt = now
+	return nil
+}
+
+// GetByProviderUserID retrieves the identity of an account at a provider
+func (r *identitiesRepository) GetByProviderUserID(ctx context.Context, provider, providerUserID string) (*models.UserIdentity, error) {
+	query := `SELECT ` + identityColumns + ` FROM user_identities WHERE provider = ? AND provider_user_id = ?`
+
+	identity, err := scanIdentity(r.db.QueryRowContext(ctx, query, provider, providerUserID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user identity: %w", err)
+	}
+
+	return identity, nil
+}
+
+// GetByUserAndProvider retrieves the identity a user linked at a provider
+func (r *identitiesRepository) GetByUserAndProvider(ctx context.Context, userID int64, provider string) (*models.UserIdentity, error) {
+	query := `SELECT ` + identityColumns + ` FROM user_identities WHERE user_id = ? AND provider = ?`
+
+	identity, err := scanIdentity(r.db.QueryRowContext(ctx, query, userID, provider))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user identity: %w", err)
+	}
+
+	return identity, nil
+}
+
+// GetByUserID retrieves every identity linked to a user
+func (r *identitiesRepository) GetByUserID(ctx context.Context, userID int64) ([]*models.UserIdentity, error) {
+	query := `SELECT ` + identityColumns + ` FROM user_identities WHERE user_id = ? ORDER BY created_at, id`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user identities: %w", err)
+	}
+	defer rows.Close()
+
+	identities := []*models.UserIdentity{}
+	for rows.Next() {
+		identity, err := scanIdentity(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user identity: %w", err)
+		}
+		identities = append(identities, identity)
+	}
+
+	return identities, rows.Err()
+}
+
+// Delete unlinks a provider from a user
+func (r *identitiesRepository) Delete(ctx context.Context, userID int64, provider string) error {
+	query := `DELETE FROM user_identities WHERE user_id = ? AND provider = ?`
+
+	result, err := r.db.ExecContext(ctx, query, userID, provider)
+	if err != nil {
+		return fmt.Errorf("failed to delete user identity: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/hyperstitieux/template/database"
+	"github.com/hyperstitieux/template/database/models"
+)
+
+type InvitationsRepository interface {
+	Create(ctx context.Context, invitation *models.Invitation, token string) error
+	GetByToken(ctx context.Context, token string) (*models.Invitation, error)
+	GetByOrganizationID(ctx context.Context, organizationID int64) ([]*models.Invitation, error)
+	Delete(ctx context.Context, organizationID, id int64) error
+	DeleteExpired(ctx context.Context) error
+}
+
+type invitationsRepository struct {
+	db *database.Database
+}
+
+func NewInvitationsRepository(db *database.Database) InvitationsRepository {
+	return &invitationsRepository{db: db}
+}
+
+const invitationColumns = `id, organization_id, email, role, token_hash, invited_by, expires_at, created_at`
+
+func scanInvitation(row scanner) (*models.Invitation, error) {
+	invitation := &models.Invitation{}
+	var invitedBy sql.NullInt64
+	err := row.Scan(
+		&invitation.ID,
+		&invitation.OrganizationID,
+		&invitation.Email,
+		&invitation.Role,
+		&invitation.TokenHash,
+		&invitedBy,
+		&invitation.ExpiresAt,
+		&invitation.CreatedAt,
+	)
+	if invitedBy.Valid {
+		invitation.InvitedBy = &invitedBy.Int64
+	}
+	return invitation, err
+}
+
+// Create stores a new invitation, keeping only a hash of its token
+func (r *invitationsRepository) Create(ctx context.Context, invitation *models.Invitation, token string) error {
+	query := `
+		INSERT INTO invitations (organization_id, email, role, token_hash, invited_by, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`
+
+	now := time.Now()
+	invitation.TokenHash = HashToken(token)
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		invitation.OrganizationID,
+		invitation.Email,
+		invitation.Role,
+		invitation.TokenHash,
+		invitation.InvitedBy,
+		invitation.ExpiresAt.UTC(),
+		now.UTC(),
+	).Scan(&invitation.ID)
+	if err != nil {
+		return writeError("create invitation", err)
+	}
+
+	invitation.CreatedAt = now
+	return nil
+}
+
+// GetByToken retrieves the invitation sent with a token, unless it expired
+func (r *invitationsRepository) GetByToken(ctx context.Context, token string) (*models.Invitation, error) {
+	query := `
+		SELECT ` + invitationColumns + `
+		FROM invitations
+		WHERE token_hash = ? AND expires_at > CURRENT_TIMESTAMP
+	`
+
+	invitation, err := scanInvitation(r.db.QueryRowContext(ctx, query, HashToken(token)))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invitation: %w", err)
+	}
+
+	return invitation, nil
+}
+
+// GetByOrganizationID lists the pending invitations of an organization, newest first
+func (r *invitationsRepository) GetByOrganizationID(ctx context.Context, organizationID int64) ([]*models.Invitation, error) {
+	query := `
+		SELECT ` + invitationColumns + `
+		FROM invitations
+		WHERE organization_id = ? AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY created_at DESC, id DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	defer rows.Close()
+
+	invitations := []*models.Invitation{}
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invitation: %w", err)
+		}
+		invitations = append(invitations, invitation)
+	}
+
+	return invitations, rows.Err()
+}
+
+// Delete revokes an invitation of an organization, or removes it once accepted
+func (r *invitationsRepository) Delete(ctx context.Context, organizationID, id int64) error {
+	query := `DELETE FROM invitations WHERE id = ? AND organization_id = ?`
+
+	result, err := r.db.ExecContext(ctx, query, id, organizationID)
+	if err != nil {
+		return fmt.Errorf("failed to delete invitation: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteExpired removes the invitations that can no longer be accepted
+func (r *invitationsRepository) DeleteExpired(ctx context.Context) error {
+	query := `DELETE FROM invitations WHERE expires_at <= CURRENT_TIMESTAMP`
+
+	if _, err := r.db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("failed to delete expired invitations: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,442 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/hyperstitieux/template/database"
+	"github.com/hyperstitieux/template/database/models"
+)
+
+type JobsRepository interface {
+	// Job operations
+	Enqueue(ctx context.Context, job *models.Job) error
+	Claim(ctx context.Context, workerID string, now time.Time) (*models.Job, error)
+	Complete(ctx context.Context, job *models.Job) error
+	Retry(ctx context.Context, job *models.Job, lastError string, runAt time.Time) error
+	Fail(ctx context.Context, job *models.Job, lastError string) error
+	RequeueStale(ctx context.Context, lockedBefore time.Time) (int64, error)
+	Requeue(ctx context.Context, id int64) error
+	GetByID(ctx context.Context, id int64) (*models.Job, error)
+	List(ctx context.Context, status string, limit int) ([]*models.Job, error)
+	CountByStatus(ctx context.Context) (map[string]int, error)
+	DeleteFinishedBefore(ctx context.Context, before time.Time) error
+
+	// Schedule operations
+	UpsertSchedule(ctx context.Context, schedule *models.JobSchedule) error
+	GetDueSchedules(ctx context.Context, now time.Time) ([]*models.JobSchedule, error)
+	AdvanceSchedule(ctx context.Context, schedule *models.JobSchedule, nextRunAt time.Time, job *models.Job) (bool, error)
+	ListSchedules(ctx context.Context) ([]*models.JobSchedule, error)
+}
+
+type jobsRepository struct {
+	db *database.Database
+}
+
+func NewJobsRepository(db *database.Database) JobsRepository {
+	return &jobsRepository{db: db}
+}
+
+const jobColumns = `id, kind, payload, status, attempts, max_attempts, run_at, locked_by, locked_at, last_error, created_at, updated_at, finished_at`
+
+// scanner is implemented by *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanJob(row scanner) (*models.Job, error) {
+	job := &models.Job{}
+	err := row.Scan(
+		&job.ID,
+		&job.Kind,
+		&job.Payload,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&job.LockedBy,
+		&job.LockedAt,
+		&job.LastError,
+		&job.CreatedAt,
+		&job.UpdatedAt,
+		&job.FinishedAt,
+	)
+	return job, err
+}
+
+// Enqueue stores a new pending job
+func (r *jobsRepository) Enqueue(ctx context.Context, job *models.Job) error {
+	return r.enqueue(ctx, job)
+}
+
+func (r *jobsRepository) enqueue(ctx context.Context, job *models.Job) error {
+	query := `
+		INSERT INTO jobs (kind, payload, status, max_attempts, run_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`
+
+	now := time.Now().UTC()
+	if job.RunAt.IsZero() {
+		job.RunAt = now
+	}
+	job.RunAt = job.RunAt.UTC()
+	job.Status = models.JobPending
+
+	err := r.db.QueryRowContext(ctx, query, job.Kind, job.Payload, job.Status, job.MaxAttempts, job.RunAt, now, now).Scan(&job.ID)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue job: %w", err)
+	}
+
+	job.CreatedAt = now
+	job.UpdatedAt = now
+
+	return nil
+}
+
+// Claim atomically locks the next due pending job for a worker and counts the attempt.
+// It returns ErrNotFound when no job is due.
+func (r *jobsRepository) Claim(ctx context.Context, workerID string, now time.Time) (*models.Job, error) {
+	// SQLite serializes writers, but concurrent Postgres workers must skip rows
+	// another worker is claiming instead of racing for the same job
+	lock := ""
+	if r.db.Dialect == database.Postgres {
+		lock = "FOR UPDATE SKIP LOCKED"
+	}
+
+	now = now.UTC()
+	query := `
+		UPDATE jobs
+		SET status = ?, attempts = attempts + 1, locked_by = ?, locked_at = ?, updated_at = ?
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE status = ? AND run_at <= ?
+			ORDER BY run_at, id
+			LIMIT 1
+			` + lock + `
+		)
+		RETURNING ` + jobColumns
+
+	job, err := scanJob(r.db.QueryRowContext(ctx, query, models.JobRunning, workerID, now, now, models.JobPending, now))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim job: %w", err)
+	}
+
+	return job, nil
+}
+
+// Complete marks a job claimed by a worker as succeeded
+func (r *jobsRepository) Complete(ctx context.Context, job *models.Job) error {
+	query := `
+		UPDATE jobs
+		SET status = ?, last_error = '', locked_by = '', locked_at = NULL, updated_at = ?, finished_at = ?
+		WHERE id = ? AND status = ? AND locked_by = ? AND locked_at = ?
+	`
+
+	now := time.Now().UTC()
+	result, err := r.db.ExecContext(ctx, query, models.JobSucceeded, now, now, job.ID, models.JobRunning, job.LockedBy, job.LockedAt)
+	if err != nil {
+		return fmt.Errorf("failed to complete job: %w", err)
+	}
+
+	return checkLocked(result, job)
+}
+
+// Retry puts a job claimed by a worker back in the queue to run again at runAt
+func (r *jobsRepository) Retry(ctx context.Context, job *models.Job, lastError string, runAt time.Time) error {
+	query := `
+		UPDATE jobs
+		SET status = ?, last_error = ?, run_at = ?, locked_by = '', locked_at = NULL, updated_at = ?
+		WHERE id = ? AND status = ? AND locked_by = ? AND locked_at = ?
+	`
+
+	result, err := r.db.ExecContext(ctx, query, models.JobPending, lastError, runAt.UTC(), time.Now().UTC(), job.ID, models.JobRunning, job.LockedBy, job.LockedAt)
+	if err != nil {
+		return fmt.Errorf("failed to retry job: %w", err)
+	}
+
+	return checkLocked(result, job)
+}
+
+// Fail marks a job claimed by a worker as permanently failed
+func (r *jobsRepository) Fail(ctx context.Context, job *models.Job, lastError string) error {
+	query := `
+		UPDATE jobs
+		SET status = ?, last_error = ?, locked_by = '', locked_at = NULL, updated_at = ?, finished_at = ?
+		WHERE id = ? AND status = ? AND locked_by = ? AND locked_at = ?
+	`
+
+	now := time.Now().UTC()
+	result, err := r.db.ExecContext(ctx, query, models.JobFailed, lastError, now, now, job.ID, models.JobRunning, job.LockedBy, job.LockedAt)
+	if err != nil {
+		return fmt.Errorf("failed to fail job: %w", err)
+	}
+
+	return checkLocked(result, job)
+}
+
+// checkLocked returns ErrConflict when the outcome of a job wasn't recorded because
+// its lock expired meanwhile: the job was requeued, and maybe claimed again, and the
+// outcome is now up to that attempt
+func checkLocked(result sql.Result, job *models.Job) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("job %d is no longer locked by %s: %w", job.ID, job.LockedBy, ErrConflict)
+	}
+
+	return nil
+}
+
+// RequeueStale puts running jobs locked before the given time back in the queue.
+// This is what makes delivery at-least-once when a worker dies mid-job. Claiming the
+// job counted the attempt that died, so jobs without attempts left fail instead.
+// It returns the number of jobs requeued.
+func (r *jobsRepository) RequeueStale(ctx context.Context, lockedBefore time.Time) (int64, error) {
+	var requeued int64
+	err := r.db.Transaction(ctx, func(ctx context.Context) error {
+		now := time.Now().UTC()
+		query := `
+			UPDATE jobs
+			SET status = ?, locked_by = '', locked_at = NULL, last_error = 'worker lock expired', updated_at = ?, finished_at = ?
+			WHERE status = ? AND locked_at < ? AND attempts >= max_attempts
+		`
+		if _, err := r.db.ExecContext(ctx, query, models.JobFailed, now, now, models.JobRunning, lockedBefore.UTC()); err != nil {
+			return fmt.Errorf("failed to fail stale jobs: %w", err)
+		}
+
+		query = `
+			UPDATE jobs
+			SET status = ?, locked_by = '', locked_at = NULL, last_error = 'worker lock expired', updated_at = ?
+			WHERE status = ? AND locked_at < ?
+		`
+		result, err := r.db.ExecContext(ctx, query, models.JobPending, now, models.JobRunning, lockedBefore.UTC())
+		if err != nil {
+			return fmt.Errorf("failed to requeue stale jobs: %w", err)
+		}
+
+		requeued, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return requeued, nil
+}
+
+// Requeue puts a finished job back in the queue with a fresh set of attempts
+func (r *jobsRepository) Requeue(ctx context.Context, id int64) error {
+	query := `
+		UPDATE jobs
+		SET status = ?, attempts = 0, run_at = ?, finished_at = NULL, updated_at = ?
+		WHERE id = ? AND status IN (?, ?)
+	`
+
+	now := time.Now().UTC()
+	result, err := r.db.ExecContext(ctx, query, models.JobPending, now, now, id, models.JobSucceeded, models.JobFailed)
+	if err != nil {
+		return fmt.Errorf("failed to requeue job: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("job %d is missing or still queued: %w", id, ErrConflict)
+	}
+
+	return nil
+}
+
+// GetByID retrieves a job by its ID
+func (r *jobsRepository) GetByID(ctx context.Context, id int64) (*models.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE id = ?`
+
+	job, err := scanJob(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job by id: %w", err)
+	}
+
+	return job, nil
+}
+
+// List retrieves the most recently updated jobs, optionally filtered by status
+func (r *jobsRepository) List(ctx context.Context, status string, limit int) ([]*models.Job, error) {
+	query := `
+		SELECT ` + jobColumns + `
+		FROM jobs
+		WHERE ? = '' OR status = ?
+		ORDER BY updated_at DESC, id DESC
+		LIMIT ?
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, status, status, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []*models.Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// CountByStatus counts jobs in each status
+func (r *jobsRepository) CountByStatus(ctx context.Context) (map[string]int, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT status, COUNT(*) FROM jobs GROUP BY status`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count jobs: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan job count: %w", err)
+		}
+		counts[status] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// DeleteFinishedBefore removes succeeded and failed jobs that finished before the given time
+func (r *jobsRepository) DeleteFinishedBefore(ctx context.Context, before time.Time) error {
+	query := `DELETE FROM jobs WHERE status IN (?, ?) AND finished_at < ?`
+
+	if _, err := r.db.ExecContext(ctx, query, models.JobSucceeded, models.JobFailed, before.UTC()); err != nil {
+		return fmt.Errorf("failed to delete finished jobs: %w", err)
+	}
+
+	return nil
+}
+
+// UpsertSchedule creates a recurring job schedule, or updates its spec and job if it
+// already exists. The next run time of an existing schedule only moves when the spec changes.
+func (r *jobsRepository) UpsertSchedule(ctx context.Context, schedule *models.JobSchedule) error {
+	query := `
+		INSERT INTO job_schedules (name, spec, kind, payload, next_run_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET
+			next_run_at = CASE WHEN job_schedules.spec = excluded.spec THEN job_schedules.next_run_at ELSE excluded.next_run_at END,
+			spec = excluded.spec,
+			kind = excluded.kind,
+			payload = excluded.payload
+	`
+
+	_, err := r.db.ExecContext(ctx, query, schedule.Name, schedule.Spec, schedule.Kind, schedule.Payload, schedule.NextRunAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to upsert job schedule: %w", err)
+	}
+
+	return nil
+}
+
+// GetDueSchedules retrieves schedules whose next run time has passed
+func (r *jobsRepository) GetDueSchedules(ctx context.Context, now time.Time) ([]*models.JobSchedule, error) {
+	query := `
+		SELECT id, name, spec, kind, payload, next_run_at, last_run_at, created_at
+		FROM job_schedules
+		WHERE next_run_at <= ?
+		ORDER BY next_run_at
+	`
+
+	return r.querySchedules(ctx, query, now.UTC())
+}
+
+// ListSchedules retrieves every recurring job schedule
+func (r *jobsRepository) ListSchedules(ctx context.Context) ([]*models.JobSchedule, error) {
+	query := `
+		SELECT id, name, spec, kind, payload, next_run_at, last_run_at, created_at
+		FROM job_schedules
+		ORDER BY name
+	`
+
+	return r.querySchedules(ctx, query)
+}
+
+func (r *jobsRepository) querySchedules(ctx context.Context, query string, args ...any) ([]*models.JobSchedule, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job schedules: %w", err)
+	}
+	defer rows.Close()
+
+	schedules := []*models.JobSchedule{}
+	for rows.Next() {
+		schedule := &models.JobSchedule{}
+		err := rows.Scan(
+			&schedule.ID,
+			&schedule.Name,
+			&schedule.Spec,
+			&schedule.Kind,
+			&schedule.Payload,
+			&schedule.NextRunAt,
+			&schedule.LastRunAt,
+			&schedule.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job schedule: %w", err)
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, rows.Err()
+}
+
+// AdvanceSchedule moves a due schedule to its next run time and enqueues its job in
+// the same transaction. It returns false without enqueuing when another process
+// advanced the schedule first.
+func (r *jobsRepository) AdvanceSchedule(ctx context.Context, schedule *models.JobSchedule, nextRunAt time.Time, job *models.Job) (bool, error) {
+	advanced := false
+	err := r.db.Transaction(ctx, func(ctx context.Context) error {
+		query := `
+			UPDATE job_schedules
+			SET next_run_at = ?, last_run_at = ?
+			WHERE id = ? AND next_run_at = ?
+		`
+		result, err := r.db.ExecContext(ctx, query, nextRunAt.UTC(), time.Now().UTC(), schedule.ID, schedule.NextRunAt.UTC())
+		if err != nil {
+			return fmt.Errorf("failed to advance job schedule: %w", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if rowsAffected == 0 {
+			return nil
+		}
+
+		advanced = true
+		return r.enqueue(ctx, job)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return advanced, nil
+}
@@ -0,0 +1,176 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/hyperstitieux/template/database"
+	"github.com/hyperstitieux/template/database/models"
+)
+
+type LinkChecksRepository interface {
+	Create(ctx context.Context, siteID int) (*models.LinkCheck, error)
+	Finish(ctx context.Context, check *models.LinkCheck, brokenLinks []*models.BrokenLink) error
+	GetByID(ctx context.Context, id int) (*models.LinkCheck, error)
+	GetLatestBySiteID(ctx context.Context, siteID int) (*models.LinkCheck, error)
+	GetBrokenLinks(ctx context.Context, linkCheckID int) ([]*models.BrokenLink, error)
+}
+
+type linkChecksRepository struct {
+	db *database.Database
+}
+
+func NewLinkChecksRepository(db *database.Database) LinkChecksRepository {
+	return &linkChecksRepository{db: db}
+}
+
+// Create starts a new link check run for a site
+func (r *linkChecksRepository) Create(ctx context.Context, siteID int) (*models.LinkCheck, error) {
+	query := `INSERT INTO link_checks (site_id, status) VALUES (?, ?) RETURNING id`
+
+	var id int
+	if err := r.db.QueryRowContext(ctx, query, siteID, models.LinkCheckRunning).Scan(&id); err != nil {
+		return nil, fmt.Errorf("failed to create link check: %w", err)
+	}
+
+	return &models.LinkCheck{
+		ID:        id,
+		SiteID:    siteID,
+		Status:    models.LinkCheckRunning,
+		StartedAt: time.Now(),
+	}, nil
+}
+
+// Finish stores the outcome of a link check run along with the broken links it found
+func (r *linkChecksRepository) Finish(ctx context.Context, check *models.LinkCheck, brokenLinks []*models.BrokenLink) error {
+	now := time.Now()
+	err := r.db.Transaction(ctx, func(ctx context.Context) error {
+		query := `
+			UPDATE link_checks
+			SET status = ?, pages_checked = ?, links_checked = ?, error = ?, finished_at = ?
+			WHERE id = ?
+		`
+		if _, err := r.db.ExecContext(ctx, query, check.Status, check.PagesChecked, check.LinksChecked, check.Error, now, check.ID); err != nil {
+			return fmt.Errorf("failed to update link check: %w", err)
+		}
+
+		insert := `
+			INSERT INTO broken_links (link_check_id, source_path, line, target, kind, reason)
+			VALUES (?, ?, ?, ?, ?, ?)
+			RETURNING id
+		`
+		for _, link := range brokenLinks {
+			link.LinkCheckID = check.ID
+			err := r.db.QueryRowContext(ctx, insert, link.LinkCheckID, link.SourcePath, link.Line, link.Target, link.Kind, link.Reason).Scan(&link.ID)
+			if err != nil {
+				return fmt.Errorf("failed to create broken link: %w", err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	check.FinishedAt = &now
+	return nil
+}
+
+// GetByID retrieves a link check by its ID
+func (r *linkChecksRepository) GetByID(ctx context.Context, id int) (*models.LinkCheck, error) {
+	query := `
+		SELECT id, site_id, status, pages_checked, links_checked, error, started_at, finished_at
+		FROM link_checks
+		WHERE id = ?
+	`
+
+	check := &models.LinkCheck{}
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&check.ID,
+		&check.SiteID,
+		&check.Status,
+		&check.PagesChecked,
+		&check.LinksChecked,
+		&check.Error,
+		&check.StartedAt,
+		&check.FinishedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get link check by id: %w", err)
+	}
+
+	return check, nil
+}
+
+// GetLatestBySiteID retrieves the most recent link check of a site
+func (r *linkChecksRepository) GetLatestBySiteID(ctx context.Context, siteID int) (*models.LinkCheck, error) {
+	query := `
+		SELECT id, site_id, status, pages_checked, links_checked, error, started_at, finished_at
+		FROM link_checks
+		WHERE site_id = ?
+		ORDER BY started_at DESC, id DESC
+		LIMIT 1
+	`
+
+	check := &models.LinkCheck{}
+	err := r.db.QueryRowContext(ctx, query, siteID).Scan(
+		&check.ID,
+		&check.SiteID,
+		&check.Status,
+		&check.PagesChecked,
+		&check.LinksChecked,
+		&check.Error,
+		&check.StartedAt,
+		&check.FinishedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest link check: %w", err)
+	}
+
+	return check, nil
+}
+
+// GetBrokenLinks retrieves the broken links found by a link check, grouped by page
+func (r *linkChecksRepository) GetBrokenLinks(ctx context.Context, linkCheckID int) ([]*models.BrokenLink, error) {
+	query := `
+		SELECT id, link_check_id, source_path, line, target, kind, reason
+		FROM broken_links
+		WHERE link_check_id = ?
+		ORDER BY source_path, line, id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, linkCheckID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get broken links: %w", err)
+	}
+	defer rows.Close()
+
+	links := []*models.BrokenLink{}
+	for rows.Next() {
+		link := &models.BrokenLink{}
+		err := rows.Scan(
+			&link.ID,
+			&link.LinkCheckID,
+			&link.SourcePath,
+			&link.Line,
+			&link.Target,
+			&link.Kind,
+			&link.Reason,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan broken link: %w", err)
+		}
+		links = append(links, link)
+	}
+
+	return links, rows.Err()
+}
@@ -0,0 +1,125 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/hyperstitieux/template/database"
+	"github.com/hyperstitieux/template/database/models"
+)
+
+type MagicLinksRepository interface {
+	Create(ctx context.Context, link *models.MagicLink) error
+	Consume(ctx context.Context, tokenHash string, now time.Time) (*models.MagicLink, error)
+	CountSince(ctx context.Context, email, ip string, since time.Time) (byEmail int, byIP int, err error)
+	DeleteExpiredBefore(ctx context.Context, before time.Time) error
+}
+
+type magicLinksRepository struct {
+	db *database.Database
+}
+
+func NewMagicLinksRepository(db *database.Database) MagicLinksRepository {
+	return &magicLinksRepository{db: db}
+}
+
+const magicLinkColumns = `id, email, token_hash, ip, redirect_to, expires_at, used_at, created_at`
+
+func scanMagicLink(row scanner) (*models.MagicLink, error) {
+	link := &models.MagicLink{}
+	var usedAt sql.NullTime
+	err := row.Scan(
+		&link.ID,
+		&link.Email,
+		&link.TokenHash,
+		&link.IP,
+		&link.RedirectTo,
+		&link.ExpiresAt,
+		&usedAt,
+		&link.CreatedAt,
+	)
+	if usedAt.Valid {
+		link.UsedAt = &usedAt.Time
+	}
+	return link, err
+}
+
+// Create stores a new magic link
+func (r *magicLinksRepository) Create(ctx context.Context, link *models.MagicLink) error {
+	query := `
+		INSERT INTO magic_links (email, token_hash, ip, redirect_to, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`
+
+	now := time.Now().UTC()
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		link.Email,
+		link.TokenHash,
+		link.IP,
+		link.RedirectTo,
+		link.ExpiresAt.UTC(),
+		now,
+	).Scan(&link.ID)
+	if err != nil {
+		return writeError("create magic link", err)
+	}
+
+	link.CreatedAt = now
+	return nil
+}
+
+// Consume marks the link with the token hash as used and returns it. It returns
+// ErrNotFound when the link doesn't exist, expired or was already used, so a link
+// only ever signs in once.
+func (r *magicLinksRepository) Consume(ctx context.Context, tokenHash string, now time.Time) (*models.MagicLink, error) {
+	query := `
+		UPDATE magic_links SET used_at = ?
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?
+		RETURNING ` + magicLinkColumns
+
+	now = now.UTC()
+	link, err := scanMagicLink(r.db.QueryRowContext(ctx, query, now, tokenHash, now))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume magic link: %w", err)
+	}
+
+	return link, nil
+}
+
+// CountSince counts the links created since the given time for the email and for the IP
+func (r *magicLinksRepository) CountSince(ctx context.Context, email, ip string, since time.Time) (int, int, error) {
+	query := `
+		SELECT
+			COUNT(CASE WHEN email = ? THEN 1 END),
+			COUNT(CASE WHEN ip = ? THEN 1 END)
+		FROM magic_links
+		WHERE created_at >= ? AND (email = ? OR ip = ?)
+	`
+
+	var byEmail, byIP int
+	err := r.db.QueryRowContext(ctx, query, email, ip, since.UTC(), email, ip).Scan(&byEmail, &byIP)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count magic links: %w", err)
+	}
+
+	return byEmail, byIP, nil
+}
+
+// DeleteExpiredBefore removes the links that expired before the given time
+func (r *magicLinksRepository) DeleteExpiredBefore(ctx context.Context, before time.Time) error {
+	query := `DELETE FROM magic_links WHERE expires_at < ?`
+
+	if _, err := r.db.ExecContext(ctx, query, before.UTC()); err != nil {
+		return fmt.Errorf("failed to delete expired magic links: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,226 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/hyperstitieux/template/database"
+	"github.com/hyperstitieux/template/database/models"
+)
+
+type OrganizationsRepository interface {
+	Create(ctx context.Context, org *models.Organization) error
+	GetByID(ctx context.Context, id int64) (*models.Organization, error)
+	GetBySlug(ctx context.Context, slug string) (*models.Organization, error)
+	GetByUserID(ctx context.Context, userID int64) ([]*models.Organization, error)
+	Delete(ctx context.Context, id int64) error
+
+	AddMember(ctx context.Context, organizationID, userID int64, role string) error
+	GetRole(ctx context.Context, organizationID, userID int64) (string, error)
+	GetMembers(ctx context.Context, organizationID int64) ([]*models.Membership, error)
+	UpdateRole(ctx context.Context, organizationID, userID int64, role string) error
+	RemoveMember(ctx context.Context, organizationID, userID int64) error
+}
+
+type organizationsRepository struct {
+	db *database.Database
+}
+
+func NewOrganizationsRepository(db *database.Database) OrganizationsRepository {
+	return &organizationsRepository{db: db}
+}
+
+const organizationColumns = `id, name, slug, created_at`
+
+func scanOrganization(row scanner) (*models.Organization, error) {
+	org := &models.Organization{}
+	err := row.Scan(&org.ID, &org.Name, &org.Slug, &org.CreatedAt)
+	return org, err
+}
+
+// Create stores a new organization, without members
+func (r *organizationsRepository) Create(ctx context.Context, org *models.Organization) error {
+	query := `INSERT INTO organizations (name, slug, created_at) VALUES (?, ?, ?) RETURNING id`
+
+	now := time.Now()
+	if err := r.db.QueryRowContext(ctx, query, org.Name, org.Slug, now.UTC()).Scan(&org.ID); err != nil {
+		return writeError("create organization", err)
+	}
+
+	org.CreatedAt = now
+	return nil
+}
+
+func (r *organizationsRepository) GetByID(ctx context.Context, id int64) (*models.Organization, error) {
+	query := `SELECT ` + organizationColumns + ` FROM organizations WHERE id = ?`
+
+	org, err := scanOrganization(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+
+	return org, nil
+}
+
+func (r *organizationsRepository) GetBySlug(ctx context.Context, slug string) (*models.Organization, error) {
+	query := `SELECT ` + organizationColumns + ` FROM organizations WHERE slug = ?`
+
+	org, err := scanOrganization(r.db.QueryRowContext(ctx, query, slug))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+
+	return org, nil
+}
+
+// GetByUserID lists the organizations a user is a member of, with their role
+func (r *organizationsRepository) GetByUserID(ctx context.Context, userID int64) ([]*models.Organization, error) {
+	query := `
+		SELECT o.id, o.name, o.slug, o.created_at, m.role
+		FROM organizations o
+		JOIN memberships m ON m.organization_id = o.id
+		WHERE m.user_id = ?
+		ORDER BY o.name
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", err)
+	}
+	defer rows.Close()
+
+	orgs := []*models.Organization{}
+	for rows.Next() {
+		org := &models.Organization{}
+		if err := rows.Scan(&org.ID, &org.Name, &org.Slug, &org.CreatedAt, &org.Role); err != nil {
+			return nil, fmt.Errorf("failed to scan organization: %w", err)
+		}
+		orgs = append(orgs, org)
+	}
+
+	return orgs, rows.Err()
+}
+
+// Delete deletes an organization along with its members and invitations. It returns
+// ErrConflict while the organization still has sites, which are deleted first.
+func (r *organizationsRepository) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM organizations WHERE id = ?`, id)
+	if database.IsForeignKeyViolation(err) {
+		return fmt.Errorf("failed to delete organization: %w: %w", ErrConflict, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete organization: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// AddMember gives a user a role in an organization. It returns ErrConflict if the
+// user is already a member.
+func (r *organizationsRepository) AddMember(ctx context.Context, organizationID, userID int64, role string) error {
+	query := `INSERT INTO memberships (organization_id, user_id, role, created_at) VALUES (?, ?, ?, ?)`
+
+	if _, err := r.db.ExecContext(ctx, query, organizationID, userID, role, time.Now().UTC()); err != nil {
+		return writeError("add member", err)
+	}
+	return nil
+}
+
+// GetRole returns the role of a user in an organization, or ErrNotFound if they
+// aren't a member
+func (r *organizationsRepository) GetRole(ctx context.Context, organizationID, userID int64) (string, error) {
+	query := `SELECT role FROM memberships WHERE organization_id = ? AND user_id = ?`
+
+	var role string
+	err := r.db.QueryRowContext(ctx, query, organizationID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get role: %w", err)
+	}
+
+	return role, nil
+}
+
+// GetMembers lists the members of an organization with their name and email, in
+// order of role then name
+func (r *organizationsRepository) GetMembers(ctx context.Context, organizationID int64) ([]*models.Membership, error) {
+	query := `
+		SELECT m.id, m.organization_id, m.user_id, m.role, m.created_at, u.name, u.email
+		FROM memberships m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.organization_id = ?
+		ORDER BY CASE m.role WHEN 'owner' THEN 0 WHEN 'admin' THEN 1 WHEN 'editor' THEN 2 ELSE 3 END, u.name
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list members: %w", err)
+	}
+	defer rows.Close()
+
+	members := []*models.Membership{}
+	for rows.Next() {
+		m := &models.Membership{}
+		if err := rows.Scan(&m.ID, &m.OrganizationID, &m.UserID, &m.Role, &m.CreatedAt, &m.Name, &m.Email); err != nil {
+			return nil, fmt.Errorf("failed to scan member: %w", err)
+		}
+		members = append(members, m)
+	}
+
+	return members, rows.Err()
+}
+
+// UpdateRole changes the role of a member
+func (r *organizationsRepository) UpdateRole(ctx context.Context, organizationID, userID int64, role string) error {
+	query := `UPDATE memberships SET role = ? WHERE organization_id = ? AND user_id = ?`
+
+	result, err := r.db.ExecContext(ctx, query, role, organizationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update role: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RemoveMember removes a user from an organization
+func (r *organizationsRepository) RemoveMember(ctx context.Context, organizationID, userID int64) error {
+	query := `DELETE FROM memberships WHERE organization_id = ? AND user_id = ?`
+
+	result, err := r.db.ExecContext(ctx, query, organizationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove member: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
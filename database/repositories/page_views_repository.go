@@ -0,0 +1,118 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hyperstitieux/template/database"
+	"github.com/hyperstitieux/template/database/models"
+)
+
+type PageViewsRepository interface {
+	AddViews(ctx context.Context, views *models.PageViews) error
+	AddCounts(ctx context.Context, siteID int, day string, counts []*models.PageViewCount) error
+	GetDaily(ctx context.Context, siteID int, from string) ([]*models.PageViews, error)
+	TopCounts(ctx context.Context, siteID int, from, dimension string, limit int) ([]*models.PageViewCount, error)
+}
+
+type pageViewsRepository struct {
+	db *database.Database
+}
+
+func NewPageViewsRepository(db *database.Database) PageViewsRepository {
+	return &pageViewsRepository{db: db}
+}
+
+// AddViews adds views and visitors to those of the site on their day. Views of a site
+// deleted since are dropped.
+func (r *pageViewsRepository) AddViews(ctx context.Context, views *models.PageViews) error {
+	query := `
+		INSERT INTO page_views_daily (site_id, day, views, visitors)
+		SELECT id, ?, ?, ? FROM sites WHERE id = ?
+		ON CONFLICT (site_id, day) DO UPDATE SET
+			views = page_views_daily.views + excluded.views,
+			visitors = page_views_daily.visitors + excluded.visitors
+	`
+
+	_, err := r.db.ExecContext(ctx, query, views.Day, views.Views, views.Visitors, views.SiteID)
+	if err != nil {
+		return writeError("add page views", err)
+	}
+	return nil
+}
+
+// AddCounts adds the views of each value to those of the site on a day, like AddViews
+func (r *pageViewsRepository) AddCounts(ctx context.Context, siteID int, day string, counts []*models.PageViewCount) error {
+	query := `
+		INSERT INTO page_view_breakdowns_daily (site_id, day, dimension, value, views)
+		SELECT id, ?, ?, ?, ? FROM sites WHERE id = ?
+		ON CONFLICT (site_id, day, dimension, value) DO UPDATE SET
+			views = page_view_breakdowns_daily.views + excluded.views
+	`
+
+	for _, count := range counts {
+		_, err := r.db.ExecContext(ctx, query, day, count.Dimension, count.Value, count.Views, siteID)
+		if err != nil {
+			return writeError("add page view counts", err)
+		}
+	}
+	return nil
+}
+
+// GetDaily lists the traffic of a site from a day on, oldest first. Days without
+// views are left out.
+func (r *pageViewsRepository) GetDaily(ctx context.Context, siteID int, from string) ([]*models.PageViews, error) {
+	query := `
+		SELECT site_id, day, views, visitors
+		FROM page_views_daily
+		WHERE site_id = ? AND day >= ?
+		ORDER BY day
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, siteID, from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get page views: %w", err)
+	}
+	defer rows.Close()
+
+	days := []*models.PageViews{}
+	for rows.Next() {
+		views := &models.PageViews{}
+		if err := rows.Scan(&views.SiteID, &views.Day, &views.Views, &views.Visitors); err != nil {
+			return nil, fmt.Errorf("failed to scan page views: %w", err)
+		}
+		days = append(days, views)
+	}
+
+	return days, rows.Err()
+}
+
+// TopCounts sums the views of each value of a dimension from a day on, most viewed
+// first
+func (r *pageViewsRepository) TopCounts(ctx context.Context, siteID int, from, dimension string, limit int) ([]*models.PageViewCount, error) {
+	query := `
+		SELECT dimension, value, SUM(views) AS total
+		FROM page_view_breakdowns_daily
+		WHERE site_id = ? AND day >= ? AND dimension = ?
+		GROUP BY dimension, value
+		ORDER BY total DESC, value
+		LIMIT ?
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, siteID, from, dimension, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get page view counts: %w", err)
+	}
+	defer rows.Close()
+
+	counts := []*models.PageViewCount{}
+	for rows.Next() {
+		count := &models.PageViewCount{}
+		if err := rows.Scan(&count.Dimension, &count.Value, &count.Views); err != nil {
+			return nil, fmt.Errorf("failed to scan page view count: %w", err)
+		}
+		counts = append(counts, count)
+	}
+
+	return counts, rows.Err()
+}
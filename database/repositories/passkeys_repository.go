@@ -0,0 +1,251 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperstitieux/template/database"
+	"github.com/hyperstitieux/template/database/models"
+)
+
+type PasskeysRepository interface {
+	Create(ctx context.Context, passkey *models.Passkey) error
+	GetByCredentialID(ctx context.Context, credentialID string) (*models.Passkey, error)
+	GetByUserID(ctx context.Context, userID int64) ([]*models.Passkey, error)
+	Rename(ctx context.Context, userID, id int64, name string) error
+	Delete(ctx context.Context, userID, id int64) error
+	RecordUse(ctx context.Context, id int64, signCount uint32) error
+
+	// Challenge operations
+	CreateChallenge(ctx context.Context, challenge *models.WebAuthnChallenge) error
+	ConsumeChallenge(ctx context.Context, challenge, purpose string, now time.Time) (*models.WebAuthnChallenge, error)
+	DeleteExpiredChallenges(ctx context.Context, before time.Time) error
+}
+
+type passkeysRepository struct {
+	db *database.Database
+}
+
+func NewPasskeysRepository(db *database.Database) PasskeysRepository {
+	return &passkeysRepository{db: db}
+}
+
+const passkeyColumns = `id, user_id, credential_id, public_key, sign_count, transports, name, last_used_at, created_at`
+
+func scanPasskey(row scanner) (*models.Passkey, error) {
+	passkey := &models.Passkey{}
+	var signCount int64
+	var transports string
+	var lastUsedAt sql.NullTime
+	err := row.Scan(
+		&passkey.ID,
+		&passkey.UserID,
+		&passkey.CredentialID,
+		&passkey.PublicKey,
+		&signCount,
+		&transports,
+		&passkey.Name,
+		&lastUsedAt,
+		&passkey.CreatedAt,
+	)
+	passkey.SignCount = uint32(signCount)
+	if transports != "" {
+		passkey.Transports = strings.Split(transports, ",")
+	}
+	if lastUsedAt.Valid {
+		passkey.LastUsedAt = &lastUsedAt.Time
+	}
+	return passkey, err
+}
+
+// Create stores a newly registered passkey. It returns ErrConflict when the
+// credential is already registered.
+func (r *passkeysRepository) Create(ctx context.Context, passkey *models.Passkey) error {
+	query := `
+		INSERT INTO passkeys (user_id, credential_id, public_key, sign_count, transports, name, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`
+
+	now := time.Now().UTC()
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		passkey.UserID,
+		passkey.CredentialID,
+		passkey.PublicKey,
+		int64(passkey.SignCount),
+		strings.Join(passkey.Transports, ","),
+		passkey.Name,
+		now,
+	).Scan(&passkey.ID)
+	if err != nil {
+		return writeError("create passkey", err)
+	}
+
+	passkey.CreatedAt = now
+	return nil
+}
+
+// GetByCredentialID retrieves the passkey with a credential ID
+func (r *passkeysRepository) GetByCredentialID(ctx context.Context, credentialID string) (*models.Passkey, error) {
+	query := `SELECT ` + passkeyColumns + ` FROM passkeys WHERE credential_id = ?`
+
+	passkey, err := scanPasskey(r.db.QueryRowContext(ctx, query, credentialID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get passkey: %w", err)
+	}
+
+	return passkey, nil
+}
+
+// GetByUserID lists the passkeys of a user, oldest first
+func (r *passkeysRepository) GetByUserID(ctx context.Context, userID int64) ([]*models.Passkey, error) {
+	query := `SELECT ` + passkeyColumns + ` FROM passkeys WHERE user_id = ? ORDER BY created_at, id`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list passkeys: %w", err)
+	}
+	defer rows.Close()
+
+	var passkeys []*models.Passkey
+	for rows.Next() {
+		passkey, err := scanPasskey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan passkey: %w", err)
+		}
+		passkeys = append(passkeys, passkey)
+	}
+
+	return passkeys, rows.Err()
+}
+
+// Rename renames one of the user's passkeys
+func (r *passkeysRepository) Rename(ctx context.Context, userID, id int64, name string) error {
+	query := `UPDATE passkeys SET name = ? WHERE id = ? AND user_id = ?`
+
+	result, err := r.db.ExecContext(ctx, query, name, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to rename passkey: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Delete removes one of the user's passkeys
+func (r *passkeysRepository) Delete(ctx context.Context, userID, id int64) error {
+	query := `DELETE FROM passkeys WHERE id = ? AND user_id = ?`
+
+	result, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete passkey: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RecordUse stores the signature counter of a successful sign in and when it happened
+func (r *passkeysRepository) RecordUse(ctx context.Context, id int64, signCount uint32) error {
+	query := `UPDATE passkeys SET sign_count = ?, last_used_at = ? WHERE id = ?`
+
+	if _, err := r.db.ExecContext(ctx, query, int64(signCount), time.Now().UTC(), id); err != nil {
+		return fmt.Errorf("failed to record passkey use: %w", err)
+	}
+
+	return nil
+}
+
+// CreateChallenge stores a challenge issued to the browser
+func (r *passkeysRepository) CreateChallenge(ctx context.Context, challenge *models.WebAuthnChallenge) error {
+	query := `
+		INSERT INTO webauthn_challenges (challenge, user_id, purpose, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		RETURNING id
+	`
+
+	now := time.Now().UTC()
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		challenge.Challenge,
+		challenge.UserID,
+		challenge.Purpose,
+		challenge.ExpiresAt.UTC(),
+		now,
+	).Scan(&challenge.ID)
+	if err != nil {
+		return writeError("create webauthn challenge", err)
+	}
+
+	challenge.CreatedAt = now
+	return nil
+}
+
+// ConsumeChallenge deletes the challenge and returns it, so it can't be replayed. It
+// returns ErrNotFound when the challenge doesn't exist, expired or was issued for
+// another purpose.
+func (r *passkeysRepository) ConsumeChallenge(ctx context.Context, challenge, purpose string, now time.Time) (*models.WebAuthnChallenge, error) {
+	query := `
+		DELETE FROM webauthn_challenges
+		WHERE challenge = ? AND purpose = ? AND expires_at > ?
+		RETURNING id, challenge, user_id, purpose, expires_at, created_at
+	`
+
+	c := &models.WebAuthnChallenge{}
+	var userID sql.NullInt64
+	err := r.db.QueryRowContext(ctx, query, challenge, purpose, now.UTC()).Scan(
+		&c.ID,
+		&c.Challenge,
+		&userID,
+		&c.Purpose,
+		&c.ExpiresAt,
+		&c.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume webauthn challenge: %w", err)
+	}
+	if userID.Valid {
+		c.UserID = &userID.Int64
+	}
+
+	return c, nil
+}
+
+// DeleteExpiredChallenges removes the challenges that expired before the given time
+func (r *passkeysRepository) DeleteExpiredChallenges(ctx context.Context, before time.Time) error {
+	query := `DELETE FROM webauthn_challenges WHERE expires_at < ?`
+
+	if _, err := r.db.ExecContext(ctx, query, before.UTC()); err != nil {
+		return fmt.Errorf("failed to delete expired webauthn challenges: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,216 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/hyperstitieux/template/database"
+	"github.com/hyperstitieux/template/database/models"
+)
+
+type QuotasRepository interface {
+	GetLimits(ctx context.Context, userID int64) (*models.UserLimits, error)
+	SetLimits(ctx context.Context, limits *models.UserLimits) error
+	AddUsage(ctx context.Context, usage *models.Usage) error
+	GetUsage(ctx context.Context, userID int64, from string) ([]*models.Usage, error)
+	BandwidthSince(ctx context.Context, from string) (map[int64]int64, error)
+	CountSites(ctx context.Context, userID int64) (int, error)
+	StorageBytes(ctx context.Context, userID int64, exceptSiteID int) (int64, error)
+	RecordStorage(ctx context.Context, day string) error
+}
+
+type quotasRepository struct {
+	db *database.Database
+}
+
+func NewQuotasRepository(db *database.Database) QuotasRepository {
+	return &quotasRepository{db: db}
+}
+
+// GetLimits retrieves the plan and limits of a user. Users admins never set any for
+// get empty ones.
+func (r *quotasRepository) GetLimits(ctx context.Context, userID int64) (*models.UserLimits, error) {
+	query := `
+		SELECT plan, sites, storage_bytes, bandwidth_bytes, syncs_per_day
+		FROM user_limits
+		WHERE user_id = ?
+	`
+
+	limits := &models.UserLimits{UserID: userID}
+	var sites, syncsPerDay sql.NullInt32
+	var storageBytes, bandwidthBytes sql.NullInt64
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&limits.Plan, &sites, &storageBytes, &bandwidthBytes, &syncsPerDay)
+	if err == sql.ErrNoRows {
+		return limits, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user limits: %w", err)
+	}
+
+	if sites.Valid {
+		value := int(sites.Int32)
+		limits.Sites = &value
+	}
+	if storageBytes.Valid {
+		limits.StorageBytes = &storageBytes.Int64
+	}
+	if bandwidthBytes.Valid {
+		limits.BandwidthBytes = &bandwidthBytes.Int64
+	}
+	if syncsPerDay.Valid {
+		value := int(syncsPerDay.Int32)
+		limits.SyncsPerDay = &value
+	}
+	return limits, nil
+}
+
+// SetLimits stores the plan and limits of a user
+func (r *quotasRepository) SetLimits(ctx context.Context, limits *models.UserLimits) error {
+	query := `
+		INSERT INTO user_limits (user_id, plan, sites, storage_bytes, bandwidth_bytes, syncs_per_day)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET
+			plan = excluded.plan,
+			sites = excluded.sites,
+			storage_bytes = excluded.storage_bytes,
+			bandwidth_bytes = excluded.bandwidth_bytes,
+			syncs_per_day = excluded.syncs_per_day
+	`
+
+	_, err := r.db.ExecContext(ctx, query, limits.UserID, limits.Plan, limits.Sites, limits.StorageBytes, limits.BandwidthBytes, limits.SyncsPerDay)
+	if err != nil {
+		return writeError("set user limits", err)
+	}
+	return nil
+}
+
+// AddUsage adds the bandwidth, requests and syncs of usage to what the user used on
+// its day. Its storage is ignored, RecordStorage measures it.
+func (r *quotasRepository) AddUsage(ctx context.Context, usage *models.Usage) error {
+	query := `
+		INSERT INTO usage_daily (user_id, day, bandwidth_bytes, requests, syncs)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, day) DO UPDATE SET
+			bandwidth_bytes = usage_daily.bandwidth_bytes + excluded.bandwidth_bytes,
+			requests = usage_daily.requests + excluded.requests,
+			syncs = usage_daily.syncs + excluded.syncs
+	`
+
+	_, err := r.db.ExecContext(ctx, query, usage.UserID, usage.Day, usage.BandwidthBytes, usage.Requests, usage.Syncs)
+	if err != nil {
+		return writeError("add usage", err)
+	}
+	return nil
+}
+
+// GetUsage lists what a user used from a day on, oldest first. Days without usage are
+// left out.
+func (r *quotasRepository) GetUsage(ctx context.Context, userID int64, from string) ([]*models.Usage, error) {
+	query := `
+		SELECT user_id, day, bandwidth_bytes, requests, syncs, storage_bytes
+		FROM usage_daily
+		WHERE user_id = ? AND day >= ?
+		ORDER BY day
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage: %w", err)
+	}
+	defer rows.Close()
+
+	days := []*models.Usage{}
+	for rows.Next() {
+		usage := &models.Usage{}
+		err := rows.Scan(&usage.UserID, &usage.Day, &usage.BandwidthBytes, &usage.Requests, &usage.Syncs, &usage.StorageBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan usage: %w", err)
+		}
+		days = append(days, usage)
+	}
+
+	return days, rows.Err()
+}
+
+// BandwidthSince sums the bandwidth used by every user from a day on, by user id
+func (r *quotasRepository) BandwidthSince(ctx context.Context, from string) (map[int64]int64, error) {
+	query := `
+		SELECT user_id, SUM(bandwidth_bytes)
+		FROM usage_daily
+		WHERE day >= ?
+		GROUP BY user_id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum bandwidth: %w", err)
+	}
+	defer rows.Close()
+
+	bandwidth := make(map[int64]int64)
+	for rows.Next() {
+		var userID, bytes int64
+		if err := rows.Scan(&userID, &bytes); err != nil {
+			return nil, fmt.Errorf("failed to scan bandwidth: %w", err)
+		}
+		bandwidth[userID] = bytes
+	}
+
+	return bandwidth, rows.Err()
+}
+
+// CountSites counts the sites a user created, for themselves or their organizations
+func (r *quotasRepository) CountSites(ctx context.Context, userID int64) (int, error) {
+	var count int
+	if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sites WHERE user_id = ?`, userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count sites: %w", err)
+	}
+	return count, nil
+}
+
+// userStorageQuery sums the size of the last successful deployment of every site of a
+// user
+const userStorageQuery = `
+	SELECT COALESCE(SUM(d.size_bytes), 0)
+	FROM sites s
+	JOIN deployments d ON d.id = (
+		SELECT id FROM deployments
+		WHERE site_id = s.id AND status = 'succeeded'
+		ORDER BY started_at DESC, id DESC
+		LIMIT 1
+	)
+`
+
+// StorageBytes returns the storage used by the sites a user created, leaving out the
+// site exceptSiteID to measure what a new sync of it would add
+func (r *quotasRepository) StorageBytes(ctx context.Context, userID int64, exceptSiteID int) (int64, error) {
+	var bytes int64
+	err := r.db.QueryRowContext(ctx, userStorageQuery+` WHERE s.user_id = ? AND s.id <> ?`, userID, exceptSiteID).Scan(&bytes)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum storage: %w", err)
+	}
+	return bytes, nil
+}
+
+// RecordStorage stores the storage every user with sites uses as theirs on a day
+func (r *quotasRepository) RecordStorage(ctx context.Context, day string) error {
+	query := `
+		INSERT INTO usage_daily (user_id, day, storage_bytes)
+		SELECT s.user_id, ?, COALESCE(SUM(d.size_bytes), 0)
+		FROM sites s
+		LEFT JOIN deployments d ON d.id = (
+			SELECT id FROM deployments
+			WHERE site_id = s.id AND status = 'succeeded'
+			ORDER BY started_at DESC, id DESC
+			LIMIT 1
+		)
+		GROUP BY s.user_id
+		ON CONFLICT (user_id, day) DO UPDATE SET storage_bytes = excluded.storage_bytes
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, day); err != nil {
+		return fmt.Errorf("failed to record storage: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,672 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hyperstitieux/template/database"
+	"github.com/hyperstitieux/template/database/dbtest"
+	"github.com/hyperstitieux/template/database/models"
+)
+
+// createUser inserts a user with a verified address
+func createUser(t *testing.T, db *database.Database, email string) *models.User {
+	t.Helper()
+
+	user := &models.User{Email: email, Name: email, VerifiedEmail: true}
+	if err := NewUsersRepository(db).CreateUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestSitesRepository(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.Database) {
+		ctx := context.Background()
+		sites := NewSitesRepository(db)
+		alice := createUser(t, db, "alice@example.com")
+
+		site, err := sites.Create(ctx, int(alice.ID), nil, "docs", "alice/docs", "main", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name    string
+			run     func() error
+			wantErr error
+		}{
+			{"get by id", func() error { _, err := sites.GetByID(ctx, site.ID); return err }, nil},
+			{"get by slug", func() error { _, err := sites.GetBySlug(ctx, "docs"); return err }, nil},
+			{"missing id", func() error { _, err := sites.GetByID(ctx, site.ID+1); return err }, ErrNotFound},
+			{"missing slug", func() error { _, err := sites.GetBySlug(ctx, "blog"); return err }, ErrNotFound},
+			{"taken slug", func() error {
+				_, err := sites.Create(ctx, int(alice.ID), nil, "docs", "alice/other", "main", "")
+				return err
+			}, ErrConflict},
+			{"update missing site", func() error {
+				return sites.Update(ctx, &models.Site{ID: site.ID + 1, Slug: "blog", GithubRepo: "a/b", GithubBranch: "main"})
+			}, ErrNotFound},
+			{"delete missing site", func() error { return sites.Delete(ctx, site.ID+1) }, ErrNotFound},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				err := tt.run()
+				if tt.wantErr == nil && err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+			})
+		}
+
+		got, err := sites.GetBySlug(ctx, "docs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.UserID != int(alice.ID) || got.GithubRepo != "alice/docs" || got.OrganizationID != nil {
+			t.Errorf("site = %+v, want alice/docs owned by alice", got)
+		}
+	})
+}
+
+func TestTransaction(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.Database) {
+		ctx := context.Background()
+		sites := NewSitesRepository(db)
+		alice := createUser(t, db, "alice@example.com")
+
+		tests := []struct {
+			name  string
+			fail  bool
+			slug  string
+			count int
+		}{
+			{"commits", false, "kept", 1},
+			{"rolls back", true, "dropped", 0},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				errFail := errors.New("fail")
+				err := db.Transaction(ctx, func(ctx context.Context) error {
+					if _, err := sites.Create(ctx, int(alice.ID), nil, tt.slug, "alice/docs", "main", ""); err != nil {
+						return err
+					}
+					// Nested calls join the outer transaction
+					err := db.Transaction(ctx, func(ctx context.Context) error {
+						_, err := sites.Create(ctx, int(alice.ID), nil, tt.slug+"-nested", "alice/docs", "main", "")
+						return err
+					})
+					if err != nil {
+						return err
+					}
+					if tt.fail {
+						return errFail
+					}
+					return nil
+				})
+				if tt.fail != errors.Is(err, errFail) {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				for _, slug := range []string{tt.slug, tt.slug + "-nested"} {
+					_, err := sites.GetBySlug(ctx, slug)
+					if found := err == nil; found != (tt.count == 1) {
+						t.Errorf("site %s found = %v, want %v (%v)", slug, found, tt.count == 1, err)
+					}
+				}
+			})
+		}
+	})
+}
+
+func TestSessions(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.Database) {
+		ctx := context.Background()
+		users := NewUsersRepository(db)
+		alice := createUser(t, db, "alice@example.com")
+
+		now := time.Now()
+		session := &models.Session{UserID: alice.ID, ExpiresAt: now.Add(time.Hour), MaxExpiresAt: now.Add(2 * time.Hour)}
+		if err := users.CreateSession(ctx, session, "token"); err != nil {
+			t.Fatal(err)
+		}
+		expired := &models.Session{UserID: alice.ID, ExpiresAt: now.Add(-time.Minute), MaxExpiresAt: now.Add(time.Hour)}
+		if err := users.CreateSession(ctx, expired, "expired"); err != nil {
+			t.Fatal(err)
+		}
+		if err := users.RotateSession(ctx, "token", "rotated"); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name    string
+			token   string
+			wantErr error
+		}{
+			{"current token", "rotated", nil},
+			{"rotated away", "token", ErrNotFound},
+			{"expired", "expired", ErrNotFound},
+			{"unknown", "unknown", ErrNotFound},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				user, err := users.GetUserBySessionToken(ctx, tt.token)
+				if tt.wantErr != nil {
+					if !errors.Is(err, tt.wantErr) {
+						t.Fatalf("error = %v, want %v", err, tt.wantErr)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if user.ID != alice.ID {
+					t.Errorf("user = %d, want %d", user.ID, alice.ID)
+				}
+			})
+		}
+
+		if session.TokenHash == "token" {
+			t.Error("session token is stored in clear")
+		}
+		if err := users.DeleteSession(ctx, "token"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("deleting a rotated token: error = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestReassignCreator(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.Database) {
+		ctx := context.Background()
+		sites := NewSitesRepository(db)
+		organizations := NewOrganizationsRepository(db)
+		alice := createUser(t, db, "alice@example.com")
+		bob := createUser(t, db, "bob@example.com")
+
+		org := &models.Organization{Name: "Team", Slug: "team"}
+		if err := organizations.Create(ctx, org); err != nil {
+			t.Fatal(err)
+		}
+		orgSite, err := sites.Create(ctx, int(bob.ID), &org.ID, "team-docs", "team/docs", "main", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		personal, err := sites.Create(ctx, int(bob.ID), nil, "bob-docs", "bob/docs", "main", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := sites.ReassignCreator(ctx, org.ID, int(bob.ID), int(alice.ID)); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name   string
+			siteID int
+			userID int64
+		}{
+			{"organization site", orgSite.ID, alice.ID},
+			{"personal site", personal.ID, bob.ID},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				site, err := sites.GetByID(ctx, tt.siteID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if site.UserID != int(tt.userID) {
+					t.Errorf("user_id = %d, want %d", site.UserID, tt.userID)
+				}
+			})
+		}
+	})
+}
+
+func TestPageViews(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.Database) {
+		ctx := context.Background()
+		sites := NewSitesRepository(db)
+		pageViews := NewPageViewsRepository(db)
+		alice := createUser(t, db, "alice@example.com")
+
+		site, err := sites.Create(ctx, int(alice.ID), nil, "docs", "alice/docs", "main", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Placeholders in the select list are rebound like any other
+		for _, views := range []*models.PageViews{
+			{SiteID: site.ID, Day: "2026-01-01", Views: 3, Visitors: 2},
+			{SiteID: site.ID, Day: "2026-01-01", Views: 2, Visitors: 1},
+			{SiteID: site.ID, Day: "2026-01-02", Views: 1, Visitors: 1},
+			{SiteID: site.ID + 1, Day: "2026-01-02", Views: 7, Visitors: 7},
+		} {
+			if err := pageViews.AddViews(ctx, views); err != nil {
+				t.Fatal(err)
+			}
+		}
+		counts := []*models.PageViewCount{
+			{Dimension: models.PageViewPath, Value: "/", Views: 2},
+			{Dimension: models.PageViewPath, Value: "/about", Views: 3},
+		}
+		for _, day := range []string{"2026-01-01", "2026-01-02"} {
+			if err := pageViews.AddCounts(ctx, site.ID, day, counts); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := pageViews.AddCounts(ctx, site.ID+1, "2026-01-01", counts); err != nil {
+			t.Fatal(err)
+		}
+
+		days, err := pageViews.GetDaily(ctx, site.ID, "2026-01-01")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []models.PageViews{
+			{SiteID: site.ID, Day: "2026-01-01", Views: 5, Visitors: 3},
+			{SiteID: site.ID, Day: "2026-01-02", Views: 1, Visitors: 1},
+		}
+		if len(days) != len(want) {
+			t.Fatalf("got %d days, want %d", len(days), len(want))
+		}
+		for i := range want {
+			if *days[i] != want[i] {
+				t.Errorf("day %d = %+v, want %+v", i, *days[i], want[i])
+			}
+		}
+
+		top, err := pageViews.TopCounts(ctx, site.ID, "2026-01-02", models.PageViewPath, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(top) != 1 || top[0].Value != "/about" || top[0].Views != 3 {
+			t.Errorf("top paths = %+v, want /about with 3 views", top)
+		}
+	})
+}
+
+func TestAuditEventsAppendOnly(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.Database) {
+		ctx := context.Background()
+		events := NewAuditEventsRepository(db)
+		alice := createUser(t, db, "alice@example.com")
+
+		event := &models.AuditEvent{
+			ActorID:    &alice.ID,
+			ActorEmail: alice.Email,
+			Action:     models.AuditAccountDelete,
+			TargetType: models.AuditTargetUser,
+			TargetID:   "1",
+		}
+		if err := events.Create(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name  string
+			query string
+		}{
+			{"update", `UPDATE audit_events SET action = 'changed' WHERE id = ?`},
+			{"delete", `DELETE FROM audit_events WHERE id = ?`},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if _, err := db.ExecContext(ctx, tt.query, event.ID); err == nil {
+					t.Fatal("audit events can be changed")
+				}
+			})
+		}
+
+		listed, err := events.GetByUserID(ctx, alice.ID, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(listed) != 1 || listed[0].Action != models.AuditAccountDelete {
+			t.Errorf("events = %+v, want the recorded event", listed)
+		}
+	})
+}
+
+func TestAdminSearchIgnoresCase(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.Database) {
+		ctx := context.Background()
+		alice := createUser(t, db, "Alice@Example.com")
+		if _, err := NewSitesRepository(db).Create(ctx, int(alice.ID), nil, "alice-docs", "Alice/Docs", "main", ""); err != nil {
+			t.Fatal(err)
+		}
+		event := &models.AuditEvent{ActorID: &alice.ID, ActorEmail: alice.Email, Action: models.AuditAccountDelete, TargetType: models.AuditTargetUser, TargetID: "1"}
+		if err := NewAuditEventsRepository(db).Create(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name   string
+			search func(search string) (int, error)
+		}{
+			{"users", func(search string) (int, error) {
+				users, err := NewUsersRepository(db).List(ctx, search, 10)
+				return len(users), err
+			}},
+			{"sites", func(search string) (int, error) {
+				sites, err := NewSitesRepository(db).List(ctx, search, 10)
+				return len(sites), err
+			}},
+			{"audit events", func(search string) (int, error) {
+				events, err := NewAuditEventsRepository(db).List(ctx, "", search, 0, 10)
+				return len(events), err
+			}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				for _, search := range []string{"alice@example", "ALICE@EXAMPLE.COM"} {
+					count, err := tt.search(search)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if count != 1 {
+						t.Errorf("search %q found %d results, want 1", search, count)
+					}
+				}
+			})
+		}
+	})
+}
+
+func TestSiteLogsCountSince(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.Database) {
+		ctx := context.Background()
+		sites := NewSitesRepository(db)
+		logs := NewSiteLogsRepository(db)
+		alice := createUser(t, db, "alice@example.com")
+
+		site, err := sites.Create(ctx, int(alice.ID), nil, "docs", "alice/docs", "main", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, log := range []*models.SiteLog{
+			models.NewSiteLog(site.ID, models.LogLevelWarning, "/missing.md", 404, errors.New("not found")),
+			models.NewSiteLog(site.ID, models.LogLevelWarning, "/missing.md", 404, errors.New("not found")),
+			models.NewSiteLog(site.ID, models.LogLevelError, "/missing.md", 0, errors.New("timeout")),
+			models.NewSiteLog(site.ID, models.LogLevelError, "/other.md", 500, errors.New("server error")),
+		} {
+			if err := logs.Create(ctx, log); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		tests := []struct {
+			name   string
+			path   string
+			status int
+			since  time.Time
+			byPath int
+			bySite int
+		}{
+			{"same path and status", "/missing.md", 404, time.Now().Add(-time.Hour), 2, 4},
+			{"no upstream status", "/missing.md", 0, time.Now().Add(-time.Hour), 1, 4},
+			{"other status", "/other.md", 404, time.Now().Add(-time.Hour), 0, 4},
+			{"other path", "/new.md", 404, time.Now().Add(-time.Hour), 0, 4},
+			{"outside the window", "/missing.md", 404, time.Now().Add(time.Hour), 0, 0},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				byPath, bySite, err := logs.CountSince(ctx, site.ID, tt.path, tt.status, tt.since)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if byPath != tt.byPath || bySite != tt.bySite {
+					t.Errorf("counts = %d, %d, want %d, %d", byPath, bySite, tt.byPath, tt.bySite)
+				}
+			})
+		}
+	})
+}
+
+func TestJobLocks(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.Database) {
+		ctx := context.Background()
+		jobs := NewJobsRepository(db)
+
+		if err := jobs.Enqueue(ctx, &models.Job{Kind: "test", Payload: "{}", MaxAttempts: 3}); err != nil {
+			t.Fatal(err)
+		}
+		stale, err := jobs.Claim(ctx, "worker", time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The worker takes too long, its job is requeued and claimed again by the same process
+		if requeued, err := jobs.RequeueStale(ctx, time.Now().Add(time.Minute)); err != nil || requeued != 1 {
+			t.Fatalf("requeued %d jobs (%v), want 1", requeued, err)
+		}
+		claimed, err := jobs.Claim(ctx, "worker", time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claimed.ID != stale.ID || claimed.Attempts != 2 {
+			t.Fatalf("claimed job %d at attempt %d, want job %d at attempt 2", claimed.ID, claimed.Attempts, stale.ID)
+		}
+
+		tests := []struct {
+			name   string
+			record func(job *models.Job) error
+		}{
+			{"complete", func(job *models.Job) error { return jobs.Complete(ctx, job) }},
+			{"retry", func(job *models.Job) error { return jobs.Retry(ctx, job, "failed", time.Now()) }},
+			{"fail", func(job *models.Job) error { return jobs.Fail(ctx, job, "failed") }},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if err := tt.record(stale); !errors.Is(err, ErrConflict) {
+					t.Fatalf("outcome of the expired lock: error = %v, want ErrConflict", err)
+				}
+				job, err := jobs.GetByID(ctx, stale.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if job.Status != models.JobRunning || job.LockedBy != "worker" {
+					t.Errorf("job is %s locked by %q, want still running", job.Status, job.LockedBy)
+				}
+			})
+		}
+
+		if err := jobs.Complete(ctx, claimed); err != nil {
+			t.Fatal(err)
+		}
+		if err := jobs.Complete(ctx, claimed); !errors.Is(err, ErrConflict) {
+			t.Errorf("completing twice: error = %v, want ErrConflict", err)
+		}
+	})
+}
+
+func TestRequeueStaleAttempts(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.Database) {
+		ctx := context.Background()
+		jobs := NewJobsRepository(db)
+
+		if err := jobs.Enqueue(ctx, &models.Job{Kind: "test", Payload: "{}", MaxAttempts: 2}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Workers keep dying on the job, each claim counts an attempt
+		for attempt := 1; attempt <= 2; attempt++ {
+			job, err := jobs.Claim(ctx, "worker", time.Now())
+			if err != nil {
+				t.Fatalf("attempt %d: %v", attempt, err)
+			}
+			if job.Attempts != attempt {
+				t.Fatalf("attempts = %d, want %d", job.Attempts, attempt)
+			}
+			if _, err := jobs.RequeueStale(ctx, time.Now().Add(time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if _, err := jobs.Claim(ctx, "worker", time.Now()); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("claimed a job without attempts left: error = %v", err)
+		}
+		failed, err := jobs.List(ctx, models.JobFailed, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(failed) != 1 || failed[0].Attempts != 2 || failed[0].FinishedAt == nil {
+			t.Errorf("failed jobs = %+v, want the job after 2 attempts", failed)
+		}
+	})
+}
+
+func TestSitesAreKept(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.Database) {
+		ctx := context.Background()
+		sites := NewSitesRepository(db)
+		organizations := NewOrganizationsRepository(db)
+		logs := NewSiteLogsRepository(db)
+		alice := createUser(t, db, "alice@example.com")
+		bob := createUser(t, db, "bob@example.com")
+
+		org := &models.Organization{Name: "Team", Slug: "team"}
+		if err := organizations.Create(ctx, org); err != nil {
+			t.Fatal(err)
+		}
+		orgSite, err := sites.Create(ctx, int(bob.ID), &org.ID, "team-docs", "team/docs", "main", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		personal, err := sites.Create(ctx, int(alice.ID), nil, "alice-docs", "alice/docs", "main", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := logs.Create(ctx, models.NewSiteLog(personal.ID, models.LogLevelError, "/", 0, errors.New("failed"))); err != nil {
+			t.Fatal(err)
+		}
+
+		// Rebuilding the table on SQLite keeps the rows referencing sites
+		if _, err := db.MigrateDown(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.MigrateUp(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name   string
+			delete func() error
+		}{
+			{"user with a personal site", func() error { return NewUsersRepository(db).DeleteUser(ctx, alice.ID) }},
+			{"creator of an organization site", func() error { return NewUsersRepository(db).DeleteUser(ctx, bob.ID) }},
+			{"organization with a site", func() error { return organizations.Delete(ctx, org.ID) }},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if err := tt.delete(); !errors.Is(err, ErrConflict) {
+					t.Fatalf("error = %v, want ErrConflict", err)
+				}
+			})
+		}
+
+		for _, site := range []*models.Site{orgSite, personal} {
+			if _, err := sites.GetByID(ctx, site.ID); err != nil {
+				t.Errorf("site %s: %v", site.Slug, err)
+			}
+		}
+		kept, err := logs.GetBySiteID(ctx, personal.ID, "", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(kept) != 1 {
+			t.Errorf("got %d logs of the rebuilt site, want 1", len(kept))
+		}
+
+		// Once the sites are gone, so can their user and organization
+		for _, site := range []*models.Site{orgSite, personal} {
+			if err := sites.Delete(ctx, site.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := organizations.Delete(ctx, org.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := NewUsersRepository(db).DeleteUser(ctx, alice.ID); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestDeleteTransfersFromMember(t *testing.T) {
+	dbtest.Run(t, func(t *testing.T, db *database.Database) {
+		ctx := context.Background()
+		sites := NewSitesRepository(db)
+		organizations := NewOrganizationsRepository(db)
+		transfers := NewSiteTransfersRepository(db)
+		alice := createUser(t, db, "alice@example.com")
+		bob := createUser(t, db, "bob@example.com")
+		carol := createUser(t, db, "carol@example.com")
+
+		org := &models.Organization{Name: "Team", Slug: "team"}
+		if err := organizations.Create(ctx, org); err != nil {
+			t.Fatal(err)
+		}
+		orgSite, err := sites.Create(ctx, int(alice.ID), &org.ID, "team-docs", "team/docs", "main", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		otherSite, err := sites.Create(ctx, int(alice.ID), &org.ID, "team-blog", "team/blog", "main", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		personal, err := sites.Create(ctx, int(bob.ID), nil, "bob-docs", "bob/docs", "main", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		offer := func(site *models.Site, from *models.User) *models.SiteTransfer {
+			transfer := &models.SiteTransfer{SiteID: site.ID, FromUserID: from.ID, ToUserID: &carol.ID, ExpiresAt: time.Now().Add(time.Hour)}
+			if err := transfers.Create(ctx, transfer); err != nil {
+				t.Fatal(err)
+			}
+			return transfer
+		}
+		fromMember := offer(orgSite, bob)
+		fromOther := offer(otherSite, alice)
+		outside := offer(personal, bob)
+
+		if err := transfers.DeleteFromMember(ctx, org.ID, bob.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name     string
+			transfer *models.SiteTransfer
+			kept     bool
+		}{
+			{"offered by the member", fromMember, false},
+			{"offered by another member", fromOther, true},
+			{"site outside the organization", outside, true},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := transfers.GetByID(ctx, tt.transfer.ID)
+				if tt.kept && err != nil {
+					t.Errorf("transfer deleted: %v", err)
+				}
+				if !tt.kept && !errors.Is(err, ErrNotFound) {
+					t.Errorf("error = %v, want ErrNotFound", err)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperstitieux/template/database"
+	"github.com/hyperstitieux/template/database/models"
+)
+
+type SiteLogsRepository interface {
+	Create(ctx context.Context, log *models.SiteLog) error
+	GetBySiteID(ctx context.Context, siteID int, level string, limit int) ([]*models.SiteLog, error)
+	CountSince(ctx context.Context, siteID int, path string, upstreamStatus int, since time.Time) (byPath int, bySite int, err error)
+	DeleteOlderThan(ctx context.Context, before time.Time) error
+}
+
+type siteLogsRepository struct {
+	db *database.Database
+}
+
+func NewSiteLogsRepository(db *database.Database) SiteLogsRepository {
+	return &siteLogsRepository{db: db}
+}
+
+// Create stores a new log entry for a site
+func (r *siteLogsRepository) Create(ctx context.Context, log *models.SiteLog) error {
+	query := `
+		INSERT INTO site_logs (site_id, level, path, upstream_status, message, error_chain)
+		VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`
+
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		log.SiteID,
+		log.Level,
+		log.Path,
+		log.UpstreamStatus,
+		log.Message,
+		strings.Join(log.ErrorChain, "\n"),
+	).Scan(&log.ID)
+	if err != nil {
+		return fmt.Errorf("failed to create site log: %w", err)
+	}
+
+	log.CreatedAt = time.Now()
+
+	return nil
+}
+
+// GetBySiteID retrieves the most recent log entries of a site, newest first.
+// An empty level returns entries of every severity.
+func (r *siteLogsRepository) GetBySiteID(ctx context.Context, siteID int, level string, limit int) ([]*models.SiteLog, error) {
+	query := `
+		SELECT id, site_id, level, path, upstream_status, message, error_chain, created_at
+		FROM site_logs
+		WHERE site_id = ? AND (? = '' OR level = ?)
+		ORDER BY created_at DESC, id DESC
+		LIMIT ?
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, siteID, level, level, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get site logs: %w", err)
+	}
+	defer rows.Close()
+
+	logs := []*models.SiteLog{}
+	for rows.Next() {
+		log := &models.SiteLog{}
+		var errorChain string
+		err := rows.Scan(
+			&log.ID,
+			&log.SiteID,
+			&log.Level,
+			&log.Path,
+			&log.UpstreamStatus,
+			&log.Message,
+			&errorChain,
+			&log.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan site log: %w", err)
+		}
+		if errorChain != "" {
+			log.ErrorChain = strings.Split(errorChain, "\n")
+		}
+		logs = append(logs, log)
+	}
+
+	return logs, rows.Err()
+}
+
+// CountSince counts the entries of a site created since the given time for the path and
+// upstream status, 0 for none, and for the whole site
+func (r *siteLogsRepository) CountSince(ctx context.Context, siteID int, path string, upstreamStatus int, since time.Time) (int, int, error) {
+	query := `
+		SELECT
+			COUNT(CASE WHEN path = ? AND COALESCE(upstream_status, 0) = ? THEN 1 END),
+			COUNT(*)
+		FROM site_logs
+		WHERE site_id = ? AND created_at >= ?
+	`
+
+	var byPath, bySite int
+	err := r.db.QueryRowContext(ctx, query, path, upstreamStatus, siteID, since.UTC()).Scan(&byPath, &bySite)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count site logs: %w", err)
+	}
+
+	return byPath, bySite, nil
+}
+
+// DeleteOlderThan removes log entries created before the given time
+func (r *siteLogsRepository) DeleteOlderThan(ctx context.Context, before time.Time) error {
+	query := `DELETE FROM site_logs WHERE created_at < ?`
+
+	_, err := r.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return fmt.Errorf("failed to delete old site logs: %w", err)
+	}
+
+	return nil
+}
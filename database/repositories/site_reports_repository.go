@@ -0,0 +1,195 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/hyperstitieux/template/database"
+	"github.com/hyperstitieux/template/database/models"
+)
+
+type SiteReportsRepository interface {
+	Create(ctx context.Context, report *models.SiteReport) error
+	GetByID(ctx context.Context, id int64) (*models.SiteReport, error)
+	List(ctx context.Context, resolved bool, limit int) ([]*models.SiteReport, error)
+	CountOpen(ctx context.Context, siteID int) (int, error)
+	CountSince(ctx context.Context, ip string, since time.Time) (int, error)
+	Resolve(ctx context.Context, id, resolvedBy int64, resolution string) error
+	ResolveSite(ctx context.Context, siteID int, resolvedBy int64, resolution string) error
+}
+
+type siteReportsRepository struct {
+	db *database.Database
+}
+
+func NewSiteReportsRepository(db *database.Database) SiteReportsRepository {
+	return &siteReportsRepository{db: db}
+}
+
+// siteReportQuery selects reports with the slug and suspension of their site, and who
+// resolved them
+const siteReportQuery = `
+	SELECT r.id, r.site_id, r.category, r.url, r.details, r.reporter_email, r.ip,
+		r.resolution, r.resolved_by, r.resolved_at, r.created_at,
+		s.slug, s.suspended_at IS NOT NULL, COALESCE(u.email, '')
+	FROM site_reports r
+	JOIN sites s ON s.id = r.site_id
+	LEFT JOIN users u ON u.id = r.resolved_by
+`
+
+func scanSiteReport(row scanner) (*models.SiteReport, error) {
+	report := &models.SiteReport{}
+	var resolvedBy sql.NullInt64
+	var resolvedAt sql.NullTime
+	err := row.Scan(
+		&report.ID,
+		&report.SiteID,
+		&report.Category,
+		&report.URL,
+		&report.Details,
+		&report.ReporterEmail,
+		&report.IP,
+		&report.Resolution,
+		&resolvedBy,
+		&resolvedAt,
+		&report.CreatedAt,
+		&report.SiteSlug,
+		&report.SiteSuspended,
+		&report.ResolverEmail,
+	)
+	if resolvedBy.Valid {
+		report.ResolvedBy = &resolvedBy.Int64
+	}
+	if resolvedAt.Valid {
+		report.ResolvedAt = &resolvedAt.Time
+	}
+	return report, err
+}
+
+// Create stores an open report
+func (r *siteReportsRepository) Create(ctx context.Context, report *models.SiteReport) error {
+	query := `
+		INSERT INTO site_reports (site_id, category, url, details, reporter_email, ip, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`
+
+	now := time.Now()
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		report.SiteID,
+		report.Category,
+		report.URL,
+		report.Details,
+		report.ReporterEmail,
+		report.IP,
+		now.UTC(),
+	).Scan(&report.ID)
+	if err != nil {
+		return writeError("create site report", err)
+	}
+
+	report.CreatedAt = now
+	return nil
+}
+
+// GetByID retrieves a report
+func (r *siteReportsRepository) GetByID(ctx context.Context, id int64) (*models.SiteReport, error) {
+	report, err := scanSiteReport(r.db.QueryRowContext(ctx, siteReportQuery+` WHERE r.id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get site report: %w", err)
+	}
+
+	return report, nil
+}
+
+// List returns the open reports, oldest first, or the resolved ones, most recently
+// resolved first
+func (r *siteReportsRepository) List(ctx context.Context, resolved bool, limit int) ([]*models.SiteReport, error) {
+	query := siteReportQuery + ` WHERE r.resolved_at IS NULL ORDER BY r.created_at, r.id LIMIT ?`
+	if resolved {
+		query = siteReportQuery + ` WHERE r.resolved_at IS NOT NULL ORDER BY r.resolved_at DESC, r.id DESC LIMIT ?`
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list site reports: %w", err)
+	}
+	defer rows.Close()
+
+	reports := []*models.SiteReport{}
+	for rows.Next() {
+		report, err := scanSiteReport(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan site report: %w", err)
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, rows.Err()
+}
+
+// CountOpen counts the open reports of a site
+func (r *siteReportsRepository) CountOpen(ctx context.Context, siteID int) (int, error) {
+	query := `SELECT COUNT(*) FROM site_reports WHERE site_id = ? AND resolved_at IS NULL`
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, query, siteID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count site reports: %w", err)
+	}
+	return count, nil
+}
+
+// CountSince counts the reports sent from an IP address since the given time, to
+// limit how many a visitor sends
+func (r *siteReportsRepository) CountSince(ctx context.Context, ip string, since time.Time) (int, error) {
+	query := `SELECT COUNT(*) FROM site_reports WHERE ip = ? AND created_at >= ?`
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, query, ip, since.UTC()).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count site reports: %w", err)
+	}
+	return count, nil
+}
+
+// Resolve closes an open report. It returns ErrNotFound if the report doesn't exist or
+// was already resolved.
+func (r *siteReportsRepository) Resolve(ctx context.Context, id, resolvedBy int64, resolution string) error {
+	query := `
+		UPDATE site_reports SET resolution = ?, resolved_by = ?, resolved_at = ?
+		WHERE id = ? AND resolved_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, resolution, resolvedBy, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to resolve site report: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ResolveSite closes every open report of a site, once it is suspended
+func (r *siteReportsRepository) ResolveSite(ctx context.Context, siteID int, resolvedBy int64, resolution string) error {
+	query := `
+		UPDATE site_reports SET resolution = ?, resolved_by = ?, resolved_at = ?
+		WHERE site_id = ? AND resolved_at IS NULL
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, resolution, resolvedBy, time.Now().UTC(), siteID); err != nil {
+		return fmt.Errorf("failed to resolve site reports: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/hyperstitieux/template/database"
+	"github.com/hyperstitieux/template/database/models"
+)
+
+type SiteTransfersRepository interface {
+	Create(ctx context.Context, transfer *models.SiteTransfer) error
+	GetByID(ctx context.Context, id int64) (*models.SiteTransfer, error)
+	GetBySiteID(ctx context.Context, siteID int) (*models.SiteTransfer, error)
+	GetIncoming(ctx context.Context, userID int64) ([]*models.SiteTransfer, error)
+	Delete(ctx context.Context, id int64) error
+	DeleteFromMember(ctx context.Context, organizationID, userID int64) error
+	DeleteExpired(ctx context.Context) error
+}
+
+type siteTransfersRepository struct {
+	db *database.Database
+}
+
+func NewSiteTransfersRepository(db *database.Database) SiteTransfersRepository {
+	return &siteTransfersRepository{db: db}
+}
+
+// siteTransferQuery selects pending transfers with the slug of their site, the name of
+// who sent them and their recipient
+const siteTransferQuery = `
+	SELECT t.id, t.site_id, t.from_user_id, t.to_user_id, t.to_organization_id, t.expires_at, t.created_at,
+		s.slug, u.name, COALESCE(tu.email, o.name, '')
+	FROM site_transfers t
+	JOIN sites s ON s.id = t.site_id
+	JOIN users u ON u.id = t.from_user_id
+	LEFT JOIN users tu ON tu.id = t.to_user_id
+	LEFT JOIN organizations o ON o.id = t.to_organization_id
+	WHERE t.expires_at > CURRENT_TIMESTAMP
+`
+
+func scanSiteTransfer(row scanner) (*models.SiteTransfer, error) {
+	transfer := &models.SiteTransfer{}
+	var toUserID, toOrganizationID sql.NullInt64
+	err := row.Scan(
+		&transfer.ID,
+		&transfer.SiteID,
+		&transfer.FromUserID,
+		&toUserID,
+		&toOrganizationID,
+		&transfer.ExpiresAt,
+		&transfer.CreatedAt,
+		&transfer.SiteSlug,
+		&transfer.FromName,
+		&transfer.Recipient,
+	)
+	if toUserID.Valid {
+		transfer.ToUserID = &toUserID.Int64
+	}
+	if toOrganizationID.Valid {
+		transfer.ToOrganizationID = &toOrganizationID.Int64
+	}
+	return transfer, err
+}
+
+// Create stores a pending transfer. It returns ErrConflict if the site already has
+// one, expired transfers being removed first.
+func (r *siteTransfersRepository) Create(ctx context.Context, transfer *models.SiteTransfer) error {
+	expired := `DELETE FROM site_transfers WHERE site_id = ? AND expires_at <= CURRENT_TIMESTAMP`
+	if _, err := r.db.ExecContext(ctx, expired, transfer.SiteID); err != nil {
+		return fmt.Errorf("failed to delete expired transfer: %w", err)
+	}
+
+	query := `
+		INSERT INTO site_transfers (site_id, from_user_id, to_user_id, to_organization_id, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`
+
+	now := time.Now()
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		transfer.SiteID,
+		transfer.FromUserID,
+		transfer.ToUserID,
+		transfer.ToOrganizationID,
+		transfer.ExpiresAt.UTC(),
+		now.UTC(),
+	).Scan(&transfer.ID)
+	if err != nil {
+		return writeError("create site transfer", err)
+	}
+
+	transfer.CreatedAt = now
+	return nil
+}
+
+// GetByID retrieves a pending transfer
+func (r *siteTransfersRepository) GetByID(ctx context.Context, id int64) (*models.SiteTransfer, error) {
+	return r.get(ctx, siteTransferQuery+` AND t.id = ?`, id)
+}
+
+// GetBySiteID retrieves the pending transfer of a site
+func (r *siteTransfersRepository) GetBySiteID(ctx context.Context, siteID int) (*models.SiteTransfer, error) {
+	return r.get(ctx, siteTransferQuery+` AND t.site_id = ?`, siteID)
+}
+
+func (r *siteTransfersRepository) get(ctx context.Context, query string, args ...any) (*models.SiteTransfer, error) {
+	transfer, err := scanSiteTransfer(r.db.QueryRowContext(ctx, query, args...))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get site transfer: %w", err)
+	}
+
+	return transfer, nil
+}
+
+// GetIncoming lists the pending transfers a user can accept: those sent to them, and
+// those sent to the organizations they are an owner or admin of
+func (r *siteTransfersRepository) GetIncoming(ctx context.Context, userID int64) ([]*models.SiteTransfer, error) {
+	query := siteTransferQuery + `
+		AND (t.to_user_id = ? OR t.to_organization_id IN (
+			SELECT organization_id FROM memberships WHERE user_id = ? AND role IN ('owner', 'admin')
+		))
+		ORDER BY t.created_at DESC, t.id DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list site transfers: %w", err)
+	}
+	defer rows.Close()
+
+	transfers := []*models.SiteTransfer{}
+	for rows.Next() {
+		transfer, err := scanSiteTransfer(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan site transfer: %w", err)
+		}
+		transfers = append(transfers, transfer)
+	}
+
+	return transfers, rows.Err()
+}
+
+// Delete removes a transfer once accepted, declined or cancelled
+func (r *siteTransfersRepository) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM site_transfers WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete site transfer: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeleteFromMember removes the transfers a member offered for the sites of the
+// organization, once they are no longer allowed to give them away
+func (r *siteTransfersRepository) DeleteFromMember(ctx context.Context, organizationID, userID int64) error {
+	query := `
+		DELETE FROM site_transfers
+		WHERE from_user_id = ? AND site_id IN (SELECT id FROM sites WHERE organization_id = ?)
+	`
+	if _, err := r.db.ExecContext(ctx, query, userID, organizationID); err != nil {
+		return fmt.Errorf("failed to delete site transfers of member: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired removes the transfers that can no longer be accepted
+func (r *siteTransfersRepository) DeleteExpired(ctx context.Context) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM site_transfers WHERE expires_at <= CURRENT_TIMESTAMP`); err != nil {
+		return fmt.Errorf("failed to delete expired site transfers: %w", err)
+	}
+	return nil
+}
@@ -1,63 +1,91 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"time"
 
+	"github.com/hyperstitieux/template/database"
 	"github.com/hyperstitieux/template/database/models"
 )
 
 type SitesRepository interface {
-	Create(userID int, slug, githubRepo, githubBranch, subdirectory string) (*models.Site, error)
-	GetByID(id int) (*models.Site, error)
-	GetBySlug(slug string) (*models.Site, error)
-	GetByUserID(userID int) ([]*models.Site, error)
-	Delete(id int) error
+	Create(ctx context.Context, userID int, organizationID *int64, slug, githubRepo, githubBranch, subdirectory string) (*models.Site, error)
+	GetByID(ctx context.Context, id int) (*models.Site, error)
+	GetBySlug(ctx context.Context, slug string) (*models.Site, error)
+	GetByUserID(ctx context.Context, userID int) ([]*models.Site, error)
+	GetAccessibleByUserID(ctx context.Context, userID int) ([]*models.Site, error)
+	GetByOrganizationID(ctx context.Context, organizationID int64) ([]*models.Site, error)
+	List(ctx context.Context, search string, limit int) ([]*models.Site, error)
+	Update(ctx context.Context, site *models.Site) error
+	Delete(ctx context.Context, id int) error
+	ReassignCreator(ctx context.Context, organizationID int64, fromUserID, toUserID int) error
+	UpdateOwner(ctx context.Context, id, userID int, organizationID *int64) error
+	Suspend(ctx context.Context, id int, reason string) error
+	Unsuspend(ctx context.Context, id int) error
 }
 
 type sitesRepository struct {
-	db *sql.DB
+	db *database.Database
 }
 
-func NewSitesRepository(db *sql.DB) SitesRepository {
+func NewSitesRepository(db *database.Database) SitesRepository {
 	return &sitesRepository{db: db}
 }
 
-func (r *sitesRepository) Create(userID int, slug, githubRepo, githubBranch, subdirectory string) (*models.Site, error) {
-	query := `
-		INSERT INTO sites (user_id, slug, github_repo, github_branch, subdirectory)
-		VALUES (?, ?, ?, ?, ?)
-	`
-	result, err := r.db.Exec(query, userID, slug, githubRepo, githubBranch, subdirectory)
-	if err != nil {
-		return nil, err
+const siteColumns = `id, user_id, organization_id, slug, github_repo, github_branch, subdirectory, suspended_at, suspended_reason, created_at`
+
+func scanSite(row scanner) (*models.Site, error) {
+	site := &models.Site{}
+	var organizationID sql.NullInt64
+	var suspendedAt sql.NullTime
+	err := row.Scan(
+		&site.ID,
+		&site.UserID,
+		&organizationID,
+		&site.Slug,
+		&site.GithubRepo,
+		&site.GithubBranch,
+		&site.Subdirectory,
+		&suspendedAt,
+		&site.SuspendedReason,
+		&site.CreatedAt,
+	)
+	if organizationID.Valid {
+		site.OrganizationID = &organizationID.Int64
+	}
+	if suspendedAt.Valid {
+		site.SuspendedAt = &suspendedAt.Time
 	}
+	return site, err
+}
 
-	id, err := result.LastInsertId()
+// Create creates a site of the user, or of the organization when one is given
+func (r *sitesRepository) Create(ctx context.Context, userID int, organizationID *int64, slug, githubRepo, githubBranch, subdirectory string) (*models.Site, error) {
+	query := `
+		INSERT INTO sites (user_id, organization_id, slug, github_repo, github_branch, subdirectory)
+		VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`
+	var id int
+	err := r.db.QueryRowContext(ctx, query, userID, organizationID, slug, githubRepo, githubBranch, subdirectory).Scan(&id)
 	if err != nil {
-		return nil, err
+		return nil, writeError("create site", err)
 	}
 
-	return r.GetByID(int(id))
+	return r.GetByID(ctx, id)
 }
 
-func (r *sitesRepository) GetByID(id int) (*models.Site, error) {
+func (r *sitesRepository) GetByID(ctx context.Context, id int) (*models.Site, error) {
 	query := `
-		SELECT id, user_id, slug, github_repo, github_branch, subdirectory, created_at
+		SELECT ` + siteColumns + `
 		FROM sites
 		WHERE id = ?
 	`
-	site := &models.Site{}
-	err := r.db.QueryRow(query, id).Scan(
-		&site.ID,
-		&site.UserID,
-		&site.Slug,
-		&site.GithubRepo,
-		&site.GithubBranch,
-		&site.Subdirectory,
-		&site.CreatedAt,
-	)
+	site, err := scanSite(r.db.QueryRowContext(ctx, query, id))
 	if err == sql.ErrNoRows {
-		return nil, nil
+		return nil, ErrNotFound
 	}
 	if err != nil {
 		return nil, err
@@ -65,24 +93,15 @@ func (r *sitesRepository) GetByID(id int) (*models.Site, error) {
 	return site, nil
 }
 
-func (r *sitesRepository) GetBySlug(slug string) (*models.Site, error) {
+func (r *sitesRepository) GetBySlug(ctx context.Context, slug string) (*models.Site, error) {
 	query := `
-		SELECT id, user_id, slug, github_repo, github_branch, subdirectory, created_at
+		SELECT ` + siteColumns + `
 		FROM sites
 		WHERE slug = ?
 	`
-	site := &models.Site{}
-	err := r.db.QueryRow(query, slug).Scan(
-		&site.ID,
-		&site.UserID,
-		&site.Slug,
-		&site.GithubRepo,
-		&site.GithubBranch,
-		&site.Subdirectory,
-		&site.CreatedAt,
-	)
+	site, err := scanSite(r.db.QueryRowContext(ctx, query, slug))
 	if err == sql.ErrNoRows {
-		return nil, nil
+		return nil, ErrNotFound
 	}
 	if err != nil {
 		return nil, err
@@ -90,33 +109,70 @@ func (r *sitesRepository) GetBySlug(slug string) (*models.Site, error) {
 	return site, nil
 }
 
-func (r *sitesRepository) GetByUserID(userID int) ([]*models.Site, error) {
+// GetByUserID lists the personal sites of a user, leaving out the sites they created
+// for an organization
+func (r *sitesRepository) GetByUserID(ctx context.Context, userID int) ([]*models.Site, error) {
+	query := `
+		SELECT ` + siteColumns + `
+		FROM sites
+		WHERE user_id = ? AND organization_id IS NULL
+		ORDER BY created_at DESC
+	`
+	return r.list(ctx, query, userID)
+}
+
+// GetAccessibleByUserID lists the personal sites of a user and the sites of the
+// organizations they are a member of
+func (r *sitesRepository) GetAccessibleByUserID(ctx context.Context, userID int) ([]*models.Site, error) {
+	query := `
+		SELECT ` + siteColumns + `
+		FROM sites
+		WHERE (user_id = ? AND organization_id IS NULL)
+			OR organization_id IN (SELECT organization_id FROM memberships WHERE user_id = ?)
+		ORDER BY created_at DESC
+	`
+	return r.list(ctx, query, userID, userID)
+}
+
+// GetByOrganizationID lists the sites of an organization
+func (r *sitesRepository) GetByOrganizationID(ctx context.Context, organizationID int64) ([]*models.Site, error) {
 	query := `
-		SELECT id, user_id, slug, github_repo, github_branch, subdirectory, created_at
+		SELECT ` + siteColumns + `
 		FROM sites
-		WHERE user_id = ?
+		WHERE organization_id = ?
 		ORDER BY created_at DESC
 	`
-	rows, err := r.db.Query(query, userID)
+	return r.list(ctx, query, organizationID)
+}
+
+// List lists every site, newest first, optionally matching a search on their slug,
+// repository or creator's email, or their exact id
+func (r *sitesRepository) List(ctx context.Context, search string, limit int) ([]*models.Site, error) {
+	query := `
+		SELECT ` + siteColumns + `
+		FROM sites
+		WHERE ? = '' OR LOWER(slug) LIKE LOWER(?) OR LOWER(github_repo) LIKE LOWER(?) OR CAST(id AS TEXT) = ?
+			OR user_id IN (SELECT id FROM users WHERE LOWER(email) LIKE LOWER(?))
+		ORDER BY id DESC
+		LIMIT ?
+	`
+	pattern := "%" + search + "%"
+	return r.list(ctx, query, search, pattern, pattern, search, pattern, limit)
+}
+
+// list runs a query returning sites
+func (r *sitesRepository) list(ctx context.Context, query string, args ...any) ([]*models.Site, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to list sites: %w", err)
 	}
 	defer rows.Close()
 
 	sites := []*models.Site{}
 	for rows.Next() {
-		site := &models.Site{}
-		err := rows.Scan(
-			&site.ID,
-			&site.UserID,
-			&site.Slug,
-			&site.GithubRepo,
-			&site.GithubBranch,
-			&site.Subdirectory,
-			&site.CreatedAt,
-		)
+		site, err := scanSite(rows)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("failed to scan site: %w", err)
 		}
 		sites = append(sites, site)
 	}
@@ -124,8 +180,103 @@ func (r *sitesRepository) GetByUserID(userID int) ([]*models.Site, error) {
 	return sites, rows.Err()
 }
 
-func (r *sitesRepository) Delete(id int) error {
+// Update saves the repository, branch and subdirectory of a site. The slug is its
+// address and doesn't change.
+func (r *sitesRepository) Update(ctx context.Context, site *models.Site) error {
+	query := `UPDATE sites SET github_repo = ?, github_branch = ?, subdirectory = ? WHERE id = ?`
+	result, err := r.db.ExecContext(ctx, query, site.GithubRepo, site.GithubBranch, site.Subdirectory, site.ID)
+	if err != nil {
+		return writeError("update site", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *sitesRepository) Delete(ctx context.Context, id int) error {
 	query := `DELETE FROM sites WHERE id = ?`
-	_, err := r.db.Exec(query, id)
-	return err
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ReassignCreator credits another member with the sites a member created for an
+// organization, when that member leaves it or their account is deleted
+func (r *sitesRepository) ReassignCreator(ctx context.Context, organizationID int64, fromUserID, toUserID int) error {
+	query := `UPDATE sites SET user_id = ? WHERE organization_id = ? AND user_id = ?`
+	if _, err := r.db.ExecContext(ctx, query, toUserID, organizationID, fromUserID); err != nil {
+		return writeError("reassign sites", err)
+	}
+	return nil
+}
+
+// UpdateOwner hands a site over to a user, or to an organization with userID as the
+// member credited for it. The site keeps its slug, deployments and logs.
+func (r *sitesRepository) UpdateOwner(ctx context.Context, id, userID int, organizationID *int64) error {
+	query := `UPDATE sites SET user_id = ?, organization_id = ? WHERE id = ?`
+	result, err := r.db.ExecContext(ctx, query, userID, organizationID, id)
+	if err != nil {
+		return writeError("update site owner", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Suspend stops serving a site, for the reason given
+func (r *sitesRepository) Suspend(ctx context.Context, id int, reason string) error {
+	query := `UPDATE sites SET suspended_at = ?, suspended_reason = ? WHERE id = ?`
+	result, err := r.db.ExecContext(ctx, query, time.Now().UTC(), reason, id)
+	if err != nil {
+		return writeError("suspend site", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Unsuspend serves a suspended site again
+func (r *sitesRepository) Unsuspend(ctx context.Context, id int) error {
+	query := `UPDATE sites SET suspended_at = NULL, suspended_reason = '' WHERE id = ?`
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return writeError("unsuspend site", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
 }
@@ -0,0 +1,56 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hyperstitieux/template/database"
+	"github.com/hyperstitieux/template/database/models"
+)
+
+type StatsRepository interface {
+	Get(ctx context.Context) (*models.InstanceStats, error)
+}
+
+type statsRepository struct {
+	db *database.Database
+}
+
+func NewStatsRepository(db *database.Database) StatsRepository {
+	return &statsRepository{db: db}
+}
+
+// Get counts the users, organizations, sites, recent deployments and open reports of
+// the instance
+func (r *statsRepository) Get(ctx context.Context) (*models.InstanceStats, error) {
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM users),
+			(SELECT COUNT(*) FROM users WHERE suspended_at IS NOT NULL),
+			(SELECT COUNT(DISTINCT user_id) FROM sessions WHERE last_seen_at > ? AND NOT second_factor_pending),
+			(SELECT COUNT(*) FROM organizations),
+			(SELECT COUNT(*) FROM sites),
+			(SELECT COUNT(*) FROM sites WHERE suspended_at IS NOT NULL),
+			(SELECT COUNT(*) FROM deployments WHERE started_at > ?),
+			(SELECT COUNT(*) FROM site_reports WHERE resolved_at IS NULL)
+	`
+
+	now := time.Now().UTC()
+	stats := &models.InstanceStats{}
+	err := r.db.QueryRowContext(ctx, query, now.Add(-30*24*time.Hour), now.Add(-24*time.Hour)).Scan(
+		&stats.Users,
+		&stats.SuspendedUsers,
+		&stats.ActiveUsers,
+		&stats.Organizations,
+		&stats.Sites,
+		&stats.SuspendedSites,
+		&stats.RecentDeployments,
+		&stats.OpenReports,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get instance stats: %w", err)
+	}
+
+	return stats, nil
+}
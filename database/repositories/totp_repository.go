@@ -0,0 +1,244 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/hyperstitieux/template/database"
+	"github.com/hyperstitieux/template/database/models"
+)
+
+type TOTPRepository interface {
+	Get(ctx context.Context, userID int64) (*models.TOTPCredential, error)
+	SaveUnconfirmed(ctx context.Context, userID int64, secret string) error
+	Confirm(ctx context.Context, userID, step int64) error
+	RecordUse(ctx context.Context, userID, step int64) error
+	RecordFailure(ctx context.Context, userID int64) (int, error)
+	Delete(ctx context.Context, userID int64) error
+
+	// Recovery code operations
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error
+	ConsumeRecoveryCode(ctx context.Context, userID int64, codeHash string) error
+	CountRecoveryCodes(ctx context.Context, userID int64) (int, error)
+}
+
+type totpRepository struct {
+	db *database.Database
+}
+
+func NewTOTPRepository(db *database.Database) TOTPRepository {
+	return &totpRepository{db: db}
+}
+
+// Get retrieves the authenticator app secret of a user, confirmed or not
+func (r *totpRepository) Get(ctx context.Context, userID int64) (*models.TOTPCredential, error) {
+	query := `
+		SELECT user_id, secret, confirmed_at, last_used_step, failed_attempts, created_at
+		FROM totp_credentials
+		WHERE user_id = ?
+	`
+
+	credential := &models.TOTPCredential{}
+	var confirmedAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(
+		&credential.UserID,
+		&credential.Secret,
+		&confirmedAt,
+		&credential.LastUsedStep,
+		&credential.FailedAttempts,
+		&credential.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get totp credential: %w", err)
+	}
+	if confirmedAt.Valid {
+		credential.ConfirmedAt = &confirmedAt.Time
+	}
+
+	return credential, nil
+}
+
+// SaveUnconfirmed stores a new secret for the user to add to their app, replacing
+// one they never confirmed. It returns ErrConflict when a confirmed secret exists.
+func (r *totpRepository) SaveUnconfirmed(ctx context.Context, userID int64, secret string) error {
+	query := `
+		INSERT INTO totp_credentials (user_id, secret, created_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET
+			secret = excluded.secret,
+			created_at = excluded.created_at
+		WHERE totp_credentials.confirmed_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID, secret, time.Now().UTC())
+	if err != nil {
+		return writeError("save totp credential", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("authenticator app already set up for user %d: %w", userID, ErrConflict)
+	}
+
+	return nil
+}
+
+// Confirm turns on the user's secret after they entered a code of the given step
+func (r *totpRepository) Confirm(ctx context.Context, userID, step int64) error {
+	query := `
+		UPDATE totp_credentials SET confirmed_at = ?, last_used_step = ?, failed_attempts = 0
+		WHERE user_id = ? AND confirmed_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now().UTC(), step, userID)
+	if err != nil {
+		return fmt.Errorf("failed to confirm totp credential: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RecordUse stores the step of a code that was accepted and clears failed attempts.
+// It returns ErrConflict when a code of that step or a later one was already used,
+// so a code seen by someone else can't be replayed.
+func (r *totpRepository) RecordUse(ctx context.Context, userID, step int64) error {
+	query := `
+		UPDATE totp_credentials SET last_used_step = ?, failed_attempts = 0
+		WHERE user_id = ? AND last_used_step < ?
+	`
+
+	result, err := r.db.ExecContext(ctx, query, step, userID, step)
+	if err != nil {
+		return fmt.Errorf("failed to record totp use: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrConflict
+	}
+
+	return nil
+}
+
+// RecordFailure counts a wrong code and returns the failures since the last success
+func (r *totpRepository) RecordFailure(ctx context.Context, userID int64) (int, error) {
+	query := `
+		UPDATE totp_credentials SET failed_attempts = failed_attempts + 1
+		WHERE user_id = ?
+		RETURNING failed_attempts
+	`
+
+	var failedAttempts int
+	err := r.db.QueryRowContext(ctx, query, userID).Scan(&failedAttempts)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to record totp failure: %w", err)
+	}
+
+	return failedAttempts, nil
+}
+
+// Delete turns off the authenticator app of a user and drops their recovery codes
+func (r *totpRepository) Delete(ctx context.Context, userID int64) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM totp_credentials WHERE user_id = ?`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete totp credential: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ReplaceRecoveryCodes swaps all recovery codes of a user for new ones
+func (r *totpRepository) ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes []string) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	now := time.Now().UTC()
+	for _, codeHash := range codeHashes {
+		query := `INSERT INTO recovery_codes (user_id, code_hash, created_at) VALUES (?, ?, ?)`
+		if _, err := r.db.ExecContext(ctx, query, userID, codeHash, now); err != nil {
+			return writeError("create recovery code", err)
+		}
+	}
+
+	return nil
+}
+
+// ConsumeRecoveryCode marks one of the user's recovery codes as used and clears failed
+// attempts. It returns ErrNotFound when the code doesn't exist or was already used.
+func (r *totpRepository) ConsumeRecoveryCode(ctx context.Context, userID int64, codeHash string) error {
+	query := `
+		UPDATE recovery_codes SET used_at = ?
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now().UTC(), userID, codeHash)
+	if err != nil {
+		return fmt.Errorf("failed to consume recovery code: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	if _, err := r.db.ExecContext(ctx, `UPDATE totp_credentials SET failed_attempts = 0 WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to clear totp failures: %w", err)
+	}
+
+	return nil
+}
+
+// CountRecoveryCodes counts the recovery codes a user has left
+func (r *totpRepository) CountRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	query := `SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used_at IS NULL`
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, query, userID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+
+	return count, nil
+}
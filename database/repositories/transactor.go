@@ -0,0 +1,10 @@
+package repositories
+
+import "context"
+
+// Transactor runs work spanning several repositories as one unit. Repository calls
+// made with the context passed to fn share a transaction that commits when fn returns
+// nil and rolls back otherwise. *database.Database implements it.
+type Transactor interface {
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
@@ -1,48 +1,88 @@
 package repositories
 
 import (
+	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
 	"time"
 
+	"github.com/hyperstitieux/template/database"
 	"github.com/hyperstitieux/template/database/models"
 )
 
 type UsersRepository interface {
 	// User operations
-	CreateUser(user *models.User) error
-	GetUserByID(id int64) (*models.User, error)
-	GetUserByGoogleID(googleID string) (*models.User, error)
-	GetUserByEmail(email string) (*models.User, error)
-	UpdateUser(user *models.User) error
-	DeleteUser(id int64) error
+	CreateUser(ctx context.Context, user *models.User) error
+	GetUserByID(ctx context.Context, id int64) (*models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	UpdateUser(ctx context.Context, user *models.User) error
+	DeleteUser(ctx context.Context, id int64) error
+	List(ctx context.Context, search string, limit int) ([]*models.User, error)
+	Suspend(ctx context.Context, id int64, reason string) error
+	Unsuspend(ctx context.Context, id int64) error
+	SetAdmin(ctx context.Context, id int64, isAdmin bool) error
 
 	// Session operations
-	CreateSession(session *models.Session) error
-	GetSessionByToken(token string) (*models.Session, error)
-	GetUserBySessionToken(token string) (*models.User, error)
-	DeleteSession(token string) error
-	DeleteExpiredSessions() error
+	CreateSession(ctx context.Context, session *models.Session, token string) error
+	GetSessionByToken(ctx context.Context, token string) (*models.Session, error)
+	GetUserBySessionToken(ctx context.Context, token string) (*models.User, error)
+	GetSessionsByUserID(ctx context.Context, userID int64) ([]*models.Session, error)
+	TouchSession(ctx context.Context, token, userAgent, ipAddress string, expiresAt, since time.Time) (bool, error)
+	RotateSession(ctx context.Context, token, newToken string) error
+	DeleteSession(ctx context.Context, token string) error
+	DeleteUserSession(ctx context.Context, userID, id int64) error
+	DeleteOtherSessions(ctx context.Context, userID int64, token string) (int64, error)
+	DeleteExpiredSessions(ctx context.Context) error
+	SetImpersonation(ctx context.Context, token string, userID *int64) error
 }
 
 type usersRepository struct {
-	db *sql.DB
+	db *database.Database
 }
 
-func NewUsersRepository(db *sql.DB) UsersRepository {
+func NewUsersRepository(db *database.Database) UsersRepository {
 	return &usersRepository{db: db}
 }
 
+const userColumns = `id, email, name, given_name, family_name, picture, locale, verified_email, is_admin, suspended_at, suspended_reason, created_at, updated_at`
+
+func scanUser(row scanner) (*models.User, error) {
+	user := &models.User{}
+	var suspendedAt sql.NullTime
+	err := row.Scan(
+		&user.ID,
+		&user.Email,
+		&user.Name,
+		&user.GivenName,
+		&user.FamilyName,
+		&user.Picture,
+		&user.Locale,
+		&user.VerifiedEmail,
+		&user.IsAdmin,
+		&suspendedAt,
+		&user.SuspendedReason,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+	if suspendedAt.Valid {
+		user.SuspendedAt = &suspendedAt.Time
+	}
+	return user, err
+}
+
 // CreateUser creates a new user in the database
-func (r *usersRepository) CreateUser(user *models.User) error {
+func (r *usersRepository) CreateUser(ctx context.Context, user *models.User) error {
 	query := `
-		INSERT INTO users (google_id, email, name, given_name, family_name, picture, locale, verified_email)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO users (email, name, given_name, family_name, picture, locale, verified_email)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
 	`
 
-	result, err := r.db.Exec(
+	err := r.db.QueryRowContext(
+		ctx,
 		query,
-		user.GoogleID,
 		user.Email,
 		user.Name,
 		user.GivenName,
@@ -50,17 +90,11 @@ func (r *usersRepository) CreateUser(user *models.User) error {
 		user.Picture,
 		user.Locale,
 		user.VerifiedEmail,
-	)
+	).Scan(&user.ID)
 	if err != nil {
-		return fmt.Errorf("failed to create user: %w", err)
+		return writeError("create user", err)
 	}
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		return fmt.Errorf("failed to get last insert id: %w", err)
-	}
-
-	user.ID = id
 	user.CreatedAt = time.Now()
 	user.UpdatedAt = time.Now()
 
@@ -68,29 +102,16 @@ func (r *usersRepository) CreateUser(user *models.User) error {
 }
 
 // GetUserByID retrieves a user by their ID
-func (r *usersRepository) GetUserByID(id int64) (*models.User, error) {
+func (r *usersRepository) GetUserByID(ctx context.Context, id int64) (*models.User, error) {
 	query := `
-		SELECT id, google_id, email, name, given_name, family_name, picture, locale, verified_email, created_at, updated_at
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE id = ?
 	`
 
-	user := &models.User{}
-	err := r.db.QueryRow(query, id).Scan(
-		&user.ID,
-		&user.GoogleID,
-		&user.Email,
-		&user.Name,
-		&user.GivenName,
-		&user.FamilyName,
-		&user.Picture,
-		&user.Locale,
-		&user.VerifiedEmail,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, id))
 	if err == sql.ErrNoRows {
-		return nil, nil
+		return nil, ErrNotFound
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user by id: %w", err)
@@ -99,62 +120,17 @@ func (r *usersRepository) GetUserByID(id int64) (*models.User, error) {
 	return user, nil
 }
 
-// GetUserByGoogleID retrieves a user by their Google ID
-func (r *usersRepository) GetUserByGoogleID(googleID string) (*models.User, error) {
-	query := `
-		SELECT id, google_id, email, name, given_name, family_name, picture, locale, verified_email, created_at, updated_at
-		FROM users
-		WHERE google_id = ?
-	`
-
-	user := &models.User{}
-	err := r.db.QueryRow(query, googleID).Scan(
-		&user.ID,
-		&user.GoogleID,
-		&user.Email,
-		&user.Name,
-		&user.GivenName,
-		&user.FamilyName,
-		&user.Picture,
-		&user.Locale,
-		&user.VerifiedEmail,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, nil
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to get user by google id: %w", err)
-	}
-
-	return user, nil
-}
-
 // GetUserByEmail retrieves a user by their email address
-func (r *usersRepository) GetUserByEmail(email string) (*models.User, error) {
+func (r *usersRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `
-		SELECT id, google_id, email, name, given_name, family_name, picture, locale, verified_email, created_at, updated_at
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE email = ?
 	`
 
-	user := &models.User{}
-	err := r.db.QueryRow(query, email).Scan(
-		&user.ID,
-		&user.GoogleID,
-		&user.Email,
-		&user.Name,
-		&user.GivenName,
-		&user.FamilyName,
-		&user.Picture,
-		&user.Locale,
-		&user.VerifiedEmail,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, email))
 	if err == sql.ErrNoRows {
-		return nil, nil
+		return nil, ErrNotFound
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user by email: %w", err)
@@ -164,14 +140,15 @@ func (r *usersRepository) GetUserByEmail(email string) (*models.User, error) {
 }
 
 // UpdateUser updates an existing user's information
-func (r *usersRepository) UpdateUser(user *models.User) error {
+func (r *usersRepository) UpdateUser(ctx context.Context, user *models.User) error {
 	query := `
 		UPDATE users
 		SET email = ?, name = ?, given_name = ?, family_name = ?, picture = ?, locale = ?, verified_email = ?
 		WHERE id = ?
 	`
 
-	result, err := r.db.Exec(
+	result, err := r.db.ExecContext(
+		ctx,
 		query,
 		user.Email,
 		user.Name,
@@ -183,7 +160,7 @@ func (r *usersRepository) UpdateUser(user *models.User) error {
 		user.ID,
 	)
 	if err != nil {
-		return fmt.Errorf("failed to update user: %w", err)
+		return writeError("update user", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
@@ -192,17 +169,21 @@ func (r *usersRepository) UpdateUser(user *models.User) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("user not found")
+		return ErrNotFound
 	}
 
 	return nil
 }
 
-// DeleteUser deletes a user by their ID
-func (r *usersRepository) DeleteUser(id int64) error {
+// DeleteUser deletes a user by their ID. It returns ErrConflict while the user still
+// has sites, which are never deleted along.
+func (r *usersRepository) DeleteUser(ctx context.Context, id int64) error {
 	query := `DELETE FROM users WHERE id = ?`
 
-	result, err := r.db.Exec(query, id)
+	result, err := r.db.ExecContext(ctx, query, id)
+	if database.IsForeignKeyViolation(err) {
+		return fmt.Errorf("failed to delete user: %w: %w", ErrConflict, err)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
@@ -213,58 +194,152 @@ func (r *usersRepository) DeleteUser(id int64) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("user not found")
+		return ErrNotFound
 	}
 
 	return nil
 }
 
-// CreateSession creates a new session for a user
-func (r *usersRepository) CreateSession(session *models.Session) error {
+// List lists users, newest first, optionally matching a search on their email or name,
+// or their exact id
+func (r *usersRepository) List(ctx context.Context, search string, limit int) ([]*models.User, error) {
 	query := `
-		INSERT INTO sessions (user_id, token, expires_at)
-		VALUES (?, ?, ?)
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE ? = '' OR LOWER(email) LIKE LOWER(?) OR LOWER(name) LIKE LOWER(?) OR CAST(id AS TEXT) = ?
+		ORDER BY id DESC
+		LIMIT ?
 	`
 
-	result, err := r.db.Exec(
-		query,
-		session.UserID,
-		session.Token,
-		session.ExpiresAt,
-	)
+	pattern := "%" + search + "%"
+	rows, err := r.db.QueryContext(ctx, query, search, pattern, pattern, search, limit)
 	if err != nil {
-		return fmt.Errorf("failed to create session: %w", err)
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []*models.User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
 	}
 
-	id, err := result.LastInsertId()
+	return users, rows.Err()
+}
+
+// Suspend keeps a user from signing in, for the reason given. Their sessions stop
+// working until they are unsuspended.
+func (r *usersRepository) Suspend(ctx context.Context, id int64, reason string) error {
+	query := `UPDATE users SET suspended_at = ?, suspended_reason = ? WHERE id = ?`
+	return r.update(ctx, "suspend user", query, time.Now().UTC(), reason, id)
+}
+
+// Unsuspend lets a suspended user sign in again
+func (r *usersRepository) Unsuspend(ctx context.Context, id int64) error {
+	query := `UPDATE users SET suspended_at = NULL, suspended_reason = '' WHERE id = ?`
+	return r.update(ctx, "unsuspend user", query, id)
+}
+
+// SetAdmin grants or revokes the admin role of a user
+func (r *usersRepository) SetAdmin(ctx context.Context, id int64, isAdmin bool) error {
+	query := `UPDATE users SET is_admin = ? WHERE id = ?`
+	return r.update(ctx, "set admin", query, isAdmin, id)
+}
+
+// update runs an update of one user, returning ErrNotFound if there is no such user
+func (r *usersRepository) update(ctx context.Context, action, query string, args ...any) error {
+	result, err := r.db.ExecContext(ctx, query, args...)
 	if err != nil {
-		return fmt.Errorf("failed to get last insert id: %w", err)
+		return fmt.Errorf("failed to %s: %w", action, err)
 	}
 
-	session.ID = id
-	session.CreatedAt = time.Now()
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
 
 	return nil
 }
 
-// GetSessionByToken retrieves a session by its token
-func (r *usersRepository) GetSessionByToken(token string) (*models.Session, error) {
+// CreateSession creates a new session for a user, storing only a hash of its token
+func (r *usersRepository) CreateSession(ctx context.Context, session *models.Session, token string) error {
 	query := `
-		SELECT id, user_id, token, expires_at, created_at
-		FROM sessions
-		WHERE token = ? AND expires_at > CURRENT_TIMESTAMP
+		INSERT INTO sessions (user_id, token_hash, expires_at, max_expires_at, second_factor_pending, user_agent, ip_address, last_seen_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
 	`
 
+	now := time.Now()
+	session.TokenHash = HashToken(token)
+	err := r.db.QueryRowContext(
+		ctx,
+		query,
+		session.UserID,
+		session.TokenHash,
+		session.ExpiresAt.UTC(),
+		session.MaxExpiresAt.UTC(),
+		session.SecondFactorPending,
+		session.UserAgent,
+		session.IPAddress,
+		now.UTC(),
+	).Scan(&session.ID)
+	if err != nil {
+		return writeError("create session", err)
+	}
+
+	session.CreatedAt = now
+	session.LastSeenAt = now
+
+	return nil
+}
+
+// HashToken hashes a secret token (sessions, API tokens, invitations, sign in links,
+// recovery codes) for storage. Tokens are random, so a fast hash is enough to keep
+// them unusable if the database leaks.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+const sessionColumns = `id, user_id, token_hash, expires_at, max_expires_at, created_at, second_factor_pending, user_agent, ip_address, last_seen_at, impersonated_user_id`
+
+func scanSession(row scanner) (*models.Session, error) {
 	session := &models.Session{}
-	err := r.db.QueryRow(query, token).Scan(
+	var impersonatedUserID sql.NullInt64
+	err := row.Scan(
 		&session.ID,
 		&session.UserID,
-		&session.Token,
+		&session.TokenHash,
 		&session.ExpiresAt,
+		&session.MaxExpiresAt,
 		&session.CreatedAt,
+		&session.SecondFactorPending,
+		&session.UserAgent,
+		&session.IPAddress,
+		&session.LastSeenAt,
+		&impersonatedUserID,
 	)
+	if impersonatedUserID.Valid {
+		session.ImpersonatedUserID = &impersonatedUserID.Int64
+	}
+	return session, err
+}
+
+// GetSessionByToken retrieves a session by its token, including sessions waiting for
+// a second factor
+func (r *usersRepository) GetSessionByToken(ctx context.Context, token string) (*models.Session, error) {
+	query := `SELECT ` + sessionColumns + ` FROM sessions WHERE token_hash = ? AND expires_at > CURRENT_TIMESTAMP`
+
+	session, err := scanSession(r.db.QueryRowContext(ctx, query, HashToken(token)))
 	if err == sql.ErrNoRows {
-		return nil, nil
+		return nil, ErrNotFound
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get session by token: %w", err)
@@ -273,31 +348,97 @@ func (r *usersRepository) GetSessionByToken(token string) (*models.Session, erro
 	return session, nil
 }
 
-// GetUserBySessionToken retrieves a user by their session token
-func (r *usersRepository) GetUserBySessionToken(token string) (*models.User, error) {
+// GetSessionsByUserID lists the signed-in sessions of a user, most recently used first
+func (r *usersRepository) GetSessionsByUserID(ctx context.Context, userID int64) ([]*models.Session, error) {
 	query := `
-		SELECT u.id, u.google_id, u.email, u.name, u.given_name, u.family_name, u.picture, u.locale, u.verified_email, u.created_at, u.updated_at
-		FROM users u
-		INNER JOIN sessions s ON u.id = s.user_id
-		WHERE s.token = ? AND s.expires_at > CURRENT_TIMESTAMP
+		SELECT ` + sessionColumns + `
+		FROM sessions
+		WHERE user_id = ? AND expires_at > CURRENT_TIMESTAMP AND NOT second_factor_pending
+		ORDER BY last_seen_at DESC, id DESC
 	`
 
-	user := &models.User{}
-	err := r.db.QueryRow(query, token).Scan(
-		&user.ID,
-		&user.GoogleID,
-		&user.Email,
-		&user.Name,
-		&user.GivenName,
-		&user.FamilyName,
-		&user.Picture,
-		&user.Locale,
-		&user.VerifiedEmail,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*models.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// TouchSession records that a session was just used, from which browser and address,
+// and pushes its expiration to expiresAt, or its maximum lifetime if that comes first.
+// Sessions seen after since are left alone, so busy sessions don't write on every
+// request. It tells whether the session was updated.
+func (r *usersRepository) TouchSession(ctx context.Context, token, userAgent, ipAddress string, expiresAt, since time.Time) (bool, error) {
+	query := `
+		UPDATE sessions SET
+			last_seen_at = ?,
+			user_agent = ?,
+			ip_address = ?,
+			expires_at = CASE WHEN max_expires_at < ? THEN max_expires_at ELSE ? END
+		WHERE token_hash = ? AND last_seen_at < ?
+	`
+
+	expiresAt = expiresAt.UTC()
+	result, err := r.db.ExecContext(ctx, query, time.Now().UTC(), userAgent, ipAddress, expiresAt, expiresAt, HashToken(token), since.UTC())
+	if err != nil {
+		return false, fmt.Errorf("failed to touch session: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// RotateSession replaces the token of a session, keeping everything else
+func (r *usersRepository) RotateSession(ctx context.Context, token, newToken string) error {
+	query := `UPDATE sessions SET token_hash = ? WHERE token_hash = ?`
+
+	result, err := r.db.ExecContext(ctx, query, HashToken(newToken), HashToken(token))
+	if err != nil {
+		return writeError("rotate session", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetUserBySessionToken retrieves a user by their session token. Sessions waiting for
+// a second factor and sessions of suspended users don't sign in.
+func (r *usersRepository) GetUserBySessionToken(ctx context.Context, token string) (*models.User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE id = (
+			SELECT user_id FROM sessions
+			WHERE token_hash = ? AND expires_at > CURRENT_TIMESTAMP AND NOT second_factor_pending
+		) AND suspended_at IS NULL
+	`
+
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, HashToken(token)))
 	if err == sql.ErrNoRows {
-		return nil, nil
+		return nil, ErrNotFound
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user by session token: %w", err)
@@ -307,10 +448,29 @@ func (r *usersRepository) GetUserBySessionToken(token string) (*models.User, err
 }
 
 // DeleteSession deletes a session by its token
-func (r *usersRepository) DeleteSession(token string) error {
-	query := `DELETE FROM sessions WHERE token = ?`
+func (r *usersRepository) DeleteSession(ctx context.Context, token string) error {
+	query := `DELETE FROM sessions WHERE token_hash = ?`
+
+	result, err := r.db.ExecContext(ctx, query, HashToken(token))
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
 
-	result, err := r.db.Exec(query, token)
+// DeleteUserSession signs a user out of one of their sessions
+func (r *usersRepository) DeleteUserSession(ctx context.Context, userID, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM sessions WHERE id = ? AND user_id = ?`, id, userID)
 	if err != nil {
 		return fmt.Errorf("failed to delete session: %w", err)
 	}
@@ -321,20 +481,43 @@ func (r *usersRepository) DeleteSession(token string) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("session not found")
+		return ErrNotFound
 	}
 
 	return nil
 }
 
+// DeleteOtherSessions signs a user out everywhere but the session with the given token
+// and returns how many sessions ended
+func (r *usersRepository) DeleteOtherSessions(ctx context.Context, userID int64, token string) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = ? AND token_hash <> ?`, userID, HashToken(token))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete sessions: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected, nil
+}
+
 // DeleteExpiredSessions removes all expired sessions from the database
-func (r *usersRepository) DeleteExpiredSessions() error {
+func (r *usersRepository) DeleteExpiredSessions(ctx context.Context) error {
 	query := `DELETE FROM sessions WHERE expires_at <= CURRENT_TIMESTAMP`
 
-	_, err := r.db.Exec(query)
+	_, err := r.db.ExecContext(ctx, query)
 	if err != nil {
 		return fmt.Errorf("failed to delete expired sessions: %w", err)
 	}
 
 	return nil
 }
+
+// SetImpersonation makes the session view the dashboard as another user, or as its
+// own user again when userID is nil
+func (r *usersRepository) SetImpersonation(ctx context.Context, token string, userID *int64) error {
+	query := `UPDATE sessions SET impersonated_user_id = ? WHERE token_hash = ?`
+	return r.update(ctx, "set impersonation", query, userID, HashToken(token))
+}
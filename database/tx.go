@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// txKey is the context key holding the transaction started by Transaction
+type txKey struct{}
+
+// conn is implemented by *sql.DB and *sql.Tx
+type conn interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// conn returns the transaction carried by the context, or the connection pool
+func (d *Database) conn(ctx context.Context) conn {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return d.DB
+}
+
+// Transaction runs fn in a transaction. Every query made with the context passed to
+// fn joins the transaction, so work spanning several repositories commits or rolls
+// back as a whole. Calls nested in an open transaction join the outer one.
+func (d *Database) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// ExecContext executes a query written with ? placeholders
+func (d *Database) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return d.conn(ctx).ExecContext(ctx, d.Dialect.Rebind(query), args...)
+}
+
+// QueryContext runs a query written with ? placeholders
+func (d *Database) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return d.conn(ctx).QueryContext(ctx, d.Dialect.Rebind(query), args...)
+}
+
+// QueryRowContext runs a query written with ? placeholders that returns at most one row
+func (d *Database) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return d.conn(ctx).QueryRowContext(ctx, d.Dialect.Rebind(query), args...)
+}
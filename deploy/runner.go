@@ -0,0 +1,248 @@
+// Package deploy syncs sites with their GitHub repository. Pages are still rendered
+// from GitHub on each request; a deployment records the commit the branch points to
+// and checks the site has pages to serve there.
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/github"
+	"github.com/hyperstitieux/template/jobs"
+	"github.com/hyperstitieux/template/livereload"
+	"github.com/hyperstitieux/template/quota"
+)
+
+// JobKind is the kind of the background job running a deployment
+const JobKind = "sites.deploy"
+
+// StaleAfter is when a deployment still marked running may be replaced by a new one
+const StaleAfter = 15 * time.Minute
+
+// ErrSuspended refuses deployments of sites an admin suspended
+var ErrSuspended = errors.New("site is suspended")
+
+// errNoPages fails deployments of repositories without any page to serve
+var errNoPages = errors.New("no Markdown pages found")
+
+// jobPayload identifies the deployment a job runs
+type jobPayload struct {
+	SiteID       int `json:"site_id"`
+	DeploymentID int `json:"deployment_id"`
+}
+
+// Runner runs deployments on the job queue and stores their outcome
+type Runner struct {
+	queue       *jobs.Queue
+	tx          repositories.Transactor
+	sites       *repositories.SitesRepository
+	deployments repositories.DeploymentsRepository
+	logs        repositories.SiteLogsRepository
+	live        *livereload.Hub
+	quotas      *quota.Quotas
+}
+
+// NewRunner creates a runner and registers its job handler on the queue. Open pages
+// of a site are told through live when a deployment brings in a new commit, and syncs
+// count in the quotas of the site's creator.
+func NewRunner(queue *jobs.Queue, tx repositories.Transactor, sites *repositories.SitesRepository, deployments repositories.DeploymentsRepository, logs repositories.SiteLogsRepository, live *livereload.Hub, quotas *quota.Quotas) *Runner {
+	r := &Runner{
+		queue:       queue,
+		tx:          tx,
+		sites:       sites,
+		deployments: deployments,
+		logs:        logs,
+		live:        live,
+		quotas:      quotas,
+	}
+	queue.Register(JobKind, r.handle)
+	return r
+}
+
+// Start records a new deployment of the site and queues it, unless one is already
+// running, which is returned instead. Both happen in one transaction so a deployment
+// is never left running without a job to finish it. Suspended sites return ErrSuspended,
+// and creators who used up their syncs of the day a *quota.ExceededError.
+func (r *Runner) Start(ctx context.Context, site *models.Site, triggeredBy string) (*models.Deployment, error) {
+	if site.SuspendedAt != nil {
+		return nil, ErrSuspended
+	}
+
+	latest, err := r.deployments.GetLatestBySiteID(ctx, site.ID)
+	if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		return nil, err
+	}
+	if latest != nil && latest.Status == models.DeploymentRunning && time.Since(latest.StartedAt) < StaleAfter {
+		return latest, nil
+	}
+
+	if err := r.quotas.CheckSync(ctx, int64(site.UserID)); err != nil {
+		return nil, err
+	}
+
+	var deployment *models.Deployment
+	err = r.tx.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		deployment, err = r.deployments.Create(ctx, site.ID, triggeredBy)
+		if err != nil {
+			return err
+		}
+
+		payload := jobPayload{SiteID: site.ID, DeploymentID: deployment.ID}
+		_, err = r.queue.Enqueue(ctx, JobKind, payload, jobs.MaxAttempts(3))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.quotas.RecordSync(ctx, int64(site.UserID)); err != nil {
+		slog.Error("failed to record sync", "error", err, "site_id", site.ID)
+	}
+
+	return deployment, nil
+}
+
+// handle runs a queued deployment. Failures are retried by the queue; the deployment
+// is only marked failed once the job runs out of attempts, or right away when
+// retrying can't help.
+func (r *Runner) handle(ctx context.Context, job *models.Job) error {
+	var payload jobPayload
+	if err := jobs.Decode(job, &payload); err != nil {
+		return fmt.Errorf("%w: %w", jobs.ErrPermanent, err)
+	}
+
+	// The site or the deployment may have been deleted since the job was queued
+	site, err := (*r.sites).GetByID(ctx, payload.SiteID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	deployment, err := r.deployments.GetByID(ctx, payload.DeploymentID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if deployment.Status != models.DeploymentRunning {
+		return nil
+	}
+
+	slog.Info("deployment started", "site_id", site.ID, "deployment_id", deployment.ID, "attempt", job.Attempts)
+
+	sha, pages, size, err := resolve(site)
+	if err == nil {
+		// Pages going over the creator's storage fail the deployment for good, retrying
+		// won't make room
+		err = r.quotas.CheckStorage(ctx, int64(site.UserID), site.ID, size)
+	}
+	if err != nil {
+		var exceeded *quota.ExceededError
+		permanent := errors.Is(err, errNoPages) || errors.As(err, &exceeded) || github.StatusCode(err) == http.StatusNotFound
+		if !permanent && job.Attempts < job.MaxAttempts {
+			return err
+		}
+
+		deployment.Status = models.DeploymentFailed
+		deployment.CommitSHA = sha
+		deployment.Error = err.Error()
+		if logErr := r.logs.Create(ctx, models.NewSiteLog(site.ID, models.LogLevelError, "", github.StatusCode(err), err)); logErr != nil {
+			slog.Error("failed to record site log", "error", logErr, "site_id", site.ID)
+		}
+		if finishErr := r.deployments.Finish(ctx, deployment); finishErr != nil {
+			return finishErr
+		}
+		if permanent {
+			return fmt.Errorf("%w: %w", jobs.ErrPermanent, err)
+		}
+		return err
+	}
+
+	previous, err := r.deployments.GetLatestSucceededBySiteID(ctx, site.ID)
+	if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		return err
+	}
+
+	deployment.Status = models.DeploymentSucceeded
+	deployment.CommitSHA = sha
+	deployment.Pages = pages
+	deployment.SizeBytes = size
+	if err := r.deployments.Finish(ctx, deployment); err != nil {
+		return err
+	}
+
+	if previous == nil || previous.CommitSHA != sha {
+		r.publish(site, previous, sha)
+	}
+
+	slog.Info("deployment finished",
+		"site_id", site.ID,
+		"deployment_id", deployment.ID,
+		"commit", sha,
+		"pages", pages,
+	)
+
+	return nil
+}
+
+// publish tells the open pages of the site about the new commit. Only the pages whose
+// file changed since the previous deployment are told, or all of them when the
+// previous commit is unknown or can't be compared.
+func (r *Runner) publish(site *models.Site, previous *models.Deployment, sha string) {
+	var changed []string
+	if previous != nil && previous.CommitSHA != "" {
+		files, err := github.ChangedFiles(site.GithubRepo, previous.CommitSHA, sha)
+		if err != nil {
+			slog.Warn("failed to list changed files", "error", err, "site_id", site.ID)
+		} else {
+			changed = files
+		}
+	}
+	r.live.Publish(site, sha, changed)
+}
+
+// resolve finds the commit the site's branch points to, and counts the pages in the
+// site's subdirectory at that commit and their size in bytes
+func resolve(site *models.Site) (string, int, int64, error) {
+	sha, err := github.LatestCommit(site.GithubRepo, site.GithubBranch)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("failed to resolve %s@%s: %w", site.GithubRepo, site.GithubBranch, err)
+	}
+
+	files, err := github.ListFiles(site.GithubRepo, sha)
+	if err != nil {
+		return sha, 0, 0, err
+	}
+
+	prefix := ""
+	if site.Subdirectory != "" {
+		prefix = strings.Trim(site.Subdirectory, "/") + "/"
+	}
+	pages := 0
+	var size int64
+	for _, file := range files {
+		if strings.HasPrefix(file.Path, prefix) && strings.HasSuffix(file.Path, ".md") {
+			pages++
+			size += file.Size
+		}
+	}
+	if pages == 0 {
+		where := site.GithubRepo + "@" + site.GithubBranch
+		if prefix != "" {
+			where += " in " + prefix
+		}
+		return sha, 0, 0, fmt.Errorf("%w in %s", errNoPages, where)
+	}
+
+	return sha, pages, size, nil
+}
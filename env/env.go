@@ -1,6 +1,10 @@
 package env
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"strings"
+)
 
 // GetVar gives the value of an environment variable or fallbacks to a default value.
 func GetVar(key, defaultValue string) string {
@@ -9,3 +13,34 @@ func GetVar(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// GetBool gives the boolean value of an environment variable or fallbacks to a default value.
+func GetBool(key string, defaultValue bool) bool {
+	if value, exists := os.LookupEnv(key); exists {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
+
+// GetInt gives the integer value of an environment variable or fallbacks to a default value.
+func GetInt(key string, defaultValue int) int {
+	if value, exists := os.LookupEnv(key); exists {
+		if i, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+			return i
+		}
+	}
+	return defaultValue
+}
+
+// GetList gives the comma separated values of an environment variable, or nil if it is not set.
+func GetList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,105 @@
+// Package geoip finds the country of IP addresses in an offline database: a CSV file of
+// IP ranges with their country code, one "first,last,country" range per line, like the
+// free "IP to Country Lite" database of DB-IP. IPv4 and IPv6 ranges may be mixed.
+package geoip
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+)
+
+// DB holds the ranges of a database in memory, sorted by their first address
+type DB struct {
+	ranges []ipRange
+}
+
+type ipRange struct {
+	first, last netip.Addr
+	country     string
+}
+
+// Open loads the database at path
+func Open(path string) (*DB, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Read(file)
+}
+
+// Read loads a database from r
+func Read(r io.Reader) (*DB, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	db := &DB{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read geoip database: %w", err)
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("invalid geoip range on line %d", line)
+		}
+
+		first, err := netip.ParseAddr(strings.TrimSpace(record[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid geoip range on line %d: %w", line, err)
+		}
+		last, err := netip.ParseAddr(strings.TrimSpace(record[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid geoip range on line %d: %w", line, err)
+		}
+		country := strings.ToUpper(strings.TrimSpace(record[2]))
+		// "ZZ" marks unassigned ranges
+		if country == "" || country == "ZZ" {
+			continue
+		}
+
+		db.ranges = append(db.ranges, ipRange{first: first.Unmap(), last: last.Unmap(), country: country})
+	}
+
+	slices.SortFunc(db.ranges, func(a, b ipRange) int {
+		return a.first.Compare(b.first)
+	})
+	return db, nil
+}
+
+// Country returns the ISO 3166 code of the country of ip, or an empty string if it is
+// not in the database
+func (db *DB) Country(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+
+	// Last range starting at or before the address
+	i, found := slices.BinarySearchFunc(db.ranges, addr, func(r ipRange, addr netip.Addr) int {
+		return r.first.Compare(addr)
+	})
+	if !found {
+		i--
+	}
+	if i < 0 {
+		return ""
+	}
+
+	r := db.ranges[i]
+	if r.first.BitLen() != addr.BitLen() || r.last.Compare(addr) < 0 {
+		return ""
+	}
+	return r.country
+}
@@ -0,0 +1,108 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// DefaultAPIURL is the base URL of the public GitHub REST API
+const DefaultAPIURL = "https://api.github.com"
+
+// Client calls the GitHub REST API on behalf of a user. The HTTP client is expected to
+// authenticate requests, e.g. one returned by oauth2.Config.Client.
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// NewClient creates a client for the API at baseURL
+func NewClient(baseURL string, httpClient *http.Client) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		http:    httpClient,
+	}
+}
+
+// User is the authenticated GitHub user
+type User struct {
+	ID        int64  `json:"id"`
+	Login     string `json:"login"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+// Email is one of the addresses of the authenticated user
+type Email struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+// Repository is a repository the authenticated user can access
+type Repository struct {
+	FullName      string `json:"full_name"`
+	DefaultBranch string `json:"default_branch"`
+	Private       bool   `json:"private"`
+	Description   string `json:"description"`
+}
+
+// User fetches the authenticated user
+func (c *Client) User(ctx context.Context) (*User, error) {
+	var user User
+	if err := c.get(ctx, "/user", &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// PrimaryEmail fetches the primary email address of the authenticated user and
+// whether GitHub verified it
+func (c *Client) PrimaryEmail(ctx context.Context) (string, bool, error) {
+	var emails []Email
+	if err := c.get(ctx, "/user/emails", &emails); err != nil {
+		return "", false, err
+	}
+	for _, email := range emails {
+		if email.Primary {
+			return email.Email, email.Verified, nil
+		}
+	}
+	return "", false, nil
+}
+
+// Repositories lists the repositories of the authenticated user, most recently updated first
+func (c *Client) Repositories(ctx context.Context) ([]*Repository, error) {
+	var repos []*Repository
+	if err := c.get(ctx, "/user/repos?per_page=100&sort=updated", &repos); err != nil {
+		return nil, err
+	}
+	return repos, nil
+}
+
+// get decodes the JSON response of a GET request to the API
+func (c *Client) get(ctx context.Context, path string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &StatusError{Path: path, StatusCode: resp.StatusCode}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return nil
+}
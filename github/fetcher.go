@@ -1,11 +1,37 @@
 package github
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 )
 
+// StatusError is returned when GitHub answers with a non-200 status code
+type StatusError struct {
+	Path       string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	if e.StatusCode == http.StatusNotFound {
+		return fmt.Sprintf("file not found: %s", e.Path)
+	}
+	return fmt.Sprintf("unexpected status code %d for %s", e.StatusCode, e.Path)
+}
+
+// StatusCode extracts the upstream status code from an error returned by this package.
+// It returns 0 when the error did not come from an HTTP response.
+func StatusCode(err error) int {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode
+	}
+	return 0
+}
+
 // FetchRawFile fetches a file from GitHub's raw content URL
 func FetchRawFile(repo, branch, path string) ([]byte, error) {
 	url := fmt.Sprintf("https://raw.githubusercontent.com/%s/%s/%s", repo, branch, path)
@@ -16,12 +42,8 @@ func FetchRawFile(repo, branch, path string) ([]byte, error) {
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, fmt.Errorf("file not found: %s", path)
-	}
-
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, &StatusError{Path: path, StatusCode: resp.StatusCode}
 	}
 
 	content, err := io.ReadAll(resp.Body)
@@ -31,3 +53,131 @@ func FetchRawFile(repo, branch, path string) ([]byte, error) {
 
 	return content, nil
 }
+
+// treeResponse is the subset of GitHub's git trees API response we use
+type treeResponse struct {
+	Tree []struct {
+		Path string `json:"path"`
+		Type string `json:"type"`
+		Size int64  `json:"size"`
+	} `json:"tree"`
+	Truncated bool `json:"truncated"`
+}
+
+// File is a file of a repository and its size in bytes
+type File struct {
+	Path string
+	Size int64
+}
+
+// ListFiles lists every file in a branch using GitHub's git trees API
+func ListFiles(repo, branch string) ([]File, error) {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/git/trees/%s?recursive=1", repo, branch)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{Path: branch, StatusCode: resp.StatusCode}
+	}
+
+	var tree treeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tree); err != nil {
+		return nil, fmt.Errorf("failed to decode tree: %w", err)
+	}
+	if tree.Truncated {
+		return nil, fmt.Errorf("repository tree of %s@%s is too large to list", repo, branch)
+	}
+
+	files := make([]File, 0, len(tree.Tree))
+	for _, entry := range tree.Tree {
+		if entry.Type == "blob" {
+			files = append(files, File{Path: entry.Path, Size: entry.Size})
+		}
+	}
+
+	return files, nil
+}
+
+// LatestCommit returns the SHA of the commit a branch points to
+func LatestCommit(repo, branch string) (string, error) {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/commits/%s", repo, branch)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	// Asks for the bare SHA instead of the whole commit
+	req.Header.Set("Accept", "application/vnd.github.sha")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get latest commit: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &StatusError{Path: branch, StatusCode: resp.StatusCode}
+	}
+
+	sha, err := io.ReadAll(io.LimitReader(resp.Body, 64))
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	return strings.TrimSpace(string(sha)), nil
+}
+
+// compareResponse is the part of a commit comparison listing the changed files
+type compareResponse struct {
+	Files []struct {
+		Filename         string `json:"filename"`
+		PreviousFilename string `json:"previous_filename"`
+	} `json:"files"`
+}
+
+// ChangedFiles lists the files added, modified, removed or renamed between two commits.
+// Renamed files are listed under both names.
+func ChangedFiles(repo, base, head string) ([]string, error) {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/compare/%s...%s", repo, base, head)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare commits: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{Path: base + "..." + head, StatusCode: resp.StatusCode}
+	}
+
+	var compare compareResponse
+	if err := json.NewDecoder(resp.Body).Decode(&compare); err != nil {
+		return nil, fmt.Errorf("failed to decode comparison: %w", err)
+	}
+
+	files := make([]string, 0, len(compare.Files))
+	for _, file := range compare.Files {
+		files = append(files, file.Filename)
+		if file.PreviousFilename != "" {
+			files = append(files, file.PreviousFilename)
+		}
+	}
+
+	return files, nil
+}
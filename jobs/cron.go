@@ -0,0 +1,183 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule computes when a recurring job runs next
+type Schedule interface {
+	// Next returns the first run time strictly after t
+	Next(t time.Time) time.Time
+}
+
+// ParseSchedule parses a cron-like schedule spec. It accepts the five standard cron
+// fields (minute hour day-of-month month day-of-week) with *, lists, ranges and
+// steps, the @hourly, @daily, @weekly and @monthly shorthands, and "@every <duration>".
+// Times are evaluated in UTC.
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	}
+
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		interval, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval in %q: %w", spec, err)
+		}
+		if interval < time.Second {
+			return nil, fmt.Errorf("interval in %q must be at least one second", spec)
+		}
+		return everySchedule(interval), nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: expected 5 fields, got %d", spec, len(fields))
+	}
+
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+	var sets [5]map[int]bool
+	for i, field := range fields {
+		set, err := parseField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+		sets[i] = set
+	}
+
+	// Cron treats 7 as Sunday too
+	if sets[4][7] {
+		sets[4][0] = true
+	}
+
+	return &cronSchedule{
+		minute:     sets[0],
+		hour:       sets[1],
+		dayOfMonth: sets[2],
+		month:      sets[3],
+		dayOfWeek:  sets[4],
+		anyDOM:     fields[2] == "*",
+		anyDOW:     fields[4] == "*",
+	}, nil
+}
+
+// parseField parses one cron field into the set of values it matches
+func parseField(field string, min, max int) (map[int]bool, error) {
+	set := make(map[int]bool)
+
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step %q", stepPart)
+			}
+		}
+
+		lo, hi := min, max
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = strconv.Atoi(from); err != nil {
+				return nil, fmt.Errorf("invalid value %q", from)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(to); err != nil {
+					return nil, fmt.Errorf("invalid value %q", to)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+
+		// Allow 7 for Sunday in the day-of-week field
+		limit := max
+		if max == 6 {
+			limit = 7
+		}
+		if lo < min || hi > limit || lo > hi {
+			return nil, fmt.Errorf("value %q out of range %d-%d", rangePart, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+
+	return set, nil
+}
+
+// cronSchedule matches times against the five cron fields
+type cronSchedule struct {
+	minute, hour, dayOfMonth, month, dayOfWeek map[int]bool
+	anyDOM, anyDOW                             bool
+}
+
+// Next walks forward from t, skipping whole months, days and hours that can't match
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if !s.month[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.hour[t.Hour()] {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if !s.minute[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	// The spec can never match (e.g. February 30th)
+	return time.Time{}
+}
+
+// dayMatches follows cron semantics: when both day fields are restricted,
+// a day matching either of them is enough
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dayOfMonth[t.Day()]
+	dow := s.dayOfWeek[int(t.Weekday())]
+	switch {
+	case s.anyDOM && s.anyDOW:
+		return true
+	case s.anyDOM:
+		return dow
+	case s.anyDOW:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+// everySchedule runs at a fixed interval
+type everySchedule time.Duration
+
+func (s everySchedule) Next(t time.Time) time.Time {
+	return t.UTC().Add(time.Duration(s))
+}
@@ -0,0 +1,323 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+)
+
+// Handler runs a job. Returning an error schedules a retry until the job runs out of attempts.
+// Jobs are delivered at least once, so handlers must be safe to run again.
+type Handler func(ctx context.Context, job *models.Job) error
+
+// ErrPermanent marks a job error that retrying can't fix. Wrap it to fail the job right away.
+var ErrPermanent = errors.New("permanent failure")
+
+// Config tunes the workers of a queue
+type Config struct {
+	Workers      int           // Number of jobs run concurrently
+	PollInterval time.Duration // How often idle workers look for due jobs
+	LockTimeout  time.Duration // How long a job may run before another worker takes it over
+	MaxAttempts  int           // Default number of attempts before a job fails for good
+	BaseBackoff  time.Duration // Delay before the first retry, doubled on each attempt
+	MaxBackoff   time.Duration // Upper bound of the retry delay
+}
+
+// DefaultConfig returns a configuration suited to a single SQLite-backed server
+func DefaultConfig() Config {
+	return Config{
+		Workers:      2,
+		PollInterval: time.Second,
+		LockTimeout:  15 * time.Minute,
+		MaxAttempts:  5,
+		BaseBackoff:  10 * time.Second,
+		MaxBackoff:   time.Hour,
+	}
+}
+
+// Queue dispatches jobs stored in the database to registered handlers
+type Queue struct {
+	jobs     repositories.JobsRepository
+	config   Config
+	workerID string
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+	wake     chan struct{}
+}
+
+// New creates a queue. Handlers must be registered before Start is called.
+func New(jobs repositories.JobsRepository, cfg Config) *Queue {
+	hostname, _ := os.Hostname()
+	return &Queue{
+		jobs:     jobs,
+		config:   cfg,
+		workerID: fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		handlers: make(map[string]Handler),
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Register sets the handler for a kind of job
+func (q *Queue) Register(kind string, handler Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[kind] = handler
+}
+
+// EnqueueOption customizes a job when it is enqueued
+type EnqueueOption func(job *models.Job)
+
+// RunAt delays a job until the given time
+func RunAt(t time.Time) EnqueueOption {
+	return func(job *models.Job) {
+		job.RunAt = t
+	}
+}
+
+// MaxAttempts overrides how many times a job is attempted before it fails for good
+func MaxAttempts(n int) EnqueueOption {
+	return func(job *models.Job) {
+		job.MaxAttempts = n
+	}
+}
+
+// Enqueue stores a job with a JSON encoded payload to run as soon as a worker is free
+func (q *Queue) Enqueue(ctx context.Context, kind string, payload any, opts ...EnqueueOption) (*models.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job payload: %w", err)
+	}
+
+	job := &models.Job{
+		Kind:        kind,
+		Payload:     string(data),
+		MaxAttempts: q.config.MaxAttempts,
+	}
+	for _, opt := range opts {
+		opt(job)
+	}
+
+	if err := q.jobs.Enqueue(ctx, job); err != nil {
+		return nil, err
+	}
+
+	// Wake an idle worker instead of waiting for the next poll
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+
+	return job, nil
+}
+
+// Every registers a recurring job, enqueued each time the cron-like spec comes due.
+// Schedules are stored by name, so every server process may register the same
+// schedule and it still runs once per occurrence.
+func (q *Queue) Every(ctx context.Context, name, spec, kind string, payload any) error {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return err
+	}
+
+	next := schedule.Next(time.Now())
+	if next.IsZero() {
+		return fmt.Errorf("schedule %q never runs", spec)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode job payload: %w", err)
+	}
+
+	return q.jobs.UpsertSchedule(ctx, &models.JobSchedule{
+		Name:      name,
+		Spec:      spec,
+		Kind:      kind,
+		Payload:   string(data),
+		NextRunAt: next,
+	})
+}
+
+// Decode decodes the JSON payload of a job
+func Decode(job *models.Job, v any) error {
+	if err := json.Unmarshal([]byte(job.Payload), v); err != nil {
+		return fmt.Errorf("failed to decode payload of job %d: %w", job.ID, err)
+	}
+	return nil
+}
+
+// Start launches the workers and the scheduler. They stop when the context is cancelled.
+func (q *Queue) Start(ctx context.Context) {
+	for i := 0; i < q.config.Workers; i++ {
+		go q.work(ctx)
+	}
+	go q.schedule(ctx)
+
+	slog.Info("job queue started", "workers", q.config.Workers, "worker_id", q.workerID)
+}
+
+// work claims and runs jobs until the context is cancelled
+func (q *Queue) work(ctx context.Context) {
+	ticker := time.NewTicker(q.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Drain every due job before sleeping again
+		for ctx.Err() == nil {
+			job, err := q.jobs.Claim(ctx, q.workerID, time.Now())
+			if errors.Is(err, repositories.ErrNotFound) {
+				break
+			}
+			if err != nil {
+				slog.Error("failed to claim job", "error", err)
+				break
+			}
+			q.run(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+// run executes a claimed job and records its outcome
+func (q *Queue) run(ctx context.Context, job *models.Job) {
+	q.mu.RLock()
+	handler, ok := q.handlers[job.Kind]
+	q.mu.RUnlock()
+
+	// Record the outcome even when the queue is shutting down, so the job
+	// isn't left running until its lock expires
+	recordCtx := context.WithoutCancel(ctx)
+
+	if !ok {
+		slog.Error("no handler for job", "job_id", job.ID, "kind", job.Kind)
+		if err := q.jobs.Fail(recordCtx, job, fmt.Sprintf("no handler registered for %q", job.Kind)); err != nil {
+			slog.Error("failed to record job failure", "error", err, "job_id", job.ID)
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, q.config.LockTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := runHandler(ctx, handler, job)
+	duration := time.Since(start)
+
+	switch {
+	case err == nil:
+		slog.Info("job succeeded", "job_id", job.ID, "kind", job.Kind, "attempt", job.Attempts, "duration", duration)
+		err = q.jobs.Complete(recordCtx, job)
+	case job.Attempts >= job.MaxAttempts || errors.Is(err, ErrPermanent):
+		slog.Error("job failed", "job_id", job.ID, "kind", job.Kind, "attempt", job.Attempts, "error", err)
+		err = q.jobs.Fail(recordCtx, job, err.Error())
+	default:
+		retryAt := time.Now().Add(q.backoff(job.Attempts))
+		slog.Warn("job failed, retrying", "job_id", job.ID, "kind", job.Kind, "attempt", job.Attempts, "retry_at", retryAt, "error", err)
+		err = q.jobs.Retry(recordCtx, job, err.Error(), retryAt)
+	}
+	if err != nil {
+		slog.Error("failed to record job outcome", "error", err, "job_id", job.ID)
+	}
+}
+
+// runHandler runs a handler, turning panics into errors so one bad job can't kill a worker
+func runHandler(ctx context.Context, handler Handler, job *models.Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// backoff returns the delay before retrying a job, doubling with each attempt
+// and jittered so retries of jobs failing together spread out
+func (q *Queue) backoff(attempts int) time.Duration {
+	delay := q.config.BaseBackoff
+	for i := 1; i < attempts && delay < q.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, q.config.MaxBackoff)
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// schedule enqueues recurring jobs as they come due and requeues jobs whose worker died
+func (q *Queue) schedule(ctx context.Context) {
+	ticker := time.NewTicker(q.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+
+		requeued, err := q.jobs.RequeueStale(ctx, now.Add(-q.config.LockTimeout))
+		if err != nil {
+			slog.Error("failed to requeue stale jobs", "error", err)
+		} else if requeued > 0 {
+			slog.Warn("requeued jobs with expired locks", "count", requeued)
+		}
+
+		schedules, err := q.jobs.GetDueSchedules(ctx, now)
+		if err != nil {
+			slog.Error("failed to get due job schedules", "error", err)
+			continue
+		}
+
+		for _, s := range schedules {
+			if err := q.enqueueScheduled(ctx, s, now); err != nil {
+				slog.Error("failed to enqueue scheduled job", "error", err, "schedule", s.Name)
+			}
+		}
+	}
+}
+
+// enqueueScheduled enqueues the job of a due schedule and moves it to its next run.
+// Missed runs (e.g. while the server was down) are collapsed into a single job.
+func (q *Queue) enqueueScheduled(ctx context.Context, s *models.JobSchedule, now time.Time) error {
+	schedule, err := ParseSchedule(s.Spec)
+	if err != nil {
+		return err
+	}
+
+	job := &models.Job{
+		Kind:        s.Kind,
+		Payload:     s.Payload,
+		MaxAttempts: q.config.MaxAttempts,
+	}
+
+	next := schedule.Next(now)
+	if next.IsZero() {
+		return fmt.Errorf("schedule %q never runs", s.Spec)
+	}
+
+	enqueued, err := q.jobs.AdvanceSchedule(ctx, s, next, job)
+	if err != nil {
+		return err
+	}
+	if enqueued {
+		slog.Debug("scheduled job enqueued", "schedule", s.Name, "job_id", job.ID)
+	}
+
+	return nil
+}
@@ -0,0 +1,346 @@
+package linkcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hyperstitieux/template/database/models"
+	githubpkg "github.com/hyperstitieux/template/github"
+	"github.com/hyperstitieux/template/markdown"
+)
+
+const (
+	// maxPages bounds how many markdown files a single check renders
+	maxPages = 500
+	// maxRedirects bounds the redirects followed by an external check
+	maxRedirects = 10
+)
+
+// errNotPublic is returned when an external check would reach a private address
+var errNotPublic = errors.New("address is not public")
+
+// sharedAddressSpace is the carrier-grade NAT range, not covered by netip.Addr.IsPrivate
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// Config controls how the checker treats links leaving the site
+type Config struct {
+	CheckExternal bool         // Check links to other hosts over HTTP
+	AllowedHosts  []string     // Hosts (and their subdomains) external checks may reach; empty allows none
+	Client        *http.Client // Client for external checks, one refusing non-public addresses if nil
+}
+
+// Result summarizes a link check
+type Result struct {
+	Pages  int
+	Links  int
+	Broken []*models.BrokenLink
+}
+
+// Checker walks the pages of a site and reports links that lead nowhere
+type Checker struct {
+	config    Config
+	listFiles func(repo, branch string) ([]githubpkg.File, error)
+	fetchFile func(repo, branch, path string) ([]byte, error)
+}
+
+// New creates a checker reading site content from GitHub
+func New(cfg Config) *Checker {
+	c := &Checker{
+		listFiles: githubpkg.ListFiles,
+		fetchFile: githubpkg.FetchRawFile,
+	}
+
+	if cfg.Client == nil {
+		dialer := &net.Dialer{Timeout: 5 * time.Second, Control: dialPublic}
+		cfg.Client = &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				// No proxy, which would dial the address for us
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: 5 * time.Second,
+				MaxIdleConns:        10,
+				IdleConnTimeout:     30 * time.Second,
+			},
+		}
+	}
+	// Redirects may lead anywhere, each hop is checked like the link itself
+	client := *cfg.Client
+	client.CheckRedirect = c.checkRedirect
+	cfg.Client = &client
+
+	c.config = cfg
+	return c
+}
+
+// dialPublic refuses connections to loopback, private, link-local and other non-public
+// addresses. It runs after DNS resolution, so host names pointing inside the network
+// are refused too.
+func dialPublic(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !isPublic(addrPort.Addr()) {
+		return fmt.Errorf("%s: %w", address, errNotPublic)
+	}
+	return nil
+}
+
+// isPublic reports whether the address is reachable on the internet
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// checkRedirect follows a redirect only to a host external checks may reach
+func (c *Checker) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	if (req.URL.Scheme != "http" && req.URL.Scheme != "https") || !c.allowed(req.URL.Hostname()) {
+		return fmt.Errorf("redirect to %s is not allowed", req.URL.Redacted())
+	}
+	return nil
+}
+
+// Check renders every markdown page of the site and checks its links, anchors
+// and images against the site's content tree
+func (c *Checker) Check(ctx context.Context, site *models.Site) (*Result, error) {
+	files, err := c.listFiles(site.GithubRepo, site.GithubBranch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files of %s@%s: %w", site.GithubRepo, site.GithubBranch, err)
+	}
+
+	// Build the content tree relative to the site's subdirectory
+	prefix := ""
+	if site.Subdirectory != "" {
+		prefix = strings.Trim(site.Subdirectory, "/") + "/"
+	}
+	tree := make(map[string]bool)
+	for _, file := range files {
+		if strings.HasPrefix(file.Path, prefix) {
+			tree[strings.TrimPrefix(file.Path, prefix)] = true
+		}
+	}
+
+	// Render every page first so links to anchors on other pages can be checked
+	pages := make(map[string]*page)
+	for file := range tree {
+		if !strings.HasSuffix(file, ".md") {
+			continue
+		}
+		if len(pages) >= maxPages {
+			return nil, fmt.Errorf("site has more than %d pages", maxPages)
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		source, err := c.fetchFile(site.GithubRepo, site.GithubBranch, prefix+file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch %s: %w", file, err)
+		}
+		rendered, err := markdown.RenderMarkdown(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render %s: %w", file, err)
+		}
+		pages[file] = parsePage(file, source, rendered)
+	}
+
+	result := &Result{Pages: len(pages)}
+	external := make(map[string]string)
+
+	paths := make([]string, 0, len(pages))
+	for p := range pages {
+		paths = append(paths, p)
+	}
+	slices.Sort(paths)
+
+	for _, p := range paths {
+		pg := pages[p]
+		line := 1
+		for _, ref := range pg.references {
+			kind, reason, checked := c.checkReference(ctx, pg, ref, tree, pages, external)
+			if !checked {
+				continue
+			}
+			result.Links++
+			found := pg.lineOf(ref.target, line)
+			if found > 0 {
+				line = found
+			}
+			if reason == "" {
+				continue
+			}
+			result.Broken = append(result.Broken, &models.BrokenLink{
+				SourcePath: p,
+				Line:       found,
+				Target:     ref.target,
+				Kind:       kind,
+				Reason:     reason,
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// checkReference checks a single link or image. It returns the kind of link, why it
+// is broken (empty when it is fine) and whether the reference was checked at all.
+func (c *Checker) checkReference(ctx context.Context, pg *page, ref reference, tree map[string]bool, pages map[string]*page, external map[string]string) (string, string, bool) {
+	u, err := url.Parse(ref.target)
+	if err != nil {
+		return kindOf(ref), "invalid URL", true
+	}
+
+	// Links leaving the site
+	if u.Scheme != "" || u.Host != "" {
+		if (u.Scheme != "http" && u.Scheme != "https") || !c.config.CheckExternal || !c.allowed(u.Hostname()) {
+			return "", "", false
+		}
+		reason, ok := external[ref.target]
+		if !ok {
+			reason = c.checkExternal(ctx, ref.target)
+			external[ref.target] = reason
+		}
+		return models.LinkKindExternal, reason, true
+	}
+
+	// Anchors on the same page
+	if u.Path == "" {
+		if u.Fragment == "" || pg.ids[u.Fragment] {
+			return models.LinkKindAnchor, "", true
+		}
+		return models.LinkKindAnchor, fmt.Sprintf("no element with id %q on this page", u.Fragment), true
+	}
+
+	resolved, ok := resolve(pg.path, u.Path)
+	if !ok {
+		return kindOf(ref), "points outside of the site", true
+	}
+
+	if ref.isImage {
+		if tree[resolved] {
+			return models.LinkKindImage, "", true
+		}
+		return models.LinkKindImage, "image not found in repository", true
+	}
+
+	target, ok := findPage(resolved, strings.HasSuffix(u.Path, "/"), tree)
+	if !ok {
+		return models.LinkKindInternal, "page not found in repository", true
+	}
+	if u.Fragment == "" {
+		return models.LinkKindInternal, "", true
+	}
+	if targetPage, ok := pages[target]; ok && !targetPage.ids[u.Fragment] {
+		return models.LinkKindAnchor, fmt.Sprintf("no element with id %q on %s", u.Fragment, target), true
+	}
+	return models.LinkKindAnchor, "", true
+}
+
+// checkExternal requests an external URL and returns why it is broken, if it is
+func (c *Checker) checkExternal(ctx context.Context, target string) string {
+	status, err := c.request(ctx, http.MethodHead, target)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		status, err = c.request(ctx, http.MethodGet, target)
+	}
+	if err != nil {
+		// The error would tell the site owner about the network the checker runs in
+		slog.Debug("external link check failed", "url", target, "error", err)
+		return "request failed"
+	}
+	if status >= 400 {
+		return fmt.Sprintf("responded with status %d", status)
+	}
+	return ""
+}
+
+func (c *Checker) request(ctx context.Context, method, target string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "InternetPublishing-LinkChecker/1.0")
+
+	resp, err := c.config.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// allowed reports whether external checks may reach the host. Without allowed hosts,
+// none is.
+func (c *Checker) allowed(host string) bool {
+	host = strings.ToLower(host)
+	for _, allowed := range c.config.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve turns a link path found on a page into a path of the content tree,
+// the same way the public site maps URLs to files. It reports false for paths
+// escaping the site root.
+func resolve(pagePath, linkPath string) (string, bool) {
+	if strings.HasPrefix(linkPath, "/") {
+		return strings.TrimPrefix(path.Clean(linkPath), "/"), true
+	}
+
+	resolved := path.Join(path.Dir(pagePath), linkPath)
+	if resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return "", false
+	}
+	if resolved == "." {
+		resolved = ""
+	}
+	return resolved, true
+}
+
+// findPage finds the markdown file served for a resolved link path
+func findPage(resolved string, isDir bool, tree map[string]bool) (string, bool) {
+	var candidates []string
+	switch {
+	case resolved == "" || isDir:
+		dir := resolved
+		if dir != "" {
+			dir += "/"
+		}
+		candidates = []string{dir + "README.md", dir + "index.md"}
+	case strings.HasSuffix(resolved, ".md"):
+		candidates = []string{resolved}
+	default:
+		candidates = []string{resolved + ".md", resolved}
+	}
+
+	for _, candidate := range candidates {
+		if tree[candidate] {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// kindOf gives the kind of a reference that could not be resolved
+func kindOf(ref reference) string {
+	if ref.isImage {
+		return models.LinkKindImage
+	}
+	return models.LinkKindInternal
+}
@@ -0,0 +1,124 @@
+package linkcheck
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestIsPublic(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.215.14", true},
+		{"2606:2800:21f:cb07:6820:80da:af6b:8b2c", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.0.0.1", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"fd00:ec2::254", false},
+		{"fe80::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"224.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		if got := isPublic(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("isPublic(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		host    string
+		want    bool
+	}{
+		{"no allowed hosts", nil, "example.com", false},
+		{"listed", []string{"example.com"}, "example.com", true},
+		{"subdomain", []string{"example.com"}, "docs.Example.com", true},
+		{"other host", []string{"example.com"}, "example.org", false},
+		{"suffix of another name", []string{"example.com"}, "evilexample.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(Config{CheckExternal: true, AllowedHosts: tt.allowed})
+			if got := c.allowed(tt.host); got != tt.want {
+				t.Errorf("allowed(%q) = %v, want %v", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckExternalRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the checker reached a loopback address")
+	}))
+	defer server.Close()
+
+	c := New(Config{CheckExternal: true, AllowedHosts: []string{"127.0.0.1"}})
+	reason := c.checkExternal(context.Background(), server.URL)
+	if reason != "request failed" {
+		t.Errorf("reason = %q, want a generic failure", reason)
+	}
+}
+
+func TestCheckExternalRedirects(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the checker followed a redirect to a host that isn't allowed")
+	}))
+	defer target.Close()
+	targetURL, _ := url.Parse(target.URL)
+
+	var redirected bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/allowed":
+			http.Redirect(w, r, "/ok", http.StatusFound)
+		case "/other-host":
+			// Same server under another name, which isn't allowed
+			redirected = true
+			http.Redirect(w, r, "http://localhost:"+targetURL.Port()+"/", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	// The client given dials loopback, as only the redirects are under test
+	c := New(Config{CheckExternal: true, AllowedHosts: []string{"127.0.0.1"}, Client: &http.Client{}})
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/allowed", ""},
+		{"/other-host", "request failed"},
+		{"/loop", "request failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.TrimPrefix(tt.path, "/"), func(t *testing.T) {
+			if got := c.checkExternal(context.Background(), server.URL+tt.path); got != tt.want {
+				t.Errorf("reason = %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if !redirected {
+		t.Error("the redirect to another host wasn't requested")
+	}
+}
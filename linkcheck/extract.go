@@ -0,0 +1,65 @@
+package linkcheck
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// reference is a link or image found in a rendered page
+type reference struct {
+	target  string
+	isImage bool
+}
+
+// page holds what the checker needs to know about a rendered page
+type page struct {
+	path       string
+	ids        map[string]bool
+	references []reference
+	lines      []string
+}
+
+// parsePage extracts element ids, links and image references from rendered HTML
+func parsePage(path string, source []byte, rendered string) *page {
+	p := &page{
+		path:  path,
+		ids:   make(map[string]bool),
+		lines: strings.Split(string(source), "\n"),
+	}
+
+	tokenizer := html.NewTokenizer(strings.NewReader(rendered))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return p
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			for _, a := range token.Attr {
+				switch {
+				case a.Key == "id" || (a.Key == "name" && token.Data == "a"):
+					p.ids[a.Val] = true
+				case a.Key == "href" && token.Data == "a":
+					p.references = append(p.references, reference{target: a.Val})
+				case a.Key == "src" && token.Data == "img":
+					p.references = append(p.references, reference{target: a.Val, isImage: true})
+				}
+			}
+		}
+	}
+}
+
+// lineOf returns the 1-based line of the markdown source where target appears,
+// starting the search at line from so repeated targets map to successive lines.
+// It returns 0 when the target cannot be found in the source.
+func (p *page) lineOf(target string, from int) int {
+	for i := max(from-1, 0); i < len(p.lines); i++ {
+		if strings.Contains(p.lines[i], target) {
+			return i + 1
+		}
+	}
+	if from > 1 {
+		return p.lineOf(target, 1)
+	}
+	return 0
+}
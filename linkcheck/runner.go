@@ -0,0 +1,138 @@
+package linkcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+	"github.com/hyperstitieux/template/jobs"
+)
+
+// JobKind is the kind of the background job running a link check
+const JobKind = "links.check"
+
+// checkTimeout bounds how long a single link check may run
+const checkTimeout = 10 * time.Minute
+
+// jobPayload identifies the link check a job runs
+type jobPayload struct {
+	SiteID      int `json:"site_id"`
+	LinkCheckID int `json:"link_check_id"`
+}
+
+// Runner runs link checks on the job queue and stores their reports
+type Runner struct {
+	checker *Checker
+	queue   *jobs.Queue
+	tx      repositories.Transactor
+	sites   *repositories.SitesRepository
+	checks  repositories.LinkChecksRepository
+	logs    repositories.SiteLogsRepository
+}
+
+// NewRunner creates a runner and registers its job handler on the queue
+func NewRunner(checker *Checker, queue *jobs.Queue, tx repositories.Transactor, sites *repositories.SitesRepository, checks repositories.LinkChecksRepository, logs repositories.SiteLogsRepository) *Runner {
+	r := &Runner{
+		checker: checker,
+		queue:   queue,
+		tx:      tx,
+		sites:   sites,
+		checks:  checks,
+		logs:    logs,
+	}
+	queue.Register(JobKind, r.handle)
+	return r
+}
+
+// Start records a new link check for the site and queues it. Both happen in one
+// transaction so a check is never left running without a job to finish it.
+func (r *Runner) Start(ctx context.Context, site *models.Site) (*models.LinkCheck, error) {
+	var check *models.LinkCheck
+	err := r.tx.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		check, err = r.checks.Create(ctx, site.ID)
+		if err != nil {
+			return err
+		}
+
+		payload := jobPayload{SiteID: site.ID, LinkCheckID: check.ID}
+		_, err = r.queue.Enqueue(ctx, JobKind, payload, jobs.MaxAttempts(3))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return check, nil
+}
+
+// handle runs a queued link check. Failures are retried by the queue; the check is
+// only marked failed once the job runs out of attempts.
+func (r *Runner) handle(ctx context.Context, job *models.Job) error {
+	var payload jobPayload
+	if err := jobs.Decode(job, &payload); err != nil {
+		return fmt.Errorf("%w: %w", jobs.ErrPermanent, err)
+	}
+
+	// The site or the check may have been deleted since the job was queued
+	site, err := (*r.sites).GetByID(ctx, payload.SiteID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	check, err := r.checks.GetByID(ctx, payload.LinkCheckID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if check.Status != models.LinkCheckRunning {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	slog.Info("link check started", "site_id", site.ID, "link_check_id", check.ID, "attempt", job.Attempts)
+
+	result, err := r.checker.Check(ctx, site)
+	if err != nil {
+		if job.Attempts < job.MaxAttempts {
+			return err
+		}
+
+		check.Status = models.LinkCheckFailed
+		check.Error = err.Error()
+		if logErr := r.logs.Create(ctx, models.NewSiteLog(site.ID, models.LogLevelError, "", 0, err)); logErr != nil {
+			slog.Error("failed to record site log", "error", logErr, "site_id", site.ID)
+		}
+		if finishErr := r.checks.Finish(ctx, check, nil); finishErr != nil {
+			return finishErr
+		}
+		return err
+	}
+
+	check.Status = models.LinkCheckFinished
+	check.PagesChecked = result.Pages
+	check.LinksChecked = result.Links
+	if err := r.checks.Finish(ctx, check, result.Broken); err != nil {
+		return err
+	}
+
+	slog.Info("link check finished",
+		"site_id", site.ID,
+		"link_check_id", check.ID,
+		"pages", result.Pages,
+		"links", result.Links,
+		"broken", len(result.Broken),
+	)
+
+	return nil
+}
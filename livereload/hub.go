@@ -0,0 +1,233 @@
+// Package livereload tells the open pages of public sites when a deployment brings in
+// a new commit, so visitors see the update without reloading. Pages subscribe over a
+// websocket to their site and path; unlike the development hot reload, which reloads
+// every tab of the dashboard, only the pages of the updated site are told, and only
+// those whose file changed when the changes are known.
+package livereload
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/router"
+)
+
+// Path is where the pages of public sites open their websocket
+const Path = "/__live"
+
+type Config struct {
+	MaxConnectionsPerIP int           // Open websockets allowed from one IP address
+	HeartbeatInterval   time.Duration // How often pings are sent to idle connections
+	PongTimeout         time.Duration // How long a connection may go without answering
+	WriteTimeout        time.Duration // How long a message may take to be sent
+}
+
+// DefaultConfig returns the limits used in production
+func DefaultConfig() Config {
+	return Config{
+		MaxConnectionsPerIP: 20,
+		HeartbeatInterval:   30 * time.Second,
+		PongTimeout:         75 * time.Second,
+		WriteTimeout:        10 * time.Second,
+	}
+}
+
+// Message is sent to a page when the site it belongs to was updated
+type Message struct {
+	Type   string `json:"type"`
+	Commit string `json:"commit"`
+}
+
+// subscriber is one open page
+type subscriber struct {
+	siteID int
+	page   string
+	ip     string
+	send   chan []byte
+}
+
+// Hub keeps the open pages of every site and sends them updates. It only knows the
+// pages connected to this process.
+type Hub struct {
+	config   Config
+	upgrader websocket.Upgrader
+
+	mu    sync.Mutex
+	sites map[int]map[*subscriber]struct{}
+	ips   map[string]int
+}
+
+func NewHub(config Config) *Hub {
+	return &Hub{
+		config: config,
+		// Pages connect from the subdomain of their site, the origin is checked by the
+		// default upgrader
+		upgrader: websocket.Upgrader{},
+		sites:    make(map[int]map[*subscriber]struct{}),
+		ips:      make(map[string]int),
+	}
+}
+
+// Serve subscribes the page at file, the path of its Markdown file in the repository,
+// to the updates of the site. It returns once the page is closed.
+func (h *Hub) Serve(w http.ResponseWriter, r *http.Request, site *models.Site, file string) {
+	sub := &subscriber{
+		siteID: site.ID,
+		page:   pageKey(file),
+		ip:     router.ClientIP(r),
+		send:   make(chan []byte, 4),
+	}
+	if !h.subscribe(sub) {
+		http.Error(w, "Too many live connections", http.StatusTooManyRequests)
+		return
+	}
+	defer h.unsubscribe(sub)
+
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already answered the request
+		slog.Debug("failed to upgrade live reload connection", "error", err, "site_id", site.ID)
+		return
+	}
+	defer conn.Close()
+
+	done := make(chan struct{})
+	go h.write(conn, sub, done)
+
+	// Pages send nothing, reading only tells when they go away or stop answering pings
+	conn.SetReadLimit(512)
+	conn.SetReadDeadline(time.Now().Add(h.config.PongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(h.config.PongTimeout))
+	})
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+	close(done)
+}
+
+// write sends the messages of a subscriber and the heartbeat pings, which is the only
+// place writing to the connection
+func (h *Hub) write(conn *websocket.Conn, sub *subscriber, done chan struct{}) {
+	ticker := time.NewTicker(h.config.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case message := <-sub.send:
+			conn.SetWriteDeadline(time.Now().Add(h.config.WriteTimeout))
+			if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				conn.Close()
+				return
+			}
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(h.config.WriteTimeout)); err != nil {
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// subscribe registers a page, unless its IP address has too many pages open already
+func (h *Hub) subscribe(sub *subscriber) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.ips[sub.ip] >= h.config.MaxConnectionsPerIP {
+		return false
+	}
+	h.ips[sub.ip]++
+
+	if h.sites[sub.siteID] == nil {
+		h.sites[sub.siteID] = make(map[*subscriber]struct{})
+	}
+	h.sites[sub.siteID][sub] = struct{}{}
+	return true
+}
+
+// unsubscribe forgets a closed page
+func (h *Hub) unsubscribe(sub *subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.ips[sub.ip]--; h.ips[sub.ip] <= 0 {
+		delete(h.ips, sub.ip)
+	}
+	delete(h.sites[sub.siteID], sub)
+	if len(h.sites[sub.siteID]) == 0 {
+		delete(h.sites, sub.siteID)
+	}
+}
+
+// Publish tells the open pages of a site that commit was deployed. When changed lists
+// the files of the repository that changed, only the pages rendered from them are
+// told, unless other files changed, such as images, which any page may show. A nil
+// list tells every page.
+func (h *Hub) Publish(site *models.Site, commit string, changed []string) {
+	pages := changedPages(changed)
+	message, err := json.Marshal(Message{Type: "update", Commit: commit})
+	if err != nil {
+		slog.Error("failed to encode live reload message", "error", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sent := 0
+	for sub := range h.sites[site.ID] {
+		if pages != nil {
+			if _, ok := pages[sub.page]; !ok {
+				continue
+			}
+		}
+		// A page too slow to take the message will get the next one
+		select {
+		case sub.send <- message:
+			sent++
+		default:
+		}
+	}
+
+	if sent > 0 {
+		slog.Info("notified open pages of site update", "site_id", site.ID, "commit", commit, "pages", sent)
+	}
+}
+
+// changedPages returns the keys of the pages rendered from the changed files, or nil
+// if every page may have changed
+func changedPages(changed []string) map[string]struct{} {
+	if changed == nil {
+		return nil
+	}
+	pages := make(map[string]struct{}, len(changed))
+	for _, file := range changed {
+		if !strings.HasSuffix(file, ".md") {
+			return nil
+		}
+		pages[pageKey(file)] = struct{}{}
+	}
+	return pages
+}
+
+// pageKey identifies the page rendered from a file. The home page of a folder is
+// README.md or index.md, whichever exists, so both have the same key.
+func pageKey(file string) string {
+	file = strings.TrimPrefix(file, "/")
+	if path.Base(file) == "index.md" {
+		return strings.TrimSuffix(file, "index.md") + "README.md"
+	}
+	return file
+}
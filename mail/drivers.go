@@ -0,0 +1,149 @@
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"time"
+)
+
+// logSender logs emails instead of sending them
+type logSender struct {
+	from string
+}
+
+func (s *logSender) Send(ctx context.Context, msg *Message) error {
+	slog.InfoContext(ctx, "email", "from", s.from, "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
+
+// fileSender writes each email to its own .eml file, which mail clients can open
+type fileSender struct {
+	from string
+	dir  string
+}
+
+func newFileSender(from, dir string) (*fileSender, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	return &fileSender{from: from, dir: dir}, nil
+}
+
+func (s *fileSender) Send(ctx context.Context, msg *Message) error {
+	data, err := format(s.from, msg)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(s.dir, time.Now().UTC().Format("20060102-150405-")+"*.eml")
+	if err != nil {
+		return fmt.Errorf("failed to create email file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		return fmt.Errorf("failed to write email file: %w", err)
+	}
+
+	slog.InfoContext(ctx, "email written", "to", msg.To, "subject", msg.Subject, "path", file.Name())
+	return file.Close()
+}
+
+// smtpSender delivers emails through an SMTP server, upgrading the connection with
+// STARTTLS when the server offers it
+type smtpSender struct {
+	from     string
+	envelope string // Address of the From header, used as MAIL FROM
+	addr     string
+	host     string
+	auth     smtp.Auth
+}
+
+func newSMTPSender(config Config) (*smtpSender, error) {
+	host, _, err := net.SplitHostPort(config.SMTPAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SMTP address %q: %w", config.SMTPAddr, err)
+	}
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender address %q: %w", config.From, err)
+	}
+
+	sender := &smtpSender{
+		from:     config.From,
+		envelope: from.Address,
+		addr:     config.SMTPAddr,
+		host:     host,
+	}
+	if config.SMTPUsername != "" {
+		// PlainAuth refuses to send credentials over unencrypted connections to
+		// anything but localhost
+		sender.auth = smtp.PlainAuth("", config.SMTPUsername, config.SMTPPassword, host)
+	}
+	return sender, nil
+}
+
+func (s *smtpSender) Send(ctx context.Context, msg *Message) error {
+	data, err := format(s.from, msg)
+	if err != nil {
+		return err
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient %q: %w", msg.To, err)
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(time.Minute)
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	if s.auth != nil {
+		if err := client.Auth(s.auth); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+
+	if err := client.Mail(s.envelope); err != nil {
+		return fmt.Errorf("failed to send MAIL FROM: %w", err)
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return fmt.Errorf("failed to send RCPT TO: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to send DATA: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return client.Quit()
+}
@@ -0,0 +1,104 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers emails
+type Sender interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Drivers a Sender can be created with
+const (
+	DriverLog  = "log"  // Logs emails, for development
+	DriverFile = "file" // Writes emails as .eml files, for development
+	DriverSMTP = "smtp" // Delivers emails through an SMTP server
+)
+
+// Config selects and configures the driver used to send emails
+type Config struct {
+	Driver       string
+	From         string // Sender address, e.g. "Internet Publishing <hello@example.com>"
+	Dir          string // Where the file driver writes emails
+	SMTPAddr     string // host:port of the SMTP server
+	SMTPUsername string // Optional, authenticates with PLAIN when set
+	SMTPPassword string
+}
+
+// New creates the sender of the configured driver
+func New(config Config) (Sender, error) {
+	if _, err := mail.ParseAddress(config.From); err != nil {
+		return nil, fmt.Errorf("invalid sender address %q: %w", config.From, err)
+	}
+
+	switch config.Driver {
+	case DriverLog, "":
+		return &logSender{from: config.From}, nil
+	case DriverFile:
+		return newFileSender(config.From, config.Dir)
+	case DriverSMTP:
+		return newSMTPSender(config)
+	}
+	return nil, fmt.Errorf("unknown mail driver %q", config.Driver)
+}
+
+// format renders a message in the Internet Message Format, with a quoted-printable
+// UTF-8 body
+func format(from string, msg *Message) ([]byte, error) {
+	// Header values come from user input, newlines would let them add headers
+	if strings.ContainsAny(msg.To+msg.Subject, "\r\n") {
+		return nil, fmt.Errorf("invalid newline in email header")
+	}
+	if _, err := mail.ParseAddress(msg.To); err != nil {
+		return nil, fmt.Errorf("invalid recipient %q: %w", msg.To, err)
+	}
+
+	domain := "localhost"
+	if address, err := mail.ParseAddress(from); err == nil {
+		if at := strings.LastIndex(address.Address, "@"); at >= 0 {
+			domain = address.Address[at+1:]
+		}
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate message id: %w", err)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	buf.WriteString("\r\n")
+
+	body := quotedprintable.NewWriter(&buf)
+	if _, err := body.Write([]byte(strings.ReplaceAll(msg.Body, "\n", "\r\n"))); err != nil {
+		return nil, err
+	}
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
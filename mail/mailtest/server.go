@@ -0,0 +1,131 @@
+// Package mailtest provides a local SMTP server that records the emails it receives,
+// to test code sending mail without delivering it.
+package mailtest
+
+import (
+	"bufio"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+// Message is an email received by the server
+type Message struct {
+	From string
+	To   []string
+	Data string // Headers and body, as sent
+}
+
+// Server is a minimal SMTP server listening on a local port
+type Server struct {
+	// Addr is the host:port to configure as SMTP address
+	Addr string
+
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewServer starts a server on a random local port. Call Close when done.
+func NewServer() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{Addr: listener.Addr().String(), listener: listener}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Messages returns the emails received so far
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Close stops the server and waits for open sessions to end
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.session(textproto.NewConn(conn))
+		}()
+	}
+}
+
+// session speaks just enough SMTP for net/smtp clients: no TLS and no authentication
+func (s *Server) session(conn *textproto.Conn) {
+	conn.PrintfLine("220 localhost ESMTP mailtest")
+
+	var msg Message
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			conn.PrintfLine("250 localhost")
+		case "MAIL":
+			msg = Message{From: address(arg)}
+			conn.PrintfLine("250 OK")
+		case "RCPT":
+			msg.To = append(msg.To, address(arg))
+			conn.PrintfLine("250 OK")
+		case "DATA":
+			conn.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			lines, err := conn.ReadDotLines()
+			if err != nil {
+				return
+			}
+			msg.Data = strings.Join(lines, "\r\n")
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			conn.PrintfLine("250 OK")
+		case "RSET":
+			msg = Message{}
+			conn.PrintfLine("250 OK")
+		case "NOOP":
+			conn.PrintfLine("250 OK")
+		case "QUIT":
+			conn.PrintfLine("221 Bye")
+			return
+		default:
+			conn.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+// address extracts the address of a "FROM:<a@b>" or "TO:<a@b>" argument
+func address(arg string) string {
+	_, addr, _ := strings.Cut(arg, ":")
+	addr, _, _ = strings.Cut(strings.TrimSpace(addr), " ")
+	return strings.Trim(addr, "<>")
+}
+
+// Reader returns a buffered reader over the data of a message, e.g. for net/mail
+func (m Message) Reader() *bufio.Reader {
+	return bufio.NewReader(strings.NewReader(m.Data + "\r\n"))
+}
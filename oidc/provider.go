@@ -0,0 +1,182 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Config describes a client registered at an OpenID Connect provider
+type Config struct {
+	ID           string // Identifies the provider in URLs and linked identities
+	Name         string // Shown to users, e.g. on the sign in page
+	Issuer       string // Issuer URL, the discovery document is found under it
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	Claims       ClaimMapping // Which claims fill in the user profile
+}
+
+// ClaimMapping names the claims holding each part of the user profile. Nested claims
+// are separated by dots, e.g. "profile.display_name".
+type ClaimMapping struct {
+	Email         string
+	EmailVerified string
+	Name          string
+	Username      string
+	GivenName     string
+	FamilyName    string
+	Picture       string
+	Locale        string
+}
+
+// DefaultClaimMapping uses the standard OpenID Connect claims
+func DefaultClaimMapping() ClaimMapping {
+	return ClaimMapping{
+		Email:         "email",
+		EmailVerified: "email_verified",
+		Name:          "name",
+		Username:      "preferred_username",
+		GivenName:     "given_name",
+		FamilyName:    "family_name",
+		Picture:       "picture",
+		Locale:        "locale",
+	}
+}
+
+// Metadata is the part of a provider's discovery document used to sign in
+type Metadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	UserInfoEndpoint      string   `json:"userinfo_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	IDTokenSigningAlgs    []string `json:"id_token_signing_alg_values_supported"`
+}
+
+// Provider signs users in at an OpenID Connect provider. The discovery document is
+// fetched on first use, so the server starts even when the provider is down.
+type Provider struct {
+	config Config
+	http   *http.Client
+
+	mu       sync.Mutex
+	metadata *Metadata
+	keys     *keySet
+}
+
+// NewProvider creates a provider for the given client configuration
+func NewProvider(config Config) *Provider {
+	return &Provider{
+		config: config,
+		http:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Config returns the client configuration of the provider
+func (p *Provider) Config() Config {
+	return p.config
+}
+
+// Metadata returns the provider's discovery document, fetching it on first use
+func (p *Provider) Metadata(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	discoveryURL := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	var metadata Metadata
+	if err := p.getJSON(ctx, discoveryURL, "", &metadata); err != nil {
+		return nil, fmt.Errorf("failed to discover %s: %w", p.config.Issuer, err)
+	}
+
+	// The issuer must be the one we were configured with, or anyone serving the
+	// discovery document could issue tokens for it
+	if strings.TrimSuffix(metadata.Issuer, "/") != strings.TrimSuffix(p.config.Issuer, "/") {
+		return nil, fmt.Errorf("discovery document of %s is for issuer %q", p.config.Issuer, metadata.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document of %s is missing endpoints", p.config.Issuer)
+	}
+
+	p.metadata = &metadata
+	p.keys = newKeySet(metadata.JWKSURI, p.http)
+	return p.metadata, nil
+}
+
+// OAuth2Config returns the OAuth2 configuration for the authorization code flow
+func (p *Provider) OAuth2Config(ctx context.Context) (*oauth2.Config, error) {
+	metadata, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		RedirectURL:  p.config.RedirectURL,
+		Scopes:       p.config.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  metadata.AuthorizationEndpoint,
+			TokenURL: metadata.TokenEndpoint,
+		},
+	}, nil
+}
+
+// UserInfo fetches the claims of the userinfo endpoint. It returns no claims when
+// the provider doesn't have one.
+func (p *Provider) UserInfo(ctx context.Context, token *oauth2.Token) (Claims, error) {
+	metadata, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if metadata.UserInfoEndpoint == "" {
+		return Claims{}, nil
+	}
+
+	claims := Claims{}
+	if err := p.getJSON(ctx, metadata.UserInfoEndpoint, token.AccessToken, &claims); err != nil {
+		return nil, fmt.Errorf("failed to get user info: %w", err)
+	}
+	return claims, nil
+}
+
+// getJSON decodes the JSON response of a GET request, authenticated with the access
+// token when one is given
+func (p *Provider) getJSON(ctx context.Context, url, accessToken string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+
+	resp, err := p.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", url, err)
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+package oidc
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	_ "crypto/sha256" // Register the hashes of the RS, PS and ES algorithms
+	_ "crypto/sha512"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrInvalidIDToken is returned when an ID token can't be trusted
+var ErrInvalidIDToken = errors.New("invalid id token")
+
+// clockSkew tolerates small clock differences with the provider
+const clockSkew = time.Minute
+
+// Claims are the claims of an ID token or of the userinfo endpoint
+type Claims map[string]any
+
+// String returns a claim as a string, or "" when it is missing. The name may be a
+// dotted path to a nested claim.
+func (c Claims) String(name string) string {
+	switch value := c.lookup(name).(type) {
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	}
+	return ""
+}
+
+// Bool returns a claim as a boolean. Some providers send booleans as strings.
+func (c Claims) Bool(name string) bool {
+	switch value := c.lookup(name).(type) {
+	case bool:
+		return value
+	case string:
+		return value == "true"
+	}
+	return false
+}
+
+func (c Claims) lookup(name string) any {
+	if name == "" {
+		return nil
+	}
+	var value any = map[string]any(c)
+	for part := range strings.SplitSeq(name, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = object[part]
+	}
+	return value
+}
+
+// audience returns the aud claim, which is either a string or a list of strings
+func (c Claims) audience() []string {
+	switch aud := c["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []any:
+		audience := make([]string, 0, len(aud))
+		for _, value := range aud {
+			if s, ok := value.(string); ok {
+				audience = append(audience, s)
+			}
+		}
+		return audience
+	}
+	return nil
+}
+
+// time returns a NumericDate claim
+func (c Claims) time(name string) (time.Time, bool) {
+	number, ok := c[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	seconds, err := number.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(seconds), 0), true
+}
+
+// VerifyIDToken checks the signature and claims of an ID token issued to this client
+// and returns its claims. The nonce must be the one sent with the authorization request.
+func (p *Provider) VerifyIDToken(ctx context.Context, rawToken, nonce string) (Claims, error) {
+	metadata, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidIDToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJSONSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrInvalidIDToken)
+	}
+
+	// Providers sign with RS256 unless their discovery document says otherwise
+	algorithms := metadata.IDTokenSigningAlgs
+	if len(algorithms) == 0 {
+		algorithms = []string{"RS256"}
+	}
+	if !slices.Contains(algorithms, header.Alg) {
+		return nil, fmt.Errorf("%w: unexpected algorithm %q", ErrInvalidIDToken, header.Alg)
+	}
+
+	key, err := p.keys.key(ctx, header.Kid)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+
+	signature, err := decodeSegment(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidIDToken)
+	}
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+
+	claims := Claims{}
+	if err := decodeJSONSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims", ErrInvalidIDToken)
+	}
+
+	if claims.String("iss") != metadata.Issuer {
+		return nil, fmt.Errorf("%w: issued by %q", ErrInvalidIDToken, claims.String("iss"))
+	}
+	audience := claims.audience()
+	if !slices.Contains(audience, p.config.ClientID) {
+		return nil, fmt.Errorf("%w: issued to another client", ErrInvalidIDToken)
+	}
+	if len(audience) > 1 && claims.String("azp") != p.config.ClientID {
+		return nil, fmt.Errorf("%w: authorized party is not this client", ErrInvalidIDToken)
+	}
+	expiresAt, ok := claims.time("exp")
+	if !ok || time.Now().After(expiresAt.Add(clockSkew)) {
+		return nil, fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	}
+	if issuedAt, ok := claims.time("iat"); ok && issuedAt.After(time.Now().Add(clockSkew)) {
+		return nil, fmt.Errorf("%w: issued in the future", ErrInvalidIDToken)
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.String("nonce")), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	if claims.String("sub") == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+
+	return claims, nil
+}
+
+// verifySignature checks a JWS signature made with one of the asymmetric algorithms.
+// The key type must match the algorithm, so a public key can't be used as an HMAC secret.
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	if len(alg) < 3 {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	var hash crypto.Hash
+	switch alg[len(alg)-3:] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	}
+
+	digest := func() []byte {
+		h := hash.New()
+		h.Write(signed)
+		return h.Sum(nil)
+	}
+
+	switch alg {
+	case "RS256", "RS384", "RS512":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key does not match algorithm %s", alg)
+		}
+		return rsa.VerifyPKCS1v15(rsaKey, hash, digest(), signature)
+
+	case "PS256", "PS384", "PS512":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key does not match algorithm %s", alg)
+		}
+		return rsa.VerifyPSS(rsaKey, hash, digest(), signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+
+	case "ES256", "ES384", "ES512":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key does not match algorithm %s", alg)
+		}
+		// JWS signatures are the fixed size R and S values, not ASN.1
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("invalid signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(ecKey, digest(), r, s) {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+
+	case "EdDSA":
+		edKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("key does not match algorithm %s", alg)
+		}
+		if !ed25519.Verify(edKey, signed, signature) {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported algorithm %s", alg)
+}
+
+// decodeJSONSegment decodes a base64url JSON segment of a JWT, keeping numbers exact
+func decodeJSONSegment(segment string, v any) error {
+	data, err := decodeSegment(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
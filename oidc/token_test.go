@@ -0,0 +1,228 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testProvider serves the discovery document and signing keys of a provider, and
+// signs ID tokens with them
+type testProvider struct {
+	*httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testProvider{rsaKey: rsaKey, ecKey: ecKey}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Metadata{
+			Issuer:                p.URL,
+			AuthorizationEndpoint: p.URL + "/authorize",
+			TokenEndpoint:         p.URL + "/token",
+			JWKSURI:               p.URL + "/jwks",
+			// HS256 is advertised to check a public key is never used as a secret
+			IDTokenSigningAlgs: []string{"RS256", "ES256", "HS256"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		x, y := make([]byte, 32), make([]byte, 32)
+		ecKey.X.FillBytes(x)
+		ecKey.Y.FillBytes(y)
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "use": "sig", "n": encodeSegment(rsaKey.N.Bytes()), "e": encodeSegment(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encodeSegment(x), "y": encodeSegment(y)},
+		}})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func encodeSegment(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// sign returns a token with the header and claims, signed as the header says
+func (p *testProvider) sign(t *testing.T, header map[string]string, claims map[string]any) string {
+	t.Helper()
+
+	encodedHeader, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodedClaims, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := encodeSegment(encodedHeader) + "." + encodeSegment(encodedClaims)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch header["alg"] {
+	case "RS256":
+		signature, err = rsa.SignPKCS1v15(nil, p.rsaKey, crypto.SHA256, digest[:])
+	case "ES256":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, p.ecKey, digest[:])
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case "HS256":
+		// The public key as the secret, as in algorithm confusion attacks
+		mac := hmac.New(sha256.New, p.rsaKey.N.Bytes())
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + encodeSegment(signature)
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	provider := newTestProvider(t)
+	p := NewProvider(Config{ID: "test", Issuer: provider.URL, ClientID: "client"})
+	now := time.Now()
+
+	// valid returns the claims of a token that verifies, changed by fn
+	valid := func(fn func(claims map[string]any)) map[string]any {
+		claims := map[string]any{
+			"iss":   provider.URL,
+			"aud":   "client",
+			"sub":   "alice",
+			"nonce": "nonce",
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+		}
+		if fn != nil {
+			fn(claims)
+		}
+		return claims
+	}
+	rs256 := map[string]string{"alg": "RS256", "kid": "rsa"}
+
+	tests := []struct {
+		name   string
+		token  string
+		nonce  string
+		wantOK bool
+	}{
+		{"rs256", provider.sign(t, rs256, valid(nil)), "nonce", true},
+		{"es256", provider.sign(t, map[string]string{"alg": "ES256", "kid": "ec"}, valid(nil)), "nonce", true},
+		{"several audiences with this client as authorized party", provider.sign(t, rs256, valid(func(c map[string]any) {
+			c["aud"] = []string{"other", "client"}
+			c["azp"] = "client"
+		})), "nonce", true},
+		{"expired within the clock skew", provider.sign(t, rs256, valid(func(c map[string]any) {
+			c["exp"] = now.Add(-clockSkew / 2).Unix()
+		})), "nonce", true},
+
+		// Algorithms
+		{"alg none", provider.sign(t, map[string]string{"alg": "none", "kid": "rsa"}, valid(nil)), "nonce", false},
+		{"alg not advertised", provider.sign(t, map[string]string{"alg": "RS512", "kid": "rsa"}, valid(nil)), "nonce", false},
+		{"hmac with the public key", provider.sign(t, map[string]string{"alg": "HS256", "kid": "rsa"}, valid(nil)), "nonce", false},
+		{"alg of another key type", provider.sign(t, map[string]string{"alg": "ES256", "kid": "rsa"}, valid(nil)), "nonce", false},
+
+		// Keys
+		{"unknown kid", provider.sign(t, map[string]string{"alg": "RS256", "kid": "other"}, valid(nil)), "nonce", false},
+		{"no kid with several keys", provider.sign(t, map[string]string{"alg": "RS256"}, valid(nil)), "nonce", false},
+		{"tampered claims", func() string {
+			parts := strings.Split(provider.sign(t, rs256, valid(nil)), ".")
+			forged, _ := json.Marshal(valid(func(c map[string]any) { c["sub"] = "mallory" }))
+			return parts[0] + "." + encodeSegment(forged) + "." + parts[2]
+		}(), "nonce", false},
+		{"malformed", "not.a-token", "nonce", false},
+
+		// Claims
+		{"other issuer", provider.sign(t, rs256, valid(func(c map[string]any) { c["iss"] = "https://evil.example" })), "nonce", false},
+		{"other audience", provider.sign(t, rs256, valid(func(c map[string]any) { c["aud"] = "other" })), "nonce", false},
+		{"several audiences without authorized party", provider.sign(t, rs256, valid(func(c map[string]any) {
+			c["aud"] = []string{"other", "client"}
+		})), "nonce", false},
+		{"expired", provider.sign(t, rs256, valid(func(c map[string]any) { c["exp"] = now.Add(-time.Hour).Unix() })), "nonce", false},
+		{"no expiration", provider.sign(t, rs256, valid(func(c map[string]any) { delete(c, "exp") })), "nonce", false},
+		{"issued in the future", provider.sign(t, rs256, valid(func(c map[string]any) { c["iat"] = now.Add(time.Hour).Unix() })), "nonce", false},
+		{"other nonce", provider.sign(t, rs256, valid(nil)), "other", false},
+		{"no nonce in the token", provider.sign(t, rs256, valid(func(c map[string]any) { delete(c, "nonce") })), "nonce", false},
+		{"no subject", provider.sign(t, rs256, valid(func(c map[string]any) { delete(c, "sub") })), "nonce", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := p.VerifyIDToken(context.Background(), tt.token, tt.nonce)
+			if tt.wantOK {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if claims.String("sub") != "alice" {
+					t.Errorf("sub = %q, want alice", claims.String("sub"))
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidIDToken) {
+				t.Fatalf("error = %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	provider := newTestProvider(t)
+	p := NewProvider(Config{ID: "test", Issuer: provider.URL + "/other", ClientID: "client"})
+
+	if _, err := p.Metadata(context.Background()); err == nil {
+		t.Fatal("discovery document of another issuer accepted")
+	}
+}
+
+func TestClaims(t *testing.T) {
+	claims := Claims{}
+	if err := decodeJSONSegment(encodeSegment([]byte(`{"email":"alice@example.com","email_verified":"true","profile":{"name":"Alice"},"id":12345678901234567890}`)), &claims); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"string", claims.String("email"), "alice@example.com"},
+		{"nested", claims.String("profile.name"), "Alice"},
+		{"large number kept exact", claims.String("id"), "12345678901234567890"},
+		{"missing", claims.String("profile.missing"), ""},
+		{"boolean sent as string", claims.Bool("email_verified"), true},
+		{"missing boolean", claims.Bool("missing"), false},
+	}
+
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
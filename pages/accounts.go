@@ -0,0 +1,601 @@
+package pages
+
+import (
+	gohtml "html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/frenchsoftware/libhtml/attr"
+	"github.com/frenchsoftware/libhtml/html"
+	"github.com/frenchsoftware/libvalidator/validator"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/github"
+	"github.com/hyperstitieux/template/views"
+	"github.com/hyperstitieux/template/views/components/icons"
+	"github.com/hyperstitieux/template/views/components/ui"
+	"github.com/hyperstitieux/template/views/layouts"
+)
+
+// SignInProvider describes a provider users can sign in or connect with
+type SignInProvider struct {
+	ID   string // Provider of the linked identities
+	Name string // Shown on the buttons
+	Path string // Starts the sign in flow
+}
+
+// icon returns the logo of well-known providers and a key for the others
+func (p SignInProvider) icon() html.Node {
+	switch p.ID {
+	case models.ProviderGoogle:
+		return icons.Google()
+	case models.ProviderGitHub:
+		return icons.GitHub()
+	}
+	return icons.Key()
+}
+
+// SignInProps holds everything shown on the sign in page
+type SignInProps struct {
+	Providers   []SignInProvider
+	EmailSignIn bool   // Whether sign in links can be requested by email
+	Email       string // Address entered in the email form
+	Errors      validator.ValidationErrors
+}
+
+func SignIn(w http.ResponseWriter, r *http.Request, props SignInProps) error {
+	// Signed in users have nothing to do here
+	if views.GetUser(r) != nil {
+		http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+		return nil
+	}
+
+	// Forward the page to return to, the sign in controllers check it is local
+	redirect := r.FormValue("redirect")
+	errs := props.Errors
+
+	buttons := []any{attr.Class("flex flex-col gap-3")}
+	for _, provider := range props.Providers {
+		href := provider.Path
+		if redirect != "" {
+			href += "?redirect=" + url.QueryEscape(redirect)
+		}
+		buttons = append(buttons, html.A(
+			attr.Href(href),
+			attr.Class("btn-outline w-full"),
+			provider.icon(),
+			escapedText("Continue with "+provider.Name),
+		))
+	}
+
+	page := layouts.Base(nil, r, "Sign in - Internet Publishing",
+		html.Div(
+			attr.Class("max-w-sm mx-auto px-8 py-16"),
+			ui.Card(
+				ui.CardHeader(ui.CardHeaderProps{
+					Title:       "Sign in",
+					Description: "New here? Signing in creates your account",
+				}),
+				ui.CardSection(
+					html.Div(buttons...),
+
+					// Passkeys sign in without choosing an account first
+					html.Div(
+						attr.Class("flex flex-col gap-2"),
+						html.Button(
+							attr.Type("button"),
+							attr.Class("btn-outline w-full"),
+							html.Attr("data-passkey", "sign-in"),
+							html.Attr("data-redirect", gohtml.EscapeString(redirect)),
+							icons.Key(),
+							html.Text("Sign in with a passkey"),
+						),
+						passkeyError(),
+					),
+
+					// Passwordless sign in for people without one of the accounts above
+					html.If(props.EmailSignIn,
+						form(r,
+							attr.Action("/auth/email"),
+							attr.Method("POST"),
+							attr.Class("flex flex-col gap-3"),
+							html.Input(
+								attr.Type("hidden"),
+								attr.Name("redirect"),
+								attr.Value(gohtml.EscapeString(redirect)),
+							),
+							html.If(len(props.Providers) > 0,
+								html.P(
+									attr.Class("text-center text-sm text-muted-foreground"),
+									html.Text("or"),
+								),
+							),
+							html.Div(
+								attr.Class("flex flex-col gap-2"),
+								html.Label(
+									attr.For("email"),
+									attr.Class("text-sm font-medium"),
+									html.Text("Email"),
+								),
+								html.Input(
+									attr.Type("email"),
+									attr.Id("email"),
+									attr.Name("email"),
+									attr.Value(gohtml.EscapeString(props.Email)),
+									attr.Placeholder("you@example.com"),
+									attr.Required("true"),
+									attr.ClassIfElse(errs != nil && errs.Has("email"), "input border-destructive focus:ring-destructive", "input"),
+								),
+								html.If(errs != nil && errs.Has("email"),
+									html.P(
+										attr.Class("text-xs text-destructive"),
+										html.Text(errs.Get("email")),
+									),
+								),
+							),
+							html.Button(
+								attr.Type("submit"),
+								attr.Class("btn-primary w-full"),
+								html.Text("Email me a sign in link"),
+							),
+						),
+					),
+				),
+			),
+			passkeyScript(),
+		),
+	)
+
+	// Render page
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return page.Render(w)
+}
+
+// SecondFactorProps holds the second factors a pending sign in can complete with
+type SecondFactorProps struct {
+	Redirect string // Page to return to once signed in
+	Passkey  bool   // Whether the user has passkeys
+	TOTP     bool   // Whether the user has an authenticator app
+	Errors   validator.ValidationErrors
+}
+
+// SecondFactor asks for a second factor before signing in
+func SecondFactor(w http.ResponseWriter, r *http.Request, props SecondFactorProps) error {
+	errs := props.Errors
+
+	page := layouts.Base(nil, r, "Two-factor authentication - Internet Publishing",
+		html.Div(
+			attr.Class("max-w-sm mx-auto px-8 py-16"),
+			ui.Card(
+				ui.CardHeader(ui.CardHeaderProps{
+					Title:       "Two-factor authentication",
+					Description: "Confirm it's you to finish signing in",
+				}),
+				ui.CardSection(
+					html.If(props.Passkey,
+						html.Div(
+							attr.Class("flex flex-col gap-2"),
+							html.Button(
+								attr.Type("button"),
+								attr.Class("btn-primary w-full"),
+								html.Attr("data-passkey", "second-factor"),
+								html.Attr("data-redirect", gohtml.EscapeString(props.Redirect)),
+								icons.Key(),
+								html.Text("Use a passkey"),
+							),
+							passkeyError(),
+						),
+					),
+					html.If(props.TOTP,
+						form(r,
+							attr.Action("/sign-in/second-factor/code"),
+							attr.Method("POST"),
+							attr.Class("flex flex-col gap-3"),
+							html.Input(
+								attr.Type("hidden"),
+								attr.Name("redirect"),
+								attr.Value(gohtml.EscapeString(props.Redirect)),
+							),
+							html.If(props.Passkey,
+								html.P(
+									attr.Class("text-center text-sm text-muted-foreground"),
+									html.Text("or"),
+								),
+							),
+							codeField("Enter the code from your authenticator app, or one of your recovery codes", errs),
+							html.Button(
+								attr.Type("submit"),
+								attr.Class("btn-primary w-full"),
+								html.Text("Verify"),
+							),
+						),
+					),
+					html.A(
+						attr.Href("/auth/sign-out"),
+						attr.Class("text-sm underline"),
+						html.Text("Cancel and sign out"),
+					),
+				),
+			),
+			passkeyScript(),
+		),
+	)
+
+	// Render page
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return page.Render(w)
+}
+
+// MagicLinkSent tells where the sign in link was sent
+func MagicLinkSent(w http.ResponseWriter, r *http.Request, email string) error {
+	page := layouts.Base(nil, r, "Check your email - Internet Publishing",
+		html.Div(
+			attr.Class("max-w-sm mx-auto px-8 py-16"),
+			ui.Card(
+				ui.CardHeader(ui.CardHeaderProps{
+					Title:       "Check your email",
+					Description: "We sent you a link to sign in",
+				}),
+				ui.CardSection(
+					html.P(
+						attr.Class("text-sm"),
+						html.Text("Open the email sent to "),
+						html.Strong(escapedText(email)),
+						html.Text(" and follow the link. It expires in 15 minutes."),
+					),
+					html.A(
+						attr.Href("/sign-in"),
+						attr.Class("text-sm underline"),
+						html.Text("Use another address"),
+					),
+				),
+			),
+		),
+	)
+
+	// Render page
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return page.Render(w)
+}
+
+// ConfirmMagicLink asks to confirm signing in with a link from an email
+func ConfirmMagicLink(w http.ResponseWriter, r *http.Request, token string) error {
+	page := layouts.Base(views.GetUser(r), r, "Sign in - Internet Publishing",
+		html.Div(
+			attr.Class("max-w-sm mx-auto px-8 py-16"),
+			form(r,
+				attr.Action("/auth/email/verify"),
+				attr.Method("POST"),
+				html.Input(
+					attr.Type("hidden"),
+					attr.Name("token"),
+					attr.Value(gohtml.EscapeString(token)),
+				),
+				ui.Card(
+					ui.CardHeader(ui.CardHeaderProps{
+						Title:       "Sign in",
+						Description: "Confirm to sign in with the link from your email",
+					}),
+					ui.CardFooter(
+						html.Button(
+							attr.Type("submit"),
+							attr.Class("btn-primary w-full"),
+							html.Text("Sign in"),
+						),
+					),
+				),
+			),
+		),
+	)
+
+	// Render page
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return page.Render(w)
+}
+
+// connectedAccounts lists the sign-in providers on the settings page. A provider can
+// only be disconnected while another one is left to sign in with.
+func connectedAccounts(r *http.Request, providers []SignInProvider, identities []*models.UserIdentity) html.Node {
+	linked := make(map[string]*models.UserIdentity, len(identities))
+	for _, identity := range identities {
+		linked[identity.Provider] = identity
+	}
+
+	rows := []any{attr.Class("flex flex-col divide-y divide-border")}
+	for _, provider := range providers {
+		identity := linked[provider.ID]
+
+		var status, action html.Node
+		switch {
+		case identity == nil:
+			status = html.Text("Not connected")
+			action = html.A(
+				attr.Href(provider.Path+"?redirect=/settings"),
+				attr.Class("btn-outline btn-sm"),
+				html.Text("Connect"),
+			)
+		default:
+			label := identity.Email
+			if identity.Username != "" {
+				label = identity.Username
+			}
+			status = escapedText("Connected as " + label)
+			action = form(r,
+				attr.Action("/settings/identities/"+url.PathEscape(provider.ID)+"/delete"),
+				attr.Method("POST"),
+				html.Button(
+					attr.Type("submit"),
+					attr.Class("btn-outline btn-sm"),
+					disabledIf(len(identities) < 2),
+					html.Text("Disconnect"),
+				),
+			)
+		}
+
+		rows = append(rows, html.Div(
+			attr.Class("flex items-center justify-between gap-4 py-3"),
+			html.Div(
+				attr.Class("flex items-center gap-3"),
+				provider.icon(),
+				html.Div(
+					html.P(
+						attr.Class("text-sm font-medium"),
+						escapedText(provider.Name),
+					),
+					html.P(
+						attr.Class("text-sm text-muted-foreground"),
+						status,
+					),
+				),
+			),
+			action,
+		))
+	}
+
+	return ui.Card(
+		ui.CardHeader(ui.CardHeaderProps{
+			Title:       "Connected accounts",
+			Description: "Sign in with any of these. Keep at least one connected.",
+		}),
+		ui.CardSection(
+			html.Div(rows...),
+		),
+	)
+}
+
+// repositoryOptions suggests the user's GitHub repositories in the new site form
+func repositoryOptions(repos []*github.Repository) html.Node {
+	options := []any{attr.Id("github-repos")}
+	for _, repo := range repos {
+		if repo.Private {
+			continue
+		}
+		options = append(options, html.Option(
+			attr.Value(gohtml.EscapeString(repo.FullName)),
+			html.Attr("data-branch", gohtml.EscapeString(repo.DefaultBranch)),
+			escapedText(repo.Description),
+		))
+	}
+	return html.Datalist(options...)
+}
+
+// passkeysCard lists the user's passkeys on the settings page, each of which can be
+// renamed or removed, and registers new ones
+func passkeysCard(r *http.Request, passkeys []*models.Passkey) html.Node {
+	rows := []any{attr.Class("flex flex-col divide-y divide-border")}
+	for _, passkey := range passkeys {
+		id := strconv.FormatInt(passkey.ID, 10)
+		used := "Never used"
+		if passkey.LastUsedAt != nil {
+			used = "Last used " + passkey.LastUsedAt.Format("Jan 2, 2006")
+		}
+
+		rows = append(rows, html.Div(
+			attr.Class("flex flex-col sm:flex-row sm:items-center justify-between gap-3 py-3"),
+			form(r,
+				attr.Action("/settings/passkeys/"+id+"/rename"),
+				attr.Method("POST"),
+				attr.Class("flex items-center gap-3"),
+				icons.Key(),
+				html.Div(
+					html.Input(
+						attr.Type("text"),
+						attr.Name("name"),
+						attr.Value(gohtml.EscapeString(passkey.Name)),
+						attr.Required("true"),
+						attr.Maxlength("50"),
+						html.Attr("aria-label", "Passkey name"),
+						attr.Class("input h-8"),
+					),
+					html.P(
+						attr.Class("text-xs text-muted-foreground mt-1"),
+						html.Text("Added "+passkey.CreatedAt.Format("Jan 2, 2006")+" · "+used),
+					),
+				),
+				html.Button(
+					attr.Type("submit"),
+					attr.Class("btn-outline btn-sm"),
+					html.Text("Rename"),
+				),
+			),
+			form(r,
+				attr.Action("/settings/passkeys/"+id+"/delete"),
+				attr.Method("POST"),
+				html.Button(
+					attr.Type("submit"),
+					attr.Class("btn-outline btn-sm"),
+					html.Text("Remove"),
+				),
+			),
+		))
+	}
+	if len(passkeys) == 0 {
+		rows = append(rows, html.P(
+			attr.Class("text-sm text-muted-foreground py-3"),
+			html.Text("No passkeys yet"),
+		))
+	}
+
+	return ui.Card(
+		ui.CardHeader(ui.CardHeaderProps{
+			Title:       "Passkeys",
+			Description: "Sign in with your device instead of a password. Once you add one, it is also asked for after signing in another way.",
+		}),
+		ui.CardSection(
+			html.Div(rows...),
+		),
+		ui.CardFooter(
+			html.Div(
+				attr.Class("flex flex-col gap-2 w-full"),
+				html.Div(
+					attr.Class("flex gap-2"),
+					html.Input(
+						attr.Type("text"),
+						attr.Id("passkey-name"),
+						attr.Placeholder("Name, e.g. Work laptop"),
+						attr.Maxlength("50"),
+						html.Attr("aria-label", "New passkey name"),
+						attr.Class("input"),
+					),
+					html.Button(
+						attr.Type("button"),
+						attr.Class("btn-primary"),
+						html.Attr("data-passkey", "register"),
+						html.Text("Add a passkey"),
+					),
+				),
+				passkeyError(),
+			),
+		),
+		passkeyScript(),
+	)
+}
+
+// passkeyError shows what went wrong with a passkey, filled in by passkeys.js
+func passkeyError() html.Node {
+	return html.P(
+		attr.Class("text-xs text-destructive"),
+		html.Attr("data-passkey-error", ""),
+		attr.Hidden("true"),
+	)
+}
+
+// passkeyScript wires the passkey buttons of the page
+func passkeyScript() html.Node {
+	return html.Script(attr.Src("/js/passkeys.js"), html.Attr("defer", ""))
+}
+
+// sessionsCard lists where the account is signed in. Other sessions can be signed
+// out one at a time or all at once.
+func sessionsCard(r *http.Request, sessions []*models.Session, currentID int64) html.Node {
+	rows := []any{attr.Class("flex flex-col divide-y divide-border")}
+	for _, session := range sessions {
+		details := "Signed in " + session.CreatedAt.Format("Jan 2, 2006")
+		if session.IPAddress != "" {
+			details += " from " + session.IPAddress
+		}
+		details += " · Last active " + session.LastSeenAt.Format("Jan 2, 2006 15:04")
+
+		var action html.Node
+		if session.ID == currentID {
+			action = html.Span(
+				attr.Class("text-xs font-medium text-muted-foreground"),
+				html.Text("This device"),
+			)
+		} else {
+			action = form(r,
+				attr.Action("/settings/sessions/"+strconv.FormatInt(session.ID, 10)+"/delete"),
+				attr.Method("POST"),
+				html.Button(
+					attr.Type("submit"),
+					attr.Class("btn-outline btn-sm"),
+					html.Text("Sign out"),
+				),
+			)
+		}
+
+		rows = append(rows, html.Div(
+			attr.Class("flex items-center justify-between gap-3 py-3"),
+			html.Div(
+				html.P(
+					attr.Class("text-sm font-medium"),
+					escapedText(describeUserAgent(session.UserAgent)),
+				),
+				html.P(
+					attr.Class("text-xs text-muted-foreground"),
+					escapedText(details),
+				),
+			),
+			action,
+		))
+	}
+
+	return ui.Card(
+		ui.CardHeader(ui.CardHeaderProps{
+			Title:       "Sessions",
+			Description: "Devices signed in to your account. Sign out the ones you don't recognize.",
+		}),
+		ui.CardSection(
+			html.Div(rows...),
+		),
+		html.If(len(sessions) > 1,
+			ui.CardFooter(
+				form(r,
+					attr.Action("/settings/sessions/delete-others"),
+					attr.Method("POST"),
+					html.Button(
+						attr.Type("submit"),
+						attr.Class("btn-outline"),
+						html.Text("Sign out all other sessions"),
+					),
+				),
+			),
+		),
+	)
+}
+
+// describeUserAgent names the browser and system of a user agent, e.g. "Firefox on
+// macOS". It only tells sessions apart, user agents are easy to fake.
+func describeUserAgent(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+
+	browser := "Unknown browser"
+	for _, candidate := range []struct{ token, name string }{
+		// Order matters, Edge and Opera also claim to be Chrome, which claims to be Safari
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	} {
+		if strings.Contains(userAgent, candidate.token) {
+			browser = candidate.name
+			break
+		}
+	}
+
+	system := ""
+	for _, candidate := range []struct{ token, name string }{
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Android", "Android"},
+		{"Mac OS X", "macOS"},
+		{"Windows", "Windows"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, candidate.token) {
+			system = candidate.name
+			break
+		}
+	}
+
+	if system == "" {
+		return browser
+	}
+	return browser + " on " + system
+}
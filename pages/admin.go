@@ -0,0 +1,443 @@
+package pages
+
+import (
+	"fmt"
+	gohtml "html"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/frenchsoftware/libhtml/attr"
+	"github.com/frenchsoftware/libhtml/html"
+	"github.com/frenchsoftware/libvalidator/validator"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/views"
+	"github.com/hyperstitieux/template/views/components/ui"
+	"github.com/hyperstitieux/template/views/layouts"
+)
+
+// adminSections are the pages of the admin console, by path
+var adminSections = []struct{ path, name string }{
+	{"/admin", "Overview"},
+	{"/admin/users", "Users"},
+	{"/admin/sites", "Sites"},
+	{"/admin/reports", "Reports"},
+	{"/admin/jobs", "Jobs"},
+	{"/admin/audit", "Audit log"},
+}
+
+// adminNav links the pages of the admin console together
+func adminNav(r *http.Request) html.Node {
+	nav := []any{attr.Class("flex flex-wrap gap-2 mb-6")}
+	for _, section := range adminSections {
+		nav = append(nav, html.A(
+			attr.Href(section.path),
+			attr.ClassIfElse(r.URL.Path == section.path, "btn-sm-secondary", "btn-sm-ghost"),
+			html.Text(section.name),
+		))
+	}
+	return html.Nav(nav...)
+}
+
+// adminPage builds an admin console page with its header and navigation
+func adminPage(r *http.Request, title, description string, children ...any) html.Node {
+	content := []any{
+		attr.Class("max-w-6xl mx-auto px-8 py-8"),
+
+		// Page header
+		html.Div(
+			attr.Class("mb-8"),
+			html.H1(
+				attr.Class("text-3xl font-semibold mb-2"),
+				html.Text(title),
+			),
+			html.P(
+				attr.Class("text-muted-foreground"),
+				html.Text(description),
+			),
+		),
+		adminNav(r),
+	}
+
+	return layouts.Base(views.GetUser(r), r, title+" - Internet Publishing",
+		html.Div(append(content, children...)...),
+	)
+}
+
+// adminCounter is a statistic of the admin dashboard, linking to where it comes from
+type adminCounter struct {
+	label string
+	value int
+	href  string
+}
+
+// AdminDashboard shows instance statistics and the state of the job queue
+func AdminDashboard(w http.ResponseWriter, r *http.Request, stats *models.InstanceStats, jobCounts map[string]int) error {
+	counters := []adminCounter{
+		{"Users", stats.Users, "/admin/users"},
+		{"Active in the last 30 days", stats.ActiveUsers, "/admin/users"},
+		{"Suspended users", stats.SuspendedUsers, "/admin/users"},
+		{"Organizations", stats.Organizations, ""},
+		{"Sites", stats.Sites, "/admin/sites"},
+		{"Suspended sites", stats.SuspendedSites, "/admin/sites"},
+		{"Open reports", stats.OpenReports, "/admin/reports"},
+		{"Deployments in the last 24 hours", stats.RecentDeployments, ""},
+		{"Failed jobs", jobCounts[models.JobFailed], "/admin/jobs?status=" + models.JobFailed},
+	}
+
+	page := adminPage(r, "Admin", "Users, sites and background work of this instance",
+		html.Div(
+			attr.Class("grid grid-cols-2 md:grid-cols-4 gap-4"),
+			html.Map(counters, func(counter adminCounter) html.Node {
+				value := html.Div(
+					attr.Class("text-3xl font-semibold"),
+					html.Text(strconv.Itoa(counter.value)),
+				)
+				if counter.href != "" {
+					value = html.A(attr.Href(counter.href), attr.Class("hover:underline"), value)
+				}
+				return ui.Card(
+					ui.CardSection(
+						html.Div(
+							attr.Class("text-sm text-muted-foreground"),
+							html.Text(counter.label),
+						),
+						value,
+					),
+				)
+			}),
+		),
+	)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return page.Render(w)
+}
+
+// AdminUsers lists users with their role and suspension, and the actions admins take
+// on them. Errors are keyed by "user_<id>".
+func AdminUsers(w http.ResponseWriter, r *http.Request, users []*models.User, search string, errs validator.ValidationErrors) error {
+	page := adminPage(r, "Users", "Search users to suspend them, make them admins or view the dashboard as them",
+		ui.Card(
+			ui.CardSection(
+				adminSearch("/admin/users", search, "Email, name or ID"),
+				html.IfElse(len(users) == 0,
+					html.P(
+						attr.Class("text-sm text-muted-foreground py-8 text-center"),
+						html.Text("No users"),
+					),
+					html.Div(
+						attr.Class("flex flex-col divide-y divide-border"),
+						html.Map(users, func(user *models.User) html.Node {
+							return adminUserRow(r, user, errs)
+						}),
+					),
+				),
+			),
+		),
+	)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return page.Render(w)
+}
+
+// adminUserRow shows a user and the actions available on them
+func adminUserRow(r *http.Request, user *models.User, errs validator.ValidationErrors) html.Node {
+	base := fmt.Sprintf("/admin/users/%d", user.ID)
+	details := fmt.Sprintf("#%d · Joined %s", user.ID, user.CreatedAt.Format("Jan 2, 2006"))
+
+	var actions []any
+	actions = append(actions, attr.Class("flex flex-wrap items-center gap-2"))
+	if user.SuspendedAt != nil {
+		actions = append(actions, adminAction(r, base+"/unsuspend", "Unsuspend"))
+	} else if !user.IsAdmin {
+		actions = append(actions, adminSuspendForm(r, base+"/suspend"))
+	}
+	actions = append(actions, html.A(
+		attr.Href(base+"/limits"),
+		attr.Class("btn-sm-outline"),
+		html.Text("Limits"),
+	))
+	if user.IsAdmin {
+		actions = append(actions, adminAction(r, base+"/admin", "Revoke admin"))
+	} else {
+		actions = append(actions,
+			adminAction(r, base+"/admin", "Make admin", html.Input(attr.Type("hidden"), attr.Name("admin"), attr.Value("true"))),
+			adminAction(r, base+"/impersonate", "View as"),
+		)
+	}
+
+	return html.Div(
+		attr.Class("flex flex-col gap-2 py-3"),
+		html.Div(
+			attr.Class("flex flex-col md:flex-row md:items-center md:justify-between gap-3"),
+			html.Div(
+				html.P(
+					attr.Class("text-sm font-medium flex items-center gap-2"),
+					escapedText(user.Email),
+					html.If(user.IsAdmin, html.Span(attr.Class("badge-secondary"), html.Text("Admin"))),
+					html.If(user.SuspendedAt != nil, html.Span(attr.Class("badge-destructive"), html.Text("Suspended"))),
+				),
+				html.P(
+					attr.Class("text-xs text-muted-foreground"),
+					escapedText(user.Name+" · "+details),
+				),
+				html.IfExec(user.SuspendedAt != nil, func() html.Node {
+					return html.P(
+						attr.Class("text-xs text-destructive"),
+						escapedText("Suspended "+user.SuspendedAt.Format("Jan 2, 2006")+": "+user.SuspendedReason),
+					)
+				}),
+			),
+			html.Div(actions...),
+		),
+		fieldError(errs, fmt.Sprintf("user_%d", user.ID)),
+	)
+}
+
+// AdminSites lists sites with their suspension, and lets admins suspend them. Errors
+// are keyed by "site_<id>".
+func AdminSites(w http.ResponseWriter, r *http.Request, sites []*models.Site, search string, errs validator.ValidationErrors) error {
+	page := adminPage(r, "Sites", "Search sites to suspend the ones breaking the rules",
+		ui.Card(
+			ui.CardSection(
+				adminSearch("/admin/sites", search, "Slug, repository, creator's email or ID"),
+				html.IfElse(len(sites) == 0,
+					html.P(
+						attr.Class("text-sm text-muted-foreground py-8 text-center"),
+						html.Text("No sites"),
+					),
+					html.Div(
+						attr.Class("flex flex-col divide-y divide-border"),
+						html.Map(sites, func(site *models.Site) html.Node {
+							return adminSiteRow(r, site, errs)
+						}),
+					),
+				),
+			),
+		),
+	)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return page.Render(w)
+}
+
+// adminSiteRow shows a site, who owns it and the actions available on it
+func adminSiteRow(r *http.Request, site *models.Site, errs validator.ValidationErrors) html.Node {
+	base := fmt.Sprintf("/admin/sites/%d", site.ID)
+	owner := fmt.Sprintf("user #%d", site.UserID)
+	if site.OrganizationID != nil {
+		owner = fmt.Sprintf("organization #%d, created by user #%d", *site.OrganizationID, site.UserID)
+	}
+
+	var action html.Node
+	if site.SuspendedAt != nil {
+		action = adminAction(r, base+"/unsuspend", "Unsuspend")
+	} else {
+		action = adminSuspendForm(r, base+"/suspend")
+	}
+
+	return html.Div(
+		attr.Class("flex flex-col gap-2 py-3"),
+		html.Div(
+			attr.Class("flex flex-col md:flex-row md:items-center md:justify-between gap-3"),
+			html.Div(
+				html.P(
+					attr.Class("text-sm font-medium flex items-center gap-2"),
+					escapedText(site.Slug),
+					html.If(site.SuspendedAt != nil, html.Span(attr.Class("badge-destructive"), html.Text("Suspended"))),
+				),
+				html.P(
+					attr.Class("text-xs text-muted-foreground"),
+					escapedText(fmt.Sprintf("#%d · %s@%s · ", site.ID, site.GithubRepo, site.GithubBranch)),
+					html.A(
+						attr.Href(fmt.Sprintf("/admin/users?q=%d", site.UserID)),
+						attr.Class("hover:underline"),
+						html.Text("Owned by "+owner),
+					),
+				),
+				html.IfExec(site.SuspendedAt != nil, func() html.Node {
+					return html.P(
+						attr.Class("text-xs text-destructive"),
+						escapedText("Suspended "+site.SuspendedAt.Format("Jan 2, 2006")+": "+site.SuspendedReason),
+					)
+				}),
+			),
+			action,
+		),
+		fieldError(errs, fmt.Sprintf("site_%d", site.ID)),
+	)
+}
+
+// AdminReports lists the open site reports with the actions resolving them, or the
+// resolved ones. Errors are keyed by "report_<id>".
+func AdminReports(w http.ResponseWriter, r *http.Request, reports []*models.SiteReport, resolved bool, errs validator.ValidationErrors) error {
+	page := adminPage(r, "Reports", "Abuse reported by visitors of public sites",
+		html.Nav(
+			attr.Class("flex gap-2 mb-4"),
+			html.A(
+				attr.Href("/admin/reports"),
+				attr.ClassIfElse(!resolved, "btn-sm-secondary", "btn-sm-ghost"),
+				html.Text("Open"),
+			),
+			html.A(
+				attr.Href("/admin/reports?resolved=1"),
+				attr.ClassIfElse(resolved, "btn-sm-secondary", "btn-sm-ghost"),
+				html.Text("Resolved"),
+			),
+		),
+		ui.Card(
+			ui.CardSection(
+				html.IfElse(len(reports) == 0,
+					html.P(
+						attr.Class("text-sm text-muted-foreground py-8 text-center"),
+						html.Text("No reports"),
+					),
+					html.Div(
+						attr.Class("flex flex-col divide-y divide-border"),
+						html.Map(reports, func(report *models.SiteReport) html.Node {
+							return adminReportRow(r, report, errs)
+						}),
+					),
+				),
+			),
+		),
+	)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return page.Render(w)
+}
+
+// adminReportRow shows a report, and the actions resolving it while it is open
+func adminReportRow(r *http.Request, report *models.SiteReport, errs validator.ValidationErrors) html.Node {
+	base := fmt.Sprintf("/admin/reports/%d", report.ID)
+
+	var status html.Node
+	switch {
+	case report.ResolvedAt != nil:
+		status = html.P(
+			attr.Class("text-xs text-muted-foreground"),
+			escapedText(fmt.Sprintf("%s by %s on %s", capitalize(report.Resolution), formatAuditValue(report.ResolverEmail), report.ResolvedAt.Format("Jan 2, 2006"))),
+		)
+	case report.SiteSuspended:
+		status = html.Div(
+			attr.Class("flex flex-wrap items-center gap-2"),
+			html.Span(attr.Class("badge-destructive"), html.Text("Site suspended")),
+			adminAction(r, base+"/resolve", "Resolve"),
+		)
+	default:
+		status = html.Div(
+			attr.Class("flex flex-wrap items-center gap-2"),
+			adminAction(r, base+"/resolve", "Dismiss"),
+			form(r,
+				attr.Action(base+"/suspend"),
+				attr.Method("POST"),
+				attr.Class("flex gap-2"),
+				html.Input(
+					attr.Type("text"),
+					attr.Name("reason"),
+					attr.Required("true"),
+					attr.Value(models.ReportCategoryNames[report.Category]),
+					attr.Class("input h-8 text-sm"),
+				),
+				html.Button(
+					attr.Type("submit"),
+					attr.Class("btn-sm-destructive"),
+					html.Text("Suspend site"),
+				),
+			),
+		)
+	}
+
+	return html.Div(
+		attr.Class("flex flex-col gap-2 py-3"),
+		html.Div(
+			attr.Class("flex flex-col md:flex-row md:items-start md:justify-between gap-3"),
+			html.Div(
+				attr.Class("flex flex-col gap-1 min-w-0"),
+				html.P(
+					attr.Class("text-sm font-medium flex items-center gap-2"),
+					html.A(
+						attr.Href("/admin/sites?q="+url.QueryEscape(report.SiteSlug)),
+						attr.Class("hover:underline"),
+						escapedText(report.SiteSlug),
+					),
+					html.Span(attr.Class("badge-secondary"), html.Text(models.ReportCategoryNames[report.Category])),
+				),
+				html.A(
+					attr.Href(gohtml.EscapeString(report.URL)),
+					attr.Target("_blank"),
+					attr.Rel("noopener noreferrer nofollow"),
+					attr.Class("text-xs underline break-all"),
+					escapedText(report.URL),
+				),
+				html.If(report.Details != "",
+					html.P(
+						attr.Class("text-sm whitespace-pre-line"),
+						escapedText(report.Details),
+					),
+				),
+				html.P(
+					attr.Class("text-xs text-muted-foreground"),
+					escapedText(fmt.Sprintf("#%d · Sent by %s from %s on %s", report.ID, report.ReporterEmail, report.IP, report.CreatedAt.Format("Jan 2, 2006 15:04"))),
+				),
+			),
+			status,
+		),
+		fieldError(errs, fmt.Sprintf("report_%d", report.ID)),
+	)
+}
+
+// adminSearch renders the search form above a list of the admin console
+func adminSearch(path, search, placeholder string) html.Node {
+	return html.Form(
+		attr.Action(path),
+		attr.Method("GET"),
+		attr.Class("flex gap-2"),
+		html.Input(
+			attr.Type("search"),
+			attr.Name("q"),
+			attr.Value(gohtml.EscapeString(search)),
+			attr.Placeholder(placeholder),
+			attr.Class("input flex-1"),
+		),
+		html.Button(
+			attr.Type("submit"),
+			attr.Class("btn-outline"),
+			html.Text("Search"),
+		),
+	)
+}
+
+// adminSuspendForm asks for the reason of a suspension, shown to the admins and to
+// the owner
+func adminSuspendForm(r *http.Request, action string) html.Node {
+	return form(r,
+		attr.Action(action),
+		attr.Method("POST"),
+		attr.Class("flex gap-2"),
+		html.Input(
+			attr.Type("text"),
+			attr.Name("reason"),
+			attr.Required("true"),
+			attr.Placeholder("Reason"),
+			attr.Class("input h-8 text-sm"),
+		),
+		html.Button(
+			attr.Type("submit"),
+			attr.Class("btn-sm-destructive"),
+			html.Text("Suspend"),
+		),
+	)
+}
+
+// adminAction renders a button posting to an admin action
+func adminAction(r *http.Request, action, label string, fields ...any) html.Node {
+	items := []any{attr.Action(action), attr.Method("POST")}
+	items = append(items, fields...)
+	items = append(items, html.Button(
+		attr.Type("submit"),
+		attr.Class("btn-sm-outline"),
+		html.Text(label),
+	))
+	return form(r, items...)
+}
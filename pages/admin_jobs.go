@@ -0,0 +1,231 @@
+package pages
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/frenchsoftware/libhtml/attr"
+	"github.com/frenchsoftware/libhtml/html"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/views"
+	"github.com/hyperstitieux/template/views/components/ui"
+	"github.com/hyperstitieux/template/views/layouts"
+)
+
+// AdminJobsProps holds everything shown on the job queue admin page
+type AdminJobsProps struct {
+	Counts    map[string]int
+	Jobs      []*models.Job
+	Schedules []*models.JobSchedule
+	Status    string // Job status filter, empty for all
+}
+
+func AdminJobs(w http.ResponseWriter, r *http.Request, props AdminJobsProps) error {
+	user := views.GetUser(r)
+
+	// Build page
+	page := layouts.Base(user, r, "Jobs - Internet Publishing",
+		html.Div(
+			attr.Class("max-w-6xl mx-auto px-8 py-8"),
+
+			// Page header
+			html.Div(
+				attr.Class("mb-8"),
+				html.H1(
+					attr.Class("text-3xl font-semibold mb-2"),
+					html.Text("Jobs"),
+				),
+				html.P(
+					attr.Class("text-muted-foreground"),
+					html.Text("Background work queued and run by this instance"),
+				),
+			),
+			adminNav(r),
+
+			html.Div(
+				attr.Class("flex flex-col gap-6"),
+
+				// Status counters
+				html.Div(
+					attr.Class("grid grid-cols-2 md:grid-cols-4 gap-4"),
+					html.Map(models.JobStatuses, func(status string) html.Node {
+						return ui.Card(
+							ui.CardSection(
+								html.Div(
+									attr.Class("text-sm text-muted-foreground"),
+									html.Text(capitalize(status)),
+								),
+								html.Div(
+									attr.Class("text-3xl font-semibold"),
+									html.Text(fmt.Sprintf("%d", props.Counts[status])),
+								),
+							),
+						)
+					}),
+				),
+
+				// Recent jobs
+				ui.Card(
+					ui.CardHeader(ui.CardHeaderProps{
+						Title:       "Recent jobs",
+						Description: "Most recently updated first",
+					}),
+					ui.CardSection(
+						jobStatusFilters(props.Status),
+						html.IfElse(len(props.Jobs) == 0,
+							html.P(
+								attr.Class("text-sm text-muted-foreground py-8 text-center"),
+								html.Text("No jobs"),
+							),
+							jobsTable(r, props.Jobs),
+						),
+					),
+				),
+
+				// Recurring schedules
+				ui.Card(
+					ui.CardHeader(ui.CardHeaderProps{
+						Title:       "Schedules",
+						Description: "Recurring jobs and when they run next",
+					}),
+					ui.CardSection(
+						html.Div(
+							attr.Class("overflow-x-auto"),
+							html.Table(
+								attr.Class("table"),
+								html.Thead(
+									html.Tr(
+										html.Th(html.Text("Name")),
+										html.Th(html.Text("Schedule")),
+										html.Th(html.Text("Kind")),
+										html.Th(html.Text("Last run")),
+										html.Th(html.Text("Next run")),
+									),
+								),
+								html.Tbody(
+									html.Map(props.Schedules, func(s *models.JobSchedule) html.Node {
+										return html.Tr(
+											html.Td(html.Text(s.Name)),
+											html.Td(attr.Class("font-mono text-xs"), html.Text(s.Spec)),
+											html.Td(attr.Class("font-mono text-xs"), html.Text(s.Kind)),
+											html.Td(html.Text(formatOptionalTime(s.LastRunAt))),
+											html.Td(html.Text(s.NextRunAt.Format("Jan 2, 15:04:05"))),
+										)
+									}),
+								),
+							),
+						),
+					),
+				),
+			),
+		),
+	)
+
+	// Render page
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return page.Render(w)
+}
+
+// jobStatusFilters renders the status filter buttons above the jobs table
+func jobStatusFilters(status string) html.Node {
+	filters := []any{attr.Class("flex flex-wrap gap-2")}
+	filters = append(filters, html.A(
+		attr.Href("/admin/jobs"),
+		attr.ClassIfElse(status == "", "btn-sm-secondary", "btn-sm-ghost"),
+		html.Text("All"),
+	))
+	for _, s := range models.JobStatuses {
+		filters = append(filters, html.A(
+			attr.Href("/admin/jobs?status="+s),
+			attr.ClassIfElse(status == s, "btn-sm-secondary", "btn-sm-ghost"),
+			html.Text(capitalize(s)),
+		))
+	}
+	return html.Div(filters...)
+}
+
+// jobsTable lists jobs with their attempts and last error
+func jobsTable(r *http.Request, jobs []*models.Job) html.Node {
+	return html.Div(
+		attr.Class("overflow-x-auto"),
+		html.Table(
+			attr.Class("table"),
+			html.Thead(
+				html.Tr(
+					html.Th(html.Text("ID")),
+					html.Th(html.Text("Kind")),
+					html.Th(html.Text("Status")),
+					html.Th(html.Text("Attempts")),
+					html.Th(html.Text("Run at")),
+					html.Th(html.Text("Last error")),
+					html.Th(),
+				),
+			),
+			html.Tbody(
+				html.Map(jobs, func(job *models.Job) html.Node {
+					return html.Tr(
+						html.Td(attr.Class("font-mono text-xs"), html.Text(fmt.Sprintf("%d", job.ID))),
+						html.Td(
+							html.Details(
+								html.Summary(
+									attr.Class("cursor-pointer font-mono text-xs"),
+									html.Text(job.Kind),
+								),
+								html.Pre(
+									attr.Class("mt-2 text-xs text-muted-foreground whitespace-pre-wrap break-all"),
+									escapedText(job.Payload),
+								),
+							),
+						),
+						html.Td(jobStatusBadge(job.Status)),
+						html.Td(html.Text(fmt.Sprintf("%d / %d", job.Attempts, job.MaxAttempts))),
+						html.Td(
+							attr.Class("whitespace-nowrap"),
+							html.Text(job.RunAt.Format("Jan 2, 15:04:05")),
+						),
+						html.Td(
+							attr.Class("text-xs text-muted-foreground break-all"),
+							escapedText(job.LastError),
+						),
+						html.Td(
+							html.If(job.Status == models.JobFailed,
+								form(r,
+									attr.Action(fmt.Sprintf("/admin/jobs/%d/retry", job.ID)),
+									attr.Method("POST"),
+									html.Button(
+										attr.Type("submit"),
+										attr.Class("btn-sm-outline"),
+										html.Text("Retry"),
+									),
+								),
+							),
+						),
+					)
+				}),
+			),
+		),
+	)
+}
+
+// jobStatusBadge renders a badge coloured by job status
+func jobStatusBadge(status string) html.Node {
+	class := "badge-outline"
+	switch status {
+	case models.JobFailed:
+		class = "badge-destructive"
+	case models.JobRunning:
+		class = "badge-primary"
+	case models.JobSucceeded:
+		class = "badge-secondary"
+	}
+	return html.Span(attr.Class(class), html.Text(status))
+}
+
+// formatOptionalTime formats a nullable timestamp
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return "—"
+	}
+	return t.Format("Jan 2, 15:04:05")
+}
@@ -0,0 +1,113 @@
+package pages
+
+import (
+	"fmt"
+	gohtml "html"
+	"net/http"
+
+	"github.com/frenchsoftware/libhtml/attr"
+	"github.com/frenchsoftware/libhtml/html"
+	"github.com/frenchsoftware/libvalidator/validator"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/quota"
+	"github.com/hyperstitieux/template/views/components/ui"
+)
+
+// AdminLimitsProps holds the plan and limits of a user as admins set them, blank
+// limits being those of the plan
+type AdminLimitsProps struct {
+	User        *models.User
+	Plans       []quota.Plan
+	Plan        string
+	Sites       string
+	StorageMB   string
+	BandwidthGB string
+	SyncsPerDay string
+	Usage       *quota.Report
+	Errors      validator.ValidationErrors
+}
+
+// AdminLimits lets admins put a user on a plan and change its limits for them
+func AdminLimits(w http.ResponseWriter, r *http.Request, props AdminLimitsProps) error {
+	errs := props.Errors
+
+	plans := []any{attr.Id("plan"), attr.Name("plan"), attr.Class("select w-full")}
+	for _, plan := range props.Plans {
+		plans = append(plans, html.Option(
+			attr.Value(plan.ID),
+			selectedIf(props.Plan == plan.ID),
+			html.Text(plan.Name),
+		))
+	}
+
+	page := adminPage(r, "Limits of "+gohtml.EscapeString(props.User.Email), "Put the user on a plan, and raise or lower its limits for them",
+		html.Div(
+			attr.Class("flex flex-col gap-6"),
+
+			form(r,
+				attr.Action(fmt.Sprintf("/admin/users/%d/limits", props.User.ID)),
+				attr.Method("POST"),
+
+				ui.Card(
+					ui.CardHeader(ui.CardHeaderProps{
+						Title:       "Plan",
+						Description: "Leave a limit blank to take the plan's, or enter 0 for unlimited",
+					}),
+					ui.CardSection(
+						html.Div(
+							attr.Class("flex flex-col gap-2"),
+							html.Label(
+								attr.For("plan"),
+								attr.Class("text-sm font-medium"),
+								html.Text("Plan"),
+							),
+							html.Select(plans...),
+							fieldError(errs, "plan"),
+						),
+						html.Div(
+							attr.Class("grid gap-4 sm:grid-cols-2"),
+							limitField("sites", "Sites", props.Sites, errs),
+							limitField("storage_mb", "Storage (MB)", props.StorageMB, errs),
+							limitField("bandwidth_gb", "Bandwidth per month (GB)", props.BandwidthGB, errs),
+							limitField("syncs_per_day", "Syncs per day", props.SyncsPerDay, errs),
+						),
+					),
+					ui.CardFooter(
+						html.Button(
+							attr.Type("submit"),
+							attr.Class("btn-primary"),
+							html.Text("Save limits"),
+						),
+					),
+				),
+			),
+
+			usageCard(props.Usage, fmt.Sprintf("What the user used of their limits on the %s plan", props.Usage.Plan.Name)),
+		),
+	)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return page.Render(w)
+}
+
+// limitField renders the input of a limit, blank for the plan's
+func limitField(name, label, value string, errs validator.ValidationErrors) html.Node {
+	return html.Div(
+		attr.Class("flex flex-col gap-2"),
+		html.Label(
+			attr.For(name),
+			attr.Class("text-sm font-medium"),
+			html.Text(label),
+		),
+		html.Input(
+			attr.Type("number"),
+			attr.Id(name),
+			attr.Name(name),
+			attr.Min("0"),
+			attr.Value(gohtml.EscapeString(value)),
+			attr.Placeholder("Plan's"),
+			attr.ClassIfElse(errs != nil && errs.Has(name), "input border-destructive focus:ring-destructive", "input"),
+		),
+		fieldError(errs, name),
+	)
+}
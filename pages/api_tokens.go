@@ -0,0 +1,213 @@
+package pages
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/frenchsoftware/libhtml/attr"
+	"github.com/frenchsoftware/libhtml/html"
+	"github.com/frenchsoftware/libvalidator/validator"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/views"
+	"github.com/hyperstitieux/template/views/components/ui"
+	"github.com/hyperstitieux/template/views/layouts"
+)
+
+// apiTokenExpirationOptions are the lifetimes offered for new tokens, by form value
+var apiTokenExpirationOptions = []struct{ value, label string }{
+	{"30", "30 days"},
+	{"90", "90 days"},
+	{"365", "1 year"},
+	{"never", "Never"},
+}
+
+// APITokenCreated shows a new API token, the only time it can be seen
+func APITokenCreated(w http.ResponseWriter, r *http.Request, token *models.APIToken, secret string) error {
+	user := views.GetUser(r)
+
+	page := layouts.Base(user, r, "API token - Internet Publishing",
+		html.Div(
+			attr.Class("max-w-lg mx-auto px-8 py-16"),
+			ui.Card(
+				ui.CardHeader(ui.CardHeaderProps{
+					Title:       "Copy your API token",
+					Description: "Use it as a bearer token to call the API. Keep it somewhere safe, it won't be shown again.",
+				}),
+				ui.CardSection(
+					html.P(
+						attr.Class("text-sm font-medium"),
+						escapedText(token.Name),
+					),
+					html.Code(
+						attr.Class("block text-sm font-mono break-all bg-muted rounded-md p-3 select-all"),
+						escapedText(secret),
+					),
+					html.P(
+						attr.Class("text-xs text-muted-foreground"),
+						escapedText(describeAPIToken(token)),
+					),
+				),
+				ui.CardFooter(
+					html.A(
+						attr.Href("/settings#api-tokens"),
+						attr.Class("btn-primary"),
+						html.Text("I copied it"),
+					),
+				),
+			),
+		),
+	)
+
+	// Render page
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return page.Render(w)
+}
+
+// apiTokensCard lists the user's API tokens, each of which can be revoked, and creates
+// new ones
+func apiTokensCard(r *http.Request, tokens []*models.APIToken, errs validator.ValidationErrors) html.Node {
+	rows := []any{attr.Class("flex flex-col divide-y divide-border")}
+	for _, token := range tokens {
+		rows = append(rows, html.Div(
+			attr.Class("flex items-center justify-between gap-3 py-3"),
+			html.Div(
+				html.P(
+					attr.Class("text-sm font-medium"),
+					escapedText(token.Name),
+					html.Span(
+						attr.Class("ml-2 font-mono text-xs text-muted-foreground"),
+						escapedText(token.Prefix+"…"),
+					),
+				),
+				html.P(
+					attr.Class("text-xs text-muted-foreground"),
+					escapedText(describeAPIToken(token)),
+				),
+			),
+			form(r,
+				attr.Action("/settings/tokens/"+strconv.FormatInt(token.ID, 10)+"/delete"),
+				attr.Method("POST"),
+				html.Button(
+					attr.Type("submit"),
+					attr.Class("btn-outline btn-sm"),
+					html.Text("Revoke"),
+				),
+			),
+		))
+	}
+
+	scopes := []any{attr.Class("flex flex-col gap-2")}
+	for _, scope := range models.APITokenScopes {
+		scopes = append(scopes, html.Label(
+			attr.Class("flex items-center gap-2 text-sm"),
+			html.Input(
+				attr.Type("checkbox"),
+				attr.Name("scopes"),
+				attr.Value(scope),
+				attr.Class("input"),
+				checkedIf(scope == models.ScopeSitesRead),
+			),
+			html.Span(attr.Class("font-mono text-xs"), html.Text(scope)),
+		))
+	}
+
+	expirations := []any{attr.Id("expires_in"), attr.Name("expires_in"), attr.Class("select")}
+	for _, option := range apiTokenExpirationOptions {
+		expirations = append(expirations, html.Option(
+			attr.Value(option.value),
+			selectedIf(option.value == "90"),
+			html.Text(option.label),
+		))
+	}
+
+	return html.Div(
+		attr.Id("api-tokens"),
+		ui.Card(
+			ui.CardHeader(ui.CardHeaderProps{
+				Title:       "API tokens",
+				Description: "Personal access tokens for scripts and CI to manage your sites through the API",
+			}),
+			ui.CardSection(
+				html.If(len(tokens) > 0, html.Div(rows...)),
+				form(r,
+					attr.Action("/settings/tokens"),
+					attr.Method("POST"),
+					attr.Class("flex flex-col gap-4"),
+					html.Div(
+						attr.Class("flex flex-col gap-2"),
+						html.Label(
+							attr.For("token_name"),
+							attr.Class("text-sm font-medium"),
+							html.Text("Name"),
+						),
+						html.Input(
+							attr.Type("text"),
+							attr.Id("token_name"),
+							attr.Name("token_name"),
+							attr.Placeholder("Deploy from CI"),
+							attr.Required("true"),
+							attr.Maxlength("50"),
+							attr.ClassIfElse(errs != nil && errs.Has("token_name"), "input border-destructive focus:ring-destructive", "input"),
+						),
+						fieldError(errs, "token_name"),
+					),
+					html.Div(
+						attr.Class("flex flex-col gap-2"),
+						html.P(
+							attr.Class("text-sm font-medium"),
+							html.Text("Permissions"),
+						),
+						html.Div(scopes...),
+						fieldError(errs, "scopes"),
+					),
+					html.Div(
+						attr.Class("flex flex-col gap-2"),
+						html.Label(
+							attr.For("expires_in"),
+							attr.Class("text-sm font-medium"),
+							html.Text("Expires after"),
+						),
+						html.Select(expirations...),
+						fieldError(errs, "expires_in"),
+					),
+					html.Div(
+						html.Button(
+							attr.Type("submit"),
+							attr.Class("btn-outline"),
+							html.Text("Create token"),
+						),
+					),
+				),
+			),
+		),
+	)
+}
+
+// describeAPIToken sums up the scopes and use of a token
+func describeAPIToken(token *models.APIToken) string {
+	details := strings.Join(token.Scopes, ", ") + " · Created " + token.CreatedAt.Format("Jan 2, 2006")
+	switch {
+	case token.ExpiresAt == nil:
+		details += " · Never expires"
+	case token.ExpiresAt.Before(time.Now()):
+		details += " · Expired " + token.ExpiresAt.Format("Jan 2, 2006")
+	default:
+		details += " · Expires " + token.ExpiresAt.Format("Jan 2, 2006")
+	}
+	if token.LastUsedAt != nil {
+		details += " · Last used " + token.LastUsedAt.Format("Jan 2, 2006 15:04")
+	}
+	return details
+}
+
+// fieldError renders the validation error of a field, if any
+func fieldError(errs validator.ValidationErrors, field string) html.Node {
+	return html.If(errs != nil && errs.Has(field),
+		html.P(
+			attr.Class("text-xs text-destructive"),
+			escapedText(errs.Get(field)),
+		),
+	)
+}
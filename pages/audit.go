@@ -0,0 +1,234 @@
+package pages
+
+import (
+	"fmt"
+	gohtml "html"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/frenchsoftware/libhtml/attr"
+	"github.com/frenchsoftware/libhtml/html"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/views"
+	"github.com/hyperstitieux/template/views/components/ui"
+	"github.com/hyperstitieux/template/views/layouts"
+)
+
+// AuditLog lists what was done with the user's account, newest first. nextBefore is
+// the cursor of the next page, 0 on the last one.
+func AuditLog(w http.ResponseWriter, r *http.Request, events []*models.AuditEvent, nextBefore int64) error {
+	user := views.GetUser(r)
+
+	page := layouts.Base(user, r, "Activity - Internet Publishing",
+		html.Div(
+			attr.Class("max-w-4xl mx-auto px-8 py-8"),
+
+			// Page header
+			html.Div(
+				attr.Class("mb-8"),
+				html.H1(
+					attr.Class("text-3xl font-semibold mb-2"),
+					html.Text("Activity"),
+				),
+				html.P(
+					attr.Class("text-muted-foreground"),
+					html.Text("Sign-ins and changes made to your account and sites"),
+				),
+			),
+
+			ui.Card(
+				ui.CardSection(
+					auditEventsTable(events, false),
+				),
+				auditPagination("/settings/audit", url.Values{}, nextBefore),
+			),
+		),
+	)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return page.Render(w)
+}
+
+// AdminAuditProps holds the events shown on the audit log admin page
+type AdminAuditProps struct {
+	Events     []*models.AuditEvent
+	Action     string // Action filter, empty for all
+	Search     string // Actor email or target id
+	NextBefore int64  // Cursor of the next page, 0 on the last one
+}
+
+// AdminAudit lists the events of every user
+func AdminAudit(w http.ResponseWriter, r *http.Request, props AdminAuditProps) error {
+	user := views.GetUser(r)
+
+	actions := []any{attr.Name("action"), attr.Class("select")}
+	actions = append(actions, html.Option(
+		attr.Value(""),
+		selectedIf(props.Action == ""),
+		html.Text("All actions"),
+	))
+	for _, action := range models.AuditActions {
+		actions = append(actions, html.Option(
+			attr.Value(action),
+			selectedIf(props.Action == action),
+			html.Text(action),
+		))
+	}
+
+	query := url.Values{}
+	if props.Action != "" {
+		query.Set("action", props.Action)
+	}
+	if props.Search != "" {
+		query.Set("q", props.Search)
+	}
+
+	page := layouts.Base(user, r, "Audit log - Internet Publishing",
+		html.Div(
+			attr.Class("max-w-6xl mx-auto px-8 py-8"),
+
+			// Page header
+			html.Div(
+				attr.Class("mb-8"),
+				html.H1(
+					attr.Class("text-3xl font-semibold mb-2"),
+					html.Text("Audit log"),
+				),
+				html.P(
+					attr.Class("text-muted-foreground"),
+					html.Text("Sign-ins and changes made by every user of this instance"),
+				),
+			),
+			adminNav(r),
+
+			ui.Card(
+				ui.CardSection(
+					// Filters, sent as a query string
+					html.Form(
+						attr.Action("/admin/audit"),
+						attr.Method("GET"),
+						attr.Class("flex flex-col sm:flex-row gap-2"),
+						html.Select(actions...),
+						html.Input(
+							attr.Type("search"),
+							attr.Name("q"),
+							attr.Value(gohtml.EscapeString(props.Search)),
+							attr.Placeholder("Actor email or target ID"),
+							attr.Class("input flex-1"),
+						),
+						html.Button(
+							attr.Type("submit"),
+							attr.Class("btn-outline"),
+							html.Text("Filter"),
+						),
+					),
+					auditEventsTable(props.Events, true),
+				),
+				auditPagination("/admin/audit", query, props.NextBefore),
+			),
+		),
+	)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return page.Render(w)
+}
+
+// auditEventsTable lists events with their changes, and who made them when showActor
+// is set
+func auditEventsTable(events []*models.AuditEvent, showActor bool) html.Node {
+	if len(events) == 0 {
+		return html.P(
+			attr.Class("text-sm text-muted-foreground py-8 text-center"),
+			html.Text("No activity"),
+		)
+	}
+
+	return html.Div(
+		attr.Class("overflow-x-auto"),
+		html.Table(
+			attr.Class("table"),
+			html.Thead(
+				html.Tr(
+					html.Th(html.Text("Date")),
+					html.If(showActor, html.Th(html.Text("Actor"))),
+					html.Th(html.Text("Action")),
+					html.Th(html.Text("Target")),
+					html.Th(html.Text("Changes")),
+					html.Th(html.Text("Address")),
+				),
+			),
+			html.Tbody(
+				html.Map(events, func(event *models.AuditEvent) html.Node {
+					return html.Tr(
+						html.Td(
+							attr.Class("whitespace-nowrap"),
+							html.Text(event.CreatedAt.Format("Jan 2, 2006 15:04:05")),
+						),
+						html.If(showActor, html.Td(escapedText(event.ActorEmail))),
+						html.Td(attr.Class("font-mono text-xs"), html.Text(event.Action)),
+						html.Td(attr.Class("font-mono text-xs"), escapedText(event.TargetType+" "+event.TargetID)),
+						html.Td(auditChanges(event.Changes)),
+						html.Td(
+							attr.Class("text-xs text-muted-foreground"),
+							escapedText(event.IP),
+							html.If(event.RequestID != "",
+								html.Div(
+									attr.Class("font-mono break-all"),
+									escapedText(event.RequestID),
+								),
+							),
+						),
+					)
+				}),
+			),
+		),
+	)
+}
+
+// auditChanges renders the changed fields of an event, sorted by name, as
+// "field: before → after"
+func auditChanges(changes map[string]models.AuditChange) html.Node {
+	fields := make([]string, 0, len(changes))
+	for field := range changes {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+
+	items := []any{attr.Class("flex flex-col gap-1 text-xs")}
+	for _, field := range fields {
+		change := changes[field]
+		items = append(items, html.Div(
+			html.Span(attr.Class("font-medium"), escapedText(field+": ")),
+			html.Span(
+				attr.Class("text-muted-foreground"),
+				escapedText(formatAuditValue(change.Before)+" → "+formatAuditValue(change.After)),
+			),
+		))
+	}
+	return html.Div(items...)
+}
+
+// formatAuditValue formats a recorded value, missing ones as a dash
+func formatAuditValue(value any) string {
+	if value == nil || value == "" {
+		return "—"
+	}
+	return fmt.Sprint(value)
+}
+
+// auditPagination links to the older events, keeping the filters in query
+func auditPagination(path string, query url.Values, nextBefore int64) html.Node {
+	if nextBefore == 0 {
+		return html.Group()
+	}
+	query.Set("before", strconv.FormatInt(nextBefore, 10))
+	return ui.CardFooter(
+		html.A(
+			attr.Href(gohtml.EscapeString(path+"?"+query.Encode())),
+			attr.Class("btn-outline"),
+			html.Text("Older activity"),
+		),
+	)
+}
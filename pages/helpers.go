@@ -0,0 +1,61 @@
+package pages
+
+import (
+	gohtml "html"
+	"net/http"
+	"strings"
+
+	"github.com/frenchsoftware/libhtml/attr"
+	"github.com/frenchsoftware/libhtml/html"
+	"github.com/hyperstitieux/template/auth"
+	"github.com/hyperstitieux/template/views"
+)
+
+// escapedText renders untrusted content (URLs, upstream error messages) as escaped text.
+// html.Text writes its content verbatim, which is only safe for strings we control.
+func escapedText(content string) html.Node {
+	return html.Text(gohtml.EscapeString(content))
+}
+
+// disabledIf disables a form control when the condition is true.
+// Attributes can't go through html.If, which only keeps nodes.
+func disabledIf(condition bool) html.Attribute {
+	if condition {
+		return attr.Disabled("true")
+	}
+	return nil
+}
+
+// checkedIf checks a checkbox when the condition is true
+func checkedIf(condition bool) html.Attribute {
+	if condition {
+		return attr.Checked("true")
+	}
+	return nil
+}
+
+// selectedIf selects an option when the condition is true
+func selectedIf(condition bool) html.Attribute {
+	if condition {
+		return attr.Selected("true")
+	}
+	return nil
+}
+
+// capitalize uppercases the first letter of a lowercase identifier
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// form renders a form carrying the CSRF token of the request, which the CSRF
+// middleware checks on every POST. Pages build all their forms with it.
+func form(r *http.Request, items ...any) html.Node {
+	return html.Form(append(items, html.Input(
+		attr.Type("hidden"),
+		attr.Name(auth.CSRFFieldName),
+		attr.Value(views.CSRFToken(r)),
+	))...)
+}
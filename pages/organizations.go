@@ -0,0 +1,496 @@
+package pages
+
+import (
+	"fmt"
+	gohtml "html"
+	"net/http"
+
+	"github.com/frenchsoftware/libhtml/attr"
+	"github.com/frenchsoftware/libhtml/html"
+	"github.com/frenchsoftware/libvalidator/validator"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/views"
+	"github.com/hyperstitieux/template/views/components/ui"
+	"github.com/hyperstitieux/template/views/layouts"
+)
+
+// OrganizationProps holds everything shown on an organization's page
+type OrganizationProps struct {
+	Organization *models.Organization
+	Role         string // Role of the user, which decides the actions offered
+	UserID       int64
+	Members      []*models.Membership
+	Invitations  []*models.Invitation // Pending invitations, only shown to admins
+	Sites        []*models.Site
+	Errors       validator.ValidationErrors
+}
+
+// NewOrganization renders the form creating an organization
+func NewOrganization(w http.ResponseWriter, r *http.Request, errs validator.ValidationErrors) error {
+	page := layouts.Base(views.GetUser(r), r, "New Organization - Internet Publishing",
+		html.Div(
+			attr.Class("max-w-2xl mx-auto px-8 py-8"),
+
+			// Page header
+			html.Div(
+				attr.Class("mb-8"),
+				html.H1(
+					attr.Class("text-3xl font-semibold mb-2"),
+					html.Text("Create Organization"),
+				),
+				html.P(
+					attr.Class("text-muted-foreground"),
+					html.Text("Manage sites together with your team, each member with their own account"),
+				),
+			),
+
+			form(r,
+				attr.Action("/orgs"),
+				attr.Method("POST"),
+
+				ui.Card(
+					ui.CardSection(
+						html.Div(
+							attr.Class("flex flex-col gap-2"),
+							html.Label(
+								attr.For("name"),
+								attr.Class("text-sm font-medium"),
+								html.Text("Name"),
+							),
+							html.Input(
+								attr.Type("text"),
+								attr.Id("name"),
+								attr.Name("name"),
+								attr.Required("true"),
+								attr.Maxlength("50"),
+								attr.Placeholder("Acme"),
+								attr.ClassIfElse(errs != nil && errs.Has("name"), "input border-destructive focus:ring-destructive", "input"),
+							),
+							fieldError(errs, "name"),
+						),
+						html.Div(
+							attr.Class("flex flex-col gap-2"),
+							html.Label(
+								attr.For("slug"),
+								attr.Class("text-sm font-medium"),
+								html.Text("Slug"),
+							),
+							html.Input(
+								attr.Type("text"),
+								attr.Id("slug"),
+								attr.Name("slug"),
+								attr.Required("true"),
+								attr.Pattern("[a-z0-9-]+"),
+								attr.Placeholder("acme"),
+								attr.ClassIfElse(errs != nil && errs.Has("slug"), "input border-destructive focus:ring-destructive", "input"),
+							),
+							html.P(
+								attr.Class("text-xs text-muted-foreground"),
+								html.Text("Lowercase letters, numbers, and hyphens only"),
+							),
+							fieldError(errs, "slug"),
+						),
+					),
+
+					ui.CardFooter(
+						html.Div(
+							attr.Class("flex gap-2"),
+							html.A(
+								attr.Href("/sites"),
+								attr.Class("btn-outline"),
+								html.Text("Cancel"),
+							),
+							html.Button(
+								attr.Type("submit"),
+								attr.Class("btn-primary"),
+								html.Text("Create Organization"),
+							),
+						),
+					),
+				),
+			),
+		),
+	)
+
+	// Render page
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return page.Render(w)
+}
+
+// Organization renders an organization with its members and sites. Admins manage
+// members and invitations, owners delete the organization.
+func Organization(w http.ResponseWriter, r *http.Request, props OrganizationProps) error {
+	org := props.Organization
+	errs := props.Errors
+	canManage := models.RoleAtLeast(props.Role, models.RoleAdmin)
+
+	page := layouts.Base(views.GetUser(r), r, gohtml.EscapeString(org.Name)+" - Internet Publishing",
+		html.Div(
+			attr.Class("max-w-4xl mx-auto px-8 py-8"),
+
+			// Page header
+			html.Div(
+				attr.Class("flex items-center justify-between mb-8"),
+				html.Div(
+					html.H1(
+						attr.Class("text-3xl font-semibold mb-2"),
+						escapedText(org.Name),
+					),
+					html.P(
+						attr.Class("text-muted-foreground"),
+						escapedText(fmt.Sprintf("%s · You are %s", org.Slug, props.Role)),
+					),
+				),
+				html.If(canManage,
+					html.A(
+						attr.Href(fmt.Sprintf("/sites/new?organization_id=%d", org.ID)),
+						attr.Class("btn-primary"),
+						html.Text("+ New Site"),
+					),
+				),
+			),
+
+			html.Div(
+				attr.Class("flex flex-col gap-6"),
+
+				// Members card
+				html.Div(
+					attr.Id("members"),
+					ui.Card(
+						ui.CardHeader(ui.CardHeaderProps{
+							Title:       "Members",
+							Description: "Viewers see the sites, editors sync them, admins add sites and members, owners manage the organization",
+						}),
+						ui.CardSection(
+							fieldError(errs, "members"),
+							membersList(r, props),
+							html.If(canManage, invitationsList(r, org, props.Invitations)),
+							html.If(canManage, inviteForm(r, org, props.Role, errs)),
+						),
+					),
+				),
+
+				// Sites card
+				ui.Card(
+					ui.CardHeader(ui.CardHeaderProps{
+						Title:       "Sites",
+						Description: "Sites owned by the organization",
+					}),
+					ui.CardSection(
+						organizationSites(org, props.Sites),
+					),
+				),
+
+				// Leaving, or deleting the organization for owners
+				ui.Card(
+					ui.CardHeader(ui.CardHeaderProps{
+						Title:       "Danger Zone",
+						Description: "Leaving or deleting the organization",
+					}),
+					ui.CardSection(
+						html.Div(
+							attr.Class("flex gap-2"),
+							form(r,
+								attr.Action(fmt.Sprintf("/orgs/%d/members/%d/delete", org.ID, props.UserID)),
+								attr.Method("POST"),
+								html.Button(
+									attr.Type("submit"),
+									attr.Class("btn-outline"),
+									html.Attr("onclick", "return confirm('Leave this organization?')"),
+									html.Text("Leave organization"),
+								),
+							),
+							html.If(props.Role == models.RoleOwner,
+								form(r,
+									attr.Action(fmt.Sprintf("/orgs/%d/delete", org.ID)),
+									attr.Method("POST"),
+									html.Button(
+										attr.Type("submit"),
+										attr.Class("btn-destructive"),
+										html.Attr("onclick", "return confirm('Delete this organization and all its sites? This cannot be undone.')"),
+										html.Text("Delete organization"),
+									),
+								),
+							),
+						),
+					),
+				),
+			),
+		),
+	)
+
+	// Render page
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return page.Render(w)
+}
+
+// membersList lists the members of an organization. Admins change their roles and
+// remove them, only owners touch the owners.
+func membersList(r *http.Request, props OrganizationProps) html.Node {
+	org := props.Organization
+	rows := []any{attr.Class("flex flex-col divide-y divide-border")}
+	for _, member := range props.Members {
+		canEdit := models.RoleAtLeast(props.Role, models.RoleAdmin) && member.UserID != props.UserID &&
+			(member.Role != models.RoleOwner || props.Role == models.RoleOwner)
+
+		rows = append(rows, html.Div(
+			attr.Class("flex items-center justify-between gap-3 py-3"),
+			html.Div(
+				html.P(
+					attr.Class("text-sm font-medium"),
+					escapedText(member.Name),
+				),
+				html.P(
+					attr.Class("text-xs text-muted-foreground"),
+					escapedText(member.Email),
+				),
+			),
+			html.IfElse(canEdit,
+				html.Div(
+					attr.Class("flex items-center gap-2"),
+					form(r,
+						attr.Action(fmt.Sprintf("/orgs/%d/members/%d/role", org.ID, member.UserID)),
+						attr.Method("POST"),
+						roleSelect(member.Role, props.Role, true),
+					),
+					form(r,
+						attr.Action(fmt.Sprintf("/orgs/%d/members/%d/delete", org.ID, member.UserID)),
+						attr.Method("POST"),
+						html.Button(
+							attr.Type("submit"),
+							attr.Class("btn-outline btn-sm"),
+							html.Text("Remove"),
+						),
+					),
+				),
+				html.Span(
+					attr.Class("text-sm text-muted-foreground"),
+					html.Text(capitalize(member.Role)),
+				),
+			),
+		))
+	}
+	return html.Div(rows...)
+}
+
+// invitationsList lists the pending invitations of an organization, each of which
+// can be revoked
+func invitationsList(r *http.Request, org *models.Organization, invitations []*models.Invitation) html.Node {
+	if len(invitations) == 0 {
+		return html.Group()
+	}
+
+	rows := []any{attr.Class("flex flex-col divide-y divide-border")}
+	for _, invitation := range invitations {
+		rows = append(rows, html.Div(
+			attr.Class("flex items-center justify-between gap-3 py-3"),
+			html.Div(
+				html.P(
+					attr.Class("text-sm font-medium"),
+					escapedText(invitation.Email),
+				),
+				html.P(
+					attr.Class("text-xs text-muted-foreground"),
+					html.Text(fmt.Sprintf("Invited as %s · Expires %s", invitation.Role, invitation.ExpiresAt.Format("Jan 2, 2006"))),
+				),
+			),
+			form(r,
+				attr.Action(fmt.Sprintf("/orgs/%d/invitations/%d/delete", org.ID, invitation.ID)),
+				attr.Method("POST"),
+				html.Button(
+					attr.Type("submit"),
+					attr.Class("btn-outline btn-sm"),
+					html.Text("Revoke"),
+				),
+			),
+		))
+	}
+
+	return html.Div(
+		attr.Class("flex flex-col gap-2"),
+		html.H3(
+			attr.Class("text-sm font-medium"),
+			html.Text("Pending invitations"),
+		),
+		html.Div(rows...),
+	)
+}
+
+// inviteForm emails an invitation to join the organization
+func inviteForm(r *http.Request, org *models.Organization, role string, errs validator.ValidationErrors) html.Node {
+	return form(r,
+		attr.Action(fmt.Sprintf("/orgs/%d/invitations", org.ID)),
+		attr.Method("POST"),
+		attr.Class("flex flex-col gap-4"),
+		html.Div(
+			attr.Class("flex flex-col gap-2"),
+			html.Label(
+				attr.For("email"),
+				attr.Class("text-sm font-medium"),
+				html.Text("Invite by email"),
+			),
+			html.Input(
+				attr.Type("email"),
+				attr.Id("email"),
+				attr.Name("email"),
+				attr.Required("true"),
+				attr.Placeholder("teammate@example.com"),
+				attr.ClassIfElse(errs != nil && errs.Has("email"), "input border-destructive focus:ring-destructive", "input"),
+			),
+			fieldError(errs, "email"),
+		),
+		html.Div(
+			attr.Class("flex flex-col gap-2"),
+			html.Label(
+				attr.For("invite-role"),
+				attr.Class("text-sm font-medium"),
+				html.Text("Role"),
+			),
+			roleSelect(models.RoleEditor, role, false),
+			fieldError(errs, "role"),
+		),
+		html.Div(
+			html.Button(
+				attr.Type("submit"),
+				attr.Class("btn-outline"),
+				html.Text("Send invitation"),
+			),
+		),
+	)
+}
+
+// roleSelect picks a role, offering owner only to owners. Member roles are saved as
+// soon as they're picked.
+func roleSelect(selected, userRole string, saveOnChange bool) html.Node {
+	items := []any{attr.Name("role"), attr.Class("select")}
+	if saveOnChange {
+		items = append(items, html.Attr("onchange", "this.form.submit()"))
+	} else {
+		items = append(items, attr.Id("invite-role"))
+	}
+	for _, role := range models.Roles {
+		if role == models.RoleOwner && userRole != models.RoleOwner {
+			continue
+		}
+		items = append(items, html.Option(
+			attr.Value(role),
+			selectedIf(role == selected),
+			html.Text(capitalize(role)),
+		))
+	}
+	return html.Select(items...)
+}
+
+// organizationSites lists the sites of an organization with links to their dashboard
+func organizationSites(org *models.Organization, sites []*models.Site) html.Node {
+	if len(sites) == 0 {
+		return html.P(
+			attr.Class("text-sm text-muted-foreground"),
+			html.Text("The organization has no sites yet"),
+		)
+	}
+
+	rows := []any{attr.Class("flex flex-col divide-y divide-border")}
+	for _, site := range sites {
+		rows = append(rows, html.Div(
+			attr.Class("flex items-center justify-between gap-3 py-3"),
+			html.Div(
+				html.P(
+					attr.Class("text-sm font-medium"),
+					escapedText(site.Slug),
+				),
+				html.P(
+					attr.Class("text-xs text-muted-foreground"),
+					escapedText(site.GithubRepo+" · "+site.GithubBranch),
+				),
+			),
+			html.A(
+				attr.Href(fmt.Sprintf("/sites/%d", site.ID)),
+				attr.Class("btn-outline btn-sm"),
+				html.Text("Open"),
+			),
+		))
+	}
+	return html.Div(rows...)
+}
+
+// organizationsList links to the organizations of the user on the sites page
+func organizationsList(organizations []*models.Organization) html.Node {
+	links := []any{attr.Class("flex flex-wrap items-center gap-2 mb-8")}
+	links = append(links, html.Span(
+		attr.Class("text-sm text-muted-foreground"),
+		html.Text("Organizations:"),
+	))
+	for _, org := range organizations {
+		links = append(links, html.A(
+			attr.Href(fmt.Sprintf("/orgs/%d", org.ID)),
+			attr.Class("btn-outline btn-sm"),
+			escapedText(org.Name),
+		))
+	}
+	links = append(links, html.A(
+		attr.Href("/orgs/new"),
+		attr.Class("btn-sm-ghost"),
+		html.Text("+ New organization"),
+	))
+	return html.Div(links...)
+}
+
+// siteOwnerField picks whether a new site belongs to the user or one of their
+// organizations
+func siteOwnerField(organizations []*models.Organization, selected int64, errs validator.ValidationErrors) html.Node {
+	options := []any{attr.Id("organization_id"), attr.Name("organization_id"), attr.Class("select")}
+	options = append(options, html.Option(
+		attr.Value("0"),
+		selectedIf(selected == 0),
+		html.Text("Personal"),
+	))
+	for _, org := range organizations {
+		options = append(options, html.Option(
+			attr.Value(fmt.Sprint(org.ID)),
+			selectedIf(org.ID == selected),
+			escapedText(org.Name),
+		))
+	}
+
+	return html.Div(
+		attr.Class("flex flex-col gap-2"),
+		html.Label(
+			attr.For("organization_id"),
+			attr.Class("text-sm font-medium"),
+			html.Text("Owner"),
+		),
+		html.Select(options...),
+		fieldError(errs, "organization_id"),
+	)
+}
+
+// Invitation asks to accept an invitation to join an organization
+func Invitation(w http.ResponseWriter, r *http.Request, invitation *models.Invitation, org *models.Organization, token string) error {
+	page := layouts.Base(views.GetUser(r), r, "Invitation - Internet Publishing",
+		html.Div(
+			attr.Class("max-w-sm mx-auto px-8 py-16"),
+			form(r,
+				attr.Action("/invitations/"+gohtml.EscapeString(token)),
+				attr.Method("POST"),
+				ui.Card(
+					ui.CardHeader(ui.CardHeaderProps{
+						Title:       "Join " + gohtml.EscapeString(org.Name),
+						Description: gohtml.EscapeString(fmt.Sprintf("%s was invited as %s", invitation.Email, invitation.Role)),
+					}),
+					ui.CardFooter(
+						html.Button(
+							attr.Type("submit"),
+							attr.Class("btn-primary w-full"),
+							html.Text("Accept invitation"),
+						),
+					),
+				),
+			),
+		),
+	)
+
+	// Render page
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return page.Render(w)
+}
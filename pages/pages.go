@@ -2,6 +2,7 @@ package pages
 
 import (
 	"fmt"
+	gohtml "html"
 	"net/http"
 
 	"github.com/frenchsoftware/libhtml/attr"
@@ -9,6 +10,8 @@ import (
 	"github.com/frenchsoftware/libvalidator/validator"
 	"github.com/hyperstitieux/template/auth"
 	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/github"
+	"github.com/hyperstitieux/template/quota"
 	"github.com/hyperstitieux/template/views"
 	"github.com/hyperstitieux/template/views/components/ui"
 	"github.com/hyperstitieux/template/views/layouts"
@@ -26,18 +29,33 @@ func Home(w http.ResponseWriter, r *http.Request) error {
 	return page.Render(w)
 }
 
-func Settings(w http.ResponseWriter, r *http.Request) error {
-	return SettingsWithErrors(w, r, nil)
+// SettingsProps holds everything shown on the settings page
+type SettingsProps struct {
+	Errors     validator.ValidationErrors
+	Providers  []SignInProvider
+	Identities []*models.UserIdentity
+	Passkeys   []*models.Passkey
+
+	TOTPEnabled       bool // Whether an authenticator app is set up
+	RecoveryCodesLeft int
+
+	Sessions         []*models.Session
+	CurrentSessionID int64 // Session of this request, which can't be revoked from the list
+
+	APITokens []*models.APIToken
+
+	Usage *quota.Report // What the user used of the limits of their plan
 }
 
-func SettingsWithErrors(w http.ResponseWriter, r *http.Request, errs validator.ValidationErrors) error {
+func Settings(w http.ResponseWriter, r *http.Request, props SettingsProps) error {
 	// Get authenticated user from context (required for settings page)
 	user := views.GetUser(r)
 	if user == nil {
-		// Redirect to OAuth with return URL
-		http.Redirect(w, r, "/auth/google?redirect=/settings", http.StatusTemporaryRedirect)
+		// Redirect to sign in with return URL
+		http.Redirect(w, r, "/sign-in?redirect=/settings", http.StatusTemporaryRedirect)
 		return nil
 	}
+	errs := props.Errors
 
 	// Build page
 	page := layouts.Base(user, r, "Settings - Internet Publishing",
@@ -63,7 +81,7 @@ func SettingsWithErrors(w http.ResponseWriter, r *http.Request, errs validator.V
 				attr.Class("flex flex-col gap-6"),
 
 				// General settings form
-				html.Form(
+				form(r,
 					attr.Id("profile-form"),
 					attr.Action("/settings/update-profile"),
 					attr.Method("POST"),
@@ -86,7 +104,7 @@ func SettingsWithErrors(w http.ResponseWriter, r *http.Request, errs validator.V
 									attr.Type("email"),
 									attr.Id("email"),
 									attr.Name("email"),
-									attr.Value(user.Email),
+									attr.Value(gohtml.EscapeString(user.Email)),
 									attr.Readonly("true"),
 									attr.Class("input bg-muted text-muted-foreground cursor-not-allowed"),
 								),
@@ -108,7 +126,7 @@ func SettingsWithErrors(w http.ResponseWriter, r *http.Request, errs validator.V
 									attr.Type("text"),
 									attr.Id("name"),
 									attr.Name("name"),
-									attr.Value(user.Name),
+									attr.Value(gohtml.EscapeString(user.Name)),
 									attr.Required("true"),
 									attr.Maxlength("80"),
 									attr.ClassIfElse(errs != nil && errs.Has("name"), "input border-destructive focus:ring-destructive", "input"),
@@ -131,6 +149,41 @@ func SettingsWithErrors(w http.ResponseWriter, r *http.Request, errs validator.V
 					),
 				),
 
+				// Limits of the plan and usage
+				html.IfExec(props.Usage != nil, func() html.Node {
+					return usageCard(props.Usage, fmt.Sprintf("Your limits on the %s plan. Sites you create for organizations count for you. Sites going over their monthly bandwidth are off until the next month.", props.Usage.Plan.Name))
+				}),
+
+				// Sign-in providers linked to the account
+				connectedAccounts(r, props.Providers, props.Identities),
+
+				// Passkeys, to sign in and as a second factor
+				passkeysCard(r, props.Passkeys),
+
+				// Authenticator app, as a second factor
+				authenticatorCard(props.TOTPEnabled, props.RecoveryCodesLeft),
+
+				// Where the account is signed in
+				sessionsCard(r, props.Sessions, props.CurrentSessionID),
+
+				// Personal access tokens for the API
+				apiTokensCard(r, props.APITokens, errs),
+
+				// Audit log of the account
+				ui.Card(
+					ui.CardHeader(ui.CardHeaderProps{
+						Title:       "Activity",
+						Description: "Sign-ins and changes made to your account and sites, with where they came from",
+					}),
+					ui.CardFooter(
+						html.A(
+							attr.Href("/settings/audit"),
+							attr.Class("btn-outline"),
+							html.Text("View activity"),
+						),
+					),
+				),
+
 				// Danger zone card
 				ui.Card(
 					ui.CardHeader(ui.CardHeaderProps{
@@ -160,6 +213,7 @@ func SettingsWithErrors(w http.ResponseWriter, r *http.Request, errs validator.V
 								),
 							),
 						),
+						fieldError(errs, "delete_account"),
 					),
 				),
 			),
@@ -178,7 +232,7 @@ func SettingsWithErrors(w http.ResponseWriter, r *http.Request, errs validator.V
 					html.Attr("onclick", "this.closest('dialog').close()"),
 					html.Text("Cancel"),
 				),
-				html.Form(
+				form(r,
 					attr.Action("/settings/delete-account"),
 					attr.Method("POST"),
 					attr.Class("inline"),
@@ -197,9 +251,18 @@ func SettingsWithErrors(w http.ResponseWriter, r *http.Request, errs validator.V
 	return page.Render(w)
 }
 
-func Sites(w http.ResponseWriter, r *http.Request, sites []*models.Site) error {
+// Sites lists the personal sites of the user and the sites of their organizations,
+// after the transfers of sites waiting for their answer
+func Sites(w http.ResponseWriter, r *http.Request, sites []*models.Site, organizations []*models.Organization, transfers []*models.SiteTransfer) error {
 	user := views.GetUser(r)
 
+	// Sites of organizations are labelled with the organization, and can only be
+	// deleted by its admins
+	organizationsByID := make(map[int64]*models.Organization, len(organizations))
+	for _, org := range organizations {
+		organizationsByID[org.ID] = org
+	}
+
 	// Build page
 	page := layouts.Base(user, r, "My Sites - Internet Publishing",
 		html.Div(
@@ -225,6 +288,12 @@ func Sites(w http.ResponseWriter, r *http.Request, sites []*models.Site) error {
 				),
 			),
 
+			// Organizations the user is a member of
+			organizationsList(organizations),
+
+			// Sites offered to the user or their organizations
+			html.If(len(transfers) > 0, incomingTransfers(r, transfers)),
+
 			// Sites grid or empty state
 			html.If(len(sites) == 0,
 				// Empty state
@@ -252,6 +321,11 @@ func Sites(w http.ResponseWriter, r *http.Request, sites []*models.Site) error {
 					var siteCards []any
 					siteCards = append(siteCards, attr.Class("grid grid-cols-1 md:grid-cols-2 lg:grid-cols-3 gap-6"))
 					for _, site := range sites {
+						var org *models.Organization
+						if site.OrganizationID != nil {
+							org = organizationsByID[*site.OrganizationID]
+						}
+						canDelete := org == nil || models.RoleAtLeast(org.Role, models.RoleAdmin)
 						siteCards = append(siteCards, ui.Card(
 							ui.CardHeader(ui.CardHeaderProps{
 								Title:       site.Slug,
@@ -260,6 +334,19 @@ func Sites(w http.ResponseWriter, r *http.Request, sites []*models.Site) error {
 							ui.CardSection(
 								html.Div(
 									attr.Class("flex flex-col gap-2 text-sm"),
+									html.IfExec(org != nil, func() html.Node {
+										return html.Div(
+											attr.Class("flex items-center gap-2 text-muted-foreground"),
+											html.Span(
+												html.Text("Organization: "),
+											),
+											html.A(
+												attr.Href(fmt.Sprintf("/orgs/%d", org.ID)),
+												attr.Class("underline"),
+												escapedText(org.Name),
+											),
+										)
+									}),
 									html.Div(
 										attr.Class("flex items-center gap-2 text-muted-foreground"),
 										html.Span(
@@ -267,7 +354,7 @@ func Sites(w http.ResponseWriter, r *http.Request, sites []*models.Site) error {
 										),
 										html.Span(
 											attr.Class("font-mono text-xs bg-muted px-2 py-1 rounded"),
-											html.Text(site.GithubBranch),
+											escapedText(site.GithubBranch),
 										),
 									),
 									html.If(site.Subdirectory != "",
@@ -278,7 +365,7 @@ func Sites(w http.ResponseWriter, r *http.Request, sites []*models.Site) error {
 											),
 											html.Span(
 												attr.Class("font-mono text-xs bg-muted px-2 py-1 rounded"),
-												html.Text(site.Subdirectory),
+												escapedText(site.Subdirectory),
 											),
 										),
 									),
@@ -297,9 +384,15 @@ func Sites(w http.ResponseWriter, r *http.Request, sites []*models.Site) error {
 										attr.Class("btn-primary text-sm"),
 										html.Text("View Site →"),
 									),
+									html.A(
+										attr.Href(fmt.Sprintf("/sites/%d", site.ID)),
+										attr.Class("btn-outline text-sm"),
+										html.Text("Logs"),
+									),
 									html.Button(
 										attr.Type("button"),
 										attr.Class("btn-outline text-sm"),
+										disabledIf(!canDelete),
 										html.Attr("onclick", fmt.Sprintf("if(confirm('Delete %s?')) fetch('/sites/%d/delete', {method: 'POST'}).then(() => location.reload())", site.Slug, site.ID)),
 										html.Text("Delete"),
 									),
@@ -318,8 +411,18 @@ func Sites(w http.ResponseWriter, r *http.Request, sites []*models.Site) error {
 	return page.Render(w)
 }
 
-func NewSite(w http.ResponseWriter, r *http.Request, errs validator.ValidationErrors) error {
+// NewSiteProps holds everything shown on the new site form
+type NewSiteProps struct {
+	Errors          validator.ValidationErrors
+	GitHubConnected bool                   // Whether the user linked a GitHub account
+	Repositories    []*github.Repository   // Repositories offered in the picker
+	Organizations   []*models.Organization // Organizations the user may create sites for
+	OrganizationID  int64                  // Organization picked as owner, 0 for the user
+}
+
+func NewSite(w http.ResponseWriter, r *http.Request, props NewSiteProps) error {
 	user := views.GetUser(r)
+	errs := props.Errors
 
 	// Build page
 	page := layouts.Base(user, r, "New Site - Internet Publishing",
@@ -339,13 +442,27 @@ func NewSite(w http.ResponseWriter, r *http.Request, errs validator.ValidationEr
 				),
 			),
 
+			// Plan limit reached
+			html.IfExec(errs != nil && errs.Has("quota"), func() html.Node {
+				return html.Div(
+					attr.Class("alert-destructive mb-6"),
+					html.H2(html.Text("You can't create another site")),
+					html.Section(html.Text(errs.Get("quota"))),
+				)
+			}),
+
 			// Form
-			html.Form(
+			form(r,
 				attr.Action("/sites/create"),
 				attr.Method("POST"),
 
 				ui.Card(
 					ui.CardSection(
+						// Owner field, only offered to admins of organizations
+						html.If(len(props.Organizations) > 0 || errs != nil && errs.Has("organization_id"),
+							siteOwnerField(props.Organizations, props.OrganizationID, errs),
+						),
+
 						// Slug field
 						html.Div(
 							attr.Class("flex flex-col gap-2"),
@@ -397,12 +514,28 @@ func NewSite(w http.ResponseWriter, r *http.Request, errs validator.ValidationEr
 								attr.Required("true"),
 								attr.Placeholder("username/repository"),
 								attr.Pattern("[a-zA-Z0-9_.-]+/[a-zA-Z0-9_.-]+"),
+								html.Attr("list", "github-repos"),
+								html.Attr("autocomplete", "off"),
+								// Picking one of the user's repositories fills in its default branch
+								html.Attr("oninput", "const o = document.querySelector('#github-repos option[value=\"' + CSS.escape(this.value) + '\"]'); if (o) document.getElementById('github_branch').value = o.dataset.branch"),
 								attr.ClassIfElse(errs != nil && errs.Has("github_repo"), "input border-destructive focus:ring-destructive", "input"),
 							),
+							repositoryOptions(props.Repositories),
 							html.P(
 								attr.Class("text-xs text-muted-foreground"),
 								html.Text("Must be a public repository (e.g., octocat/Hello-World)"),
 							),
+							html.If(!props.GitHubConnected,
+								html.P(
+									attr.Class("text-xs text-muted-foreground"),
+									html.A(
+										attr.Href("/auth/github?redirect=/sites/new"),
+										attr.Class("underline"),
+										html.Text("Connect GitHub"),
+									),
+									html.Text(" to pick from your repositories"),
+								),
+							),
 							html.If(errs != nil && errs.Has("github_repo"),
 								html.P(
 									attr.Class("text-xs text-destructive"),
@@ -425,12 +558,18 @@ func NewSite(w http.ResponseWriter, r *http.Request, errs validator.ValidationEr
 								attr.Name("github_branch"),
 								attr.Value("main"),
 								attr.Required("true"),
-								attr.Class("input"),
+								attr.ClassIfElse(errs != nil && errs.Has("github_branch"), "input border-destructive focus:ring-destructive", "input"),
 							),
 							html.P(
 								attr.Class("text-xs text-muted-foreground"),
 								html.Text("Branch to publish from (usually 'main' or 'master')"),
 							),
+							html.If(errs != nil && errs.Has("github_branch"),
+								html.P(
+									attr.Class("text-xs text-destructive"),
+									html.Text(errs.Get("github_branch")),
+								),
+							),
 						),
 
 						// Subdirectory field (optional)
@@ -446,12 +585,18 @@ func NewSite(w http.ResponseWriter, r *http.Request, errs validator.ValidationEr
 								attr.Id("subdirectory"),
 								attr.Name("subdirectory"),
 								attr.Placeholder("docs"),
-								attr.Class("input"),
+								attr.ClassIfElse(errs != nil && errs.Has("subdirectory"), "input border-destructive focus:ring-destructive", "input"),
 							),
 							html.P(
 								attr.Class("text-xs text-muted-foreground"),
 								html.Text("Only publish files from this subdirectory (e.g., 'docs', 'content/posts')"),
 							),
+							html.If(errs != nil && errs.Has("subdirectory"),
+								html.P(
+									attr.Class("text-xs text-destructive"),
+									html.Text(errs.Get("subdirectory")),
+								),
+							),
 						),
 					),
 
@@ -480,30 +625,141 @@ func NewSite(w http.ResponseWriter, r *http.Request, errs validator.ValidationEr
 	return page.Render(w)
 }
 
-func PublicSite(w http.ResponseWriter, r *http.Request, site *models.Site, htmlContent string) error {
-	// Build simple public page
-	page := html.Html(
-		html.Head(
-			html.Meta(attr.Charset("utf-8")),
-			html.Meta(attr.Name("viewport"), attr.Content("width=device-width, initial-scale=1")),
-			html.Title(html.Text(fmt.Sprintf("%s - %s", site.Slug, site.GithubRepo))),
-			html.Link(attr.Rel("stylesheet"), attr.Href("https://cdn.jsdelivr.net/npm/@picocss/pico@2/css/pico.min.css")),
-			html.Style(
-				html.Text(`
+// CSRFError explains that a form was refused because its CSRF token didn't match,
+// which mostly happens to pages left open across a browser restart
+func CSRFError(w http.ResponseWriter, r *http.Request) error {
+	page := layouts.Base(views.GetUser(r), r, "Page expired - Internet Publishing",
+		html.Div(
+			attr.Class("max-w-sm mx-auto px-8 py-16"),
+			ui.Card(
+				ui.CardHeader(ui.CardHeaderProps{
+					Title:       "This page expired",
+					Description: "Nothing was changed. For your safety, forms only work from a page freshly loaded from this site.",
+				}),
+				ui.CardSection(
+					html.P(
+						attr.Class("text-sm"),
+						html.Text("Go back, reload the page and try again. If you didn't submit anything, another site may have tried to act on your behalf and you can ignore this page."),
+					),
+				),
+				ui.CardFooter(
+					html.A(
+						attr.Href("/"),
+						attr.Class("btn-primary"),
+						html.Text("Go home"),
+					),
+				),
+			),
+		),
+	)
+
+	// Render page
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+	return page.Render(w)
+}
+
+// liveScript keeps a public page subscribed to the updates of its site. Updated pages
+// are fetched again and their content swapped in place, or reloaded if that fails.
+// Sites are served from their own subdomain, where the script files of the dashboard
+// aren't, so it is inlined.
+const liveScript = `(function () {
+  var delay = 1000;
+  function connect() {
+    var scheme = location.protocol === "https:" ? "wss://" : "ws://";
+    var ws = new WebSocket(scheme + location.host + "/__live?path=" + encodeURIComponent(location.pathname));
+    ws.onopen = function () { delay = 1000; };
+    ws.onmessage = function () { update(); };
+    ws.onclose = function () {
+      setTimeout(connect, delay + Math.random() * 1000);
+      delay = Math.min(delay * 2, 60000);
+    };
+  }
+  function update() {
+    fetch(location.href, { cache: "no-store" })
+      .then(function (response) {
+        if (!response.ok) throw new Error(response.statusText);
+        return response.text();
+      })
+      .then(function (text) {
+        var page = new DOMParser().parseFromString(text, "text/html");
+        var main = page.querySelector("main");
+        if (!main) throw new Error("no content");
+        document.querySelector("main").replaceWith(main);
+        document.title = page.title;
+      })
+      .catch(function () { location.reload(); });
+  }
+  connect();
+})();`
+
+// PublicSite renders a page of a site, which updates itself when the site is synced
+// with a new commit
+func PublicSite(w http.ResponseWriter, r *http.Request, site *models.Site, htmlContent, reportURL string) error {
+	// Visitors report abuse from the footer of every page
+	footer := html.Footer(
+		html.Small(
+			html.A(
+				attr.Href(gohtml.EscapeString(reportURL)),
+				attr.Rel("nofollow"),
+				html.Text("Report this site"),
+			),
+		),
+	)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return publicSitePage(site, htmlContent, footer,
+		html.Script(html.Raw(liveScript)),
+	).Render(w)
+}
+
+// SiteUnavailable answers the visitors of a site that isn't served anymore with the
+// status and explanation given
+func SiteUnavailable(w http.ResponseWriter, r *http.Request, site *models.Site, status int, message string) error {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	return publicSitePage(site, "<h1>"+http.StatusText(status)+"</h1><p>"+message+"</p>", html.Group()).Render(w)
+}
+
+// PreviewSite renders a page of a local folder like PublicSite. With hotReload, the
+// page loads the hot reload script to reload when the folder changes.
+func PreviewSite(w http.ResponseWriter, r *http.Request, site *models.Site, htmlContent string, hotReload bool) error {
+	var scripts []html.Node
+	if hotReload {
+		scripts = append(scripts, html.Script(attr.Src("/js/hotreload.js"), html.Attr("defer", "")))
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return publicSitePage(site, htmlContent, html.Group(), scripts...).Render(w)
+}
+
+// publicSitePage builds the layout of public sites around a rendered page and its footer
+func publicSitePage(site *models.Site, htmlContent string, footer html.Node, scripts ...html.Node) html.Node {
+	head := []any{
+		html.Meta(attr.Charset("utf-8")),
+		html.Meta(attr.Name("viewport"), attr.Content("width=device-width, initial-scale=1")),
+		html.Title(escapedText(fmt.Sprintf("%s - %s", site.Slug, site.GithubRepo))),
+		html.Link(attr.Rel("stylesheet"), attr.Href("https://cdn.jsdelivr.net/npm/@picocss/pico@2/css/pico.min.css")),
+		html.Style(
+			html.Text(`
 					body { padding: 2rem; }
 					main { max-width: 700px; margin: 0 auto; }
+					footer { max-width: 700px; margin: 2rem auto 0; text-align: center; }
 					pre { overflow-x: auto; }
 					code { font-size: 0.9em; }
 				`),
-			),
 		),
+	}
+	for _, script := range scripts {
+		head = append(head, script)
+	}
+
+	return html.Html(
+		html.Head(head...),
 		html.Body(
 			html.Main(
 				html.Raw(htmlContent),
 			),
+			footer,
 		),
 	)
-
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	return page.Render(w)
 }
@@ -0,0 +1,87 @@
+package pages
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hyperstitieux/template/auth"
+	"github.com/hyperstitieux/template/database/models"
+)
+
+func TestSettingsEscapesUser(t *testing.T) {
+	user := &models.User{
+		ID:    1,
+		Name:  `"><script>alert("name")</script>`,
+		Email: `"><script>alert("email")</script>@example.com`,
+	}
+	r := auth.SetCurrentUser(httptest.NewRequest("GET", "/settings", nil), user)
+	w := httptest.NewRecorder()
+
+	if err := Settings(w, r, SettingsProps{}); err != nil {
+		t.Fatal(err)
+	}
+
+	body := w.Body.String()
+	if strings.Contains(body, "<script>alert") {
+		t.Fatalf("settings renders user fields unescaped:\n%s", body)
+	}
+	for _, want := range []string{
+		`value="&#34;&gt;&lt;script&gt;alert(&#34;name&#34;)&lt;/script&gt;"`,
+		`value="&#34;&gt;&lt;script&gt;alert(&#34;email&#34;)&lt;/script&gt;@example.com"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("settings doesn't contain %s", want)
+		}
+	}
+}
+
+func TestSitesEscapeSource(t *testing.T) {
+	user := &models.User{ID: 1, Name: "Alice", Email: "alice@example.com"}
+	site := &models.Site{
+		ID:           1,
+		UserID:       1,
+		Slug:         "docs",
+		GithubRepo:   "alice/docs",
+		GithubBranch: `<script>alert("branch")</script>`,
+		Subdirectory: `<script>alert("subdirectory")</script>`,
+	}
+
+	tests := []struct {
+		name   string
+		render func(w *httptest.ResponseRecorder, r *http.Request) error
+	}{
+		{"sites", func(w *httptest.ResponseRecorder, r *http.Request) error {
+			return Sites(w, r, []*models.Site{site}, nil, nil)
+		}},
+		{"site", func(w *httptest.ResponseRecorder, r *http.Request) error {
+			return Site(w, r, SiteProps{Site: site, Role: models.RoleOwner, Analytics: &SiteAnalytics{From: "2026-01-01"}})
+		}},
+		// Organization members see the sites the others created
+		{"organization", func(w *httptest.ResponseRecorder, r *http.Request) error {
+			org := &models.Organization{ID: 1, Name: "Team", Slug: "team", Role: models.RoleViewer}
+			orgSite := *site
+			orgSite.UserID, orgSite.OrganizationID = 2, &org.ID
+			return Organization(w, r, OrganizationProps{Organization: org, Role: models.RoleViewer, UserID: user.ID, Sites: []*models.Site{&orgSite}})
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := auth.SetCurrentUser(httptest.NewRequest("GET", "/sites", nil), user)
+			w := httptest.NewRecorder()
+			if err := tt.render(w, r); err != nil {
+				t.Fatal(err)
+			}
+
+			body := w.Body.String()
+			if strings.Contains(body, "<script>alert") {
+				t.Fatalf("site source rendered unescaped:\n%s", body)
+			}
+			if !strings.Contains(body, "&lt;script&gt;alert(&#34;branch&#34;)") {
+				t.Errorf("branch missing from the page")
+			}
+		})
+	}
+}
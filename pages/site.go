@@ -0,0 +1,519 @@
+package pages
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/frenchsoftware/libhtml/attr"
+	"github.com/frenchsoftware/libhtml/html"
+	"github.com/frenchsoftware/libvalidator/validator"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/views"
+	"github.com/hyperstitieux/template/views/components/ui"
+	"github.com/hyperstitieux/template/views/layouts"
+)
+
+// SiteProps holds everything shown on a site's dashboard page
+type SiteProps struct {
+	Site        *models.Site
+	Role        string // Role of the user on the site, which decides the actions offered
+	Logs        []*models.SiteLog
+	Level       string // Log severity filter, empty for all
+	LinkCheck   *models.LinkCheck
+	BrokenLinks []*models.BrokenLink
+	Deployments []*models.Deployment // Most recent first
+	Analytics   *SiteAnalytics
+	Transfer    *models.SiteTransfer // Pending transfer, only set for who may cancel it
+	Errors      validator.ValidationErrors
+}
+
+func Site(w http.ResponseWriter, r *http.Request, props SiteProps) error {
+	user := views.GetUser(r)
+	site := props.Site
+	canWrite := models.RoleAtLeast(props.Role, models.RoleEditor)
+
+	// Build page
+	page := layouts.Base(user, r, site.Slug+" - Internet Publishing",
+		html.Div(
+			attr.Class("max-w-6xl mx-auto px-8 py-8"),
+
+			// Page header
+			html.Div(
+				attr.Class("flex items-center justify-between mb-8"),
+				html.Div(
+					html.H1(
+						attr.Class("text-3xl font-semibold mb-2"),
+						escapedText(site.Slug),
+					),
+					html.P(
+						attr.Class("text-muted-foreground"),
+						escapedText(fmt.Sprintf("%s · %s", site.GithubRepo, site.GithubBranch)),
+					),
+				),
+				html.A(
+					attr.Href(fmt.Sprintf("https://%s.internetpublishing.co", site.Slug)),
+					attr.Target("_blank"),
+					attr.Class("btn-primary"),
+					html.Text("View Site →"),
+				),
+			),
+
+			html.Div(
+				attr.Class("flex flex-col gap-6"),
+
+				// Suspension notice
+				html.IfExec(site.SuspendedAt != nil, func() html.Node {
+					return html.Div(
+						attr.Class("alert-destructive"),
+						html.H2(html.Text("This site is suspended")),
+						html.Section(escapedText("It is not served and cannot be synced. Reason given by the admins: "+site.SuspendedReason)),
+					)
+				}),
+
+				// Deployments card
+				html.Div(
+					attr.Id("deployments"),
+					ui.Card(
+						ui.CardHeader(ui.CardHeaderProps{
+							Title:       "Deployments",
+							Description: "Syncs of the site with its repository",
+						}),
+						ui.CardSection(
+							html.IfElse(len(props.Deployments) == 0,
+								html.P(
+									attr.Class("text-sm text-muted-foreground"),
+									html.Text("The site has not been synced yet"),
+								),
+								deploymentsTable(props.Deployments),
+							),
+						),
+						ui.CardFooter(
+							form(r,
+								attr.Action(fmt.Sprintf("/sites/%d/sync", site.ID)),
+								attr.Method("POST"),
+								html.Button(
+									attr.Type("submit"),
+									attr.Class("btn-outline"),
+									disabledIf(!canWrite || site.SuspendedAt != nil || len(props.Deployments) > 0 && props.Deployments[0].Status == models.DeploymentRunning),
+									html.Text("Sync now"),
+								),
+							),
+							fieldError(props.Errors, "sync"),
+						),
+					),
+				),
+
+				// Analytics card
+				siteAnalyticsCard(props.Analytics),
+
+				// Logs card
+				ui.Card(
+					ui.CardHeader(ui.CardHeaderProps{
+						Title:       "Logs",
+						Description: "Sync and render failures for this site",
+					}),
+					ui.CardSection(
+						siteLogFilters(site, props.Level),
+						html.IfElse(len(props.Logs) == 0,
+							html.P(
+								attr.Class("text-sm text-muted-foreground py-8 text-center"),
+								html.Text("No log entries"),
+							),
+							siteLogsTable(props.Logs),
+						),
+					),
+				),
+
+				// Broken links card
+				html.Div(
+					attr.Id("links"),
+					ui.Card(
+						ui.CardHeader(ui.CardHeaderProps{
+							Title:       "Broken Links",
+							Description: "Links, anchors and images that lead nowhere",
+						}),
+						ui.CardSection(
+							linkCheckSummary(props.LinkCheck, props.BrokenLinks),
+							html.If(len(props.BrokenLinks) > 0,
+								brokenLinksTable(props.BrokenLinks),
+							),
+						),
+						ui.CardFooter(
+							form(r,
+								attr.Action(fmt.Sprintf("/sites/%d/check-links", site.ID)),
+								attr.Method("POST"),
+								html.Button(
+									attr.Type("submit"),
+									attr.Class("btn-outline"),
+									disabledIf(!canWrite || props.LinkCheck != nil && props.LinkCheck.Status == models.LinkCheckRunning),
+									html.Text("Check links"),
+								),
+							),
+						),
+					),
+				),
+
+				// Transfer card, for who may give the site away
+				html.If(models.RoleAtLeast(props.Role, models.RoleOwner),
+					siteTransferCard(r, site, props.Transfer, props.Errors),
+				),
+			),
+		),
+	)
+
+	// Render page
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return page.Render(w)
+}
+
+// siteLogFilters renders the severity filter buttons above the logs table
+func siteLogFilters(site *models.Site, level string) html.Node {
+	filters := []any{attr.Class("flex flex-wrap gap-2")}
+	filters = append(filters, html.A(
+		attr.Href(fmt.Sprintf("/sites/%d", site.ID)),
+		attr.ClassIfElse(level == "", "btn-sm-secondary", "btn-sm-ghost"),
+		html.Text("All"),
+	))
+	for _, l := range models.LogLevels {
+		filters = append(filters, html.A(
+			attr.Href(fmt.Sprintf("/sites/%d?level=%s", site.ID, l)),
+			attr.ClassIfElse(level == l, "btn-sm-secondary", "btn-sm-ghost"),
+			html.Text(capitalize(l)),
+		))
+	}
+	return html.Div(filters...)
+}
+
+// siteLogsTable renders log entries, with the full error chain folded under each message
+func siteLogsTable(logs []*models.SiteLog) html.Node {
+	return html.Div(
+		attr.Class("overflow-x-auto"),
+		html.Table(
+			attr.Class("table"),
+			html.Thead(
+				html.Tr(
+					html.Th(html.Text("Time")),
+					html.Th(html.Text("Level")),
+					html.Th(html.Text("Path")),
+					html.Th(html.Text("Status")),
+					html.Th(html.Text("Error")),
+				),
+			),
+			html.Tbody(
+				html.Map(logs, func(log *models.SiteLog) html.Node {
+					return html.Tr(
+						html.Td(
+							attr.Class("whitespace-nowrap text-muted-foreground"),
+							html.Time(
+								attr.Datetime(log.CreatedAt.Format("2006-01-02T15:04:05Z07:00")),
+								html.Text(log.CreatedAt.Format("Jan 2, 15:04:05")),
+							),
+						),
+						html.Td(logLevelBadge(log.Level)),
+						html.Td(
+							attr.Class("font-mono text-xs"),
+							escapedText(log.Path),
+						),
+						html.Td(
+							attr.Class("font-mono text-xs"),
+							html.IfElse(log.UpstreamStatus != nil,
+								html.Text(fmt.Sprintf("%d", derefInt(log.UpstreamStatus))),
+								html.Text("—"),
+							),
+						),
+						html.Td(
+							html.IfElse(len(log.ErrorChain) > 1,
+								html.Details(
+									html.Summary(
+										attr.Class("cursor-pointer"),
+										escapedText(log.Message),
+									),
+									html.Ol(
+										attr.Class("mt-2 list-decimal pl-5 font-mono text-xs text-muted-foreground"),
+										html.Map(log.ErrorChain, func(message string) html.Node {
+											return html.Li(escapedText(message))
+										}),
+									),
+								),
+								escapedText(log.Message),
+							),
+						),
+					)
+				}),
+			),
+		),
+	)
+}
+
+// linkCheckSummary describes the state of the latest link check
+func linkCheckSummary(check *models.LinkCheck, brokenLinks []*models.BrokenLink) html.Node {
+	var summary string
+	switch {
+	case check == nil:
+		summary = "Links have not been checked yet"
+	case check.Status == models.LinkCheckRunning:
+		summary = fmt.Sprintf("Check started %s is still running, reload the page to see the results", check.StartedAt.Format("Jan 2, 15:04"))
+	case check.Status == models.LinkCheckFailed:
+		return html.Div(
+			attr.Class("alert-destructive"),
+			html.H2(html.Text("The last link check failed")),
+			html.Section(escapedText(check.Error)),
+		)
+	case len(brokenLinks) == 0:
+		summary = fmt.Sprintf("No broken links in %d links across %d pages", check.LinksChecked, check.PagesChecked)
+	default:
+		summary = fmt.Sprintf("%d broken of %d links across %d pages", len(brokenLinks), check.LinksChecked, check.PagesChecked)
+	}
+
+	return html.P(
+		attr.Class("text-sm text-muted-foreground"),
+		html.Text(summary),
+	)
+}
+
+// brokenLinksTable lists broken links with the page and line they appear on
+func brokenLinksTable(links []*models.BrokenLink) html.Node {
+	return html.Div(
+		attr.Class("overflow-x-auto"),
+		html.Table(
+			attr.Class("table"),
+			html.Thead(
+				html.Tr(
+					html.Th(html.Text("Page")),
+					html.Th(html.Text("Line")),
+					html.Th(html.Text("Kind")),
+					html.Th(html.Text("Target")),
+					html.Th(html.Text("Reason")),
+				),
+			),
+			html.Tbody(
+				html.Map(links, func(link *models.BrokenLink) html.Node {
+					return html.Tr(
+						html.Td(
+							attr.Class("font-mono text-xs"),
+							escapedText(link.SourcePath),
+						),
+						html.Td(
+							attr.Class("font-mono text-xs"),
+							html.IfElse(link.Line > 0,
+								html.Text(fmt.Sprintf("%d", link.Line)),
+								html.Text("—"),
+							),
+						),
+						html.Td(html.Span(attr.Class("badge-outline"), html.Text(link.Kind))),
+						html.Td(
+							attr.Class("font-mono text-xs break-all"),
+							escapedText(link.Target),
+						),
+						html.Td(escapedText(link.Reason)),
+					)
+				}),
+			),
+		),
+	)
+}
+
+// deploymentsTable lists deployments with the commit they found
+func deploymentsTable(deployments []*models.Deployment) html.Node {
+	return html.Div(
+		attr.Class("overflow-x-auto"),
+		html.Table(
+			attr.Class("table"),
+			html.Thead(
+				html.Tr(
+					html.Th(html.Text("Started")),
+					html.Th(html.Text("Status")),
+					html.Th(html.Text("Commit")),
+					html.Th(html.Text("Pages")),
+					html.Th(html.Text("From")),
+				),
+			),
+			html.Tbody(
+				html.Map(deployments, func(deployment *models.Deployment) html.Node {
+					commit := "—"
+					if len(deployment.CommitSHA) >= 7 {
+						commit = deployment.CommitSHA[:7]
+					}
+					return html.Tr(
+						html.Td(
+							attr.Class("text-xs whitespace-nowrap"),
+							html.Text(deployment.StartedAt.Format("Jan 2, 15:04")),
+						),
+						html.Td(
+							deploymentStatusBadge(deployment.Status),
+							html.If(deployment.Error != "",
+								html.P(
+									attr.Class("text-xs text-muted-foreground mt-1"),
+									escapedText(deployment.Error),
+								),
+							),
+						),
+						html.Td(
+							attr.Class("font-mono text-xs"),
+							escapedText(commit),
+						),
+						html.Td(html.Text(fmt.Sprintf("%d", deployment.Pages))),
+						html.Td(html.Text(deploymentTriggerLabel(deployment.TriggeredBy))),
+					)
+				}),
+			),
+		),
+	)
+}
+
+// deploymentTriggerLabel names what started a deployment
+func deploymentTriggerLabel(triggeredBy string) string {
+	if triggeredBy == models.DeploymentTriggerAPI {
+		return "API"
+	}
+	return capitalize(triggeredBy)
+}
+
+// deploymentStatusBadge renders a badge coloured by deployment status
+func deploymentStatusBadge(status string) html.Node {
+	class := "badge-outline"
+	switch status {
+	case models.DeploymentSucceeded:
+		class = "badge-secondary"
+	case models.DeploymentFailed:
+		class = "badge-destructive"
+	}
+	return html.Span(attr.Class(class), html.Text(status))
+}
+
+// logLevelBadge renders a badge coloured by severity
+func logLevelBadge(level string) html.Node {
+	class := "badge-outline"
+	switch level {
+	case models.LogLevelError:
+		class = "badge-destructive"
+	case models.LogLevelWarning:
+		class = "badge-secondary"
+	}
+	return html.Span(attr.Class(class), html.Text(level))
+}
+
+// derefInt returns the value of an int pointer, or 0 if nil
+func derefInt(i *int) int {
+	if i == nil {
+		return 0
+	}
+	return *i
+}
+
+// incomingTransfers lists the sites offered to the user or their organizations, each
+// of which can be accepted or declined
+func incomingTransfers(r *http.Request, transfers []*models.SiteTransfer) html.Node {
+	rows := []any{attr.Class("flex flex-col divide-y divide-border")}
+	for _, transfer := range transfers {
+		rows = append(rows, html.Div(
+			attr.Class("flex items-center justify-between gap-3 py-3"),
+			html.Div(
+				html.P(
+					attr.Class("text-sm font-medium"),
+					html.Text(transfer.SiteSlug),
+				),
+				html.P(
+					attr.Class("text-xs text-muted-foreground"),
+					escapedText(fmt.Sprintf("From %s to %s · Expires %s", transfer.FromName, transfer.Recipient, transfer.ExpiresAt.Format("Jan 2, 2006"))),
+				),
+			),
+			html.Div(
+				attr.Class("flex items-center gap-2"),
+				form(r,
+					attr.Action(fmt.Sprintf("/transfers/%d/accept", transfer.ID)),
+					attr.Method("POST"),
+					html.Button(
+						attr.Type("submit"),
+						attr.Class("btn-primary btn-sm"),
+						html.Text("Accept"),
+					),
+				),
+				form(r,
+					attr.Action(fmt.Sprintf("/transfers/%d/decline", transfer.ID)),
+					attr.Method("POST"),
+					html.Button(
+						attr.Type("submit"),
+						attr.Class("btn-outline btn-sm"),
+						html.Text("Decline"),
+					),
+				),
+			),
+		))
+	}
+
+	return html.Div(
+		attr.Class("mb-8"),
+		ui.Card(
+			ui.CardHeader(ui.CardHeaderProps{
+				Title:       "Transfers",
+				Description: "Sites offered to you or your organizations",
+			}),
+			ui.CardSection(html.Div(rows...)),
+		),
+	)
+}
+
+// siteTransferCard offers the site to another user or organization, or shows the
+// transfer waiting for its recipient
+func siteTransferCard(r *http.Request, site *models.Site, transfer *models.SiteTransfer, errs validator.ValidationErrors) html.Node {
+	var content html.Node
+	if transfer != nil {
+		content = html.Div(
+			attr.Class("flex flex-wrap items-center justify-between gap-3"),
+			html.P(
+				attr.Class("text-sm"),
+				escapedText(fmt.Sprintf("Waiting for %s to accept, until %s", transfer.Recipient, transfer.ExpiresAt.Format("Jan 2, 2006"))),
+			),
+			form(r,
+				attr.Action(fmt.Sprintf("/sites/%d/transfer/cancel", site.ID)),
+				attr.Method("POST"),
+				html.Button(
+					attr.Type("submit"),
+					attr.Class("btn-outline btn-sm"),
+					html.Text("Cancel transfer"),
+				),
+			),
+			fieldError(errs, "recipient"),
+		)
+	} else {
+		content = form(r,
+			attr.Action(fmt.Sprintf("/sites/%d/transfer", site.ID)),
+			attr.Method("POST"),
+			attr.Class("flex flex-col gap-2"),
+			html.Label(
+				attr.For("recipient"),
+				attr.Class("text-sm font-medium"),
+				html.Text("Recipient"),
+			),
+			html.Div(
+				attr.Class("flex items-center gap-2"),
+				html.Input(
+					attr.Type("text"),
+					attr.Id("recipient"),
+					attr.Name("recipient"),
+					attr.Required("true"),
+					attr.Placeholder("teammate@example.com or organization-slug"),
+					attr.ClassIfElse(errs != nil && errs.Has("recipient"), "input border-destructive focus:ring-destructive flex-1", "input flex-1"),
+				),
+				html.Button(
+					attr.Type("submit"),
+					attr.Class("btn-outline"),
+					html.Text("Transfer"),
+				),
+			),
+			fieldError(errs, "recipient"),
+		)
+	}
+
+	return html.Div(
+		attr.Id("transfer"),
+		ui.Card(
+			ui.CardHeader(ui.CardHeaderProps{
+				Title:       "Transfer",
+				Description: "Give the site to another user or organization. It keeps its address, deployments and logs once they accept.",
+			}),
+			ui.CardSection(content),
+		),
+	)
+}
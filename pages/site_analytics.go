@@ -0,0 +1,178 @@
+package pages
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/frenchsoftware/libhtml/attr"
+	"github.com/frenchsoftware/libhtml/html"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/views/components/ui"
+)
+
+// SiteAnalytics is the traffic of a site over its last days
+type SiteAnalytics struct {
+	From   string                             // First day, formatted YYYY-MM-DD
+	Days   []*models.PageViews                // Oldest first, days without views left out
+	Counts map[string][]*models.PageViewCount // Most viewed values, by dimension
+}
+
+// siteAnalyticsCard charts the daily views of a site, and lists the pages, referrers,
+// countries and devices they came from
+func siteAnalyticsCard(analytics *SiteAnalytics) html.Node {
+	var views, visitors int64
+	for _, day := range analytics.Days {
+		views += day.Views
+		visitors += day.Visitors
+	}
+
+	return html.Div(
+		attr.Id("analytics"),
+		ui.Card(
+			ui.CardHeader(ui.CardHeaderProps{
+				Title:       "Analytics",
+				Description: "Views of the public site since " + formatDay(analytics.From) + ", counted without cookies or IP addresses",
+			}),
+			ui.CardSection(
+				html.Div(
+					attr.Class("flex gap-8"),
+					analyticsTotal("Views", views),
+					analyticsTotal("Visitors, unique per day", visitors),
+				),
+				viewsChart(analytics.From, analytics.Days),
+			),
+			ui.CardSection(
+				html.Div(
+					attr.Class("grid gap-6 md:grid-cols-2"),
+					analyticsList("Pages", "No pages viewed", analytics.Counts[models.PageViewPath], func(value string) string { return value }),
+					analyticsList("Referrers", "No views", analytics.Counts[models.PageViewReferrer], func(value string) string {
+						if value == "" {
+							return "Direct"
+						}
+						return value
+					}),
+					analyticsList("Countries", "No views", analytics.Counts[models.PageViewCountry], func(value string) string {
+						if value == "" {
+							return "Unknown"
+						}
+						return value
+					}),
+					analyticsList("Devices", "No views", analytics.Counts[models.PageViewDevice], capitalize),
+				),
+			),
+		),
+	)
+}
+
+// analyticsTotal shows a total of the period
+func analyticsTotal(label string, value int64) html.Node {
+	return html.Div(
+		html.P(
+			attr.Class("text-xs text-muted-foreground"),
+			html.Text(label),
+		),
+		html.P(
+			attr.Class("text-2xl font-semibold"),
+			html.Text(fmt.Sprintf("%d", value)),
+		),
+	)
+}
+
+// viewsChart draws a bar of views for every day from the first one to today
+func viewsChart(from string, days []*models.PageViews) html.Node {
+	byDay := make(map[string]*models.PageViews, len(days))
+	var highest int64
+	for _, day := range days {
+		byDay[day.Day] = day
+		highest = max(highest, day.Views)
+	}
+
+	start, err := time.Parse(time.DateOnly, from)
+	if err != nil {
+		return html.Group()
+	}
+	today := time.Now().UTC().Format(time.DateOnly)
+
+	bars := []any{attr.Class("flex h-32 items-end gap-px mt-4")}
+	for day := start; day.Format(time.DateOnly) <= today; day = day.AddDate(0, 0, 1) {
+		key := day.Format(time.DateOnly)
+		var views, visitors int64
+		if stats, ok := byDay[key]; ok {
+			views, visitors = stats.Views, stats.Visitors
+		}
+
+		percent := int64(0)
+		if highest > 0 {
+			percent = views * 100 / highest
+		}
+		bars = append(bars, html.Div(
+			attr.Class("flex h-full flex-1 items-end"),
+			attr.Title(fmt.Sprintf("%s: %d views, %d visitors", day.Format("Jan 2"), views, visitors)),
+			html.Div(
+				attr.Class("w-full rounded-t-sm bg-primary"),
+				attr.Style(fmt.Sprintf("height: %d%%; min-height: 1px", percent)),
+			),
+		))
+	}
+
+	return html.Div(
+		html.Div(bars...),
+		html.Div(
+			attr.Class("flex justify-between text-xs text-muted-foreground mt-1"),
+			html.Span(html.Text(start.Format("Jan 2"))),
+			html.Span(html.Text("Today")),
+		),
+	)
+}
+
+// analyticsList lists the most viewed values of a dimension with a bar of their share
+// of the views of the first one
+func analyticsList(title, empty string, counts []*models.PageViewCount, label func(string) string) html.Node {
+	var highest int64
+	for _, count := range counts {
+		highest = max(highest, count.Views)
+	}
+
+	return html.Div(
+		attr.Class("flex flex-col gap-2"),
+		html.H3(
+			attr.Class("text-sm font-medium"),
+			html.Text(title),
+		),
+		html.IfElse(len(counts) == 0,
+			html.P(
+				attr.Class("text-sm text-muted-foreground"),
+				html.Text(empty),
+			),
+			html.Div(
+				attr.Class("flex flex-col gap-1"),
+				html.Map(counts, func(count *models.PageViewCount) html.Node {
+					return html.Div(
+						attr.Class("relative flex justify-between gap-2 px-2 py-1 text-sm"),
+						html.Div(
+							attr.Class("absolute inset-y-0 left-0 rounded-sm bg-muted"),
+							attr.Style(fmt.Sprintf("width: %d%%", count.Views*100/highest)),
+						),
+						html.Span(
+							attr.Class("relative truncate"),
+							escapedText(label(count.Value)),
+						),
+						html.Span(
+							attr.Class("relative text-muted-foreground"),
+							html.Text(fmt.Sprintf("%d", count.Views)),
+						),
+					)
+				}),
+			),
+		),
+	)
+}
+
+// formatDay formats a day stored as YYYY-MM-DD like "Jan 2"
+func formatDay(day string) string {
+	t, err := time.Parse(time.DateOnly, day)
+	if err != nil {
+		return day
+	}
+	return t.Format("Jan 2")
+}
@@ -0,0 +1,185 @@
+package pages
+
+import (
+	gohtml "html"
+	"net/http"
+
+	"github.com/frenchsoftware/libhtml/attr"
+	"github.com/frenchsoftware/libhtml/html"
+	"github.com/frenchsoftware/libvalidator/validator"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/views"
+	"github.com/hyperstitieux/template/views/components/ui"
+	"github.com/hyperstitieux/template/views/layouts"
+)
+
+// ReportSiteProps holds the report form of a public site, as sent back on errors
+type ReportSiteProps struct {
+	Site     *models.Site
+	Category string
+	URL      string // Page being reported
+	Details  string
+	Email    string // Contact of the reporter, for the admins only
+	Errors   validator.ValidationErrors
+}
+
+// ReportSite asks visitors of a public site what is wrong with it
+func ReportSite(w http.ResponseWriter, r *http.Request, props ReportSiteProps) error {
+	errs := props.Errors
+
+	categories := []any{attr.Id("category"), attr.Name("category"), attr.Required("true"), attr.Class("select w-full")}
+	categories = append(categories, html.Option(
+		attr.Value(""),
+		selectedIf(props.Category == ""),
+		html.Text("Choose a reason"),
+	))
+	for _, category := range models.ReportCategories {
+		categories = append(categories, html.Option(
+			attr.Value(category),
+			selectedIf(props.Category == category),
+			html.Text(models.ReportCategoryNames[category]),
+		))
+	}
+
+	page := layouts.Base(views.GetUser(r), r, "Report "+props.Site.Slug+" - Internet Publishing",
+		html.Div(
+			attr.Class("max-w-xl mx-auto px-8 py-8"),
+
+			// Page header
+			html.Div(
+				attr.Class("mb-8"),
+				html.H1(
+					attr.Class("text-3xl font-semibold mb-2"),
+					html.Text("Report "+props.Site.Slug),
+				),
+				html.P(
+					attr.Class("text-muted-foreground"),
+					html.Text("Tell the admins of Internet Publishing about content breaking the rules. The owners of the site are told it was reported, but not by whom."),
+				),
+			),
+
+			form(r,
+				attr.Action("/report"),
+				attr.Method("POST"),
+				html.Input(
+					attr.Type("hidden"),
+					attr.Name("site"),
+					attr.Value(props.Site.Slug),
+				),
+
+				ui.Card(
+					ui.CardSection(
+						// Category field
+						html.Div(
+							attr.Class("flex flex-col gap-2"),
+							html.Label(
+								attr.For("category"),
+								attr.Class("text-sm font-medium"),
+								html.Text("What is wrong?"),
+							),
+							html.Select(categories...),
+							fieldError(errs, "category"),
+						),
+
+						// URL field
+						html.Div(
+							attr.Class("flex flex-col gap-2"),
+							html.Label(
+								attr.For("url"),
+								attr.Class("text-sm font-medium"),
+								html.Text("Page"),
+							),
+							html.Input(
+								attr.Type("url"),
+								attr.Id("url"),
+								attr.Name("url"),
+								attr.Value(gohtml.EscapeString(props.URL)),
+								attr.Required("true"),
+								attr.ClassIfElse(errs != nil && errs.Has("url"), "input border-destructive focus:ring-destructive", "input"),
+							),
+							fieldError(errs, "url"),
+						),
+
+						// Details field
+						html.Div(
+							attr.Class("flex flex-col gap-2"),
+							html.Label(
+								attr.For("details"),
+								attr.Class("text-sm font-medium"),
+								html.Text("Details (optional)"),
+							),
+							html.Textarea(
+								attr.Id("details"),
+								attr.Name("details"),
+								attr.Rows("4"),
+								attr.Class("textarea"),
+								escapedText(props.Details),
+							),
+							fieldError(errs, "details"),
+						),
+
+						// Email field
+						html.Div(
+							attr.Class("flex flex-col gap-2"),
+							html.Label(
+								attr.For("email"),
+								attr.Class("text-sm font-medium"),
+								html.Text("Your email"),
+							),
+							html.Input(
+								attr.Type("email"),
+								attr.Id("email"),
+								attr.Name("email"),
+								attr.Value(gohtml.EscapeString(props.Email)),
+								attr.Required("true"),
+								attr.ClassIfElse(errs != nil && errs.Has("email"), "input border-destructive focus:ring-destructive", "input"),
+							),
+							html.P(
+								attr.Class("text-xs text-muted-foreground"),
+								html.Text("Only the admins see it, to ask you more if needed"),
+							),
+							fieldError(errs, "email"),
+						),
+					),
+
+					ui.CardFooter(
+						html.Button(
+							attr.Type("submit"),
+							attr.Class("btn-primary"),
+							html.Text("Send report"),
+						),
+					),
+				),
+			),
+		),
+	)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return page.Render(w)
+}
+
+// SiteReportSent thanks the visitor for their report
+func SiteReportSent(w http.ResponseWriter, r *http.Request, site *models.Site) error {
+	page := layouts.Base(views.GetUser(r), r, "Report sent - Internet Publishing",
+		html.Div(
+			attr.Class("max-w-sm mx-auto px-8 py-16"),
+			ui.Card(
+				ui.CardHeader(ui.CardHeaderProps{
+					Title:       "Thank you",
+					Description: "Your report was sent to the admins",
+				}),
+				ui.CardSection(
+					html.P(
+						attr.Class("text-sm"),
+						html.Text("The admins of Internet Publishing will review "),
+						html.Strong(html.Text(site.Slug)),
+						html.Text(" and suspend it if it breaks the rules."),
+					),
+				),
+			),
+		),
+	)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return page.Render(w)
+}
@@ -0,0 +1,228 @@
+package pages
+
+import (
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/frenchsoftware/libhtml/attr"
+	"github.com/frenchsoftware/libhtml/html"
+	"github.com/frenchsoftware/libvalidator/validator"
+	"github.com/hyperstitieux/template/views"
+	"github.com/hyperstitieux/template/views/components/ui"
+	"github.com/hyperstitieux/template/views/layouts"
+	"github.com/skip2/go-qrcode"
+)
+
+// TwoFactorSetupProps holds the secret a user adds to their authenticator app
+type TwoFactorSetupProps struct {
+	Secret string // Base32 secret, for apps that can't scan
+	URI    string // otpauth:// URI encoded in the QR code
+	Errors validator.ValidationErrors
+}
+
+// TwoFactorSetup shows the QR code to scan and asks for a first code to confirm it
+func TwoFactorSetup(w http.ResponseWriter, r *http.Request, props TwoFactorSetupProps) error {
+	user := views.GetUser(r)
+
+	// The QR code is drawn here so the secret never leaves the server
+	png, err := qrcode.Encode(props.URI, qrcode.Medium, 256)
+	if err != nil {
+		return err
+	}
+
+	page := layouts.Base(user, r, "Authenticator app - Internet Publishing",
+		html.Div(
+			attr.Class("max-w-lg mx-auto px-8 py-16"),
+			form(r,
+				attr.Action("/settings/two-factor"),
+				attr.Method("POST"),
+				ui.Card(
+					ui.CardHeader(ui.CardHeaderProps{
+						Title:       "Set up an authenticator app",
+						Description: "Scan the QR code with an app like 1Password, Google Authenticator or Aegis",
+					}),
+					ui.CardSection(
+						html.Img(
+							attr.Src("data:image/png;base64,"+base64.StdEncoding.EncodeToString(png)),
+							attr.Alt("QR code to scan with your authenticator app"),
+							attr.Width("256"),
+							attr.Height("256"),
+							attr.Class("mx-auto rounded-lg border"),
+						),
+						html.P(
+							attr.Class("text-sm text-muted-foreground"),
+							html.Text("Can't scan it? Enter this key in your app instead:"),
+						),
+						html.Code(
+							attr.Class("block text-sm font-mono break-all bg-muted rounded-md p-3"),
+							escapedText(props.Secret),
+						),
+						codeField("Then enter the 6-digit code your app shows", props.Errors),
+					),
+					ui.CardFooter(
+						html.A(
+							attr.Href("/settings"),
+							attr.Class("btn-outline"),
+							html.Text("Cancel"),
+						),
+						html.Button(
+							attr.Type("submit"),
+							attr.Class("btn-primary"),
+							html.Text("Turn on"),
+						),
+					),
+				),
+			),
+		),
+	)
+
+	// Render page
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return page.Render(w)
+}
+
+// TwoFactorProps holds the state of an authenticator app that is set up
+type TwoFactorProps struct {
+	EnabledAt         time.Time
+	RecoveryCodesLeft int
+	Errors            validator.ValidationErrors
+}
+
+// TwoFactor manages an authenticator app: new recovery codes or turning it off,
+// both confirmed with a code
+func TwoFactor(w http.ResponseWriter, r *http.Request, props TwoFactorProps) error {
+	user := views.GetUser(r)
+
+	page := layouts.Base(user, r, "Authenticator app - Internet Publishing",
+		html.Div(
+			attr.Class("max-w-lg mx-auto px-8 py-16"),
+			form(r,
+				attr.Method("POST"),
+				ui.Card(
+					ui.CardHeader(ui.CardHeaderProps{
+						Title:       "Authenticator app",
+						Description: "Turned on " + props.EnabledAt.Format("Jan 2, 2006") + " · " + strconv.Itoa(props.RecoveryCodesLeft) + " recovery codes left",
+					}),
+					ui.CardSection(
+						codeField("Enter a code from your app or a recovery code to make changes", props.Errors),
+					),
+					ui.CardFooter(
+						html.Button(
+							attr.Type("submit"),
+							html.Attr("formaction", "/settings/two-factor/recovery-codes"),
+							attr.Class("btn-outline"),
+							html.Text("New recovery codes"),
+						),
+						html.Button(
+							attr.Type("submit"),
+							html.Attr("formaction", "/settings/two-factor/delete"),
+							attr.Class("btn-destructive"),
+							html.Text("Turn off"),
+						),
+					),
+				),
+			),
+		),
+	)
+
+	// Render page
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return page.Render(w)
+}
+
+// RecoveryCodes shows new recovery codes, the only time they can be seen
+func RecoveryCodes(w http.ResponseWriter, r *http.Request, codes []string) error {
+	user := views.GetUser(r)
+
+	items := []any{attr.Class("grid grid-cols-2 gap-2 font-mono text-sm bg-muted rounded-md p-4")}
+	for _, code := range codes {
+		items = append(items, html.Li(html.Text(code)))
+	}
+
+	page := layouts.Base(user, r, "Recovery codes - Internet Publishing",
+		html.Div(
+			attr.Class("max-w-lg mx-auto px-8 py-16"),
+			ui.Card(
+				ui.CardHeader(ui.CardHeaderProps{
+					Title:       "Save your recovery codes",
+					Description: "Each code signs you in once if you lose your authenticator app. Keep them somewhere safe, they won't be shown again.",
+				}),
+				ui.CardSection(
+					html.Ul(items...),
+				),
+				ui.CardFooter(
+					html.A(
+						attr.Href("/settings"),
+						attr.Class("btn-primary"),
+						html.Text("I saved them"),
+					),
+				),
+			),
+		),
+	)
+
+	// Render page
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	return page.Render(w)
+}
+
+// authenticatorCard shows on the settings page whether an authenticator app is set up
+func authenticatorCard(enabled bool, recoveryCodesLeft int) html.Node {
+	status := "Not set up"
+	action := "Set up"
+	if enabled {
+		status = "On · " + strconv.Itoa(recoveryCodesLeft) + " recovery codes left"
+		action = "Manage"
+	}
+
+	return ui.Card(
+		ui.CardHeader(ui.CardHeaderProps{
+			Title:       "Authenticator app",
+			Description: "Asks for a code from an app on your phone after you sign in, for when you can't use passkeys",
+		}),
+		ui.CardSection(
+			html.Div(
+				attr.Class("flex items-center justify-between gap-3"),
+				html.P(
+					attr.Class("text-sm"),
+					html.Text(status),
+				),
+				html.A(
+					attr.Href("/settings/two-factor"),
+					attr.Class("btn-outline btn-sm"),
+					html.Text(action),
+				),
+			),
+		),
+	)
+}
+
+// codeField is the input for a one-time code, from an app or a recovery code
+func codeField(label string, errs validator.ValidationErrors) html.Node {
+	return html.Div(
+		attr.Class("flex flex-col gap-2"),
+		html.Label(
+			attr.For("code"),
+			attr.Class("text-sm font-medium"),
+			html.Text(label),
+		),
+		html.Input(
+			attr.Type("text"),
+			attr.Id("code"),
+			attr.Name("code"),
+			attr.Autocomplete("one-time-code"),
+			attr.Autofocus("true"),
+			attr.Required("true"),
+			attr.Maxlength("24"),
+			attr.ClassIfElse(errs != nil && errs.Has("code"), "input border-destructive focus:ring-destructive", "input"),
+		),
+		html.If(errs != nil && errs.Has("code"),
+			html.P(
+				attr.Class("text-xs text-destructive"),
+				html.Text(errs.Get("code")),
+			),
+		),
+	)
+}
@@ -0,0 +1,105 @@
+package pages
+
+import (
+	"fmt"
+
+	"github.com/frenchsoftware/libhtml/attr"
+	"github.com/frenchsoftware/libhtml/html"
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/quota"
+	"github.com/hyperstitieux/template/views/components/ui"
+)
+
+// usageCard shows what a user used of their limits and their usage of the last days
+func usageCard(report *quota.Report, description string) html.Node {
+	limits := report.Limits
+
+	return ui.Card(
+		ui.CardHeader(ui.CardHeaderProps{
+			Title:       "Usage",
+			Description: description,
+		}),
+		ui.CardSection(
+			html.Div(
+				attr.Class("grid gap-4 sm:grid-cols-2"),
+				usageMeter("Sites", fmt.Sprintf("%d", report.Sites), fmt.Sprintf("%d", limits.Sites), int64(report.Sites), int64(limits.Sites)),
+				usageMeter("Storage", quota.FormatBytes(report.StorageBytes), quota.FormatBytes(limits.StorageBytes), report.StorageBytes, limits.StorageBytes),
+				usageMeter("Bandwidth this month", quota.FormatBytes(report.BandwidthBytes), quota.FormatBytes(limits.BandwidthBytes), report.BandwidthBytes, limits.BandwidthBytes),
+				usageMeter("Syncs today", fmt.Sprintf("%d", report.SyncsToday), fmt.Sprintf("%d", limits.SyncsPerDay), int64(report.SyncsToday), int64(limits.SyncsPerDay)),
+			),
+		),
+		ui.CardSection(
+			html.IfElse(len(report.Days) == 0,
+				html.P(
+					attr.Class("text-sm text-muted-foreground"),
+					html.Text("No usage in the last days"),
+				),
+				usageTable(report.Days),
+			),
+		),
+	)
+}
+
+// usageMeter shows the use of one limit, a limit of 0 being unlimited
+func usageMeter(label, used, limit string, value, max int64) html.Node {
+	if max == 0 {
+		limit = "unlimited"
+	}
+
+	percent := int64(0)
+	if max > 0 {
+		percent = min(value*100/max, 100)
+	}
+
+	return html.Div(
+		attr.Class("flex flex-col gap-2"),
+		html.Div(
+			attr.Class("flex items-center justify-between text-sm"),
+			html.Span(attr.Class("font-medium"), html.Text(label)),
+			html.Span(
+				attr.Class("text-muted-foreground"),
+				html.Text(used+" of "+limit),
+			),
+		),
+		html.Div(
+			attr.Class("h-2 w-full overflow-hidden rounded-full bg-muted"),
+			html.Div(
+				attr.ClassIfElse(percent >= 100, "h-full bg-destructive", "h-full bg-primary"),
+				attr.Style(fmt.Sprintf("width: %d%%", percent)),
+			),
+		),
+	)
+}
+
+// usageTable lists the usage of each day
+func usageTable(days []*models.Usage) html.Node {
+	return html.Div(
+		attr.Class("overflow-x-auto"),
+		html.Table(
+			attr.Class("table"),
+			html.Thead(
+				html.Tr(
+					html.Th(html.Text("Day")),
+					html.Th(html.Text("Bandwidth")),
+					html.Th(html.Text("Requests")),
+					html.Th(html.Text("Syncs")),
+					html.Th(html.Text("Storage")),
+				),
+			),
+			html.Tbody(
+				html.Map(days, func(day *models.Usage) html.Node {
+					return html.Tr(
+						html.Td(
+							attr.Class("text-xs whitespace-nowrap"),
+							html.Text(day.Day),
+						),
+						html.Td(html.Text(quota.FormatBytes(day.BandwidthBytes))),
+						html.Td(html.Text(fmt.Sprintf("%d", day.Requests))),
+						html.Td(html.Text(fmt.Sprintf("%d", day.Syncs))),
+						html.Td(html.Text(quota.FormatBytes(day.StorageBytes))),
+					)
+				}),
+			),
+		),
+	)
+}
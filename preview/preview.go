@@ -0,0 +1,95 @@
+// Package preview renders a local folder of Markdown pages the way the public site
+// renders them from GitHub, so writers can see a page before pushing it.
+package preview
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/markdown"
+	"github.com/hyperstitieux/template/pages"
+)
+
+// Server serves the pages of a folder through the public site layout of a site
+type Server struct {
+	root      *os.Root
+	site      *models.Site
+	hotReload bool
+}
+
+// New opens the folder to serve. Pages can't be read from outside of it, whatever
+// path is requested. With hotReload, pages load the hot reload script, which the
+// caller serves along with its websocket.
+func New(dir string, site *models.Site, hotReload bool) (*Server, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", dir, err)
+	}
+	return &Server{root: root, site: site, hotReload: hotReload}, nil
+}
+
+// Close releases the folder
+func (s *Server) Close() error {
+	return s.root.Close()
+}
+
+// ServeHTTP renders the page at the requested path, with the same rules as the
+// public site: the extension is optional and the home page is README.md or index.md
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if path == "" {
+		path = "README.md"
+	}
+	if !strings.HasSuffix(path, ".md") {
+		path = path + ".md"
+	}
+
+	// Paths climbing out of the folder don't exist as far as the preview is concerned
+	if !fs.ValidPath(path) {
+		http.Error(w, fmt.Sprintf("File not found: %s", path), http.StatusNotFound)
+		return
+	}
+
+	content, err := s.read(path)
+	if errors.Is(err, fs.ErrNotExist) && strings.HasSuffix(path, "README.md") {
+		path = strings.TrimSuffix(path, "README.md") + "index.md"
+		content, err = s.read(path)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		http.Error(w, fmt.Sprintf("File not found: %s", path), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to read page", "error", err, "path", path)
+		http.Error(w, "Failed to read page", http.StatusInternalServerError)
+		return
+	}
+
+	htmlContent, err := markdown.RenderMarkdown(content)
+	if err != nil {
+		slog.Error("failed to render markdown", "error", err, "path", path)
+		http.Error(w, "Failed to render markdown", http.StatusInternalServerError)
+		return
+	}
+
+	if err := pages.PreviewSite(w, r, s.site, htmlContent, s.hotReload); err != nil {
+		slog.Error("failed to render page", "error", err, "path", path)
+	}
+}
+
+// read reads a file of the folder
+func (s *Server) read(path string) ([]byte, error) {
+	f, err := s.root.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
@@ -0,0 +1,68 @@
+package preview
+
+import (
+	"context"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"strings"
+	"time"
+)
+
+// fileState is what tells that a file changed between two scans
+type fileState struct {
+	size    int64
+	modTime time.Time
+}
+
+// Watch scans the folder every interval and calls onChange when files were added,
+// removed or modified since the previous scan, until the context is done. Scanning
+// needs no platform support and an interval of a few hundred milliseconds also
+// groups the writes of an editor saving several files into one change.
+func (s *Server) Watch(ctx context.Context, interval time.Duration, onChange func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	previous := s.scan()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		current := s.scan()
+		if !maps.Equal(previous, current) {
+			onChange()
+		}
+		previous = current
+	}
+}
+
+// scan lists the files of the folder with their size and modification time. Hidden
+// folders such as .git are skipped, they hold no pages and can be large.
+func (s *Server) scan() map[string]fileState {
+	files := make(map[string]fileState)
+	err := fs.WalkDir(s.root.FS(), ".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// Files can disappear while they are being listed
+			return nil
+		}
+		if entry.IsDir() {
+			if path != "." && strings.HasPrefix(entry.Name(), ".") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		files[path] = fileState{size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	if err != nil {
+		slog.Error("failed to scan preview folder", "error", err)
+	}
+	return files
+}
@@ -0,0 +1,121 @@
+// Passkey buttons: registering on the settings page, signing in and completing a
+// second factor. Binary WebAuthn fields travel as unpadded base64url.
+
+(() => {
+  const toBase64URL = (buffer) => {
+    const bytes = new Uint8Array(buffer);
+    let binary = '';
+    bytes.forEach(b => { binary += String.fromCharCode(b); });
+    return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+  };
+
+  const fromBase64URL = (value) => {
+    const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+    const binary = atob(base64 + '='.repeat((4 - base64.length % 4) % 4));
+    return Uint8Array.from(binary, c => c.charCodeAt(0));
+  };
+
+  const csrfToken = document.querySelector('meta[name="csrf-token"]')?.content || '';
+
+  const postJSON = async (url, body) => {
+    const response = await fetch(url, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json', 'X-CSRF-Token': csrfToken },
+      credentials: 'same-origin',
+      body: JSON.stringify(body || {}),
+    });
+    const data = await response.json().catch(() => ({}));
+    if (!response.ok) {
+      throw new Error(data.error || 'Something went wrong, try again');
+    }
+    return data;
+  };
+
+  const descriptors = (list) => (list || []).map(c => ({ ...c, id: fromBase64URL(c.id) }));
+
+  const register = async () => {
+    const options = await postJSON('/settings/passkeys/options');
+    const credential = await navigator.credentials.create({
+      publicKey: {
+        ...options,
+        challenge: fromBase64URL(options.challenge),
+        user: { ...options.user, id: fromBase64URL(options.user.id) },
+        excludeCredentials: descriptors(options.excludeCredentials),
+      },
+    });
+    const name = document.getElementById('passkey-name');
+    return postJSON('/settings/passkeys', {
+      name: name ? name.value : '',
+      credential: {
+        id: credential.id,
+        type: credential.type,
+        response: {
+          clientDataJSON: toBase64URL(credential.response.clientDataJSON),
+          attestationObject: toBase64URL(credential.response.attestationObject),
+          transports: credential.response.getTransports ? credential.response.getTransports() : [],
+        },
+      },
+    });
+  };
+
+  const authenticate = async (optionsURL, verifyURL, redirect) => {
+    const options = await postJSON(optionsURL);
+    const credential = await navigator.credentials.get({
+      publicKey: {
+        ...options,
+        challenge: fromBase64URL(options.challenge),
+        allowCredentials: descriptors(options.allowCredentials),
+      },
+    });
+    return postJSON(verifyURL, {
+      redirect: redirect,
+      credential: {
+        id: credential.id,
+        type: credential.type,
+        response: {
+          clientDataJSON: toBase64URL(credential.response.clientDataJSON),
+          authenticatorData: toBase64URL(credential.response.authenticatorData),
+          signature: toBase64URL(credential.response.signature),
+          userHandle: credential.response.userHandle ? toBase64URL(credential.response.userHandle) : '',
+        },
+      },
+    });
+  };
+
+  const ceremonies = {
+    'register': () => register(),
+    'sign-in': (button) => authenticate('/auth/passkey/options', '/auth/passkey', button.dataset.redirect),
+    'second-factor': (button) => authenticate('/sign-in/second-factor/passkey/options', '/sign-in/second-factor/passkey', button.dataset.redirect),
+  };
+
+  document.querySelectorAll('[data-passkey]').forEach(button => {
+    const error = button.parentElement.parentElement.querySelector('[data-passkey-error]');
+    const showError = (message) => {
+      if (error) {
+        error.textContent = message;
+        error.hidden = false;
+      }
+    };
+
+    if (!window.PublicKeyCredential) {
+      button.disabled = true;
+      showError('This browser does not support passkeys');
+      return;
+    }
+
+    button.addEventListener('click', async () => {
+      button.disabled = true;
+      if (error) error.hidden = true;
+      try {
+        const result = await ceremonies[button.dataset.passkey](button);
+        window.location.assign(result.redirect || '/');
+      } catch (err) {
+        // Dismissing the browser prompt isn't worth an error message
+        if (err.name !== 'NotAllowedError' && err.name !== 'AbortError') {
+          showError(err.message);
+        }
+        button.disabled = false;
+      }
+    });
+  });
+})();
@@ -0,0 +1,11 @@
+// Package public holds the static files of the dashboard. The server reads them from
+// ./public, so they change without a rebuild during development, while the preview
+// command, run from the folder being previewed, embeds the ones it needs.
+package public
+
+import "embed"
+
+// HotReload holds js/hotreload.js, which reloads the page when the server says so
+//
+//go:embed js/hotreload.js
+var HotReload embed.FS
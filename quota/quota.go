@@ -0,0 +1,352 @@
+// Package quota limits what each user may use: the number of sites they create, the
+// storage of their synced pages, the bandwidth of their public sites and how often
+// they sync. Limits come from the user's plan, which admins may override per user.
+// Usage is metered per user and day; sites created for an organization count for
+// the user who created them.
+package quota
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/database/repositories"
+)
+
+// Plan is a named set of limits users are put on
+type Plan struct {
+	ID     string
+	Name   string
+	Limits models.Limits
+}
+
+type Config struct {
+	Plans         []Plan        // Plans admins put users on, the first one by default
+	FlushInterval time.Duration // How often the bandwidth of public sites is written
+}
+
+// DefaultPlan returns the plan used when none is configured
+func DefaultPlan() Plan {
+	return Plan{
+		ID:   "free",
+		Name: "Free",
+		Limits: models.Limits{
+			Sites:          10,
+			StorageBytes:   100 << 20,
+			BandwidthBytes: 10 << 30,
+			SyncsPerDay:    100,
+		},
+	}
+}
+
+// ExceededError tells which limit an action would go over, its message is shown to
+// users as is
+type ExceededError struct {
+	Message string
+}
+
+func (e *ExceededError) Error() string {
+	return e.Message
+}
+
+// Quotas checks the limits of users and meters their usage
+type Quotas struct {
+	config Config
+	quotas repositories.QuotasRepository
+
+	// Bandwidth and requests of public sites are counted in memory by user and
+	// written every FlushInterval, rather than on each request
+	mu        sync.Mutex
+	pending   map[int64]*models.Usage
+	throttled map[int64]bool // Users over their monthly bandwidth at the last flush
+}
+
+func New(config Config, quotas repositories.QuotasRepository) *Quotas {
+	if len(config.Plans) == 0 {
+		config.Plans = []Plan{DefaultPlan()}
+	}
+	return &Quotas{
+		config:    config,
+		quotas:    quotas,
+		pending:   make(map[int64]*models.Usage),
+		throttled: make(map[int64]bool),
+	}
+}
+
+// Plans lists the configured plans
+func (q *Quotas) Plans() []Plan {
+	return q.config.Plans
+}
+
+// Plan returns the plan with the given id, or the default plan for an empty or
+// unknown id
+func (q *Quotas) Plan(id string) Plan {
+	for _, plan := range q.config.Plans {
+		if plan.ID == id {
+			return plan
+		}
+	}
+	return q.config.Plans[0]
+}
+
+// Limits returns the plan of a user and their limits, those of the plan replaced by
+// the ones admins set for them
+func (q *Quotas) Limits(ctx context.Context, userID int64) (Plan, models.Limits, error) {
+	overrides, err := q.quotas.GetLimits(ctx, userID)
+	if err != nil {
+		return Plan{}, models.Limits{}, err
+	}
+
+	plan := q.Plan(overrides.Plan)
+	limits := plan.Limits
+	if overrides.Sites != nil {
+		limits.Sites = *overrides.Sites
+	}
+	if overrides.StorageBytes != nil {
+		limits.StorageBytes = *overrides.StorageBytes
+	}
+	if overrides.BandwidthBytes != nil {
+		limits.BandwidthBytes = *overrides.BandwidthBytes
+	}
+	if overrides.SyncsPerDay != nil {
+		limits.SyncsPerDay = *overrides.SyncsPerDay
+	}
+	return plan, limits, nil
+}
+
+// CheckSites returns an ExceededError if the user can't create another site
+func (q *Quotas) CheckSites(ctx context.Context, userID int64) error {
+	plan, limits, err := q.Limits(ctx, userID)
+	if err != nil || limits.Sites == 0 {
+		return err
+	}
+
+	count, err := q.quotas.CountSites(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if count >= limits.Sites {
+		return &ExceededError{fmt.Sprintf("You reached the site limit of the %s plan (%d). Delete a site to create another one.", plan.Name, limits.Sites)}
+	}
+	return nil
+}
+
+// CheckSync returns an ExceededError if the user already started as many syncs today
+// as they may
+func (q *Quotas) CheckSync(ctx context.Context, userID int64) error {
+	plan, limits, err := q.Limits(ctx, userID)
+	if err != nil || limits.SyncsPerDay == 0 {
+		return err
+	}
+
+	today := Day(time.Now())
+	days, err := q.quotas.GetUsage(ctx, userID, today)
+	if err != nil {
+		return err
+	}
+	if len(days) > 0 && days[0].Syncs >= limits.SyncsPerDay {
+		return &ExceededError{fmt.Sprintf("You reached the daily sync limit of the %s plan (%d). Try again tomorrow.", plan.Name, limits.SyncsPerDay)}
+	}
+	return nil
+}
+
+// CheckStorage returns an ExceededError if a sync of the site bringing size bytes of
+// pages would take the user over their storage
+func (q *Quotas) CheckStorage(ctx context.Context, userID int64, siteID int, size int64) error {
+	plan, limits, err := q.Limits(ctx, userID)
+	if err != nil || limits.StorageBytes == 0 {
+		return err
+	}
+
+	used, err := q.quotas.StorageBytes(ctx, userID, siteID)
+	if err != nil {
+		return err
+	}
+	if used+size > limits.StorageBytes {
+		return &ExceededError{fmt.Sprintf("The pages of this sync take %s, which would go over the %s of storage of the %s plan (%s used by your other sites).",
+			FormatBytes(size), FormatBytes(limits.StorageBytes), plan.Name, FormatBytes(used))}
+	}
+	return nil
+}
+
+// Report is what a user used of the limits of their plan
+type Report struct {
+	Plan           Plan
+	Limits         models.Limits
+	Sites          int
+	StorageBytes   int64
+	BandwidthBytes int64 // Since the start of the month, as of the last flush
+	SyncsToday     int
+	Days           []*models.Usage // Days with usage, most recent first
+}
+
+// Report measures the usage of a user, with their usage of the last days
+func (q *Quotas) Report(ctx context.Context, userID int64, days int) (*Report, error) {
+	plan, limits, err := q.Limits(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{Plan: plan, Limits: limits}
+
+	if report.Sites, err = q.quotas.CountSites(ctx, userID); err != nil {
+		return nil, err
+	}
+	if report.StorageBytes, err = q.quotas.StorageBytes(ctx, userID, 0); err != nil {
+		return nil, err
+	}
+
+	// Usage is read from the earliest of the month and the days shown
+	now := time.Now()
+	month, today, first := MonthStart(now), Day(now), Day(now.AddDate(0, 0, 1-days))
+	usage, err := q.quotas.GetUsage(ctx, userID, min(month, first))
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(usage) - 1; i >= 0; i-- {
+		day := usage[i]
+		if day.Day >= month {
+			report.BandwidthBytes += day.BandwidthBytes
+		}
+		if day.Day == today {
+			report.SyncsToday = day.Syncs
+		}
+		if day.Day >= first {
+			report.Days = append(report.Days, day)
+		}
+	}
+	return report, nil
+}
+
+// RecordSync counts a sync started by the user today
+func (q *Quotas) RecordSync(ctx context.Context, userID int64) error {
+	return q.quotas.AddUsage(ctx, &models.Usage{UserID: userID, Day: Day(time.Now()), Syncs: 1})
+}
+
+// Serve counts a page of size bytes served by a public site of the user
+func (q *Quotas) Serve(userID int64, size int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	usage, ok := q.pending[userID]
+	if !ok {
+		usage = &models.Usage{UserID: userID}
+		q.pending[userID] = usage
+	}
+	usage.BandwidthBytes += size
+	usage.Requests++
+}
+
+// Throttled tells whether the public sites of the user went over their monthly
+// bandwidth, as of the last flush
+func (q *Quotas) Throttled(userID int64) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.throttled[userID]
+}
+
+// Run writes the metered bandwidth every FlushInterval until ctx is done, then one
+// last time
+func (q *Quotas) Run(ctx context.Context) {
+	ticker := time.NewTicker(q.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := q.Flush(context.Background()); err != nil {
+				slog.Error("failed to flush usage", "error", err)
+			}
+			return
+		case <-ticker.C:
+			if err := q.Flush(ctx); err != nil {
+				slog.Error("failed to flush usage", "error", err)
+			}
+		}
+	}
+}
+
+// Flush writes the bandwidth metered since the last flush, and finds the users who
+// went over their monthly bandwidth. Usage that fails to be written is kept for the
+// next flush.
+func (q *Quotas) Flush(ctx context.Context) error {
+	q.mu.Lock()
+	pending := q.pending
+	q.pending = make(map[int64]*models.Usage)
+	q.mu.Unlock()
+
+	// Usage is counted on the day it is written, flushes being frequent
+	now := time.Now()
+	for userID, usage := range pending {
+		usage.Day = Day(now)
+		if err := q.quotas.AddUsage(ctx, usage); err != nil {
+			q.mu.Lock()
+			for _, usage := range pending {
+				q.restore(usage)
+			}
+			q.mu.Unlock()
+			return err
+		}
+		delete(pending, userID)
+	}
+
+	bandwidth, err := q.quotas.BandwidthSince(ctx, MonthStart(now))
+	if err != nil {
+		return err
+	}
+	throttled := make(map[int64]bool)
+	for userID, bytes := range bandwidth {
+		_, limits, err := q.Limits(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if limits.BandwidthBytes > 0 && bytes >= limits.BandwidthBytes {
+			throttled[userID] = true
+		}
+	}
+
+	q.mu.Lock()
+	q.throttled = throttled
+	q.mu.Unlock()
+	return nil
+}
+
+// restore adds back usage that failed to be written. q.mu must be held.
+func (q *Quotas) restore(usage *models.Usage) {
+	current, ok := q.pending[usage.UserID]
+	if !ok {
+		q.pending[usage.UserID] = usage
+		return
+	}
+	current.BandwidthBytes += usage.BandwidthBytes
+	current.Requests += usage.Requests
+}
+
+// Day formats the UTC day of t as usage is stored
+func Day(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
+
+// MonthStart formats the first UTC day of the month of t, from which bandwidth is
+// counted
+func MonthStart(t time.Time) string {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC).Format(time.DateOnly)
+}
+
+// FormatBytes formats a size in bytes with a binary unit, like "1.5 MB"
+func FormatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
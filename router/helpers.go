@@ -2,7 +2,10 @@ package router
 
 import (
 	"io"
+	"net"
 	"net/http"
+	"net/netip"
+	"strings"
 
 	"github.com/gorilla/mux"
 )
@@ -12,6 +15,7 @@ type Router struct {
 	*mux.Router
 	config       Config
 	hotReloadMux *mux.Router
+	websockets   *mux.Router
 }
 
 // WrapRouter wraps a mux.Router to add helper methods
@@ -75,13 +79,27 @@ func (r *Router) HandleRaw(path string, handler http.HandlerFunc) *mux.Route {
 	return r.Router.NewRoute().Path(path).HandlerFunc(handler)
 }
 
-// ServeHTTP implements http.Handler, combining hot reload and main routers
+// HandleWebSocket registers a websocket endpoint served before any middleware, since
+// the logging, compression and timeout middlewares can't hand over the connection
+func (r *Router) HandleWebSocket(path string, handler http.HandlerFunc) *mux.Route {
+	if r.websockets == nil {
+		r.websockets = mux.NewRouter()
+	}
+	return r.websockets.HandleFunc(path, handler).Methods(http.MethodGet)
+}
+
+// ServeHTTP implements http.Handler, combining hot reload, websocket and main routers
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	// If hot reload mux exists and path matches hot reload prefix, use it
 	if r.hotReloadMux != nil && len(req.URL.Path) >= 12 && req.URL.Path[:12] == "/__hotreload" {
 		r.hotReloadMux.ServeHTTP(w, req)
 		return
 	}
+	var match mux.RouteMatch
+	if r.websockets != nil && r.websockets.Match(req, &match) {
+		r.websockets.ServeHTTP(w, req)
+		return
+	}
 	// Otherwise use main router
 	r.Router.ServeHTTP(w, req)
 }
@@ -110,3 +128,28 @@ func IsSubdomain(host string) bool {
 	// e.g., slug.internetpublishing.co has 2 dots
 	return dotCount >= 2
 }
+
+// ClientIP returns the IP address of the client. Requests relayed by a reverse proxy on
+// the same host or private network are attributed to the last address the proxy
+// appended to X-Forwarded-For, other clients could forge the header.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	peer, err := netip.ParseAddr(host)
+	if err != nil || !(peer.IsLoopback() || peer.IsPrivate()) {
+		return host
+	}
+
+	forwarded := r.Header.Values("X-Forwarded-For")
+	if len(forwarded) == 0 {
+		return host
+	}
+	hops := strings.Split(forwarded[len(forwarded)-1], ",")
+	if client, err := netip.ParseAddr(strings.TrimSpace(hops[len(hops)-1])); err == nil {
+		return client.Unmap().String()
+	}
+	return host
+}
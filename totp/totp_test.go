@@ -0,0 +1,102 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key of the test vectors of RFC 6238, "12345678901234567890"
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B, SHA1, keeping the last 6 of the 8 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+
+	if _, err := Code("not base32!", time.Now()); err == nil {
+		t.Error("Code accepted an invalid secret")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+	codeAt := func(offset int64) string {
+		code, err := Code(rfcSecret, now.Add(time.Duration(offset)*Period))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		secret   string
+		input    string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current code", rfcSecret, codeAt(0), step, true},
+		{"lowercase secret", strings.ToLower(rfcSecret), codeAt(0), step, true},
+		{"grouped digits", rfcSecret, codeAt(0)[:3] + " " + codeAt(0)[3:], step, true},
+		{"previous period", rfcSecret, codeAt(-1), step - 1, true},
+		{"next period", rfcSecret, codeAt(1), step + 1, true},
+		{"two periods ago", rfcSecret, codeAt(-2), 0, false},
+		{"two periods ahead", rfcSecret, codeAt(2), 0, false},
+		{"too short", rfcSecret, codeAt(0)[:5], 0, false},
+		{"too long", rfcSecret, codeAt(0) + "0", 0, false},
+		{"empty", rfcSecret, "", 0, false},
+		{"invalid secret", "not base32!", codeAt(0), 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := Validate(tt.secret, tt.input, now)
+			if ok != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("Validate(%q) = %d, %v, want %d, %v", tt.input, gotStep, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := encoding.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != 20 {
+		t.Errorf("secret of %d bytes, want 20", len(key))
+	}
+}
+
+func TestURI(t *testing.T) {
+	got := URI("Internet Publishing", "alice@example.com", rfcSecret)
+	want := "otpauth://totp/Internet%20Publishing:alice@example.com?issuer=Internet+Publishing&secret=" + rfcSecret
+	if got != want {
+		t.Errorf("URI = %s, want %s", got, want)
+	}
+}
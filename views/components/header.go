@@ -1,12 +1,14 @@
 package components
 
 import (
+	gohtml "html"
 	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/frenchsoftware/libhtml/attr"
 	"github.com/frenchsoftware/libhtml/html"
 	"github.com/hyperstitieux/template/database/models"
-	"github.com/hyperstitieux/template/views/components/icons"
 )
 
 func Header(user *models.User, r *http.Request) html.Node {
@@ -24,14 +26,7 @@ func Header(user *models.User, r *http.Request) html.Node {
 				html.Attr("aria-controls", "user-menu"),
 				html.Attr("aria-expanded", "false"),
 				attr.Class("flex items-center justify-center size-9 rounded-lg transition-colors cursor-pointer overflow-hidden"),
-				html.If(user.Picture != nil && *user.Picture != "",
-					html.Img(
-						attr.Src(*user.Picture),
-						attr.Alt(user.Name),
-						attr.Class("w-full h-full object-cover"),
-						attr.Referrerpolicy("no-referrer"),
-					),
-				),
+				avatar(user),
 			),
 			// Dropdown popover
 			html.Div(
@@ -49,11 +44,11 @@ func Header(user *models.User, r *http.Request) html.Node {
 						attr.Class("px-2 py-1.5 max-w-56 flex flex-col"),
 						html.Div(
 							attr.Class("text-sm font-medium break-words"),
-							html.Text(user.Name),
+							html.Text(gohtml.EscapeString(user.Name)),
 						),
 						html.Div(
 							attr.Class("text-xs text-muted-foreground break-words"),
-							html.Text(user.Email),
+							html.Text(gohtml.EscapeString(user.Email)),
 						),
 					),
 					// Separator
@@ -66,6 +61,16 @@ func Header(user *models.User, r *http.Request) html.Node {
 						html.I(html.Attr("data-lucide", "settings")),
 						html.Text("Settings"),
 					),
+					// Admin console menu item
+					html.If(user.IsAdmin,
+						html.A(
+							html.Attr("role", "menuitem"),
+							attr.Href("/admin"),
+							attr.Class("flex cursor-pointer items-center gap-2"),
+							html.I(html.Attr("data-lucide", "shield")),
+							html.Text("Admin"),
+						),
+					),
 					// Separator
 					html.Hr(html.Attr("role", "separator")),
 					// Logout menu item
@@ -85,11 +90,10 @@ func Header(user *models.User, r *http.Request) html.Node {
 			attr.Class("flex items-center"),
 			html.A(
 				attr.Class("btn-primary h-9 flex items-center"),
-				attr.Href("/auth/google"),
-				icons.Google(),
+				attr.Href("/sign-in?redirect="+url.QueryEscape(currentPath)),
 				html.Span(
 					attr.Class("font-medium"),
-					html.Text("Sign in with Google"),
+					html.Text("Sign in"),
 				),
 			),
 		)
@@ -138,3 +142,25 @@ func Header(user *models.User, r *http.Request) html.Node {
 		),
 	)
 }
+
+// avatar shows the user's picture, or the initial of their name for users signed
+// up without one. html.If evaluates its children, so the picture can't go through it.
+func avatar(user *models.User) html.Node {
+	if user.Picture != nil && *user.Picture != "" {
+		return html.Img(
+			attr.Src(gohtml.EscapeString(*user.Picture)),
+			attr.Alt(gohtml.EscapeString(user.Name)),
+			attr.Class("w-full h-full object-cover"),
+			attr.Referrerpolicy("no-referrer"),
+		)
+	}
+
+	initial := "?"
+	if name := strings.TrimSpace(user.Name); name != "" {
+		initial = strings.ToUpper(string([]rune(name)[:1]))
+	}
+	return html.Span(
+		attr.Class("w-full h-full flex items-center justify-center bg-muted font-medium"),
+		html.Text(gohtml.EscapeString(initial)),
+	)
+}
@@ -0,0 +1,29 @@
+package components
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hyperstitieux/template/database/models"
+)
+
+func TestHeaderEscapesUser(t *testing.T) {
+	user := &models.User{
+		Name:  `<script>alert("name")</script>`,
+		Email: `"><script>alert(1)</script>@example.com`,
+	}
+
+	var b strings.Builder
+	if err := Header(user, httptest.NewRequest("GET", "/", nil)).Render(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	body := b.String()
+	if strings.Contains(body, "<script>") {
+		t.Fatalf("header renders user fields unescaped:\n%s", body)
+	}
+	if !strings.Contains(body, "&lt;script&gt;alert(&#34;name&#34;)&lt;/script&gt;") {
+		t.Errorf("header doesn't show the escaped name")
+	}
+}
@@ -0,0 +1,40 @@
+package components
+
+import (
+	gohtml "html"
+	"net/http"
+
+	"github.com/frenchsoftware/libhtml/attr"
+	"github.com/frenchsoftware/libhtml/html"
+	"github.com/hyperstitieux/template/auth"
+	"github.com/hyperstitieux/template/database/models"
+)
+
+// ImpersonationBanner reminds an admin viewing the dashboard as another user that
+// nothing can be changed, and lets them stop
+func ImpersonationBanner(user *models.User, r *http.Request) html.Node {
+	if auth.GetImpersonator(r) == nil || user == nil {
+		return html.Group()
+	}
+
+	return html.Div(
+		attr.Class("flex flex-wrap items-center justify-between gap-2 w-full bg-destructive text-white px-8 py-2 text-sm"),
+		html.Span(
+			html.Text("Viewing as "+gohtml.EscapeString(user.Email)+", read-only"),
+		),
+		html.Form(
+			attr.Action(auth.StopImpersonatingPath),
+			attr.Method("POST"),
+			html.Input(
+				attr.Type("hidden"),
+				attr.Name(auth.CSRFFieldName),
+				attr.Value(auth.CSRFToken(r)),
+			),
+			html.Button(
+				attr.Type("submit"),
+				attr.Class("underline cursor-pointer"),
+				html.Text("Back to my account"),
+			),
+		),
+	)
+}
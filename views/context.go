@@ -13,3 +13,8 @@ import (
 func GetUser(r *http.Request) *models.User {
 	return auth.GetCurrentUser(r)
 }
+
+// CSRFToken returns the token forms of the request must send back
+func CSRFToken(r *http.Request) string {
+	return auth.CSRFToken(r)
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/frenchsoftware/libhtml/attr"
 	"github.com/frenchsoftware/libhtml/html"
 	"github.com/hyperstitieux/template/database/models"
+	"github.com/hyperstitieux/template/views"
 	"github.com/hyperstitieux/template/views/components"
 )
 
@@ -25,6 +26,9 @@ func Base(user *models.User, r *http.Request, title string, children ...html.Nod
 				html.Meta(attr.Charset("utf-8")),
 				html.Meta(attr.Name("viewport"), attr.Content("width=device-width, initial-scale=1")),
 
+				// CSRF token for scripts posting to the server
+				html.Meta(attr.Name("csrf-token"), attr.Content(views.CSRFToken(r))),
+
 				// Theme initialization (must be in head before body renders)
 				components.ThemeInitScript(),
 
@@ -55,6 +59,7 @@ func Base(user *models.User, r *http.Request, title string, children ...html.Nod
 				attr.Class("font-sans min-h-screen flex flex-col"),
 
 				components.Banner(),
+				components.ImpersonationBanner(user, r),
 				components.Header(user, r),
 
 				// Main content area - takes remaining space
@@ -0,0 +1,147 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// errTruncated is returned when CBOR data ends in the middle of an item
+var errTruncated = errors.New("cbor: unexpected end of data")
+
+// maxNesting bounds the depth of nested arrays and maps, data comes from clients
+const maxNesting = 16
+
+// decodeCBOR decodes the first CBOR item of data and returns it with the bytes that
+// follow it. It supports the subset used by WebAuthn: integers, byte and text strings,
+// arrays, maps, booleans and null. Integers decode to int64, maps to map[any]any.
+func decodeCBOR(data []byte) (any, []byte, error) {
+	return decodeItem(data, 0)
+}
+
+func decodeItem(data []byte, depth int) (any, []byte, error) {
+	if depth > maxNesting {
+		return nil, nil, fmt.Errorf("cbor: nested too deeply")
+	}
+	if len(data) == 0 {
+		return nil, nil, errTruncated
+	}
+
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+	data = data[1:]
+
+	// Simple values and floats share major type 7
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, data, nil
+		case 21:
+			return true, data, nil
+		case 22, 23:
+			return nil, data, nil
+		}
+		return nil, nil, fmt.Errorf("cbor: unsupported simple value %d", info)
+	}
+
+	arg, data, err := decodeArgument(info, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > 1<<63-1 {
+			return nil, nil, fmt.Errorf("cbor: integer overflow")
+		}
+		return int64(arg), data, nil
+
+	case 1:
+		if arg > 1<<63-1 {
+			return nil, nil, fmt.Errorf("cbor: integer overflow")
+		}
+		return -1 - int64(arg), data, nil
+
+	case 2, 3:
+		if arg > uint64(len(data)) {
+			return nil, nil, errTruncated
+		}
+		value := data[:arg]
+		if major == 3 {
+			return string(value), data[arg:], nil
+		}
+		return append([]byte(nil), value...), data[arg:], nil
+
+	case 4:
+		// Every item takes at least a byte, which bounds allocations
+		if arg > uint64(len(data)) {
+			return nil, nil, errTruncated
+		}
+		items := make([]any, 0, arg)
+		for range arg {
+			var item any
+			item, data, err = decodeItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, data, nil
+
+	case 5:
+		if arg > uint64(len(data)) {
+			return nil, nil, errTruncated
+		}
+		entries := make(map[any]any, arg)
+		for range arg {
+			var key, value any
+			key, data, err = decodeItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("cbor: unsupported map key type %T", key)
+			}
+			value, data, err = decodeItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			entries[key] = value
+		}
+		return entries, data, nil
+	}
+
+	return nil, nil, fmt.Errorf("cbor: unsupported major type %d", major)
+}
+
+// decodeArgument reads the argument of an item header. Indefinite lengths are not
+// supported, WebAuthn requires the canonical encoding.
+func decodeArgument(info byte, data []byte) (uint64, []byte, error) {
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24:
+		if len(data) < 1 {
+			return 0, nil, errTruncated
+		}
+		return uint64(data[0]), data[1:], nil
+	case info == 25:
+		if len(data) < 2 {
+			return 0, nil, errTruncated
+		}
+		return uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case info == 26:
+		if len(data) < 4 {
+			return 0, nil, errTruncated
+		}
+		return uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case info == 27:
+		if len(data) < 8 {
+			return 0, nil, errTruncated
+		}
+		return binary.BigEndian.Uint64(data), data[8:], nil
+	}
+	return 0, nil, fmt.Errorf("cbor: unsupported additional information %d", info)
+}
@@ -0,0 +1,117 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithms we accept, in order of preference
+const (
+	algES256 = -7
+	algEdDSA = -8
+	algRS256 = -257
+)
+
+// supportedAlgorithms is offered to authenticators when creating credentials
+var supportedAlgorithms = []int64{algES256, algEdDSA, algRS256}
+
+// COSE key types and curves
+const (
+	ktyOKP     = 1
+	ktyEC2     = 2
+	ktyRSA     = 3
+	crvP256    = 1
+	crvEd25519 = 6
+)
+
+// publicKey is a credential public key decoded from its COSE encoding
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parsePublicKey decodes a COSE_Key as stored with a credential
+func parsePublicKey(data []byte) (*publicKey, error) {
+	item, rest, err := decodeCBOR(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("trailing data after public key")
+	}
+	return publicKeyFromCOSE(item)
+}
+
+func publicKeyFromCOSE(item any) (*publicKey, error) {
+	fields, ok := item.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("public key is not a map")
+	}
+	kty, _ := fields[int64(1)].(int64)
+	alg, _ := fields[int64(3)].(int64)
+
+	switch {
+	case kty == ktyEC2 && alg == algES256:
+		crv, _ := fields[int64(-1)].(int64)
+		x, _ := fields[int64(-2)].([]byte)
+		y, _ := fields[int64(-3)].([]byte)
+		if crv != crvP256 || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("invalid P-256 public key")
+		}
+		key, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), append([]byte{4}, append(x, y...)...))
+		if err != nil {
+			return nil, err
+		}
+		return &publicKey{alg: alg, key: key}, nil
+
+	case kty == ktyOKP && alg == algEdDSA:
+		crv, _ := fields[int64(-1)].(int64)
+		x, _ := fields[int64(-2)].([]byte)
+		if crv != crvEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 public key")
+		}
+		return &publicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+
+	case kty == ktyRSA && alg == algRS256:
+		n, _ := fields[int64(-1)].([]byte)
+		e, _ := fields[int64(-2)].([]byte)
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) < 256 || !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA public key")
+		}
+		return &publicKey{alg: alg, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported public key type %d with algorithm %d", kty, alg)
+}
+
+// verify checks a WebAuthn assertion signature over the signed data
+func (k *publicKey) verify(signed, signature []byte) error {
+	switch k.alg {
+	case algES256:
+		digest := sha256.Sum256(signed)
+		// Unlike JWS, WebAuthn ECDSA signatures are ASN.1 encoded
+		if !ecdsa.VerifyASN1(k.key.(*ecdsa.PublicKey), digest[:], signature) {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+
+	case algEdDSA:
+		if !ed25519.Verify(k.key.(ed25519.PublicKey), signed, signature) {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+
+	case algRS256:
+		digest := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(k.key.(*rsa.PublicKey), crypto.SHA256, digest[:], signature)
+	}
+
+	return fmt.Errorf("unsupported algorithm %d", k.alg)
+}
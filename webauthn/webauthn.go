@@ -0,0 +1,378 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidResponse is returned when a response from the browser can't be trusted
+var ErrInvalidResponse = errors.New("invalid webauthn response")
+
+// timeout is how long the browser waits for the user, in milliseconds
+const timeout = 5 * 60 * 1000
+
+// Authenticator data flags
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+// User verification requirements, as sent to the browser
+const (
+	VerificationRequired  = "required"
+	VerificationPreferred = "preferred"
+)
+
+// Config identifies the relying party, this site, to authenticators
+type Config struct {
+	RPID   string // Domain credentials are scoped to, e.g. "example.com"
+	RPName string // Shown by authenticators
+	Origin string // Origin the browser reports, e.g. "https://example.com"
+}
+
+// WebAuthn creates and verifies passkey ceremonies for a relying party
+type WebAuthn struct {
+	config Config
+}
+
+// New creates a WebAuthn relying party
+func New(config Config) *WebAuthn {
+	return &WebAuthn{config: config}
+}
+
+// NewChallenge returns a random challenge. It must be stored server side and used once.
+func NewChallenge() (string, error) {
+	challenge := make([]byte, 32)
+	if _, err := rand.Read(challenge); err != nil {
+		return "", err
+	}
+	return encode(challenge), nil
+}
+
+// User is the account a credential is created for
+type User struct {
+	Handle      []byte // Opaque ID returned with passwordless logins
+	Name        string
+	DisplayName string
+}
+
+// CredentialDescriptor identifies an existing credential to the browser
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+// Descriptor describes a stored credential
+func Descriptor(credentialID string, transports []string) CredentialDescriptor {
+	return CredentialDescriptor{Type: "public-key", ID: credentialID, Transports: transports}
+}
+
+// CreationOptions are the options of navigator.credentials.create, with binary fields
+// base64url encoded
+type CreationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams []struct {
+		Type string `json:"type"`
+		Alg  int64  `json:"alg"`
+	} `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+	Attestation string `json:"attestation"`
+}
+
+// CreationOptions returns the options to create a credential for the user. Existing
+// credentials are excluded so an authenticator isn't registered twice.
+func (w *WebAuthn) CreationOptions(user User, challenge string, exclude []CredentialDescriptor) *CreationOptions {
+	options := &CreationOptions{
+		Challenge:          challenge,
+		Timeout:            timeout,
+		ExcludeCredentials: exclude,
+		Attestation:        "none",
+	}
+	options.RP.ID = w.config.RPID
+	options.RP.Name = w.config.RPName
+	options.User.ID = encode(user.Handle)
+	options.User.Name = user.Name
+	options.User.DisplayName = user.DisplayName
+	for _, alg := range supportedAlgorithms {
+		options.PubKeyCredParams = append(options.PubKeyCredParams, struct {
+			Type string `json:"type"`
+			Alg  int64  `json:"alg"`
+		}{"public-key", alg})
+	}
+	// Discoverable credentials can sign in without entering anything first
+	options.AuthenticatorSelection.ResidentKey = "preferred"
+	options.AuthenticatorSelection.UserVerification = VerificationPreferred
+	if options.ExcludeCredentials == nil {
+		options.ExcludeCredentials = []CredentialDescriptor{}
+	}
+	return options
+}
+
+// RequestOptions are the options of navigator.credentials.get
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int                    `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// RequestOptions returns the options to sign in with one of the allowed credentials,
+// or with any discoverable credential when none are given
+func (w *WebAuthn) RequestOptions(challenge string, allow []CredentialDescriptor, userVerification string) *RequestOptions {
+	if allow == nil {
+		allow = []CredentialDescriptor{}
+	}
+	return &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          timeout,
+		RPID:             w.config.RPID,
+		AllowCredentials: allow,
+		UserVerification: userVerification,
+	}
+}
+
+// RegistrationResponse is the credential returned by navigator.credentials.create,
+// with binary fields base64url encoded
+type RegistrationResponse struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON"`
+		AttestationObject string   `json:"attestationObject"`
+		Transports        []string `json:"transports"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the credential returned by navigator.credentials.get, with
+// binary fields base64url encoded
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+// UserHandle returns the user handle of a discoverable credential, if any
+func (r *AssertionResponse) UserHandle() []byte {
+	handle, _ := decode(r.Response.UserHandle)
+	return handle
+}
+
+// Credential is a newly registered credential
+type Credential struct {
+	ID         string // base64url encoded credential ID
+	PublicKey  []byte // COSE encoded public key
+	SignCount  uint32
+	Transports []string
+}
+
+// VerifyRegistration checks the response to CreationOptions sent with the challenge
+// and returns the new credential. Attestation isn't verified, we ask for none.
+func (w *WebAuthn) VerifyRegistration(response *RegistrationResponse, challenge string) (*Credential, error) {
+	if response.Type != "public-key" {
+		return nil, fmt.Errorf("%w: unexpected credential type", ErrInvalidResponse)
+	}
+	if _, err := w.verifyClientData(response.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	attestation, err := decode(response.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed attestation object", ErrInvalidResponse)
+	}
+	item, _, err := decodeCBOR(attestation)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+	object, ok := item.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed attestation object", ErrInvalidResponse)
+	}
+	rawAuthData, ok := object["authData"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing authenticator data", ErrInvalidResponse)
+	}
+
+	authData, err := w.parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.flags&flagAttested == 0 || authData.credentialID == nil {
+		return nil, fmt.Errorf("%w: no attested credential", ErrInvalidResponse)
+	}
+	if encode(authData.credentialID) != strings.TrimRight(response.ID, "=") {
+		return nil, fmt.Errorf("%w: credential ID mismatch", ErrInvalidResponse)
+	}
+	if _, err := parsePublicKey(authData.publicKey); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+
+	return &Credential{
+		ID:         encode(authData.credentialID),
+		PublicKey:  authData.publicKey,
+		SignCount:  authData.signCount,
+		Transports: response.Response.Transports,
+	}, nil
+}
+
+// VerifyAssertion checks the response to RequestOptions sent with the challenge,
+// signed with the stored credential. It returns the new signature counter.
+func (w *WebAuthn) VerifyAssertion(response *AssertionResponse, challenge string, storedPublicKey []byte, storedSignCount uint32, userVerification string) (uint32, error) {
+	if response.Type != "public-key" {
+		return 0, fmt.Errorf("%w: unexpected credential type", ErrInvalidResponse)
+	}
+	clientData, err := w.verifyClientData(response.Response.ClientDataJSON, "webauthn.get", challenge)
+	if err != nil {
+		return 0, err
+	}
+
+	rawAuthData, err := decode(response.Response.AuthenticatorData)
+	if err != nil {
+		return 0, fmt.Errorf("%w: malformed authenticator data", ErrInvalidResponse)
+	}
+	authData, err := w.parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return 0, err
+	}
+	if userVerification == VerificationRequired && authData.flags&flagUserVerified == 0 {
+		return 0, fmt.Errorf("%w: user not verified", ErrInvalidResponse)
+	}
+
+	key, err := parsePublicKey(storedPublicKey)
+	if err != nil {
+		return 0, err
+	}
+	signature, err := decode(response.Response.Signature)
+	if err != nil {
+		return 0, fmt.Errorf("%w: malformed signature", ErrInvalidResponse)
+	}
+	clientDataHash := sha256.Sum256(clientData)
+	if err := key.verify(append(rawAuthData, clientDataHash[:]...), signature); err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+	}
+
+	// Counters only go up, unless the authenticator doesn't keep one. A counter that
+	// didn't may mean the credential was cloned.
+	if (authData.signCount != 0 || storedSignCount != 0) && authData.signCount <= storedSignCount {
+		return 0, fmt.Errorf("%w: signature counter went back", ErrInvalidResponse)
+	}
+
+	return authData.signCount, nil
+}
+
+// verifyClientData checks the client data of a ceremony and returns it decoded
+func (w *WebAuthn) verifyClientData(encoded, ceremony, challenge string) ([]byte, error) {
+	raw, err := decode(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed client data", ErrInvalidResponse)
+	}
+
+	var clientData struct {
+		Type        string `json:"type"`
+		Challenge   string `json:"challenge"`
+		Origin      string `json:"origin"`
+		CrossOrigin bool   `json:"crossOrigin"`
+	}
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return nil, fmt.Errorf("%w: malformed client data", ErrInvalidResponse)
+	}
+
+	if clientData.Type != ceremony {
+		return nil, fmt.Errorf("%w: unexpected ceremony %q", ErrInvalidResponse, clientData.Type)
+	}
+	if challenge == "" || strings.TrimRight(clientData.Challenge, "=") != challenge {
+		return nil, fmt.Errorf("%w: challenge mismatch", ErrInvalidResponse)
+	}
+	if clientData.Origin != w.config.Origin || clientData.CrossOrigin {
+		return nil, fmt.Errorf("%w: unexpected origin %q", ErrInvalidResponse, clientData.Origin)
+	}
+
+	return raw, nil
+}
+
+// authenticatorData is the decoded authenticator data of a ceremony
+type authenticatorData struct {
+	flags        byte
+	signCount    uint32
+	credentialID []byte // Only set when a credential was attested
+	publicKey    []byte // COSE encoded, only set with the credential ID
+}
+
+func (w *WebAuthn) parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrInvalidResponse)
+	}
+
+	rpIDHash := sha256.Sum256([]byte(w.config.RPID))
+	if !bytes.Equal(data[:32], rpIDHash[:]) {
+		return nil, fmt.Errorf("%w: credential scoped to another site", ErrInvalidResponse)
+	}
+
+	authData := &authenticatorData{
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if authData.flags&flagUserPresent == 0 {
+		return nil, fmt.Errorf("%w: user not present", ErrInvalidResponse)
+	}
+
+	if authData.flags&flagAttested != 0 {
+		// AAGUID, credential ID length and credential ID, then the public key
+		rest := data[37:]
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("%w: attested credential data too short", ErrInvalidResponse)
+		}
+		length := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if length == 0 || length > 1023 || len(rest) < length {
+			return nil, fmt.Errorf("%w: invalid credential ID", ErrInvalidResponse)
+		}
+		authData.credentialID = rest[:length]
+		rest = rest[length:]
+
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidResponse, err)
+		}
+		authData.publicKey = rest[:len(rest)-len(after)]
+	}
+
+	return authData, nil
+}
+
+// encode and decode convert binary fields to and from unpadded base64url
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,217 @@
+package webauthn
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+)
+
+// vectors are registrations and assertions of ES256, EdDSA and RS256 credentials for
+// https://example.com. The EdDSA authenticator keeps no signature counter and doesn't
+// verify the user when asserting.
+type vectors struct {
+	RPID    string `json:"rpID"`
+	Origin  string `json:"origin"`
+	Vectors []struct {
+		Name         string `json:"name"`
+		Registration struct {
+			Challenge string               `json:"challenge"`
+			Response  RegistrationResponse `json:"response"`
+			SignCount uint32               `json:"signCount"`
+		} `json:"registration"`
+		Assertion struct {
+			Challenge    string            `json:"challenge"`
+			Response     AssertionResponse `json:"response"`
+			SignCount    uint32            `json:"signCount"`
+			UserVerified bool              `json:"userVerified"`
+		} `json:"assertion"`
+	} `json:"vectors"`
+}
+
+func loadVectors(t *testing.T) *vectors {
+	t.Helper()
+
+	data, err := os.ReadFile("testdata/vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &vectors{}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestVectors(t *testing.T) {
+	v := loadVectors(t)
+	w := New(Config{RPID: v.RPID, RPName: "Example", Origin: v.Origin})
+
+	for _, vector := range v.Vectors {
+		t.Run(vector.Name, func(t *testing.T) {
+			registration := vector.Registration
+			credential, err := w.VerifyRegistration(&registration.Response, registration.Challenge)
+			if err != nil {
+				t.Fatalf("registration: %v", err)
+			}
+			if credential.ID != registration.Response.ID || credential.SignCount != registration.SignCount {
+				t.Errorf("credential %s with count %d, want %s with %d", credential.ID, credential.SignCount, registration.Response.ID, registration.SignCount)
+			}
+
+			assertion := vector.Assertion
+			verification := VerificationPreferred
+			if assertion.UserVerified {
+				verification = VerificationRequired
+			}
+			signCount, err := w.VerifyAssertion(&assertion.Response, assertion.Challenge, credential.PublicKey, credential.SignCount, verification)
+			if err != nil {
+				t.Fatalf("assertion: %v", err)
+			}
+			if signCount != assertion.SignCount {
+				t.Errorf("sign count = %d, want %d", signCount, assertion.SignCount)
+			}
+			if string(assertion.Response.UserHandle()) != "1" {
+				t.Errorf("user handle = %q, want %q", assertion.Response.UserHandle(), "1")
+			}
+		})
+	}
+}
+
+func TestVerifyRegistrationFailures(t *testing.T) {
+	v := loadVectors(t)
+	vector := v.Vectors[0]
+	challenge := vector.Registration.Challenge
+
+	tests := []struct {
+		name      string
+		config    Config
+		challenge string
+		change    func(r *RegistrationResponse)
+	}{
+		{name: "wrong challenge", challenge: encode([]byte("another challenge"))},
+		{name: "no challenge", challenge: ""},
+		{name: "wrong origin", challenge: challenge, config: Config{Origin: "https://evil.example"}},
+		{name: "wrong rp id hash", challenge: challenge, config: Config{RPID: "evil.example"}},
+		{name: "other credential id", challenge: challenge, change: func(r *RegistrationResponse) { r.ID = encode([]byte("other")) }},
+		{name: "wrong type", challenge: challenge, change: func(r *RegistrationResponse) { r.Type = "password" }},
+		{name: "assertion client data", challenge: challenge, change: func(r *RegistrationResponse) {
+			r.Response.ClientDataJSON = vector.Assertion.Response.Response.ClientDataJSON
+		}},
+		{name: "truncated attestation", challenge: challenge, change: func(r *RegistrationResponse) {
+			r.Response.AttestationObject = r.Response.AttestationObject[:40]
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{RPID: v.RPID, Origin: v.Origin}
+			if tt.config.RPID != "" {
+				config.RPID = tt.config.RPID
+			}
+			if tt.config.Origin != "" {
+				config.Origin = tt.config.Origin
+			}
+			response := vector.Registration.Response
+			if tt.change != nil {
+				tt.change(&response)
+			}
+
+			_, err := New(config).VerifyRegistration(&response, tt.challenge)
+			if !errors.Is(err, ErrInvalidResponse) {
+				t.Fatalf("error = %v, want ErrInvalidResponse", err)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertionFailures(t *testing.T) {
+	v := loadVectors(t)
+	es256, eddsa := v.Vectors[0], v.Vectors[1]
+	if es256.Name != "es256" || eddsa.Name != "eddsa" {
+		t.Fatalf("unexpected vectors %s and %s", es256.Name, eddsa.Name)
+	}
+
+	credential, err := New(Config{RPID: v.RPID, Origin: v.Origin}).VerifyRegistration(&es256.Registration.Response, es256.Registration.Challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eddsaCredential, err := New(Config{RPID: v.RPID, Origin: v.Origin}).VerifyRegistration(&eddsa.Registration.Response, eddsa.Registration.Challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		config    Config
+		challenge string
+		publicKey []byte
+		signCount uint32
+		change    func(r *AssertionResponse)
+	}{
+		{name: "wrong challenge", challenge: encode([]byte("another challenge"))},
+		{name: "registration challenge", challenge: es256.Registration.Challenge},
+		{name: "wrong origin", config: Config{Origin: "https://evil.example"}},
+		{name: "wrong rp id hash", config: Config{RPID: "evil.example"}},
+		{name: "sign count went back", signCount: es256.Assertion.SignCount + 1},
+		{name: "sign count didn't change", signCount: es256.Assertion.SignCount},
+		{name: "other credential key", publicKey: eddsaCredential.PublicKey},
+		{name: "tampered signature", change: func(r *AssertionResponse) {
+			signature, _ := decode(r.Response.Signature)
+			signature[len(signature)-1] ^= 1
+			r.Response.Signature = encode(signature)
+		}},
+		{name: "tampered authenticator data", change: func(r *AssertionResponse) {
+			data, _ := decode(r.Response.AuthenticatorData)
+			data[36]++
+			r.Response.AuthenticatorData = encode(data)
+		}},
+		{name: "registration client data", change: func(r *AssertionResponse) {
+			r.Response.ClientDataJSON = es256.Registration.Response.Response.ClientDataJSON
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{RPID: v.RPID, Origin: v.Origin}
+			if tt.config.RPID != "" {
+				config.RPID = tt.config.RPID
+			}
+			if tt.config.Origin != "" {
+				config.Origin = tt.config.Origin
+			}
+			challenge := es256.Assertion.Challenge
+			if tt.challenge != "" {
+				challenge = tt.challenge
+			}
+			publicKey := credential.PublicKey
+			if tt.publicKey != nil {
+				publicKey = tt.publicKey
+			}
+			signCount := credential.SignCount
+			if tt.signCount != 0 {
+				signCount = tt.signCount
+			}
+			response := es256.Assertion.Response
+			if tt.change != nil {
+				tt.change(&response)
+			}
+
+			_, err := New(config).VerifyAssertion(&response, challenge, publicKey, signCount, VerificationRequired)
+			if !errors.Is(err, ErrInvalidResponse) {
+				t.Fatalf("error = %v, want ErrInvalidResponse", err)
+			}
+		})
+	}
+
+	// Authenticators without a counter always report 0, which can't go back
+	w := New(Config{RPID: v.RPID, Origin: v.Origin})
+	if _, err := w.VerifyAssertion(&eddsa.Assertion.Response, eddsa.Assertion.Challenge, eddsaCredential.PublicKey, 0, VerificationPreferred); err != nil {
+		t.Errorf("assertion without counter: %v", err)
+	}
+	if _, err := w.VerifyAssertion(&eddsa.Assertion.Response, eddsa.Assertion.Challenge, eddsaCredential.PublicKey, 5, VerificationPreferred); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("counter reset to 0: error = %v, want ErrInvalidResponse", err)
+	}
+	if _, err := w.VerifyAssertion(&eddsa.Assertion.Response, eddsa.Assertion.Challenge, eddsaCredential.PublicKey, 0, VerificationRequired); !errors.Is(err, ErrInvalidResponse) {
+		t.Errorf("user not verified: error = %v, want ErrInvalidResponse", err)
+	}
+}